@@ -302,6 +302,9 @@ func dumpCmd(
 				if len(enums) != 0 {
 					line += " " + ColorExplain("(enum: "+strings.Join(enums, cmd.Strs.ArgEnumSep)+")", env)
 				}
+				if cicArgs.IsList(name) {
+					line += " " + ColorExplain("(list)", env)
+				}
 				if !args.Skeleton {
 					entry := autoMapInfo.GetMappedSource(name)
 					if entry != nil {
@@ -324,13 +327,17 @@ func dumpCmd(
 			}
 
 			arg2env := cic.GetArg2Env()
+			cicArgs := cic.Args()
 			if len(arg2env.EnvKeys()) != 0 {
 				prt(1, ColorProp("- env-from-argv:", env))
 			}
 			for _, k := range arg2env.EnvKeys() {
 				argName := arg2env.GetArgName(cic, k, true)
-				prt(2, ColorKey(k, env)+ColorSymbol(" <- ", env)+
-					ColorArg(mayQuoteStr(argName), env))
+				line := ColorKey(k, env) + ColorSymbol(" <- ", env) + ColorArg(mayQuoteStr(argName), env)
+				if cicArgs.IsList(argName) {
+					line += " " + ColorExplain("(list)", env)
+				}
+				prt(2, line)
 			}
 
 			envOps := cic.EnvOps()
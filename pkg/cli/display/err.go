@@ -229,13 +229,27 @@ func PrintTolerableErrs(screen model.Screen, env *model.Env, errs *model.Tolerab
 					fmt.Sprintf("too many (%v) conflicts between these two repos/dirs:", len(list)),
 					"",
 					"    - '"+oldSource+"'",
-					"    - '"+newSource+"' (conflicted cmds are not loaded)",
+					"    - '"+newSource+"' (conflicted cmds are not loaded or shadowed)",
 					"",
-					"use command 'h.disable' to disable one of them.",
+					"use command 'h.disable' to disable one of them, or 'hub.priority' to decide the winner.",
 				)
 			} else {
 				for _, err := range list {
 					cmdPath := err.Err.(model.ErrConflicted).GetConflictedCmdPath()
+					if shadowPath := getShadowPath(err.Err); len(shadowPath) != 0 {
+						PrintErrTitle(screen, env,
+							err.Reason+", command conflicted from repos/dirs:",
+							"    - '"+oldSource+"'",
+							"    - '"+newSource+"' (shadowed)",
+							"command:",
+							"    - "+strings.Join(cmdPath, sep),
+							"the shadowed one could be called by:",
+							"    - "+shadowPath,
+							"",
+							"use command 'hub.priority' to decide the winner, 'hub.conflicts' to list all conflicts.",
+						)
+						continue
+					}
 					PrintErrTitle(screen, env,
 						err.Reason+", command conflicted from repos/dirs:",
 						"    - '"+oldSource+"'",
@@ -252,3 +266,10 @@ func PrintTolerableErrs(screen model.Screen, env *model.Env, errs *model.Tolerab
 		}
 	}
 }
+
+func getShadowPath(err interface{}) string {
+	if conflicted, ok := err.(*model.CmdTreeErrExecutableConflicted); ok {
+		return conflicted.ShadowPath
+	}
+	return ""
+}
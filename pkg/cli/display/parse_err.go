@@ -2,6 +2,7 @@ package display
 
 import (
 	"strings"
+	"unicode/utf8"
 
 	"github.com/innerr/ticat/pkg/core/model"
 )
@@ -35,17 +36,30 @@ func HandleParseResult(
 			}
 		*/
 
-		input := cmd.ParseResult.Input
-		inputStr := strings.Join(input, " ")
-
 		switch cmd.ParseResult.Error.(type) {
+		case model.ParseErrQuote:
+			PrintErrTitle(cc.Screen, env,
+				cmd.ParseResult.Error.Error()+".",
+				"",
+				invalidInputLines(cmd.ParseResult, env),
+				"",
+				"use '\\' to escape quote chars.")
+			return false
+		case model.ErrAmbiguousPrefix:
+			PrintErrTitle(cc.Screen, env,
+				cmd.ParseResult.Error.Error()+".",
+				"",
+				invalidInputLines(cmd.ParseResult, env),
+				"",
+				"type more chars, or use the full name or an abbr.")
+			return false
 		case model.ParseErrExpectNoArg:
 			return PrintCmdByParseError(cc, cmd, env, "doesn't have args")
 		case model.ParseErrEnv:
 			PrintErrTitle(cc.Screen, env,
 				"["+cmd.DisplayPath(cc.Cmds.Strs.PathSep, true)+"] parse env failed.",
 				"",
-				"'"+inputStr+"' is not valid input.",
+				invalidInputLines(cmd.ParseResult, env),
 				"",
 				"env setting examples:",
 				"",
@@ -72,12 +86,11 @@ func PrintCmdByParseError(
 	sep := cc.Cmds.Strs.PathSep
 	cmdName := cmd.DisplayPath(sep, true)
 	printer := NewTipBoxPrinter(cc.Screen, env, true)
-	input := cmd.ParseResult.Input
 
 	printer.PrintWrap(
 		"["+cmdName+"] "+title+".",
-		"",
-		"'"+strings.Join(input, " ")+"' is not valid input.")
+		"")
+	printer.Prints(invalidInputLines(cmd.ParseResult, env)...)
 	printer.Prints("", "command detail:")
 	printer.Finish()
 	dumpArgs := NewDumpCmdArgs().NoFlatten().NoRecursive()
@@ -95,16 +108,15 @@ func PrintSubCmdByParseError(
 	sep := cc.Cmds.Strs.PathSep
 	cmdName := cmd.DisplayPath(sep, true)
 	printer := NewTipBoxPrinter(cc.Screen, env, true)
-	input := cmd.ParseResult.Input
 
 	last := cmd.LastCmdNode()
 	if last == nil {
-		return PrintFreeSearchResultByParseError(cc, flow, env, isSearch, input...)
+		return PrintFreeSearchResultByParseError(cc, flow, env, isSearch, cmd.ParseResult)
 	}
 	printer.PrintWrap(
 		"parse sub command under ["+cmdName+"] failed.",
-		"",
-		"'"+strings.Join(input, " ")+"' is not valid input.")
+		"")
+	printer.Prints(invalidInputLines(cmd.ParseResult, env)...)
 	if last.HasSubs() {
 		printer.Prints("", "commands on branch '"+last.DisplayPath()+"':")
 		dumpArgs := NewDumpCmdArgs().SetSkeleton()
@@ -130,12 +142,12 @@ func PrintFreeSearchResultByParseError(
 	flow *model.ParsedCmds,
 	env *model.Env,
 	isSearch bool,
-	findStr ...string) bool {
+	result model.ParseResult) bool {
 
 	selfName := env.GetRaw("strs.self-name")
-	input := findStr
+	input := result.Input
 	inputStr := strings.Join(input, " ")
-	notValidStr := "'" + inputStr + "' is not valid input."
+	notValidStr := invalidInputLines(result, env)
 
 	var lines int
 	for len(input) > 0 {
@@ -151,7 +163,7 @@ func PrintFreeSearchResultByParseError(
 			"search and found commands matched '" + strings.Join(input, " ") + "':",
 		}
 		if !isSearch {
-			helpStr = append([]string{notValidStr, ""}, helpStr...)
+			helpStr = append(append(notValidStr, ""), helpStr...)
 		}
 		PrintErrTitle(cc.Screen, env, helpStr)
 		screen.WriteTo(cc.Screen)
@@ -165,7 +177,7 @@ func PrintFreeSearchResultByParseError(
 			"try to change keywords on the leftside, ",
 			selfName + " will filter results by kewords from left to right.",
 		}
-		_ = append([]string{notValidStr, ""}, helpStr...)
+		_ = append(append(notValidStr, ""), helpStr...)
 		PrintErrTitle(cc.Screen, env, notValidStr)
 	} else {
 		PrintErrTitle(cc.Screen, env, notValidStr)
@@ -180,7 +192,6 @@ func PrintFindResultByParseError(
 	title string) bool {
 
 	input := cmd.ParseResult.Input
-	inputStr := strings.Join(input, " ")
 	screen := NewCacheScreen()
 	dumpArgs := NewDumpCmdArgs().SetSkeleton().AddFindStrs(input...)
 	DumpCmds(cc.Cmds, screen, env, dumpArgs)
@@ -193,13 +204,17 @@ func PrintFindResultByParseError(
 		PrintErrTitle(cc.Screen, env,
 			title,
 			"",
-			"'"+inputStr+"' is not valid input, found related commands by search:")
+			invalidInputLines(cmd.ParseResult, env),
+			"",
+			"found related commands by search:")
 		screen.WriteTo(cc.Screen)
 	} else {
 		PrintErrTitle(cc.Screen, env,
 			title,
 			"",
-			"'"+inputStr+"' is not valid input and no related commands found.",
+			invalidInputLines(cmd.ParseResult, env),
+			"",
+			"no related commands found.",
 			"",
 			"try to change input,", "or search commands by:", "",
 			SuggestFindCmds(env),
@@ -207,3 +222,45 @@ func PrintFindResultByParseError(
 	}
 	return false
 }
+
+// invalidInputLines shows the origin command line with a caret under the offending char,
+// falls back to show the parsed input if the position is unknown
+func invalidInputLines(result model.ParseResult, env *model.Env) []string {
+	line, caret, ok := result.ErrCaret()
+	if !ok {
+		return []string{"'" + strings.Join(result.Input, " ") + "' is not valid input."}
+	}
+
+	const indent = "    "
+	const more = "..."
+	width := env.GetInt("display.width") - 4 - 2 - len(indent)
+	if width > len(more)*2 && len(line) > width {
+		start := result.ErrPos - width/2
+		if start < 0 {
+			start = 0
+		}
+		end := start + width
+		if end > len(line) {
+			end = len(line)
+			start = end - width
+		}
+		prefix := ""
+		if start > 0 {
+			start += len(more)
+			prefix = more
+		}
+		suffix := ""
+		if end < len(line) {
+			end -= len(more)
+			suffix = more
+		}
+		caret = strings.Repeat(" ", len(prefix)+utf8.RuneCountInString(line[start:result.ErrPos])) + "^"
+		line = prefix + line[start:end] + suffix
+	}
+	return []string{
+		"not valid input:",
+		"",
+		indent + line,
+		indent + caret,
+	}
+}
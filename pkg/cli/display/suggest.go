@@ -318,3 +318,11 @@ func padCmdR(s string, indent int, env *model.Env) string {
 	s = ColorCmd(s, env)
 	return padR(s, indent)
 }
+
+func SuggestDetachedSession(env *model.Env, sessionId string) []string {
+	selfName, _ := getSuggestArgs(env)
+	return []string{
+		selfName + " sessions.tail " + sessionId,
+		selfName + " sessions.kill " + sessionId,
+	}
+}
@@ -134,6 +134,8 @@ func noSessionCmds(flow *model.ParsedCmds) bool {
 		builtin.Repeat,
 		builtin.LastSessionRetry,
 		builtin.LastErrorSessionRetry,
+		builtin.SessionRetryFrom,
+		builtin.SessionRetrySkip,
 	}
 	for _, it := range funcs {
 		if cmd.Cmd() != nil && cmd.Cmd().IsTheSameFunc(it) {
@@ -70,6 +70,10 @@ func (self *Executor) Run(cc *model.Cli, env *model.Env, bootstrap string, input
 
 	ok = ok && len(errs) == 0
 
+	if err := model.WaitSessionsGC(); err != nil {
+		display.PrintErrTitle(cc.Screen, env, err.Error())
+	}
+
 	if cc.FlowStatus != nil {
 		cc.FlowStatus.OnFlowFinish(env, ok)
 	}
@@ -88,6 +92,9 @@ func (self *Executor) execute(caller string, cc *model.Cli, env *model.Env, mask
 	if !innerCall && env.GetBool("sys.env.use-cmd-abbrs") {
 		useCmdsAbbrs(cc.EnvAbbrs, cc.Cmds)
 	}
+	if !innerCall {
+		cc.Parser.SetPrefixMatch(env.GetBool("sys.parser.prefix-match"))
+	}
 
 	if !innerCall && emptyInput(input...) {
 		if !env.GetBool("sys.interact.inside") {
@@ -277,6 +284,22 @@ func (self *Executor) executeCmd(
 		if last.IsNoExecutableCmd() {
 			display.PrintEmptyDirCmdHint(cc.Screen, env, cmd)
 			newCurrCmdIdx, err = currCmdIdx, nil
+		} else if !sysArgv.IsDelay() && sysArgv.HasTimeout() {
+			err = model.NewCmdError(cmd, fmt.Sprintf("sys arg '%s' only works with sys arg '%s'",
+				model.SysArgNameTimeout, model.SysArgNameDelay))
+			newCurrCmdIdx = currCmdIdx
+		} else if !sysArgv.IsDelay() && len(sysArgv.GetPool()) != 0 {
+			err = model.NewCmdError(cmd, fmt.Sprintf("sys arg '%s' only works with sys arg '%s'",
+				model.SysArgNamePool, model.SysArgNameDelay))
+			newCurrCmdIdx = currCmdIdx
+		} else if sysArgv.IsDetach() {
+			if sysArgv.IsDelay() {
+				err = model.NewCmdError(cmd, fmt.Sprintf("sys arg '%s' can't be used with sys arg '%s'",
+					model.SysArgNameDetach, model.SysArgNameDelay))
+			} else {
+				err = detachExecute(cc, cmdEnv, flow, currCmdIdx)
+			}
+			newCurrCmdIdx = currCmdIdx
 		} else {
 			if !sysArgv.IsDelay() {
 				// This cmdEnv is different from env, it included values from 'val2env' and 'arg2env'
@@ -296,15 +319,21 @@ func (self *Executor) executeCmd(
 						env, cc.Cmds.Strs.EnvValDelAllMark, cc.Cmds.Strs.PathSep, cmdEnv.GetInt("sys.stack-depth"))
 				}
 				dur, durErr := sysArgv.GetDelayDuration()
+				timeout, timeoutErr := sysArgv.GetTimeoutDuration()
 				if durErr != nil {
 					err = durErr
 					newCurrCmdIdx = currCmdIdx
+				} else if timeoutErr != nil {
+					err = timeoutErr
+					newCurrCmdIdx = currCmdIdx
 				} else {
 					asyncCC := cc.CloneForAsyncExecuting(cmdEnv)
 					var tid string
 					var asyncSucceeded bool
+					pool := sysArgv.GetPool()
 					tid, asyncSucceeded = asyncExecute(cc.Screen, sysArgv.GetDelayStr(), sysArgv.AllowError(),
-						dur, last.Cmd(), argv, asyncCC, cmdEnv.Clone(), mask, flow.CloneOne(currCmdIdx), 0)
+						dur, timeout, pool, bgPoolLimit(cmdEnv, pool),
+						last.Cmd(), argv, asyncCC, cmdEnv.Clone(), mask, flow.CloneOne(currCmdIdx), 0)
 					if !asyncSucceeded {
 						err = fmt.Errorf("async execute failed")
 					}
@@ -501,11 +530,48 @@ func stackStepOut(caller string, callerNameEntry string, env *model.Env) {
 	env.Set("sys.stack", stack)
 }
 
+// Run the cmd in a new ticat process, see 'run.detached'
+func detachExecute(cc *model.Cli, env *model.Env, flow *model.ParsedCmds, currCmdIdx int) error {
+	cmd := flow.Cmds[currCmdIdx]
+	detachArg := env.GetRaw("strs.sys-arg-prefix") + model.SysArgNameDetach
+	detachedFlow := &model.ParsedCmds{
+		Cmds:         model.ParsedCmdSeq{cmd.WithoutSysArg(detachArg)},
+		GlobalCmdIdx: -1,
+	}
+	flowStr, err := model.SaveFlowToStr(detachedFlow, cc.Cmds.Strs.PathSep, env.GetRaw("strs.trivial-mark"), env)
+	if err != nil {
+		return err
+	}
+
+	if cc.FlowStatus != nil {
+		cc.FlowStatus.OnCmdStart(flow, currCmdIdx, env, "")
+	}
+	err = builtin.StartDetachedFlow(cc, env, flowStr)
+	if cc.FlowStatus != nil {
+		cc.FlowStatus.OnCmdFinish(flow, currCmdIdx, env, err == nil, err, false)
+	}
+	return err
+}
+
+// The max running tasks of a background pool, zero means unlimited
+func bgPoolLimit(env *model.Env, pool string) int {
+	if len(pool) != 0 {
+		key := "sys.bg.pool." + pool + ".max-concurrency"
+		if env.Has(key) {
+			return env.GetInt(key)
+		}
+	}
+	return env.GetInt("sys.bg.max-concurrency")
+}
+
 func asyncExecute(
 	screen model.Screen,
 	durStr string,
 	allowError bool,
 	dur time.Duration,
+	timeout time.Duration,
+	pool string,
+	poolLimit int,
 	cic *model.Cmd,
 	argv model.ArgVals,
 	cc *model.Cli,
@@ -556,12 +622,11 @@ func asyncExecute(
 		clearBreakPointStatusInEnv(bgSessionEnv)
 
 		task := cc.BgTasks.GetOrAddTask(tid, displayName, realName, cc.Screen.(*model.BgTaskScreen).GetBgStdout())
+		task.SetTimeout(timeout)
+		cc.BgTasks.Enqueue(task, pool, poolLimit)
+		cc.BgTask = task
 		tidChan <- tid
 
-		time.Sleep(dur)
-
-		task.OnStart()
-
 		defer func() {
 			var err error
 			if !env.GetBool("sys.panic.recover") {
@@ -575,9 +640,31 @@ func asyncExecute(
 					}
 				}
 			}
+			if abortedErr, ok := task.AbortedErr().(*model.BgTaskAbortedErr); ok {
+				_ = model.MarkBgTaskAborted(env, sessionDir, abortedErr.Reason)
+			}
+			// Release the slot before notifying, or the queued tasks may never run if no one is waiting this one
+			cc.BgTasks.ReleaseSlot(task)
 			task.OnFinish(err)
 		}()
 
+		// The task could be aborted while waiting
+		select {
+		case <-time.After(dur):
+		case <-task.Context().Done():
+		}
+		if abortedErr := task.AbortedErr(); abortedErr != nil {
+			cc.FlowStatus.OnFlowFinish(env, false)
+			return
+		}
+		// The task could also be aborted while queueing
+		if !cc.BgTasks.WaitForSlot(task) {
+			cc.FlowStatus.OnFlowFinish(env, false)
+			return
+		}
+
+		task.OnStart()
+
 		stackLines := display.PrintCmdStack(false, cc.Screen, cmd, mask,
 			env, cc.EnvKeysInfo, flow.Cmds, currCmdIdx, cc.Cmds.Strs, nil, false)
 		var width int
@@ -592,7 +679,11 @@ func asyncExecute(
 		_, asyncErr := cic.Execute(argv, cc, env, mask, flow, allowError, currCmdIdx, nil)
 		elapsed := time.Since(start)
 		env.SetInt("display.executor.displayed", 0)
+		if abortedErr := task.AbortedErr(); abortedErr != nil {
+			asyncErr = abortedErr
+		}
 		if asyncErr != nil {
+			cc.FlowStatus.OnFlowFinish(env, false)
 			// PANIC: Runtime error - delay-command failed
 			panic(fmt.Errorf("delay-command fail, thread: %s: %w", tid, asyncErr))
 		}
@@ -607,7 +698,17 @@ func asyncExecute(
 	}(dur, argv, cc, env, flow, currCmdIdx)
 
 	tid = <-tidChan
-	_ = screen.Print(display.ColorExplain("(current command scheduled to thread "+tid+")\n", env))
+	queued := ""
+	if task, ok := cc.BgTasks.GetTask(tid); ok {
+		if pos := cc.BgTasks.QueuePos(task); pos > 0 {
+			poolName := "default"
+			if len(pool) != 0 {
+				poolName = "'" + pool + "'"
+			}
+			queued = fmt.Sprintf(", queued at #%d in %s pool", pos, poolName)
+		}
+	}
+	_ = screen.Print(display.ColorExplain("(current command scheduled to thread "+tid+queued+")\n", env))
 	return tid, true
 }
 
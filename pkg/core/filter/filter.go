@@ -0,0 +1,432 @@
+// Package filter is a small query language for filtering records, eg:
+//
+//	status=error cmd~deploy since=2d env.cluster.name=prod duration>10m
+//
+// Terms are separated by spaces (values with spaces could be quoted), all terms should be matched.
+// A term without operator is a keyword, it should be contained in the text of a record.
+package filter
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Kind int
+
+const (
+	KindString Kind = iota
+	KindNumber
+	KindDuration
+	KindTime
+)
+
+type Op string
+
+const (
+	OpEq          Op = "="
+	OpNe          Op = "!="
+	OpContains    Op = "~"
+	OpNotContains Op = "!~"
+	OpGt          Op = ">"
+	OpGe          Op = ">="
+	OpLt          Op = "<"
+	OpLe          Op = "<="
+)
+
+// The longer ones should be matched first
+var allOps = []Op{OpNe, OpNotContains, OpGe, OpLe, OpEq, OpContains, OpGt, OpLt}
+
+const opChars = "=!~<>"
+
+// Schema declares the fields could be used in queries
+type Schema struct {
+	Fields map[string]Kind
+	// Fields with these prefixes are dynamic ones, eg: 'env.' for env keys
+	Prefixes map[string]Kind
+	// The time field used by 'since=' and 'until=', could be empty if not supported
+	TimeField string
+}
+
+func (self Schema) KindOf(key string) (kind Kind, ok bool) {
+	if kind, ok = self.Fields[key]; ok {
+		return
+	}
+	for prefix, kind := range self.Prefixes {
+		if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+			return kind, true
+		}
+	}
+	return
+}
+
+func (self Schema) fieldNames() (names []string) {
+	for name := range self.Fields {
+		names = append(names, name)
+	}
+	for prefix := range self.Prefixes {
+		names = append(names, prefix+"*")
+	}
+	if len(self.TimeField) != 0 {
+		names = append(names, "since", "until")
+	}
+	sort.Strings(names)
+	return
+}
+
+// Record is the thing to be filtered.
+// The values of typed fields should be formatted by 'FormatNumber', 'FormatDuration' and 'FormatTime'
+type Record interface {
+	// Values returns all values of a field (eg: all cmds in a session), nil if the field is absent
+	Values(key string) []string
+	// Text returns the strings that keywords are matched against
+	Text() []string
+}
+
+type Cond struct {
+	Key  string
+	Op   Op
+	Val  string
+	kind Kind
+	num  float64
+	dur  time.Duration
+	ts   time.Time
+}
+
+type Query struct {
+	Conds []Cond
+	Words []string
+}
+
+// NewWordsQuery creates a query only with keywords
+func NewWordsQuery(words []string) *Query {
+	return &Query{Words: append([]string{}, words...)}
+}
+
+func (self *Query) IsEmpty() bool {
+	return self == nil || (len(self.Conds) == 0 && len(self.Words) == 0)
+}
+
+func (self *Query) String() string {
+	if self == nil {
+		return ""
+	}
+	var strs []string
+	for _, it := range self.Conds {
+		strs = append(strs, it.Key+string(it.Op)+quoteIfNeeded(it.Val))
+	}
+	for _, it := range self.Words {
+		strs = append(strs, quoteIfNeeded(it))
+	}
+	return strings.Join(strs, " ")
+}
+
+// Merge returns a query with all terms of the two
+func (self *Query) Merge(other *Query) *Query {
+	res := &Query{}
+	for _, it := range []*Query{self, other} {
+		if it != nil {
+			res.Conds = append(res.Conds, it.Conds...)
+			res.Words = append(res.Words, it.Words...)
+		}
+	}
+	return res
+}
+
+// Parse parses a query string, relative times (eg: 'since=2d') are resolved by 'now'
+func Parse(str string, schema Schema, now time.Time) (*Query, error) {
+	terms, err := splitTerms(str)
+	if err != nil {
+		return nil, err
+	}
+	query := &Query{}
+	for _, term := range terms {
+		i := strings.IndexAny(term, opChars)
+		if i < 0 {
+			query.Words = append(query.Words, term)
+			continue
+		}
+		cond, err := parseCond(term, i, schema, now)
+		if err != nil {
+			return nil, err
+		}
+		query.Conds = append(query.Conds, cond)
+	}
+	return query, nil
+}
+
+func parseCond(term string, i int, schema Schema, now time.Time) (cond Cond, err error) {
+	cond.Key = strings.TrimSpace(term[:i])
+	if len(cond.Key) == 0 {
+		return cond, fmt.Errorf("[Filter] no field name in term '%s'", term)
+	}
+	for _, op := range allOps {
+		if strings.HasPrefix(term[i:], string(op)) {
+			cond.Op = op
+			break
+		}
+	}
+	if len(cond.Op) == 0 {
+		return cond, fmt.Errorf("[Filter] bad operator in term '%s'", term)
+	}
+	cond.Val = strings.TrimSpace(term[i+len(cond.Op):])
+
+	if (cond.Key == "since" || cond.Key == "until") && len(schema.TimeField) != 0 {
+		if cond.Op != OpEq {
+			return cond, fmt.Errorf("[Filter] only '=' could be used with '%s' in term '%s'", cond.Key, term)
+		}
+		if cond.Key == "since" {
+			cond.Op = OpGe
+		} else {
+			cond.Op = OpLe
+		}
+		cond.Key = schema.TimeField
+	}
+
+	var ok bool
+	cond.kind, ok = schema.KindOf(cond.Key)
+	if !ok {
+		return cond, fmt.Errorf("[Filter] unknown field '%s' in term '%s', available: %s",
+			cond.Key, term, strings.Join(schema.fieldNames(), ", "))
+	}
+
+	if cond.kind == KindString {
+		if cond.Op != OpEq && cond.Op != OpNe && cond.Op != OpContains && cond.Op != OpNotContains {
+			return cond, fmt.Errorf("[Filter] operator '%s' can't be used on string field '%s'", cond.Op, cond.Key)
+		}
+		return cond, nil
+	}
+	if cond.Op == OpContains || cond.Op == OpNotContains {
+		return cond, fmt.Errorf("[Filter] operator '%s' can only be used on string fields, '%s' is not", cond.Op, cond.Key)
+	}
+
+	switch cond.kind {
+	case KindNumber:
+		cond.num, err = strconv.ParseFloat(cond.Val, 64)
+	case KindDuration:
+		cond.dur, err = ParseDuration(cond.Val)
+	case KindTime:
+		cond.ts, err = ParseTime(cond.Val, now)
+	}
+	if err != nil {
+		return cond, fmt.Errorf("[Filter] bad value in term '%s': %v", term, err)
+	}
+	return cond, nil
+}
+
+// Match returns true if the record matches all terms of the query
+func (self *Query) Match(record Record) bool {
+	if self == nil {
+		return true
+	}
+	for _, word := range self.Words {
+		found := false
+		for _, text := range record.Text() {
+			if strings.Contains(text, word) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, cond := range self.Conds {
+		if !cond.Match(record.Values(cond.Key)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match checks the values of a field: a positive operator needs one of the values matched,
+// a negative one ('!=', '!~') needs none of them matched
+func (self Cond) Match(vals []string) bool {
+	negative := self.Op == OpNe || self.Op == OpNotContains
+	for _, val := range vals {
+		if self.matchOne(val) {
+			return !negative
+		}
+	}
+	return negative
+}
+
+// matchOne returns true if the positive form of the operator matches
+func (self Cond) matchOne(val string) bool {
+	var cmp int
+	switch self.kind {
+	case KindString:
+		if self.Op == OpContains || self.Op == OpNotContains {
+			return strings.Contains(strings.ToLower(val), strings.ToLower(self.Val))
+		}
+		return val == self.Val
+	case KindNumber:
+		num, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return false
+		}
+		cmp = compare(num, self.num)
+	case KindDuration:
+		dur, err := time.ParseDuration(val)
+		if err != nil {
+			return false
+		}
+		cmp = compare(float64(dur), float64(self.dur))
+	case KindTime:
+		sec, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return false
+		}
+		cmp = compare(float64(sec), float64(self.ts.Unix()))
+	}
+	switch self.Op {
+	case OpEq, OpNe:
+		return cmp == 0
+	case OpGt:
+		return cmp > 0
+	case OpGe:
+		return cmp >= 0
+	case OpLt:
+		return cmp < 0
+	case OpLe:
+		return cmp <= 0
+	}
+	return false
+}
+
+func compare(a float64, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func FormatNumber(num float64) string {
+	return strconv.FormatFloat(num, 'f', -1, 64)
+}
+
+func FormatDuration(dur time.Duration) string {
+	return dur.String()
+}
+
+func FormatTime(ts time.Time) string {
+	return strconv.FormatInt(ts.Unix(), 10)
+}
+
+// ParseDuration is like 'time.ParseDuration', but also supports days and weeks: '2d', '1w', '1d12h', '2d1w'.
+// The units could be in any order, a plain number means seconds.
+func ParseDuration(str string) (time.Duration, error) {
+	rest := strings.TrimSpace(str)
+	if _, err := strconv.ParseFloat(rest, 64); err == nil {
+		rest += "s"
+	}
+	if len(rest) == 0 {
+		return 0, fmt.Errorf("bad duration '%s'", str)
+	}
+
+	var total time.Duration
+	for len(rest) != 0 {
+		i := strings.IndexFunc(rest, func(c rune) bool { return (c < '0' || c > '9') && c != '.' })
+		if i <= 0 {
+			return 0, fmt.Errorf("bad duration '%s'", str)
+		}
+		j := strings.IndexFunc(rest[i:], func(c rune) bool { return (c >= '0' && c <= '9') || c == '.' })
+		if j < 0 {
+			j = len(rest)
+		} else {
+			j += i
+		}
+		num, unit := rest[:i], rest[i:j]
+		rest = rest[j:]
+
+		var dur time.Duration
+		switch unit {
+		case "w", "d":
+			val, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0, fmt.Errorf("bad duration '%s'", str)
+			}
+			dur = time.Duration(val * float64(24*time.Hour))
+			if unit == "w" {
+				dur *= 7
+			}
+		default:
+			var err error
+			if dur, err = time.ParseDuration(num + unit); err != nil {
+				return 0, fmt.Errorf("bad duration '%s'", str)
+			}
+		}
+		total += dur
+	}
+	return total, nil
+}
+
+var timeFormats = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// ParseTime parses an absolute time, or a duration which means that long ago
+func ParseTime(str string, now time.Time) (time.Time, error) {
+	for _, format := range timeFormats {
+		if ts, err := time.ParseInLocation(format, str, time.Local); err == nil {
+			return ts, nil
+		}
+	}
+	dur, err := ParseDuration(str)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad time '%s', should be like '2d', '3h' or '2006-01-02'", str)
+	}
+	return now.Add(-dur), nil
+}
+
+func splitTerms(str string) (terms []string, err error) {
+	var curr strings.Builder
+	quote := rune(0)
+	inTerm := false
+	for _, c := range str {
+		if quote != 0 {
+			if c == quote {
+				quote = 0
+			} else {
+				curr.WriteRune(c)
+			}
+			continue
+		}
+		if c == '"' || c == '\'' {
+			quote = c
+			inTerm = true
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\n' {
+			if inTerm {
+				terms = append(terms, curr.String())
+				curr.Reset()
+				inTerm = false
+			}
+			continue
+		}
+		curr.WriteRune(c)
+		inTerm = true
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("[Filter] unclosed quote in query '%s'", str)
+	}
+	if inTerm {
+		terms = append(terms, curr.String())
+	}
+	return
+}
+
+func quoteIfNeeded(str string) string {
+	if strings.ContainsAny(str, " \t") {
+		return "'" + str + "'"
+	}
+	return str
+}
@@ -0,0 +1,137 @@
+package filter
+
+import (
+	"testing"
+	"time"
+)
+
+type testRecord struct {
+	text   []string
+	fields map[string][]string
+}
+
+func (self testRecord) Values(key string) []string {
+	return self.fields[key]
+}
+
+func (self testRecord) Text() []string {
+	return self.text
+}
+
+var testSchema = Schema{
+	Fields: map[string]Kind{
+		"status":   KindString,
+		"cmd":      KindString,
+		"start":    KindTime,
+		"duration": KindDuration,
+		"retries":  KindNumber,
+	},
+	Prefixes:  map[string]Kind{"env.": KindString},
+	TimeField: "start",
+}
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]time.Duration{
+		"10m":    10 * time.Minute,
+		"2d":     48 * time.Hour,
+		"1w":     7 * 24 * time.Hour,
+		"1d12h":  36 * time.Hour,
+		"30":     30 * time.Second,
+		"2d1w":   9 * 24 * time.Hour,
+		"1w2d3h": (9*24 + 3) * time.Hour,
+		"1h30m":  90 * time.Minute,
+		"1.5d":   36 * time.Hour,
+	}
+	for str, expected := range cases {
+		if dur, err := ParseDuration(str); err != nil || dur != expected {
+			t.Errorf("'%s': expect %v, got %v, %v", str, expected, dur, err)
+		}
+	}
+	for _, str := range []string{"xd", "", "d", "2x", "1d2"} {
+		if _, err := ParseDuration(str); err == nil {
+			t.Errorf("'%s' should be invalid", str)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	now := time.Now()
+	for _, str := range []string{
+		"unknown=1",
+		"=1",
+		"status>1",
+		"duration~1m",
+		"duration>abc",
+		"since>2d",
+		"cmd='deploy",
+	} {
+		if _, err := Parse(str, testSchema, now); err == nil {
+			t.Errorf("'%s' should be invalid", str)
+		}
+	}
+}
+
+func TestQueryMatch(t *testing.T) {
+	now := time.Now()
+	record := testRecord{
+		text: []string{"20240101-000000.1", "deploy.cluster : test.run"},
+		fields: map[string][]string{
+			"status":           {"error"},
+			"cmd":              {"deploy.cluster", "test.run"},
+			"start":            {FormatTime(now.Add(-time.Hour))},
+			"duration":         {FormatDuration(15 * time.Minute)},
+			"retries":          {FormatNumber(3)},
+			"env.cluster.name": {"prod"},
+		},
+	}
+
+	cases := map[string]bool{
+		"":                        true,
+		"status=error":            true,
+		"status!=error":           false,
+		"cmd~DEPLOY":              true,
+		"cmd!~deploy":             false,
+		"cmd=test.run":            true,
+		"cmd!=other":              true,
+		"since=2d":                true,
+		"since=30m":               false,
+		"until=30m":               true,
+		"duration>10m":            true,
+		"duration<=10m":           false,
+		"retries>=3 retries<4":    true,
+		"env.cluster.name=prod":   true,
+		"env.cluster.name='prod'": true,
+		"env.other=x":             false,
+		"env.other!=x":            true,
+		"deploy test.run":         true,
+		"deploy missing":          false,
+		"status=error cmd~deploy since=2d env.cluster.name=prod duration>10m": true,
+	}
+	for str, expected := range cases {
+		query, err := Parse(str, testSchema, now)
+		if err != nil {
+			t.Errorf("'%s': parse failed: %v", str, err)
+			continue
+		}
+		if query.Match(record) != expected {
+			t.Errorf("'%s': expect %v", str, expected)
+		}
+	}
+}
+
+func TestQueryMergeAndString(t *testing.T) {
+	query, err := Parse("status=error 'a b'", testSchema, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := NewWordsQuery([]string{"x"}).Merge(query)
+	if len(merged.Conds) != 1 || len(merged.Words) != 2 {
+		t.Fatalf("unexpected merged query: %+v", merged)
+	}
+	if str := merged.String(); str != "status=error x 'a b'" {
+		t.Errorf("unexpected query str: %s", str)
+	}
+	if !(*Query)(nil).IsEmpty() || !NewWordsQuery(nil).IsEmpty() {
+		t.Errorf("should be empty")
+	}
+}
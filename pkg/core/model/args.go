@@ -20,6 +20,9 @@ type Args struct {
 
 	// map[arg-name]enum-values
 	enums map[string][]string
+
+	// List args could be provided multi times, values are joined by ListSep
+	lists map[string]bool
 }
 
 func newArgs() Args {
@@ -31,6 +34,7 @@ func newArgs() Args {
 		map[string]string{},
 		map[string]bool{},
 		map[string][]string{},
+		map[string]bool{},
 	}
 }
 
@@ -81,6 +85,19 @@ func (self *Args) EnumVals(name string) []string {
 	return self.enums[name]
 }
 
+func (self *Args) SetArgIsList(owner *CmdTree, name string) {
+	if _, ok := self.names[name]; !ok {
+		// PANIC: Programming error - arg not found during list registration
+		panic(fmt.Errorf("[Args.SetArgIsList] %s: arg name not exists: %s",
+			owner.DisplayPath(), name))
+	}
+	self.lists[name] = true
+}
+
+func (self *Args) IsList(name string) bool {
+	return self.lists[name]
+}
+
 func (self *Args) AddAutoMapAllArg(owner *CmdTree, name string, defVal string, abbrs ...string) {
 	self.AddArg(owner, name, defVal, abbrs...)
 	self.fromAutoMapAll[name] = true
@@ -179,5 +196,8 @@ func (self *Args) Clone() Args {
 	for k, v := range self.enums {
 		cloned.enums[k] = append([]string{}, v...)
 	}
+	for k, v := range self.lists {
+		cloned.lists[k] = v
+	}
 	return cloned
 }
@@ -380,6 +380,9 @@ func (self *ArgsAutoMapStatus) flushCacheEntry(owner *Cmd, entry Arg2EnvMappingE
 	} else {
 		owner.AddArg(argName, entry.DefVal, newAbbrs...)
 	}
+	if srcArgs.IsList(realArgNameInSrc) {
+		owner.SetArgIsList(argName)
+	}
 	owner.AddArg2Env(entry.Key, argName)
 	self.resultArgs = append(self.resultArgs, argName)
 	self.resultData[argName] = Arg2EnvMappingEntry{entry.SrcCmd, entry.Key, argName, entry.DefVal, newAbbrs}
@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type ArgVals map[string]ArgVal
@@ -11,6 +12,8 @@ type ArgVal struct {
 	Raw      string
 	Provided bool
 	Index    int
+	// Only for list args, the items splitted from Raw
+	List []string
 }
 
 func (self ArgVals) GetRaw(name string) (raw string) {
@@ -111,6 +114,52 @@ func (self ArgVals) GetBoolEx(name string, defVal bool) bool {
 	return StrToBool(val.Raw)
 }
 
+// GetList returns the items of a list arg,
+// for a non-list arg it's the raw value as the only item (or empty list if the value is empty)
+func (self ArgVals) GetList(name string) []string {
+	val, ok := self[name]
+	if !ok {
+		// PANIC: Programming error - arg not found, caller should use GetListEx if arg might not exist
+		panic(&ArgValErrNotFound{
+			fmt.Sprintf("[ArgVals.GetList] arg '%s' not found", name),
+			name,
+		})
+	}
+	if val.List != nil {
+		return val.List
+	}
+	if len(val.Raw) == 0 {
+		return []string{}
+	}
+	return []string{val.Raw}
+}
+
+func (self ArgVals) GetListEx(name string, defVal []string) []string {
+	_, ok := self[name]
+	if !ok {
+		return defVal
+	}
+	return self.GetList(name)
+}
+
+// SplitListVal splits a list arg value into items, empty items are dropped
+func SplitListVal(raw string, sep string) []string {
+	items := []string{}
+	if len(sep) == 0 {
+		if len(strings.TrimSpace(raw)) != 0 {
+			items = append(items, strings.TrimSpace(raw))
+		}
+		return items
+	}
+	for _, it := range strings.Split(raw, sep) {
+		it = strings.TrimSpace(it)
+		if len(it) != 0 {
+			items = append(items, it)
+		}
+	}
+	return items
+}
+
 type ArgValErrNotFound struct {
 	Str     string
 	ArgName string
@@ -2,11 +2,14 @@ package model
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"strings"
 	"sync"
+	"time"
 )
 
 type CmdIO struct {
@@ -93,6 +96,65 @@ type BgTaskInfo struct {
 	Started  bool
 	Finished bool
 	Err      error
+
+	ScheduledTs time.Time
+	StartTs     time.Time
+	FinishTs    time.Time
+	// Zero means no time limit
+	Timeout time.Duration
+	// Not empty if the task is killed or timeout
+	Aborted string
+
+	// The pool the task belongs to, empty is the default one
+	Pool string
+	// The position in the pool's queue, zero means not queued.
+	// It's only filled by 'BgTasks.GetStat', the task itself doesn't know the queue.
+	QueuePos int
+}
+
+const (
+	BgTaskStateWaiting = "waiting"
+	// Waiting for a free slot in the pool
+	BgTaskStateQueued  = "queued"
+	BgTaskStateRunning = "running"
+	BgTaskStateDone    = "done"
+	BgTaskStateFailed  = "failed"
+	BgTaskStateAborted = "aborted"
+	// Aborted but the goroutine is not ended yet
+	BgTaskStateAborting = "aborting"
+)
+
+func (self BgTaskInfo) State() string {
+	if !self.Finished {
+		if len(self.Aborted) != 0 {
+			return BgTaskStateAborting
+		}
+		if self.Started {
+			return BgTaskStateRunning
+		}
+		if self.QueuePos > 0 {
+			return BgTaskStateQueued
+		}
+		return BgTaskStateWaiting
+	}
+	if len(self.Aborted) != 0 {
+		return BgTaskStateAborted
+	}
+	if self.Err != nil {
+		return BgTaskStateFailed
+	}
+	return BgTaskStateDone
+}
+
+// Elapsed is the running duration, zero if the task is not started
+func (self BgTaskInfo) Elapsed(now time.Time) time.Duration {
+	if !self.Started {
+		return 0
+	}
+	if self.Finished {
+		return self.FinishTs.Sub(self.StartTs)
+	}
+	return now.Sub(self.StartTs)
 }
 
 type BgTask struct {
@@ -100,25 +162,80 @@ type BgTask struct {
 	realCmd        string
 	stdout         *BgStdout
 	finishNotifier chan error
+	ctx            context.Context
+	cancel         context.CancelFunc
+	timer          *time.Timer
 	lock           sync.Mutex
+
+	// Fields below are guarded by BgTasks.lock
+	pool    *bgTaskPool
+	ready   bool
+	granted bool
+	slot    chan struct{}
 }
 
 func NewBgTask(tid string, cmd string, realCmd string, stdout *BgStdout) *BgTask {
+	ctx, cancel := context.WithCancel(context.Background())
 	return &BgTask{
 		info: BgTaskInfo{
-			Tid: tid,
-			Cmd: cmd,
+			Tid:         tid,
+			Cmd:         cmd,
+			ScheduledTs: time.Now(),
 		},
 		realCmd:        realCmd,
 		stdout:         stdout,
 		finishNotifier: make(chan error),
+		ctx:            ctx,
+		cancel:         cancel,
+		slot:           make(chan struct{}),
+	}
+}
+
+// Context is done when the task is aborted, the executing child processes should be killed by then
+func (self *BgTask) Context() context.Context {
+	return self.ctx
+}
+
+// SetTimeout should be called before the task starts
+func (self *BgTask) SetTimeout(timeout time.Duration) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.info.Timeout = timeout
+}
+
+// Abort cancels the task, returns false if it's already finished or aborted
+func (self *BgTask) Abort(reason string) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.info.Finished || len(self.info.Aborted) != 0 {
+		return false
 	}
+	self.info.Aborted = reason
+	self.cancel()
+	return true
+}
+
+// AbortedErr returns nil if the task is not aborted
+func (self *BgTask) AbortedErr() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if len(self.info.Aborted) == 0 {
+		return nil
+	}
+	return &BgTaskAbortedErr{self.info.Tid, self.info.Aborted}
 }
 
 func (self *BgTask) OnStart() {
 	self.lock.Lock()
 	defer self.lock.Unlock()
 	self.info.Started = true
+	self.info.StartTs = time.Now()
+	if self.info.Timeout > 0 {
+		timeout := self.info.Timeout
+		self.timer = time.AfterFunc(timeout, func() {
+			self.Abort("timeout after " + timeout.String())
+		})
+	}
 }
 
 func (self *BgTask) GetStat() BgTaskInfo {
@@ -129,9 +246,17 @@ func (self *BgTask) GetStat() BgTaskInfo {
 
 func (self *BgTask) OnFinish(err error) {
 	self.lock.Lock()
+	if self.timer != nil {
+		self.timer.Stop()
+	}
+	if len(self.info.Aborted) != 0 {
+		err = &BgTaskAbortedErr{self.info.Tid, self.info.Aborted}
+	}
 	self.info.Finished = true
+	self.info.FinishTs = time.Now()
 	self.info.Err = err
 	self.lock.Unlock()
+	self.cancel()
 	self.finishNotifier <- err
 }
 
@@ -139,10 +264,50 @@ func (self *BgTask) WaitForFinish() error {
 	return <-self.finishNotifier
 }
 
+// bgTaskPool limits the count of running tasks in a group, the others are queued in scheduling order
+type bgTaskPool struct {
+	// Zero means unlimited
+	limit   int
+	running int
+	queue   []*BgTask
+}
+
+// dispatch grants slots to the queued tasks which are ready (delay passed), in scheduling order
+func (self *bgTaskPool) dispatch() {
+	for i := 0; i < len(self.queue) && (self.limit <= 0 || self.running < self.limit); {
+		task := self.queue[i]
+		if !task.ready {
+			i += 1
+			continue
+		}
+		self.queue = append(self.queue[:i], self.queue[i+1:]...)
+		self.running += 1
+		task.granted = true
+		close(task.slot)
+	}
+}
+
+func (self *bgTaskPool) queuePos(task *BgTask) int {
+	if self.limit <= 0 {
+		return 0
+	}
+	for i, it := range self.queue {
+		if it == task {
+			pos := self.running + i + 1 - self.limit
+			if pos < 0 {
+				pos = 0
+			}
+			return pos
+		}
+	}
+	return 0
+}
+
 type BgTasks struct {
 	tids      []string
 	tasks     map[string]*BgTask
 	name2task map[string]*BgTask
+	pools     map[string]*bgTaskPool
 	lock      sync.Mutex
 }
 
@@ -151,7 +316,78 @@ func NewBgTasks() *BgTasks {
 		tids:      []string{},
 		tasks:     map[string]*BgTask{},
 		name2task: map[string]*BgTask{},
+		pools:     map[string]*bgTaskPool{},
+	}
+}
+
+// Enqueue puts the task into a pool, it should be called in scheduling order.
+// The limit of a pool is updated by the latest scheduled task, zero means unlimited.
+func (self *BgTasks) Enqueue(task *BgTask, pool string, limit int) {
+	task.lock.Lock()
+	task.info.Pool = pool
+	task.lock.Unlock()
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	p, ok := self.pools[pool]
+	if !ok {
+		p = &bgTaskPool{}
+		self.pools[pool] = p
 	}
+	p.limit = limit
+	task.pool = p
+	p.queue = append(p.queue, task)
+}
+
+// WaitForSlot blocks until the task gets a slot in its pool, returns false if it's aborted while queueing
+func (self *BgTasks) WaitForSlot(task *BgTask) bool {
+	self.lock.Lock()
+	if task.pool == nil {
+		self.lock.Unlock()
+		return true
+	}
+	task.ready = true
+	task.pool.dispatch()
+	self.lock.Unlock()
+
+	select {
+	case <-task.slot:
+		return true
+	case <-task.Context().Done():
+		return false
+	}
+}
+
+// ReleaseSlot should be called when the task ends, no matter it got a slot or not
+func (self *BgTasks) ReleaseSlot(task *BgTask) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	p := task.pool
+	if p == nil {
+		return
+	}
+	task.pool = nil
+	if task.granted {
+		p.running -= 1
+	} else {
+		for i, it := range p.queue {
+			if it == task {
+				p.queue = append(p.queue[:i], p.queue[i+1:]...)
+				break
+			}
+		}
+	}
+	p.dispatch()
+}
+
+// QueuePos returns the position of the task in its pool's queue, zero means it won't wait for a slot
+func (self *BgTasks) QueuePos(task *BgTask) int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if task.pool == nil || task.granted {
+		return 0
+	}
+	return task.pool.queuePos(task)
 }
 
 func (self *BgTasks) GetOrAddTask(tid string, displayName string, realName string, stdout *BgStdout) *BgTask {
@@ -164,11 +400,33 @@ func (self *BgTasks) GetOrAddTask(tid string, displayName string, realName strin
 	self.tids = append(self.tids, tid)
 	task = NewBgTask(tid, displayName, realName, stdout)
 	self.tasks[tid] = task
-	println(realName)
 	self.name2task[realName] = task
 	return task
 }
 
+func (self *BgTasks) GetTask(tid string) (task *BgTask, ok bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	task, ok = self.tasks[tid]
+	return
+}
+
+// AbortAll aborts all unfinished tasks, returns the aborted tids
+func (self *BgTasks) AbortAll(reason string) (tids []string) {
+	self.lock.Lock()
+	var tasks []*BgTask
+	for _, tid := range self.tids {
+		tasks = append(tasks, self.tasks[tid])
+	}
+	self.lock.Unlock()
+	for _, task := range tasks {
+		if task.Abort(reason) {
+			tids = append(tids, task.GetStat().Tid)
+		}
+	}
+	return
+}
+
 func (self *BgTasks) GetEarliestTask() (tid string, task *BgTask, ok bool) {
 	self.lock.Lock()
 	defer self.lock.Unlock()
@@ -209,7 +467,11 @@ func (self *BgTasks) GetStat() []BgTaskInfo {
 	defer self.lock.Unlock()
 	infos := make([]BgTaskInfo, len(self.tids))
 	for i, tid := range self.tids {
-		infos[i] = self.tasks[tid].GetStat()
+		task := self.tasks[tid]
+		infos[i] = task.GetStat()
+		if task.pool != nil && !task.granted {
+			infos[i].QueuePos = task.pool.queuePos(task)
+		}
 	}
 	return infos
 }
@@ -241,3 +503,66 @@ func (self *BgTasks) RemoveTask(tid string) {
 	delete(self.tasks, tid)
 	delete(self.name2task, task.realCmd)
 }
+
+// BgTaskRow is the listing view of a background task
+type BgTaskRow struct {
+	Tid     string        `json:"tid"`
+	State   string        `json:"state"`
+	Elapsed time.Duration `json:"elapsed-ns"`
+	Timeout time.Duration `json:"timeout-ns,omitempty"`
+	Pool    string        `json:"pool,omitempty"`
+	Queue   int           `json:"queue-pos,omitempty"`
+	Cmd     string        `json:"cmd"`
+	// The abort reason or the error
+	Reason string `json:"reason,omitempty"`
+}
+
+type BgTasksListing []BgTaskRow
+
+func NewBgTasksListing(infos []BgTaskInfo, now time.Time) (listing BgTasksListing) {
+	for _, info := range infos {
+		row := BgTaskRow{
+			Tid:     info.Tid,
+			State:   info.State(),
+			Elapsed: info.Elapsed(now),
+			Timeout: info.Timeout,
+			Pool:    info.Pool,
+			Queue:   info.QueuePos,
+			Cmd:     info.Cmd,
+			Reason:  info.Aborted,
+		}
+		if len(row.Reason) == 0 && info.Err != nil {
+			row.Reason = info.Err.Error()
+		}
+		listing = append(listing, row)
+	}
+	return
+}
+
+func (self BgTasksListing) FormatText() string {
+	if len(self) == 0 {
+		return "no background tasks\n"
+	}
+	rows := [][]string{{"tid", "state", "pool", "queue", "elapsed", "timeout", "cmd", "reason"}}
+	for _, it := range self {
+		elapsed := "-"
+		if it.State != BgTaskStateWaiting && it.Elapsed != 0 {
+			elapsed = fmtStatsDur(it.Elapsed)
+		}
+		timeout := "-"
+		if it.Timeout != 0 {
+			timeout = it.Timeout.String()
+		}
+		pool := "-"
+		if len(it.Pool) != 0 {
+			pool = it.Pool
+		}
+		queue := "-"
+		if it.Queue != 0 {
+			queue = fmt.Sprintf("#%d", it.Queue)
+		}
+		rows = append(rows, []string{it.Tid, it.State, pool, queue, elapsed, timeout, it.Cmd,
+			strings.Split(it.Reason, "\n")[0]})
+	}
+	return FormatTextTable(rows)
+}
@@ -0,0 +1,164 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBgTaskAbort(t *testing.T) {
+	tasks := NewBgTasks()
+	task := tasks.GetOrAddTask("10", "slow", "slow", NewBgStdout())
+	if state := task.GetStat().State(); state != BgTaskStateWaiting {
+		t.Errorf("expect waiting, got %s", state)
+	}
+
+	task.OnStart()
+	if state := task.GetStat().State(); state != BgTaskStateRunning {
+		t.Errorf("expect running, got %s", state)
+	}
+
+	if !task.Abort("killed") {
+		t.Fatal("abort a running task should succeed")
+	}
+	if task.Abort("killed again") {
+		t.Error("abort an aborted task should fail")
+	}
+	select {
+	case <-task.Context().Done():
+	default:
+		t.Error("context should be done after aborting")
+	}
+
+	go task.OnFinish(nil)
+	err := task.WaitForFinish()
+	var abortedErr *BgTaskAbortedErr
+	if !errors.As(err, &abortedErr) || abortedErr.Reason != "killed" {
+		t.Errorf("expect aborted error, got %v", err)
+	}
+	info := task.GetStat()
+	if info.State() != BgTaskStateAborted || info.Err == nil {
+		t.Errorf("unexpected stat: %+v", info)
+	}
+}
+
+func TestBgTaskTimeout(t *testing.T) {
+	task := NewBgTask("11", "slow", "slow", NewBgStdout())
+	task.SetTimeout(20 * time.Millisecond)
+	task.OnStart()
+	select {
+	case <-task.Context().Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("task should be aborted by timeout")
+	}
+	if err := task.AbortedErr(); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Errorf("expect timeout error, got %v", err)
+	}
+}
+
+func TestBgTasksAbortAllAndListing(t *testing.T) {
+	tasks := NewBgTasks()
+	running := tasks.GetOrAddTask("1", "a", "a", NewBgStdout())
+	running.OnStart()
+	done := tasks.GetOrAddTask("2", "b", "b", NewBgStdout())
+	done.OnStart()
+	go done.OnFinish(nil)
+	_ = done.WaitForFinish()
+	tasks.GetOrAddTask("3", "c", "c", NewBgStdout())
+
+	tids := tasks.AbortAll("killed by test")
+	if strings.Join(tids, ",") != "1,3" {
+		t.Errorf("expect tids 1,3 aborted, got %v", tids)
+	}
+
+	listing := NewBgTasksListing(tasks.GetStat(), time.Now())
+	states := []string{}
+	for _, it := range listing {
+		states = append(states, it.State)
+	}
+	// The aborted tasks are not finished until their goroutines end
+	if strings.Join(states, ",") != "aborting,done,aborting" {
+		t.Errorf("unexpected states: %v", states)
+	}
+	if listing[0].Reason != "killed by test" {
+		t.Errorf("unexpected reason: %s", listing[0].Reason)
+	}
+	if !strings.Contains(listing.FormatText(), "killed by test") {
+		t.Errorf("unexpected text:\n%s", listing.FormatText())
+	}
+}
+
+func TestBgTasksPool(t *testing.T) {
+	tasks := NewBgTasks()
+	a := tasks.GetOrAddTask("1", "a", "a", NewBgStdout())
+	b := tasks.GetOrAddTask("2", "b", "b", NewBgStdout())
+	c := tasks.GetOrAddTask("3", "c", "c", NewBgStdout())
+	other := tasks.GetOrAddTask("4", "d", "d", NewBgStdout())
+	tasks.Enqueue(a, "db", 1)
+	tasks.Enqueue(b, "db", 1)
+	tasks.Enqueue(c, "db", 1)
+	tasks.Enqueue(other, "", 0)
+
+	if pos := tasks.QueuePos(b); pos != 1 {
+		t.Errorf("expect b queued at 1 before a gets its slot, got %d", pos)
+	}
+	if !tasks.WaitForSlot(a) {
+		t.Fatal("a should get a slot")
+	}
+	if !tasks.WaitForSlot(other) {
+		t.Fatal("unlimited pool should not block")
+	}
+
+	bGranted := make(chan bool)
+	go func() {
+		bGranted <- tasks.WaitForSlot(b)
+	}()
+	cGranted := make(chan bool)
+	go func() {
+		cGranted <- tasks.WaitForSlot(c)
+	}()
+
+	// Wait for the goroutines to mark themselves ready
+	deadline := time.Now().Add(3 * time.Second)
+	for tasks.QueuePos(c) != 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	infos := tasks.GetStat()
+	if infos[1].State() != BgTaskStateQueued || infos[1].QueuePos != 1 || infos[1].Pool != "db" {
+		t.Errorf("unexpected stat of b: %+v", infos[1])
+	}
+	if infos[2].QueuePos != 2 {
+		t.Errorf("expect c queued at 2, got %d", infos[2].QueuePos)
+	}
+	if infos[3].QueuePos != 0 || infos[3].Pool != "" {
+		t.Errorf("unexpected stat of the task in default pool: %+v", infos[3])
+	}
+
+	// c is aborted while queueing, it should leave the queue
+	c.Abort("killed")
+	if <-cGranted {
+		t.Error("aborted task should not get a slot")
+	}
+	tasks.ReleaseSlot(c)
+
+	tasks.ReleaseSlot(a)
+	select {
+	case ok := <-bGranted:
+		if !ok {
+			t.Error("b should get the slot released by a")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("b should get a slot after a released")
+	}
+	if pos := tasks.QueuePos(b); pos != 0 {
+		t.Errorf("expect b not queued after granted, got %d", pos)
+	}
+	tasks.ReleaseSlot(b)
+	tasks.ReleaseSlot(b)
+
+	listing := NewBgTasksListing(tasks.GetStat(), time.Now())
+	if !strings.Contains(listing.FormatText(), "pool") {
+		t.Errorf("unexpected text:\n%s", listing.FormatText())
+	}
+}
@@ -66,6 +66,7 @@ type Cli struct {
 	Parser             CliParser
 	EnvAbbrs           *EnvAbbrs
 	TolerableErrs      *TolerableErrs
+	CmdConflicts       *CmdConflicts
 	Executor           Executor
 	Helps              *Helps
 	BgTasks            *BgTasks
@@ -78,6 +79,8 @@ type Cli struct {
 	Arg2EnvAutoMapCmds Arg2EnvAutoMapCmds
 	EnvKeysInfo        *EnvKeysInfo
 	TestingHook        TestingHook
+	// The background task this cli is running in, nil if in main thread
+	BgTask *BgTask
 }
 
 func NewCli(screen Screen, cmds *CmdTree, parser CliParser, abbrs *EnvAbbrs, cmdIO *CmdIO,
@@ -89,6 +92,7 @@ func NewCli(screen Screen, cmds *CmdTree, parser CliParser, abbrs *EnvAbbrs, cmd
 		parser,
 		abbrs,
 		NewTolerableErrs(),
+		NewCmdConflicts(),
 		nil,
 		NewHelps(),
 		NewBgTasks(),
@@ -101,6 +105,7 @@ func NewCli(screen Screen, cmds *CmdTree, parser CliParser, abbrs *EnvAbbrs, cmd
 		Arg2EnvAutoMapCmds{},
 		envKeysInfo,
 		nil,
+		nil,
 	}
 }
 
@@ -120,6 +125,7 @@ func (self *Cli) CopyForInteract() *Cli {
 		self.Parser,
 		self.EnvAbbrs,
 		self.TolerableErrs,
+		self.CmdConflicts,
 		self.Executor,
 		self.Helps,
 		self.BgTasks,
@@ -132,6 +138,7 @@ func (self *Cli) CopyForInteract() *Cli {
 		Arg2EnvAutoMapCmds{},
 		self.EnvKeysInfo,
 		self.TestingHook,
+		nil,
 	}
 }
 
@@ -144,6 +151,7 @@ func (self *Cli) CloneForAsyncExecuting(env *Env) *Cli {
 		self.Parser,
 		self.EnvAbbrs.Clone(),
 		NewTolerableErrs(),
+		self.CmdConflicts,
 		self.Executor.Clone(),
 		self.Helps,
 		self.BgTasks,
@@ -156,6 +164,7 @@ func (self *Cli) CloneForAsyncExecuting(env *Env) *Cli {
 		Arg2EnvAutoMapCmds{},
 		self.EnvKeysInfo,
 		self.TestingHook,
+		nil,
 	}
 }
 
@@ -166,6 +175,7 @@ func (self *Cli) CloneForChecking() *Cli {
 		self.Parser,
 		self.EnvAbbrs,
 		self.TolerableErrs,
+		self.CmdConflicts,
 		self.Executor,
 		self.Helps,
 		self.BgTasks,
@@ -178,6 +188,7 @@ func (self *Cli) CloneForChecking() *Cli {
 		Arg2EnvAutoMapCmds{},
 		self.EnvKeysInfo,
 		self.TestingHook,
+		self.BgTask,
 	}
 }
 
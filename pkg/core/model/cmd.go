@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/mattn/go-shellwords"
@@ -66,6 +67,7 @@ type CmdFlags struct {
 	exeInExecuted       bool
 	ignoreFollowingDeps bool
 	unbreakFileNFlow    bool
+	listArgsRepeated    bool
 }
 
 type Cmd struct {
@@ -88,6 +90,8 @@ type Cmd struct {
 	orderedMacros []string
 	macros        map[string][]string
 	argsAutoMap   *ArgsAutoMapStatus
+	// The cmd path prefix of the repo this cmd is from, the flow resolves its cmds relative to it
+	mountPath []string
 }
 
 func defaultCmd(owner *CmdTree, help string) *Cmd {
@@ -239,6 +243,13 @@ func (self *Cmd) execute(
 		}
 	}
 
+	// The rest cmds of an aborted background task should not be executed
+	if cc.BgTask != nil {
+		if err = cc.BgTask.AbortedErr(); err != nil {
+			return currCmdIdx, err
+		}
+	}
+
 	logFilePath := self.genLogFilePath(env)
 
 	if cc.FlowStatus != nil {
@@ -420,6 +431,11 @@ func (self *Cmd) SetArgEnums(name string, vals ...string) *Cmd {
 	return self
 }
 
+func (self *Cmd) SetArgIsList(name string) *Cmd {
+	self.args.SetArgIsList(self.owner, name)
+	return self
+}
+
 func (self *Cmd) AddAutoMapAllArg(name string, defVal string, abbrs ...string) *Cmd {
 	self.args.AddAutoMapAllArg(self.owner, name, defVal, abbrs...)
 	return self
@@ -463,6 +479,15 @@ func (self *Cmd) SetMetaFile(path string) *Cmd {
 	return self
 }
 
+func (self *Cmd) SetMountPath(path []string) *Cmd {
+	self.mountPath = path
+	return self
+}
+
+func (self *Cmd) MountPath() []string {
+	return self.mountPath
+}
+
 func (self *Cmd) AddDepend(dep string, reason string) *Cmd {
 	self.depends = append(self.depends, Depend{dep, reason})
 	return self
@@ -541,6 +566,13 @@ func (self *Cmd) SetUnbreakFileNFlow() *Cmd {
 	return self
 }
 
+// SetListArgsRepeated makes list args passed to the executable file as repeated positional args,
+// instead of one ListSep-joined string
+func (self *Cmd) SetListArgsRepeated() *Cmd {
+	self.flags.listArgsRepeated = true
+	return self
+}
+
 func (self *Cmd) SetPriority() *Cmd {
 	self.flags.priority = true
 	return self
@@ -690,6 +722,10 @@ func (self *Cmd) IsHideInSessionsLast() bool {
 	return self.flags.hideInSessionsLast
 }
 
+func (self *Cmd) IsListArgsRepeated() bool {
+	return self.flags.listArgsRepeated
+}
+
 func (self *Cmd) IsPriority() bool {
 	return self.flags.priority
 }
@@ -817,6 +853,9 @@ func (self *Cmd) RenderedFlowStrs(
 	}
 
 	flow, flowFullyRendered := RenderTemplateStrLines(flowStrs, "flow", self, argv, env, allowFlowTemplateRenderError)
+	if len(self.mountPath) != 0 {
+		flow = cc.Parser.MountFlow(cc.Cmds, self.mountPath, flow)
+	}
 	fullyRendered = macrosFullyRendered && flowFullyRendered
 	if fullyRendered {
 		if masks != nil && !cc.Blender.IsEmpty() {
@@ -1029,9 +1068,25 @@ func (self *Cmd) executeFile(argv ArgVals, cc *Cli, env *Env, allowError bool, p
 	args = append(args, self.cmdLine)
 	args = append(args, sessionDir)
 	for _, k := range self.args.Names() {
-		args = append(args, argv[k].Raw)
+		if self.flags.listArgsRepeated && self.args.IsList(k) {
+			args = append(args, argv.GetList(k)...)
+		} else {
+			args = append(args, argv[k].Raw)
+		}
 	}
 	cmd := exec.Command(bin, args...)
+	if cc.BgTask != nil {
+		if err := cc.BgTask.AbortedErr(); err != nil {
+			return err
+		}
+		cmd = exec.CommandContext(cc.BgTask.Context(), bin, args...)
+		// Kill the whole process group on aborting, or the grandchildren may keep running and holding the output
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		cmd.Cancel = func() error {
+			return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		cmd.WaitDelay = time.Second
+	}
 	cmd.Dir = filepath.Dir(self.cmdLine)
 
 	logger := cc.CmdIO.SetupForExec(cmd, logFilePath)
@@ -1044,6 +1099,12 @@ func (self *Cmd) executeFile(argv ArgVals, cc *Cli, env *Env, allowError bool, p
 	}
 
 	err := cmd.Run()
+	if err != nil && cc.BgTask != nil {
+		if abortedErr := cc.BgTask.AbortedErr(); abortedErr != nil {
+			err = abortedErr
+			allowError = false
+		}
+	}
 	if err != nil && !allowError {
 		runErr := &RunCmdFileFailed{
 			err.Error(),
@@ -1113,6 +1174,7 @@ func (self *Cmd) Clone(newOwner *CmdTree) *Cmd {
 		exeInExecuted:       self.flags.exeInExecuted,
 		ignoreFollowingDeps: self.flags.ignoreFollowingDeps,
 		unbreakFileNFlow:    self.flags.unbreakFileNFlow,
+		listArgsRepeated:    self.flags.listArgsRepeated,
 	}
 	cloned.args = self.args.Clone()
 	cloned.normal = self.normal
@@ -1132,6 +1194,7 @@ func (self *Cmd) Clone(newOwner *CmdTree) *Cmd {
 	}
 	// Just create a new one for now.
 	cloned.argsAutoMap = NewArgsAutoMapStatus()
+	cloned.mountPath = self.mountPath
 
 	return cloned
 }
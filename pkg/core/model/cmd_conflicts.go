@@ -0,0 +1,118 @@
+package model
+
+import (
+	"strings"
+)
+
+// The shadowed commands (losers of conflicts between repos) are registered under this path,
+// as '<ShadowedCmdsPath>.<repo-name>.<cmd-path>', so they could be called explicitly
+const ShadowedCmdsPath = "hub.shadowed"
+
+const (
+	CmdConflictByCmdRule   = "cmd rule"
+	CmdConflictByRepoLevel = "repo level"
+	CmdConflictByLoadOrder = "load order"
+)
+
+// CmdPriorities decides the winner when two repos (sources) define the same command
+type CmdPriorities struct {
+	// Higher level wins, the default level is 0
+	SourceLevels map[string]int
+	// Cmd path => the source of the winner
+	CmdWinners map[string]string
+}
+
+func NewCmdPriorities() CmdPriorities {
+	return CmdPriorities{map[string]int{}, map[string]string{}}
+}
+
+// NewWins returns the reason (one of the CmdConflictBy*) and whether the new one wins
+func (self CmdPriorities) NewWins(cmdPath string, oldSource string, newSource string) (newWins bool, by string) {
+	if winner, ok := self.CmdWinners[cmdPath]; ok {
+		if winner == newSource {
+			return true, CmdConflictByCmdRule
+		}
+		if winner == oldSource {
+			return false, CmdConflictByCmdRule
+		}
+	}
+	oldLevel := self.SourceLevels[oldSource]
+	newLevel := self.SourceLevels[newSource]
+	if oldLevel != newLevel {
+		return newLevel > oldLevel, CmdConflictByRepoLevel
+	}
+	return false, CmdConflictByLoadOrder
+}
+
+type CmdConflict struct {
+	CmdPath string
+	Winner  string
+	Loser   string
+	By      string
+	// Empty if the loser is not loaded
+	ShadowPath string
+}
+
+type CmdConflicts struct {
+	Priorities CmdPriorities
+	List       []CmdConflict
+}
+
+func NewCmdConflicts() *CmdConflicts {
+	return &CmdConflicts{NewCmdPriorities(), nil}
+}
+
+func (self *CmdConflicts) Add(conflict CmdConflict) {
+	self.List = append(self.List, conflict)
+}
+
+func (self *CmdConflicts) Has(cmdPath string, source string) bool {
+	for _, it := range self.List {
+		if it.CmdPath == cmdPath && (it.Winner == source || it.Loser == source) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShadowedCmdName converts a source (repo address or dir) to a cmd name
+func ShadowedCmdName(source string) string {
+	name := strings.TrimRight(source, "/")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	// Strip the pinned ref
+	if i := strings.Index(name, "@"); i > 0 {
+		name = name[:i]
+	}
+	name = strings.TrimSuffix(name, ".git")
+	var buf strings.Builder
+	for _, c := range name {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '-' {
+			buf.WriteRune(c)
+		} else {
+			buf.WriteRune('-')
+		}
+	}
+	name = buf.String()
+	if len(name) == 0 || isShortcutCmdName(name) {
+		name = "repo-" + name
+	}
+	return name
+}
+
+// MoveCmdTo moves the cmd (and its source, tags, trivial level) to another node,
+// the sub commands and the abbrs are kept
+func (self *CmdTree) MoveCmdTo(dest *CmdTree) {
+	self.loadLazyCmd()
+	dest.cmd = self.cmd
+	if dest.cmd != nil {
+		dest.cmd.owner = dest
+	}
+	dest.source = self.source
+	dest.tags = self.tags
+	dest.trivial = self.trivial
+	self.cmd = nil
+	self.tags = nil
+	self.trivial = 0
+}
@@ -0,0 +1,61 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestCmdPrioritiesNewWins(t *testing.T) {
+	priorities := NewCmdPriorities()
+	if newWins, by := priorities.NewWins("x", "a", "b"); newWins || by != CmdConflictByLoadOrder {
+		t.Errorf("expect the old one wins by load order")
+	}
+	priorities.SourceLevels["b"] = 1
+	if newWins, by := priorities.NewWins("x", "a", "b"); !newWins || by != CmdConflictByRepoLevel {
+		t.Errorf("expect the new one wins by repo level")
+	}
+	priorities.CmdWinners["x"] = "a"
+	if newWins, by := priorities.NewWins("x", "a", "b"); newWins || by != CmdConflictByCmdRule {
+		t.Errorf("expect the old one wins by cmd rule")
+	}
+	// The rule of other repo is ignored
+	priorities.CmdWinners["x"] = "c"
+	if newWins, _ := priorities.NewWins("x", "a", "b"); !newWins {
+		t.Errorf("expect the new one wins by repo level")
+	}
+}
+
+func TestShadowedCmdName(t *testing.T) {
+	cases := map[string]string{
+		"https://github.com/innerr/tidb.ticat":   "tidb-ticat",
+		"https://github.com/local/mods.git@v1.0": "mods",
+		"git@github.com:innerr/mods#dev":         "mods-dev",
+		"/home/user/my-mods/":                    "my-mods",
+		"/tmp/1mods":                             "repo-1mods",
+	}
+	for source, expected := range cases {
+		if name := ShadowedCmdName(source); name != expected {
+			t.Errorf("source '%s': expected '%s', got '%s'", source, expected, name)
+		}
+	}
+}
+
+func TestCmdTreeMoveCmdTo(t *testing.T) {
+	tree := NewCmdTree(CmdTreeStrsForTest())
+	src := tree.AddSub("src")
+	src.SetSource("repo")
+	src.RegFileCmd("/bin/true", "help", "repo")
+	src.AddTags("t")
+	sub := src.AddSub("sub")
+	dest := tree.AddSub("dest")
+
+	src.MoveCmdTo(dest)
+	if src.Cmd() != nil || dest.Cmd() == nil || dest.Cmd().Owner() != dest {
+		t.Fatal("expect cmd moved")
+	}
+	if dest.Source() != "repo" || len(dest.Tags()) != 1 || len(src.Tags()) != 0 {
+		t.Errorf("expect source and tags moved")
+	}
+	if src.GetSub("sub") != sub {
+		t.Errorf("expect sub commands kept")
+	}
+}
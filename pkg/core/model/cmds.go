@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"strings"
+	"sync"
 )
 
 // TODO: share some code with EnvAbbrs ?
@@ -47,6 +48,17 @@ type CmdTree struct {
 	tags            []string
 	trivial         int
 	isApi           bool
+	// Registers the cmd when it's accessed at the first time, see 'SetLazyCmd'
+	lazyCmd *lazyCmd
+}
+
+// lazyCmd is the loading state of a lazy cmd, the loading is guarded by the mutex,
+// so the cmd could be accessed in bg tasks
+type lazyCmd struct {
+	mutex  sync.Mutex
+	loader func(*CmdTree) error
+	// The error of loading, the cmd is not registered if it's not nil
+	err error
 }
 
 func NewCmdTree(strs *CmdTreeStrs) *CmdTree {
@@ -64,6 +76,7 @@ func NewCmdTree(strs *CmdTreeStrs) *CmdTree {
 		nil,
 		0,
 		false,
+		nil,
 	}
 }
 
@@ -76,6 +89,9 @@ func (self *CmdTree) Execute(
 	flow *ParsedCmds,
 	currCmdIdx int,
 	tryBreakInsideFileNFlow func(*Cli, *Env, *Cmd) bool) (int, error) {
+	if err := self.LazyCmdErr(); err != nil {
+		return currCmdIdx, err
+	}
 
 	if self.cmd == nil {
 		return currCmdIdx, nil
@@ -85,6 +101,7 @@ func (self *CmdTree) Execute(
 }
 
 func (self *CmdTree) cmdConflictCheck(help string, funName string, source string) {
+	self.loadLazyCmd()
 	// Allow in-source overwrite when: the cmd is not registered
 	if self.cmd == nil && self.source == source {
 		return
@@ -106,6 +123,7 @@ func (self *CmdTree) cmdConflictCheck(help string, funName string, source string
 		errStr,
 		self.Path(),
 		self.Source(),
+		"",
 	}
 	// PANIC: Programming error - command registration conflict
 	panic(err)
@@ -130,6 +148,7 @@ func (self *CmdTree) IsApi() bool {
 }
 
 func (self *CmdTree) IsEmpty() bool {
+	self.loadLazyCmd()
 	return self.cmd == nil || self.cmd.Type() == CmdTypeEmptyDir || self.cmd.Type() == CmdTypeEmpty
 }
 
@@ -150,6 +169,7 @@ func (self *CmdTree) Trivial() int {
 }
 
 func (self *CmdTree) MatchWriteKey(key string) bool {
+	self.loadLazyCmd()
 	if self.cmd == nil {
 		return false
 	}
@@ -197,6 +217,7 @@ func (self *CmdTree) RegDirWithCmd(cmd string, help string, source string) *Cmd
 }
 
 func (self *CmdTree) RegEmptyDirCmd(dir string, help string) *Cmd {
+	self.loadLazyCmd()
 	// Ignore empty dir cmd register
 	if self.cmd != nil {
 		return self.cmd
@@ -248,6 +269,7 @@ func (self *CmdTree) RegFileNFlowCmd(flow []string, cmd string, help string, sou
 }
 
 func (self *CmdTree) ReplaceCmdWithPowerCmd(cmd PowerCmd) (old *Cmd) {
+	self.loadLazyCmd()
 	old = self.cmd
 	old.owner = nil
 	self.cmd = NewPowerCmd(self, old.help, cmd)
@@ -309,10 +331,12 @@ func (self *CmdTree) GetSubByPath(path string, panicOnNotFound bool) *CmdTree {
 }
 
 func (self *CmdTree) IsQuiet() bool {
+	self.loadLazyCmd()
 	return self.cmd != nil && self.cmd.IsQuiet()
 }
 
 func (self *CmdTree) IsNoExecutableCmd() bool {
+	self.loadLazyCmd()
 	if self.cmd == nil {
 		return true
 	}
@@ -320,13 +344,69 @@ func (self *CmdTree) IsNoExecutableCmd() bool {
 }
 
 func (self *CmdTree) IsPowerCmd() bool {
+	self.loadLazyCmd()
 	return self.cmd != nil && self.cmd.IsPowerCmd()
 }
 
 func (self *CmdTree) AllowTailModeCall() bool {
+	self.loadLazyCmd()
 	return self.cmd != nil && self.cmd.AllowTailModeCall()
 }
 
+// SetLazyCmd delays the cmd registering until the cmd is accessed,
+// the loader should register the cmd to the passed node, and should not touch the other nodes
+func (self *CmdTree) SetLazyCmd(loader func(*CmdTree) error) {
+	self.lazyCmd = &lazyCmd{loader: loader}
+}
+
+func (self *CmdTree) HasLazyCmd() bool {
+	if self.lazyCmd == nil {
+		return false
+	}
+	self.lazyCmd.mutex.Lock()
+	defer self.lazyCmd.mutex.Unlock()
+	return self.lazyCmd.loader != nil
+}
+
+// LazyCmdErr returns the error of loading the lazy cmd, the node is not executable if it's not nil
+func (self *CmdTree) LazyCmdErr() error {
+	if self.lazyCmd == nil {
+		return nil
+	}
+	self.loadLazyCmd()
+	return self.lazyCmd.err
+}
+
+func (self *CmdTree) loadLazyCmd() {
+	lazy := self.lazyCmd
+	if lazy == nil {
+		return
+	}
+	lazy.mutex.Lock()
+	defer lazy.mutex.Unlock()
+	if lazy.loader == nil {
+		return
+	}
+	loader := lazy.loader
+	lazy.loader = nil
+
+	// The cmd is registered to a detached node with the same path, then moved to this node,
+	// so the registering functions (they access the lazy cmd) don't wait for the mutex held by this loading
+	loading := NewCmdTree(self.Strs)
+	loading.name = self.name
+	loading.parent = self.parent
+	loading.source = self.source
+	// The meta file may be changed or broken after the mods index is built, the node becomes not executable
+	if err := loader(loading); err != nil {
+		lazy.err = fmt.Errorf("[CmdTree.loadLazyCmd] load cmd '%s' failed: %v", self.DisplayPath(), err)
+		return
+	}
+	self.cmd = loading.cmd
+	if self.cmd != nil {
+		self.cmd.owner = self
+	}
+}
+
 func (self *CmdTree) Parent() *CmdTree {
 	return self.parent
 }
@@ -347,10 +427,12 @@ func (self *CmdTree) DisplayName() string {
 }
 
 func (self *CmdTree) Cmd() *Cmd {
+	self.loadLazyCmd()
 	return self.cmd
 }
 
 func (self *CmdTree) Args() (args Args) {
+	self.loadLazyCmd()
 	if self.cmd == nil {
 		return
 	}
@@ -418,6 +500,7 @@ func (self *CmdTree) MatchFind(findStrs ...string) bool {
 }
 
 func (self *CmdTree) matchFind(findStr string) bool {
+	self.loadLazyCmd()
 	if len(findStr) == 0 {
 		return true
 	}
@@ -550,6 +633,34 @@ func isShortcutCmdName(name string) bool {
 	return !normal
 }
 
+// RemoveSource removes the cmds registered by a source (repo address or dir), for reloading the source.
+// The nodes with sub commands from other sources are kept but become not executable.
+func (self *CmdTree) RemoveSource(source string) {
+	var names []string
+	for _, name := range self.subOrderedNames {
+		sub := self.subs[name]
+		sub.RemoveSource(source)
+		if sub.source != source {
+			names = append(names, name)
+			continue
+		}
+		if len(sub.subs) != 0 {
+			sub.cmd = nil
+			sub.lazyCmd = nil
+			sub.tags = nil
+			sub.trivial = 0
+			names = append(names, name)
+			continue
+		}
+		delete(self.subs, name)
+		for _, abbr := range self.subAbbrs[name] {
+			delete(self.subAbbrsRevIdx, abbr)
+		}
+		delete(self.subAbbrs, name)
+	}
+	self.subOrderedNames = names
+}
+
 func (self *CmdTree) Clone() *CmdTree {
 	cloned := NewCmdTree(self.Strs)
 	cloned.name = self.name
@@ -558,8 +669,15 @@ func (self *CmdTree) Clone() *CmdTree {
 	cloned.source = self.source
 	cloned.trivial = self.trivial
 	cloned.isApi = self.isApi
-
-	if self.cmd != nil {
+	// The cloned one loads the cmd by itself, not shares the loading state
+	if self.lazyCmd != nil {
+		self.lazyCmd.mutex.Lock()
+		cloned.lazyCmd = &lazyCmd{loader: self.lazyCmd.loader, err: self.lazyCmd.err}
+		if self.cmd != nil {
+			cloned.cmd = self.cmd.Clone(cloned)
+		}
+		self.lazyCmd.mutex.Unlock()
+	} else if self.cmd != nil {
 		cloned.cmd = self.cmd.Clone(cloned)
 	}
 
@@ -1,7 +1,9 @@
 package model
 
 import (
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 )
 
@@ -981,3 +983,82 @@ func TestCmdTreeAddSubEmptyAbbr(t *testing.T) {
 		t.Errorf("Expected 3 abbreviations (empty skipped), got %d: %v", len(abbrs), abbrs)
 	}
 }
+
+func TestCmdTreeRemoveSource(t *testing.T) {
+	tree := NewCmdTree(CmdTreeStrsForTest())
+	dummyFunc := func(argv ArgVals, cc *Cli, env *Env, flow []ParsedCmd) error {
+		return nil
+	}
+
+	tree.GetOrAddSubEx("repo-a", "db").AddAbbrs("d")
+	tree.GetOrAddSubEx("repo-a", "db", "start").RegCmd(dummyFunc, "start", "repo-a")
+	tree.GetOrAddSubEx("repo-a", "db").RegCmd(dummyFunc, "db", "repo-a")
+	tree.GetOrAddSubEx("repo-b", "db", "stop").RegCmd(dummyFunc, "stop", "repo-b")
+	tree.GetOrAddSubEx("repo-a", "only-a").RegCmd(dummyFunc, "only a", "repo-a")
+
+	tree.RemoveSource("repo-a")
+	if tree.GetSub("only-a") != nil || tree.GetSub("db", "start") != nil {
+		t.Error("cmds of the removed source should be removed")
+	}
+	db := tree.GetSub("d")
+	if db == nil || db.Cmd() != nil || tree.GetSub("db", "stop") == nil {
+		t.Error("the node with cmds from other sources should be kept, but not executable")
+	}
+
+	tree.GetOrAddSubEx("repo-a", "only-a").AddAbbrs("oa")
+	if tree.GetSub("oa") == nil {
+		t.Error("cmds of the removed source should be able to register again")
+	}
+}
+
+func TestCmdTreeLazyCmd(t *testing.T) {
+	tree := NewCmdTree(CmdTreeStrsForTest())
+	dummyFunc := func(argv ArgVals, cc *Cli, env *Env, flow []ParsedCmd) error {
+		return nil
+	}
+
+	loads := 0
+	var mutex sync.Mutex
+	lazy := tree.GetOrAddSubEx("repo", "db", "lazy")
+	lazy.SetLazyCmd(func(node *CmdTree) error {
+		mutex.Lock()
+		loads += 1
+		mutex.Unlock()
+		node.RegCmd(dummyFunc, "lazy cmd", "repo")
+		return nil
+	})
+	cloned := tree.Clone().GetSub("db", "lazy")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lazy.Cmd() == nil || lazy.Cmd().Help() != "lazy cmd" {
+				t.Error("lazy cmd should be loaded when accessed")
+			}
+		}()
+	}
+	wg.Wait()
+	if loads != 1 || lazy.HasLazyCmd() || lazy.Cmd().Owner() != lazy {
+		t.Errorf("lazy cmd should be loaded once to the node, loaded %d times", loads)
+	}
+	if !cloned.HasLazyCmd() || cloned.Cmd() == nil || cloned.Cmd().Owner() != cloned || loads != 2 {
+		t.Error("the cloned tree should load the cmd by itself")
+	}
+
+	broken := tree.GetOrAddSubEx("repo", "db", "broken")
+	broken.SetLazyCmd(func(node *CmdTree) error {
+		return fmt.Errorf("meta file changed")
+	})
+	if broken.Cmd() != nil {
+		t.Error("the cmd failed to load should not be registered")
+	}
+	err := broken.LazyCmdErr()
+	if err == nil || !strings.Contains(err.Error(), "meta file changed") {
+		t.Errorf("expect the loading error, got: %v", err)
+	}
+	if _, err := broken.Execute(nil, nil, nil, nil, nil, nil, 0, nil); err == nil {
+		t.Error("executing the cmd failed to load should return the error")
+	}
+}
@@ -205,14 +205,20 @@ func (self *Env) Parent() *Env {
 
 func (self *Env) GetArgv(cmdPath []string, sep string, stackDepth int, args Args) ArgVals {
 	argv := ArgVals{}
+	listSep := self.GetRaw("strs.list-sep")
 	list := args.Names()
 	for i, it := range list {
 		key := strings.Join(append(cmdPath, it), sep)
 		val, ok := self.GetEx(key)
 		if ok {
-			argv[it] = ArgVal{val.Raw, true, i}
+			argv[it] = ArgVal{val.Raw, true, i, nil}
 		} else {
-			argv[it] = ArgVal{args.DefVal(it, stackDepth), false, i}
+			argv[it] = ArgVal{args.DefVal(it, stackDepth), false, i, nil}
+		}
+		if args.IsList(it) {
+			argVal := argv[it]
+			argVal.List = SplitListVal(argVal.Raw, listSep)
+			argv[it] = argVal
 		}
 	}
 	return argv
@@ -76,6 +76,16 @@ func (self *EnvAbbrs) AddAbbrs(abbrs ...string) *EnvAbbrs {
 
 // TODO: move to parser dir
 func (self *EnvAbbrs) TryMatch(path string, sep string) (matchedPath []string, matched bool) {
+	matchedPath, matched, _ = self.TryMatchEx(path, sep, false)
+	return
+}
+
+// TryMatchEx matches each segment of the path by names and abbrs,
+// and by unambiguous prefixes if 'prefixMatch' is true.
+// The error is not nil only if a segment is an ambiguous prefix.
+func (self *EnvAbbrs) TryMatchEx(path string, sep string, prefixMatch bool) (
+	matchedPath []string, matched bool, err error) {
+
 	for len(path) > 0 {
 		i := strings.Index(path, sep)
 		if i == 0 {
@@ -90,15 +100,19 @@ func (self *EnvAbbrs) TryMatch(path string, sep string) (matchedPath []string, m
 			candidate = path
 			path = ""
 		}
-		subName, ok := self.subAbbrsRevIdx[candidate]
-		if !ok {
+		var sub *EnvAbbrs
+		if subName, ok := self.subAbbrsRevIdx[candidate]; ok {
+			sub = self.subs[subName]
+		} else if prefixMatch {
+			sub, err = self.matchSubPrefix(candidate)
+		}
+		if sub == nil {
 			matched = false
 			return
 		}
-		matchedPath = append(matchedPath, subName)
-		sub, _ := self.subs[subName]
+		matchedPath = append(matchedPath, sub.name)
 		var subMatchedPath []string
-		subMatchedPath, matched = sub.TryMatch(path, sep)
+		subMatchedPath, matched, err = sub.TryMatchEx(path, sep, prefixMatch)
 		if len(subMatchedPath) != 0 {
 			matchedPath = append(matchedPath, subMatchedPath...)
 		}
@@ -788,6 +788,39 @@ func TestEnvGetArgv(t *testing.T) {
 	}
 }
 
+func TestEnvGetArgvList(t *testing.T) {
+	tree := NewCmdTree(CmdTreeStrsForTest())
+	args := newArgs()
+	args.AddArg(tree, "hosts", "h1")
+	args.AddArg(tree, "port", "")
+	args.SetArgIsList(tree, "hosts")
+
+	env := NewEnv()
+	env.Set("strs.list-sep", ",")
+
+	argv := env.GetArgv([]string{"cmd"}, ".", 1, args)
+	if list := argv.GetList("hosts"); len(list) != 1 || list[0] != "h1" {
+		t.Errorf("Expected default list [h1], got %v", list)
+	}
+	if list := argv.GetList("port"); len(list) != 0 {
+		t.Errorf("Expected empty list for empty non-list arg, got %v", list)
+	}
+
+	env.Set("cmd.hosts", "h1, h2,,h3")
+	env.Set("cmd.port", "4000")
+	argv = env.GetArgv([]string{"cmd"}, ".", 1, args)
+	list := argv.GetList("hosts")
+	if len(list) != 3 || list[0] != "h1" || list[1] != "h2" || list[2] != "h3" {
+		t.Errorf("Expected [h1 h2 h3], got %v", list)
+	}
+	if list := argv.GetList("port"); len(list) != 1 || list[0] != "4000" {
+		t.Errorf("Expected [4000] for non-list arg, got %v", list)
+	}
+	if list := argv.GetListEx("not-exists", nil); list != nil {
+		t.Errorf("Expected default nil for not exists arg, got %v", list)
+	}
+}
+
 func TestEnvGetSysArgv(t *testing.T) {
 	env := NewEnv()
 	env.Set("strs.sys-arg-prefix", "sys.")
@@ -78,6 +78,8 @@ type CmdTreeErrExecutableConflicted struct {
 	Str       string
 	CmdPath   []string
 	OldSource string
+	// Not empty if the new one is loaded as a shadowed command
+	ShadowPath string
 }
 
 func (self CmdTreeErrExecutableConflicted) Error() string {
@@ -177,6 +179,16 @@ func (self AbortByUserErr) Error() string {
 	return "aborted by user"
 }
 
+// BgTaskAbortedErr is the error of a background task killed by 'bg.kill' or reached its timeout
+type BgTaskAbortedErr struct {
+	Tid    string
+	Reason string
+}
+
+func (self BgTaskAbortedErr) Error() string {
+	return "thread " + self.Tid + " aborted: " + self.Reason
+}
+
 func NewAbortByUserErr() *AbortByUserErr {
 	return &AbortByUserErr{}
 }
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -115,6 +116,11 @@ func ParseExecutedFlow(path ExecutedStatusFilePath) (lastActiveTs time.Time, exe
 		lines = lines[:len(lines)-1]
 	}
 
+	if DetectStatusFormat(data) == StatusFormatJsonl {
+		lastActiveTs, executed = parseExecutedFlowJsonl(path, lines)
+		return lastActiveTs, executed, nil
+	}
+
 	// Consider it's normal if ok=false but all lines are parsed
 	executed, lines, lastActiveTs, ok := parseExecutedFlow(path, lines, 0)
 	if !ok && len(lines) != 0 {
@@ -154,6 +160,121 @@ func (self *ExecutedFlow) GenExecMasks() (masks []*ExecuteMask) {
 	return
 }
 
+// ParseCmdIdxPath parses a 1-based index path like '2.1.3' (the 3rd cmd in the subflow of
+// the 1st cmd in the subflow of the 2nd cmd) into 0-based indexes
+func ParseCmdIdxPath(str string, sep string) (path []int, err error) {
+	for _, seg := range strings.Split(strings.TrimSpace(str), sep) {
+		idx, err := strconv.Atoi(strings.TrimSpace(seg))
+		if err != nil || idx <= 0 {
+			return nil, fmt.Errorf("bad cmd index '%s' in '%s', should be positive int (1-based) path like '2.1.3'", seg, str)
+		}
+		path = append(path, idx-1)
+	}
+	return
+}
+
+func CmdIdxPathStr(path []int, sep string) string {
+	var strs []string
+	for _, idx := range path {
+		strs = append(strs, strconv.Itoa(idx+1))
+	}
+	return strings.Join(strs, sep)
+}
+
+// GetCmdByPath finds a cmd by 0-based index path, the cmds of delayed(bg) tasks can't be addressed
+func (self *ExecutedFlow) GetCmdByPath(path []int) (*ExecutedCmd, error) {
+	flow := self
+	for i, idx := range path {
+		if idx < 0 || idx >= len(flow.Cmds) {
+			return nil, fmt.Errorf("cmd index %d out of range [1, %d] in flow '%s'", idx+1, len(flow.Cmds), flow.Flow)
+		}
+		cmd := flow.Cmds[idx]
+		if i == len(path)-1 {
+			return cmd, nil
+		}
+		if cmd.IsDelay {
+			return nil, fmt.Errorf("cmd '%s' is a delayed task, can't address cmds inside it", cmd.Cmd)
+		}
+		if cmd.SubFlow == nil {
+			return nil, fmt.Errorf("cmd '%s' has no subflow", cmd.Cmd)
+		}
+		flow = cmd.SubFlow
+	}
+	return nil, fmt.Errorf("empty cmd index")
+}
+
+// GenExecMasksFrom generates masks to re-run the flow from the cmd addressed by the 0-based index path:
+// cmds before it are skipped with the recorded envs, the target one starts with its recorded start env,
+// the ones after it run normally
+func (self *ExecutedFlow) GenExecMasksFrom(path []int) (masks []*ExecuteMask, err error) {
+	target, err := self.GetCmdByPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if target.IsDelay {
+		return nil, fmt.Errorf("cmd '%s' is a delayed task, can't retry from it", target.Cmd)
+	}
+	return self.genExecMasksFrom(path), nil
+}
+
+func (self *ExecutedFlow) genExecMasksFrom(path []int) (masks []*ExecuteMask) {
+	for i := 0; i < path[0]; i++ {
+		mask := self.Cmds[i].genExecMask()
+		mask.SetExecPolicyForAll(ExecPolicySkip)
+		masks = append(masks, mask)
+	}
+	cmd := self.Cmds[path[0]]
+	mask := NewExecuteMask(cmd.Cmd)
+	mask.OverWriteStartEnv = cmd.StartEnv
+	mask.ExecutedCmd = cmd
+	if len(path) > 1 {
+		mask.SubFlow = cmd.SubFlow.genExecMasksFrom(path[1:])
+	}
+	// The masks of the following cmds are omitted, so they will be executed normally
+	return append(masks, mask)
+}
+
+// GenExecMasksSkip is like 'GenExecMasks', but the cmd addressed by the 0-based index path is skipped too
+func (self *ExecutedFlow) GenExecMasksSkip(path []int) (masks []*ExecuteMask, err error) {
+	target, err := self.GetCmdByPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if target.IsDelay {
+		return nil, fmt.Errorf("cmd '%s' is a delayed task, can't skip it", target.Cmd)
+	}
+	masks = self.GenExecMasks()
+	curr := masks
+	for i, idx := range path {
+		mask := curr[idx]
+		if i == len(path)-1 {
+			mask.SetExecPolicyForAll(ExecPolicySkip)
+			break
+		}
+		// The ancestors should be executed so we could go into the subflow
+		mask.ExecPolicy = ExecPolicyExec
+		curr = mask.SubFlow
+	}
+	return masks, nil
+}
+
+func (self *ExecutedCmd) genExecMask() *ExecuteMask {
+	var subMasks []*ExecuteMask
+	if self.SubFlow != nil {
+		subMasks = self.SubFlow.GenExecMasks()
+	}
+	return &ExecuteMask{
+		self.Cmd,
+		self.StartEnv,
+		self.FinishEnv,
+		ExecPolicyExec,
+		ExecPolicyExec,
+		subMasks,
+		self.Result,
+		self,
+	}
+}
+
 func (self *ExecutedFlow) IsOneCmdSession(cmd string) bool {
 	return len(self.Cmds) == 1 && self.Cmds[0].Cmd == cmd
 }
@@ -364,8 +485,17 @@ func tryParseScheduledCmd(cmd *ExecutedCmd, path ExecutedStatusFilePath,
 	if !ok {
 		return lines, lastActiveTs, false
 	}
+	return lines, loadScheduledCmd(cmd, path, tid), true
+}
+
+// loadScheduledCmd loads the status of a delayed(bg) task from its own status file
+func loadScheduledCmd(cmd *ExecutedCmd, path ExecutedStatusFilePath, tid string) (lastActiveTs time.Time) {
 	bgSessionPath := ExecutedStatusFilePath{path.RootPath, filepath.Join(path.DirName, tid), path.FileName}
 	lastActiveTs, subflow, _ := ParseExecutedFlow(bgSessionPath)
+	if subflow == nil {
+		// The status file of the bg task may not be created yet
+		subflow = NewExecutedFlow(bgSessionPath.DirName)
+	}
 	if len(subflow.Cmds) == 0 {
 		executedCmd := NewExecutedCmd(cmd.Cmd)
 		executedCmd.Result = ExecutedResultIncompleted
@@ -378,7 +508,7 @@ func tryParseScheduledCmd(cmd *ExecutedCmd, path ExecutedStatusFilePath,
 	cmd.SubFlow = subflow
 	// The schedule-result is not important, use the execute-result
 	cmd.Result = subflow.Result
-	return lines, lastActiveTs, true
+	return lastActiveTs
 }
 
 func parseCmdOrFlowResult(path ExecutedStatusFilePath, lines []string, mark string,
@@ -0,0 +1,94 @@
+package model
+
+import (
+	"testing"
+)
+
+func newExecutedFlowForTest(results ...ExecutedResult) *ExecutedFlow {
+	flow := NewExecutedFlow("test")
+	for i, result := range results {
+		cmd := NewExecutedCmd("cmd" + string(rune('a'+i)))
+		cmd.Result = result
+		cmd.StartEnv = NewEnvEx(EnvLayerSession)
+		cmd.StartEnv.Set("step", cmd.Cmd)
+		cmd.FinishEnv = NewEnvEx(EnvLayerSession)
+		flow.Cmds = append(flow.Cmds, cmd)
+	}
+	return flow
+}
+
+func TestParseCmdIdxPath(t *testing.T) {
+	path, err := ParseCmdIdxPath("2.1.3", ".")
+	if err != nil || len(path) != 3 || path[0] != 1 || path[1] != 0 || path[2] != 2 {
+		t.Fatalf("unexpected result %v, %v", path, err)
+	}
+	if str := CmdIdxPathStr(path, "."); str != "2.1.3" {
+		t.Fatalf("expected '2.1.3', got '%s'", str)
+	}
+	for _, bad := range []string{"", "0", "1.x", "-1", "1..2"} {
+		if _, err := ParseCmdIdxPath(bad, "."); err == nil {
+			t.Errorf("'%s' should be invalid", bad)
+		}
+	}
+}
+
+func TestExecutedFlowGenExecMasksFrom(t *testing.T) {
+	flow := newExecutedFlowForTest(ExecutedResultSucceeded, ExecutedResultSucceeded, ExecutedResultError)
+	sub := newExecutedFlowForTest(ExecutedResultSucceeded, ExecutedResultSucceeded, ExecutedResultSucceeded)
+	flow.Cmds[1].SubFlow = sub
+
+	masks, err := flow.GenExecMasksFrom([]int{1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(masks) != 2 {
+		t.Fatalf("expected 2 masks, the ones after the target should be omitted, got %d", len(masks))
+	}
+	if masks[0].ExecPolicy != ExecPolicySkip || masks[0].OverWriteFinishEnv == nil {
+		t.Errorf("cmds before the target should be skipped with recorded env")
+	}
+	parent := masks[1]
+	if parent.ExecPolicy != ExecPolicyExec || parent.OverWriteFinishEnv != nil {
+		t.Errorf("the parent of the target should be executed")
+	}
+	if len(parent.SubFlow) != 2 {
+		t.Fatalf("expected 2 sub masks, got %d", len(parent.SubFlow))
+	}
+	if parent.SubFlow[0].ExecPolicy != ExecPolicySkip {
+		t.Errorf("sub cmds before the target should be skipped")
+	}
+	target := parent.SubFlow[1]
+	if target.ExecPolicy != ExecPolicyExec || target.OverWriteStartEnv.GetRaw("step") != "cmdb" {
+		t.Errorf("the target should be executed with its recorded start env")
+	}
+
+	if _, err := flow.GenExecMasksFrom([]int{3}); err == nil {
+		t.Errorf("out of range index should be an error")
+	}
+	if _, err := flow.GenExecMasksFrom([]int{0, 1}); err == nil {
+		t.Errorf("cmd without subflow can't be addressed into")
+	}
+}
+
+func TestExecutedFlowGenExecMasksSkip(t *testing.T) {
+	flow := newExecutedFlowForTest(ExecutedResultSucceeded, ExecutedResultError, ExecutedResultError)
+	sub := newExecutedFlowForTest(ExecutedResultSucceeded, ExecutedResultError)
+	flow.Cmds[1].SubFlow = sub
+
+	masks, err := flow.GenExecMasksSkip([]int{1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(masks) != 3 {
+		t.Fatalf("expected 3 masks, got %d", len(masks))
+	}
+	if masks[0].ExecPolicy != ExecPolicySkip {
+		t.Errorf("succeeded cmd should be skipped")
+	}
+	if masks[1].ExecPolicy != ExecPolicyExec || masks[1].SubFlow[1].ExecPolicy != ExecPolicySkip {
+		t.Errorf("the target should be skipped inside the executed parent")
+	}
+	if masks[2].ExecPolicy != ExecPolicyExec {
+		t.Errorf("failed cmd after the target should be executed")
+	}
+}
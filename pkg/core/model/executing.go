@@ -36,8 +36,11 @@ func ResetStatusFileOpener() {
 }
 
 type ExecutingFlow struct {
-	path  string
-	level int
+	path   string
+	level  int
+	format string
+	// The last synced value of env 'session.tags'
+	tags string
 }
 
 func NewExecutingFlow(path string, flow *ParsedCmds, env *Env) *ExecutingFlow {
@@ -47,8 +50,9 @@ func NewExecutingFlow(path string, flow *ParsedCmds, env *Env) *ExecutingFlow {
 	}
 
 	executing := &ExecutingFlow{
-		path:  path,
-		level: 0,
+		path:   path,
+		level:  0,
+		format: NormalizeStatusFormat(env.GetRaw("sys.session.status-format")),
 	}
 	executing.onFlowStart(flow, env)
 	return executing
@@ -59,17 +63,16 @@ func (self *ExecutingFlow) onFlowStart(flow *ParsedCmds, env *Env) {
 		return
 	}
 
-	buf := bytes.NewBuffer(nil)
-
 	trivialMark := env.GetRaw("strs.trivial-mark")
 	cmdPathSep := env.GetRaw("strs.cmd-path-sep")
 	flowStr, _ := SaveFlowToStr(flow, cmdPathSep, trivialMark, env)
-	buf.Write([]byte(markedContent("flow", 0, flowStr)))
-
-	now := time.Now().Format(SessionTimeFormat)
-	buf.Write([]byte(markedOneLineContent("flow-start-time", self.level, now)))
 
-	writeStatusContent(self.path, buf.String())
+	self.write(StatusEvent{
+		Event: StatusEventFlowStart,
+		Level: self.level,
+		Ts:    time.Now().Format(SessionTimeFormat),
+		Flow:  flowStr,
+	})
 }
 
 func (self *ExecutingFlow) OnCmdStart(flow *ParsedCmds, index int, env *Env, logFilePath string) {
@@ -77,22 +80,14 @@ func (self *ExecutingFlow) OnCmdStart(flow *ParsedCmds, index int, env *Env, log
 		return
 	}
 
-	buf := bytes.NewBuffer(nil)
-
 	cmdPathSep := env.GetRaw("strs.cmd-path-sep")
-	cmdName := strings.Join(flow.Cmds[index].Path(), cmdPathSep)
-	buf.Write([]byte(markedOneLineContent("cmd", self.level, cmdName)))
-
-	now := time.Now().Format(SessionTimeFormat)
-	buf.Write([]byte(markedOneLineContent("cmd-start-time", self.level, now)))
-
-	if len(logFilePath) != 0 {
-		buf.Write([]byte(markedOneLineContent("log", self.level, logFilePath)))
-	}
-
-	writeCmdEnv(buf, env, "env-start", self.level)
-
-	writeStatusContent(self.path, buf.String())
+	self.write(StatusEvent{
+		Event: StatusEventCmdStart,
+		Level: self.level,
+		Ts:    time.Now().Format(SessionTimeFormat),
+		Cmd:   strings.Join(flow.Cmds[index].Path(), cmdPathSep),
+		Log:   logFilePath,
+	}, newEnvStatusEvent(env, StatusEnvPhaseStart, self.level))
 }
 
 func (self *ExecutingFlow) OnAsyncTaskSchedule(flow *ParsedCmds, index int, env *Env, tid string) {
@@ -100,33 +95,23 @@ func (self *ExecutingFlow) OnAsyncTaskSchedule(flow *ParsedCmds, index int, env
 		return
 	}
 
-	buf := bytes.NewBuffer(nil)
-
 	cmdPathSep := env.GetRaw("strs.cmd-path-sep")
-	cmdName := strings.Join(flow.Cmds[index].Path(), cmdPathSep)
-	buf.Write([]byte(markedOneLineContent("cmd", self.level, cmdName)))
-
-	now := time.Now().Format(SessionTimeFormat)
-	buf.Write([]byte(markedOneLineContent("cmd-start-time", self.level, now)))
-
-	buf.Write([]byte(markedOneLineContent("scheduled", self.level, tid)))
-
-	writeStatusContent(self.path, buf.String())
+	self.write(StatusEvent{
+		Event: StatusEventAsyncSchedule,
+		Level: self.level,
+		Ts:    time.Now().Format(SessionTimeFormat),
+		Cmd:   strings.Join(flow.Cmds[index].Path(), cmdPathSep),
+		Tid:   tid,
+	})
 }
 
 func (self *ExecutingFlow) OnCmdFinish(flow *ParsedCmds, index int, env *Env, succeeded bool, err error, skipped bool) {
+	self.syncSessionTags(env)
 	if env.GetBool("sys.unlog-status") {
 		return
 	}
 
-	buf := bytes.NewBuffer(nil)
-
-	writeCmdEnv(buf, env, "env-finish", self.level)
-
 	result := ExecutedResultError
-	now := time.Now().Format(SessionTimeFormat)
-	buf.Write([]byte(markedOneLineContent("cmd-finish-time", self.level, now)))
-
 	if succeeded {
 		if skipped {
 			result = ExecutedResultSkipped
@@ -134,14 +119,17 @@ func (self *ExecutingFlow) OnCmdFinish(flow *ParsedCmds, index int, env *Env, su
 			result = ExecutedResultSucceeded
 		}
 	}
-	buf.Write([]byte(markedOneLineContent("cmd-result", self.level, string(result))))
-
+	finish := StatusEvent{
+		Event:  StatusEventCmdFinish,
+		Level:  self.level,
+		Ts:     time.Now().Format(SessionTimeFormat),
+		Result: string(result),
+	}
 	if err != nil {
-		errLines := strings.Split(err.Error(), "\n")
-		buf.Write([]byte(markedContent("error", self.level, errLines...)))
+		finish.Error = strings.Split(err.Error(), "\n")
 	}
 
-	writeStatusContent(self.path, buf.String())
+	self.write(newEnvStatusEvent(env, StatusEnvPhaseFinish, self.level), finish)
 }
 
 func (self *ExecutingFlow) OnSubFlowStart(env *Env, flow string) {
@@ -149,16 +137,14 @@ func (self *ExecutingFlow) OnSubFlowStart(env *Env, flow string) {
 		return
 	}
 
-	content := markStartStr("subflow", self.level) + "\n"
-
 	self.level += 1
 
-	content += markedContent("flow", self.level, flow)
-
-	now := time.Now().Format(SessionTimeFormat)
-	content += markedOneLineContent("flow-start-time", self.level, now)
-
-	writeStatusContent(self.path, content)
+	self.write(StatusEvent{
+		Event: StatusEventSubFlowStart,
+		Level: self.level,
+		Ts:    time.Now().Format(SessionTimeFormat),
+		Flow:  flow,
+	})
 }
 
 func (self *ExecutingFlow) OnSubFlowFinish(env *Env, succeeded bool, skipped bool) {
@@ -166,11 +152,6 @@ func (self *ExecutingFlow) OnSubFlowFinish(env *Env, succeeded bool, skipped boo
 		return
 	}
 
-	buf := bytes.NewBuffer(nil)
-
-	now := time.Now().Format(SessionTimeFormat)
-	buf.Write([]byte(markedOneLineContent("flow-finish-time", self.level, now)))
-
 	result := ExecutedResultError
 	if succeeded {
 		if skipped {
@@ -180,34 +161,62 @@ func (self *ExecutingFlow) OnSubFlowFinish(env *Env, succeeded bool, skipped boo
 		}
 	}
 
-	buf.Write([]byte(markedOneLineContent("flow-result", self.level, string(result))))
+	self.write(StatusEvent{
+		Event:  StatusEventSubFlowFinish,
+		Level:  self.level,
+		Ts:     time.Now().Format(SessionTimeFormat),
+		Result: string(result),
+	})
 
 	self.level -= 1
-	buf.Write([]byte(markFinishStr("subflow", self.level) + "\n"))
-
-	writeStatusContent(self.path, buf.String())
 }
 
 func (self *ExecutingFlow) OnFlowFinish(env *Env, succeeded bool) {
+	self.syncSessionTags(env)
 	if env.GetBool("sys.unlog-status") {
 		return
 	}
 
-	buf := bytes.NewBuffer(nil)
-
-	now := time.Now().Format(SessionTimeFormat)
-	buf.Write([]byte(markedOneLineContent("flow-finish-time", self.level, now)))
-
 	result := ExecutedResultError
 	if succeeded {
 		result = ExecutedResultSucceeded
 	}
-	buf.Write([]byte(markedOneLineContent("flow-result", self.level, string(result))))
 
-	writeStatusContent(self.path, buf.String())
+	self.write(StatusEvent{
+		Event:  StatusEventFlowFinish,
+		Level:  self.level,
+		Ts:     time.Now().Format(SessionTimeFormat),
+		Result: string(result),
+	})
 }
 
-func writeCmdEnv(w io.Writer, env *Env, mark string, level int) {
+// syncSessionTags saves the tags added by the flow (in env 'session.tags') to the session meta
+func (self *ExecutingFlow) syncSessionTags(env *Env) {
+	tags := env.GetRaw("session.tags")
+	if tags == self.tags {
+		return
+	}
+	self.tags = tags
+	id := env.GetRaw("sys.session.id")
+	if len(id) == 0 {
+		return
+	}
+	// Tagging is best-effort, same as status writing
+	_, _ = AddSessionTags(env, id, ParseSessionTags(tags)...)
+}
+
+func (self *ExecutingFlow) write(events ...StatusEvent) {
+	buf := bytes.NewBuffer(nil)
+	for _, event := range events {
+		writeStatusEvent(buf, event, self.format)
+	}
+	if buf.Len() != 0 {
+		writeStatusContent(self.path, buf.String())
+	}
+}
+
+// statusEnvKvs returns the env kvs need to be recorded in status file
+func statusEnvKvs(env *Env) map[string]string {
 	envPathSep := env.GetRaw("strs.env-path-sep")
 	// TODO: put these into config or env.key's prop
 	filterPrefixs := []string{
@@ -216,8 +225,14 @@ func writeCmdEnv(w io.Writer, env *Env, mark string, level int) {
 		"display" + envPathSep,
 		"sys" + envPathSep,
 	}
+	return env.Flatten(false, filterPrefixs, true)
+}
+
+func writeCmdEnv(w io.Writer, env *Env, mark string, level int) {
+	writeEnvKvs(w, statusEnvKvs(env), mark, level)
+}
 
-	kvs := env.Flatten(false, filterPrefixs, true)
+func writeEnvKvs(w io.Writer, kvs map[string]string, mark string, level int) {
 	buf := bytes.NewBuffer(nil)
 	indent := strings.Repeat(StatusFileIndent, level)
 	for k, v := range kvs {
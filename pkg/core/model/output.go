@@ -3,6 +3,7 @@ package model
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // TextFormatter is an optional interface that types can implement
@@ -72,3 +73,27 @@ func OutputError(cc *Cli, env *Env, errType string, err error, detail map[string
 	_ = cc.Screen.Error(string(b) + "\n")
 	return true
 }
+
+// FormatTextTable aligns the cells by columns, the first row is usually the header
+func FormatTextTable(rows [][]string) string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+	var buf strings.Builder
+	for _, row := range rows {
+		var cells []string
+		for i, cell := range row {
+			cells = append(cells, cell+strings.Repeat(" ", widths[i]-len(cell)))
+		}
+		buf.WriteString(strings.TrimRight(strings.Join(cells, "  "), " ") + "\n")
+	}
+	return buf.String()
+}
@@ -16,6 +16,9 @@ import (
 
 type CliParser interface {
 	Parse(cmds *CmdTree, envAbbrs *EnvAbbrs, input ...string) *ParsedCmds
+	SetPrefixMatch(enabled bool)
+	// MountFlow adds the mount path to the cmds in the flow which are defined under the mount path
+	MountFlow(cmds *CmdTree, mountPath []string, flow []string) []string
 }
 
 type ParsedCmds struct {
@@ -90,6 +93,11 @@ type ParseResult struct {
 	Input      []string
 	Error      error
 	IsMinorErr bool
+
+	// The origin command line and the position of the offending char in it,
+	// ErrPos is meaningless if Line is empty
+	Line   string
+	ErrPos int
 }
 
 func (self ParseResult) Clone() ParseResult {
@@ -100,7 +108,23 @@ func (self ParseResult) Clone() ParseResult {
 		// TODO: clone error?
 		self.Error,
 		self.IsMinorErr,
+		self.Line,
+		self.ErrPos,
+	}
+}
+
+// ErrCaret returns the origin line and a line with a caret under the offending char
+func (self ParseResult) ErrCaret() (line string, caret string, ok bool) {
+	if len(self.Line) == 0 || self.ErrPos < 0 || self.ErrPos > len(self.Line) {
+		return
 	}
+	prefix := []rune(self.Line[:self.ErrPos])
+	for i, c := range prefix {
+		if c != '\t' {
+			prefix[i] = ' '
+		}
+	}
+	return self.Line, string(prefix) + "^", true
 }
 
 type ParsedCmd struct {
@@ -123,6 +147,26 @@ func (self ParsedCmd) Clone() ParsedCmd {
 	}
 }
 
+// WithoutSysArg returns a copy without the specified sys arg, eg: `%detach`,
+// the env of segments are copied, so the original cmd is not affected
+func (self ParsedCmd) WithoutSysArg(name string) ParsedCmd {
+	cmd := self.Clone()
+	for i, seg := range cmd.Segments {
+		if seg.Env == nil {
+			continue
+		}
+		env := ParsedEnv{}
+		for k, v := range seg.Env {
+			if v.IsSysArg && len(v.MatchedPath) != 0 && v.MatchedPath[len(v.MatchedPath)-1] == name {
+				continue
+			}
+			env[k] = v
+		}
+		cmd.Segments[i].Env = env
+	}
+	return cmd
+}
+
 func (self ParsedCmd) IsEmpty() bool {
 	return len(self.Segments) == 0
 }
@@ -498,3 +542,11 @@ type ParseErrEnv struct {
 func (self ParseErrEnv) Error() string {
 	return self.Origin.Error()
 }
+
+type ParseErrQuote struct {
+	Origin error
+}
+
+func (self ParseErrQuote) Error() string {
+	return self.Origin.Error()
+}
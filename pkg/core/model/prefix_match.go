@@ -0,0 +1,85 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Unambiguous-prefix matching for sub commands, args and env key segments.
+// An exact name or declared abbr is always prior to prefix matching.
+
+type ErrAmbiguousPrefix struct {
+	Prefix     string
+	Owner      string
+	Candidates []string
+}
+
+func (self ErrAmbiguousPrefix) Error() string {
+	return fmt.Sprintf("ambiguous prefix '%s' under [%s], did you mean one of: %s",
+		self.Prefix, self.Owner, strings.Join(self.Candidates, ", "))
+}
+
+// matchPrefix returns the realname of the input, the input could be a name, an abbr or a prefix of them.
+// The candidates (sorted realnames) are returned if the prefix is ambiguous.
+func matchPrefix(input string, revIdx map[string]string, skip func(realname string) bool) (
+	realname string, candidates []string) {
+
+	if name, ok := revIdx[input]; ok {
+		return name, nil
+	}
+	if len(input) == 0 {
+		return
+	}
+	found := map[string]bool{}
+	for abbr, name := range revIdx {
+		if found[name] || !strings.HasPrefix(abbr, input) {
+			continue
+		}
+		if skip != nil && skip(name) {
+			continue
+		}
+		found[name] = true
+		candidates = append(candidates, name)
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	sort.Strings(candidates)
+	return "", candidates
+}
+
+// MatchSubPrefix is like 'GetSub' with one path segment, but also accepts an unambiguous prefix,
+// hidden sub commands could only be matched by names or abbrs
+func (self *CmdTree) MatchSubPrefix(prefix string) (sub *CmdTree, err error) {
+	realname, candidates := matchPrefix(prefix, self.subAbbrsRevIdx, func(name string) bool {
+		return self.subs[name].IsHidden()
+	})
+	if len(realname) != 0 {
+		return self.subs[realname], nil
+	}
+	if len(candidates) != 0 {
+		err = ErrAmbiguousPrefix{prefix, self.DisplayPath(), candidates}
+	}
+	return
+}
+
+// MatchPrefix is like 'Realname', but also accepts an unambiguous prefix
+func (self *Args) MatchPrefix(owner *CmdTree, prefix string) (realname string, err error) {
+	realname, candidates := matchPrefix(prefix, self.abbrsRevIdx, nil)
+	if len(candidates) != 0 {
+		err = ErrAmbiguousPrefix{prefix, owner.DisplayPath(), candidates}
+	}
+	return
+}
+
+func (self *EnvAbbrs) matchSubPrefix(prefix string) (sub *EnvAbbrs, err error) {
+	realname, candidates := matchPrefix(prefix, self.subAbbrsRevIdx, nil)
+	if len(realname) != 0 {
+		return self.subs[realname], nil
+	}
+	if len(candidates) != 0 {
+		err = ErrAmbiguousPrefix{prefix, self.DisplayPath(), candidates}
+	}
+	return
+}
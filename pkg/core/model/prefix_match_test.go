@@ -0,0 +1,113 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestCmdTreeMatchSubPrefix(t *testing.T) {
+	root := NewCmdTree(CmdTreeStrsForTest())
+	root.AddSub("deploy", "dp")
+	root.AddSub("describe")
+	root.AddSub("destroy").SetHidden()
+	root.AddSub("status", "st")
+
+	test := func(prefix string, expected string, ambiguous bool) {
+		sub, err := root.MatchSubPrefix(prefix)
+		if ambiguous {
+			if _, ok := err.(ErrAmbiguousPrefix); !ok {
+				t.Fatalf("'%s': expected ambiguous error, got %v", prefix, err)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("'%s': unexpected error: %v", prefix, err)
+		}
+		name := ""
+		if sub != nil {
+			name = sub.Name()
+		}
+		if name != expected {
+			t.Fatalf("'%s': expected '%s', got '%s'", prefix, expected, name)
+		}
+	}
+
+	test("deploy", "deploy", false)
+	test("dp", "deploy", false)
+	test("depl", "deploy", false)
+	test("desc", "describe", false)
+	test("de", "", true)
+	test("d", "", true)
+	test("sta", "status", false)
+	test("destroy", "destroy", false)
+	test("dest", "", false)
+	test("x", "", false)
+
+	_, err := root.MatchSubPrefix("de")
+	candidates := err.(ErrAmbiguousPrefix).Candidates
+	if len(candidates) != 2 || candidates[0] != "deploy" || candidates[1] != "describe" {
+		t.Fatalf("unexpected candidates %v", candidates)
+	}
+}
+
+func TestArgsMatchPrefix(t *testing.T) {
+	root := NewCmdTree(CmdTreeStrsForTest())
+	cmd := root.AddSub("cmd").RegEmptyCmd("test")
+	cmd.AddArg("host", "", "h").AddArg("hops", "").AddArg("port", "")
+	args := cmd.Args()
+
+	test := func(prefix string, expected string, ambiguous bool) {
+		realname, err := args.MatchPrefix(cmd.Owner(), prefix)
+		if (err != nil) != ambiguous {
+			t.Fatalf("'%s': unexpected error %v", prefix, err)
+		}
+		if realname != expected {
+			t.Fatalf("'%s': expected '%s', got '%s'", prefix, expected, realname)
+		}
+	}
+
+	test("h", "host", false)
+	test("ho", "", true)
+	test("hos", "host", false)
+	test("hop", "hops", false)
+	test("p", "port", false)
+	test("x", "", false)
+}
+
+func TestEnvAbbrsTryMatchEx(t *testing.T) {
+	root := NewEnvAbbrs("<root>")
+	disp := root.AddSub("display", "disp")
+	disp.AddSub("width", "w")
+	disp.AddSub("with-color")
+	root.AddSub("sys")
+
+	test := func(path string, prefixMatch bool, expected string, matched bool, ambiguous bool) {
+		matchedPath, ok, err := root.TryMatchEx(path, ".", prefixMatch)
+		if (err != nil) != ambiguous {
+			t.Fatalf("'%s': unexpected error %v", path, err)
+		}
+		if ok != matched {
+			t.Fatalf("'%s': expected matched=%v, got %v", path, matched, ok)
+		}
+		if matched && joinPath(matchedPath) != expected {
+			t.Fatalf("'%s': expected '%s', got '%s'", path, expected, joinPath(matchedPath))
+		}
+	}
+
+	test("disp.w", false, "display.width", true, false)
+	test("dis.wid", false, "", false, false)
+	test("dis.wid", true, "display.width", true, false)
+	test("dis.wi", true, "", false, true)
+	test("sy", true, "sys", true, false)
+	test("x.y", true, "", false, false)
+}
+
+func joinPath(path []string) string {
+	res := ""
+	for i, it := range path {
+		if i != 0 {
+			res += "."
+		}
+		res += it
+	}
+	return res
+}
@@ -7,9 +7,10 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 
+	"github.com/innerr/ticat/pkg/core/filter"
 	"github.com/innerr/ticat/pkg/utils"
 )
 
@@ -20,13 +21,27 @@ type SessionStatus struct {
 	Running  bool
 	Cleaning bool
 	Status   *ExecutedFlow
+	Meta     SessionMeta
+	// Imported sessions are in the imported area (by 'sessions.import'), they are read-only and never running
+	Imported bool
 }
 
 func (self SessionStatus) SessionId() string {
 	return self.DirName
 }
 
-// TODO: use iterator to avoid extra parsing?
+// SessionsRoot returns the root dir of local sessions or imported sessions
+func SessionsRoot(env *Env, imported bool) string {
+	if imported {
+		return env.GetRaw("sys.paths.sessions.imported")
+	}
+	return env.GetRaw("sys.paths.sessions")
+}
+
+func (self SessionStatus) Dir(env *Env) string {
+	return filepath.Join(SessionsRoot(env, self.Imported), self.DirName)
+}
+
 func ListSessions(
 	env *Env,
 	findStrs []string,
@@ -36,6 +51,20 @@ func ListSessions(
 	includeDone bool,
 	includeRunning bool) (sessions []SessionStatus, total int) {
 
+	return ListSessionsByQuery(env, filter.NewWordsQuery(findStrs), mustMatchDirName, cntLimit,
+		includeError, includeDone, includeRunning)
+}
+
+// ListSessionsByQuery lists sessions matched the query, the index is used to avoid parsing every status file
+func ListSessionsByQuery(
+	env *Env,
+	query *filter.Query,
+	mustMatchDirName string,
+	cntLimit int,
+	includeError bool,
+	includeDone bool,
+	includeRunning bool) (sessions []SessionStatus, total int) {
+
 	sessionsRoot := env.GetRaw("sys.paths.sessions")
 	if len(sessionsRoot) == 0 {
 		// PANIC: Programming error - sessions root path not configured
@@ -47,49 +76,111 @@ func ListSessions(
 		// PANIC: Runtime error - cannot read sessions directory
 		panic(fmt.Sprintf("[ListSessions] can't read sessions' root path '%s'\n", sessionsRoot))
 	}
-	dirs := make([]string, len(entrys))
-	for i, it := range entrys {
-		dirs[i] = it.Name()
+	sessions, total = listSessionsInRoot(env, sessionsRoot, entrys, false, query, mustMatchDirName, cntLimit,
+		includeError, includeDone, includeRunning)
+
+	// The imported sessions are only listed here when it's specified by id, they are never the 'last session'
+	if len(sessions) == 0 && len(mustMatchDirName) != 0 {
+		sessions, _ = ListImportedSessionsByQuery(env, query, mustMatchDirName, cntLimit)
+	}
+	return
+}
+
+func ListImportedSessions(
+	env *Env,
+	findStrs []string,
+	mustMatchDirName string,
+	cntLimit int) (sessions []SessionStatus, total int) {
+
+	return ListImportedSessionsByQuery(env, filter.NewWordsQuery(findStrs), mustMatchDirName, cntLimit)
+}
+
+func ListImportedSessionsByQuery(
+	env *Env,
+	query *filter.Query,
+	mustMatchDirName string,
+	cntLimit int) (sessions []SessionStatus, total int) {
+
+	importedRoot := SessionsRoot(env, true)
+	if len(importedRoot) == 0 {
+		return
+	}
+	entrys, err := os.ReadDir(importedRoot)
+	if err != nil {
+		return
+	}
+	return listSessionsInRoot(env, importedRoot, entrys, true, query, mustMatchDirName, cntLimit,
+		true, true, false)
+}
+
+func listSessionsInRoot(
+	env *Env,
+	sessionsRoot string,
+	entrys []os.DirEntry,
+	imported bool,
+	query *filter.Query,
+	mustMatchDirName string,
+	cntLimit int,
+	includeError bool,
+	includeDone bool,
+	includeRunning bool) (sessions []SessionStatus, total int) {
+
+	var dirs []string
+	for _, it := range entrys {
+		if _, _, ok := parseSessionDirName(it.Name()); ok {
+			dirs = append(dirs, it.Name())
+		}
 	}
 	total = len(dirs)
 	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
 
-	keepDur := env.GetDur("sys.sessions.keep-status-duration")
+	retention, _ := GetSessionsRetention(env)
 	statusFileName := env.GetRaw("strs.session-status-file")
+	metaFileName := env.GetRaw("strs.session-meta-file")
+
+	index := LoadSessionIndex(sessionsRoot)
+	defer index.Save()
+	index.Prune(dirs)
 
 	now := time.Now()
 	cnt := 0
 
 	for _, dir := range dirs {
-		oldSessionPid, oldSessionStartTs, ok := parseSessionDirName(dir)
-		if !ok {
+		oldSessionPid, oldSessionStartTs, _ := parseSessionDirName(dir)
+
+		if len(mustMatchDirName) != 0 && dir != mustMatchDirName {
 			continue
 		}
 
-		if len(mustMatchDirName) != 0 && dir != mustMatchDirName {
+		running := !imported && utils.IsPidRunning(oldSessionPid)
+		if running && !includeRunning {
 			continue
 		}
 
-		status := SafeParseExecutedFlow(ExecutedStatusFilePath{sessionsRoot, dir, statusFileName})
+		statusPath := ExecutedStatusFilePath{sessionsRoot, dir, statusFileName}
+		entry, status := index.Lookup(statusPath, running)
 		// TODO: better error handling
-		if status == nil {
+		if entry == nil {
 			continue
 		}
 
-		if !status.MatchFind(findStrs) {
-			continue
+		if !running {
+			if entry.Result == ExecutedResultSucceeded && !includeDone {
+				continue
+			}
+			if (entry.Result == ExecutedResultIncompleted || entry.Result == ExecutedResultError) && !includeError {
+				continue
+			}
 		}
 
-		running := utils.IsPidRunning(oldSessionPid)
-		if running && !includeRunning {
+		meta := loadSessionMetaFile(filepath.Join(sessionsRoot, dir, metaFileName))
+		if !query.Match(sessionRecord{dir, entry, running, meta, now}) {
 			continue
 		}
 
-		if !running {
-			if status.Result == ExecutedResultSucceeded && !includeDone {
-				continue
-			}
-			if (status.Result == ExecutedResultIncompleted || status.Result == ExecutedResultError) && !includeError {
+		if status == nil {
+			status = SafeParseExecutedFlow(statusPath)
+			if status == nil {
 				continue
 			}
 		}
@@ -98,8 +189,9 @@ func ListSessions(
 			status.FinishTs = time.Now()
 		}
 
-		cleaning := oldSessionStartTs.Add(keepDur).Before(now)
-		session := SessionStatus{dir, oldSessionPid, oldSessionStartTs, running, cleaning, status}
+		cleaning := !imported && !running && !IsSessionProtected(meta) &&
+			retention.IsExpired(oldSessionStartTs, status.Result != ExecutedResultSucceeded, now)
+		session := SessionStatus{dir, oldSessionPid, oldSessionStartTs, running, cleaning, status, meta, imported}
 		sessions = append([]SessionStatus{session}, sessions...)
 		cnt += 1
 		if cntLimit > 0 && cnt >= cntLimit {
@@ -148,6 +240,10 @@ func CleanSession(session SessionStatus, env *Env, force bool) (cleaned bool, ru
 		panic(fmt.Errorf("[CleanSession] can't get sessions' root path"))
 	}
 
+	if session.Imported {
+		return false, false
+	}
+
 	running = utils.IsPidRunning(session.Pid)
 	if running && !force {
 		return false, running
@@ -189,45 +285,19 @@ func SessionInit(cc *Cli, flow *ParsedCmds, env *Env, sessionFileName string,
 		return nil, true, true
 	}
 
-	keepDur := env.GetDur("sys.sessions.keep-status-duration")
-
 	if err := os.MkdirAll(sessionsRoot, os.ModePerm); err != nil {
 		_ = cc.Screen.Print(fmt.Sprintf("[sessionInit] can't create sessions root path '%s': %v\n",
 			sessionsRoot, err))
 		return nil, false, false
 	}
-	dirs, err := os.ReadDir(sessionsRoot)
-	if err != nil {
-		_ = cc.Screen.Print(fmt.Sprintf("[sessionInit] can't read sessions' root path '%s'\n",
-			sessionsRoot))
-		return nil, false, false
-	}
 
 	_, now, id := GenSessionId()
 	dirName := id
 
-	// TODO: move this cleaning code to another function
-	for _, dir := range dirs {
-		oldSessionPid, oldSessionStartTs, ok := parseSessionDirName(dir.Name())
-		if !ok {
-			// TODO: print a warning msg
-			continue
-		}
-		err = syscall.Kill(oldSessionPid, syscall.Signal(0))
-		if !(err != nil && err == syscall.ESRCH) {
-			continue
-		}
-		added := oldSessionStartTs.Add(keepDur)
-		if added.Before(now) {
-			if err := os.RemoveAll(filepath.Join(sessionsRoot, dir.Name())); err != nil {
-				_ = cc.Screen.Print(fmt.Sprintf("[sessionInit] can't remove old session '%s': %v\n",
-					dir.Name(), err))
-			}
-		}
-	}
+	gcSessionsOnInit(cc, env, now)
 
 	sessionDir = filepath.Join(sessionsRoot, dirName)
-	err = os.MkdirAll(sessionDir, os.ModePerm)
+	err := os.MkdirAll(sessionDir, os.ModePerm)
 	if err != nil && !os.IsExist(err) {
 		_ = cc.Screen.Print(fmt.Sprintf("[sessionInit] can't create session dir '%s'\n",
 			sessionDir))
@@ -243,6 +313,61 @@ func SessionInit(cc *Cli, flow *ParsedCmds, env *Env, sessionFileName string,
 	return NewExecutingFlow(statusPath, flow, env), false, true
 }
 
+// The background sessions GC is silent (not mixing with the cmd outputs), the error is reported in WaitSessionsGC
+var bgSessionsGC = struct {
+	running sync.Mutex
+	wait    sync.WaitGroup
+	err     error
+}{}
+
+// gcSessionsOnInit removes the sessions out of the retention policies, in a background goroutine by default
+func gcSessionsOnInit(cc *Cli, env *Env, now time.Time) {
+	gc, err := NewSessionsGC(env)
+	if err != nil {
+		_ = cc.Screen.Print(fmt.Sprintf("[sessionInit] %v\n", err))
+		return
+	}
+	run := func() error {
+		items, err := gc.Plan(now)
+		if err == nil {
+			_, err = gc.Run(items)
+		}
+		return err
+	}
+	if !env.GetBool("sys.sessions.gc.background") {
+		if err := run(); err != nil {
+			_ = cc.Screen.Print(fmt.Sprintf("[sessionInit] %v\n", err))
+		}
+		return
+	}
+	// Skip if the previous one (eg: in interactive mode) is still running
+	if !bgSessionsGC.running.TryLock() {
+		return
+	}
+	bgSessionsGC.wait.Add(1)
+	go func() {
+		defer bgSessionsGC.wait.Done()
+		defer bgSessionsGC.running.Unlock()
+		if err := run(); err != nil {
+			bgSessionsGC.err = err
+		}
+	}()
+}
+
+// WaitSessionsGC waits for the background sessions GC and returns its error, should be called before exiting.
+// A session dir is renamed before removing, so it's still safe if the process exits in the middle of GC.
+func WaitSessionsGC() error {
+	bgSessionsGC.wait.Wait()
+	bgSessionsGC.running.Lock()
+	defer bgSessionsGC.running.Unlock()
+	err := bgSessionsGC.err
+	bgSessionsGC.err = nil
+	if err != nil {
+		return fmt.Errorf("[sessionInit] %v", err)
+	}
+	return nil
+}
+
 // TODO: clean it
 // Seems not very useful, no user now.
 /*
@@ -0,0 +1,455 @@
+package model
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A session archive is a tar.gz file with only one top dir (named by the session id),
+// it contains all files in the session dir (status, env, meta, logs, bg-task subdirs),
+// and a manifest describing where it's from and the commands it ran.
+
+const SessionArchiveManifestFile = "export-manifest.json"
+
+type SessionArchiveManifest struct {
+	SessionId string `json:"session-id"`
+	// The origin path of the session dir, use for relocating the paths recorded in status files
+	SessionDir   string              `json:"session-dir"`
+	ExportedAt   string              `json:"exported-at"`
+	Host         string              `json:"host"`
+	TicatVersion string              `json:"ticat-version"`
+	Redacted     bool                `json:"redacted"`
+	Cmds         []SessionArchiveCmd `json:"cmds"`
+}
+
+type SessionArchiveCmd struct {
+	Cmd      string   `json:"cmd"`
+	Type     string   `json:"type"`
+	Source   string   `json:"source,omitempty"`
+	Version  string   `json:"version,omitempty"`
+	MetaFile string   `json:"meta-file,omitempty"`
+	Flow     []string `json:"flow,omitempty"`
+}
+
+// SessionRedactor returns true if the value of the key should be redacted
+type SessionRedactor func(key string, val string) bool
+
+const SessionRedactedVal = "***"
+
+func ExportSession(env *Env, session SessionStatus, w io.Writer,
+	manifest SessionArchiveManifest, redactor SessionRedactor) error {
+
+	sessionDir := session.Dir(env)
+	statusFileName := env.GetRaw("strs.session-status-file")
+	envFileName := env.GetRaw("strs.session-env-file")
+
+	manifest.SessionId = session.DirName
+	manifest.SessionDir = sessionDir
+	manifest.ExportedAt = time.Now().Format(SessionTimeFormat)
+	manifest.Redacted = redactor != nil
+	manifestData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return fmt.Errorf("[ExportSession] encode manifest failed: %v", err)
+	}
+
+	// The sensitive values may also be printed in the cmd logs, collect them before packing
+	var secrets []string
+	if redactor != nil {
+		secrets, err = collectSessionSecrets(sessionDir, statusFileName, envFileName, redactor)
+		if err != nil {
+			return fmt.Errorf("[ExportSession] scan session dir '%s' failed: %v", sessionDir, err)
+		}
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err = filepath.Walk(sessionDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sessionDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(session.DirName, rel))
+		if info.IsDir() {
+			return tw.WriteHeader(&tar.Header{Name: name + "/", Mode: 0755, ModTime: info.ModTime(), Typeflag: tar.TypeDir})
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if redactor != nil {
+			switch filepath.Base(path) {
+			case statusFileName:
+				data = []byte(RedactStatusContent(string(data), redactor))
+			case envFileName:
+				data = []byte(RedactEnvContent(string(data), redactor))
+			default:
+				data = []byte(RedactLogContent(string(data), redactor, secrets))
+			}
+		}
+		return writeTarFile(tw, name, data, info.ModTime())
+	})
+	if err != nil {
+		return fmt.Errorf("[ExportSession] pack session dir '%s' failed: %v", sessionDir, err)
+	}
+
+	err = writeTarFile(tw, session.DirName+"/"+SessionArchiveManifestFile, manifestData, time.Now())
+	if err != nil {
+		return fmt.Errorf("[ExportSession] write manifest failed: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("[ExportSession] close tar writer failed: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		return fmt.Errorf("[ExportSession] close gzip writer failed: %v", err)
+	}
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// ImportSession unpacks a session archive into the imported area, the files are set to read-only
+func ImportSession(env *Env, r io.Reader, origin string, force bool) (
+	dirName string, manifest SessionArchiveManifest, err error) {
+
+	importedRoot := SessionsRoot(env, true)
+	if len(importedRoot) == 0 {
+		return "", manifest, fmt.Errorf("[ImportSession] can't get imported sessions' root path")
+	}
+	if err = os.MkdirAll(importedRoot, os.ModePerm); err != nil {
+		return "", manifest, fmt.Errorf("[ImportSession] create imported sessions' root path '%s' failed: %v", importedRoot, err)
+	}
+
+	tmpDir, err := os.MkdirTemp(importedRoot, ".importing-")
+	if err != nil {
+		return "", manifest, fmt.Errorf("[ImportSession] create tmp dir failed: %v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	dirName, err = extractSessionArchive(r, tmpDir)
+	if err != nil {
+		return "", manifest, err
+	}
+	extracted := filepath.Join(tmpDir, dirName)
+
+	manifestPath := filepath.Join(extracted, SessionArchiveManifestFile)
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return "", manifest, fmt.Errorf("[ImportSession] read manifest failed, not a session archive? %v", err)
+	}
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return "", manifest, fmt.Errorf("[ImportSession] parse manifest failed: %v", err)
+	}
+
+	target := filepath.Join(importedRoot, dirName)
+	if err = relocateSessionPaths(env, extracted, manifest.SessionDir, target); err != nil {
+		return "", manifest, err
+	}
+	meta := loadSessionMetaFile(filepath.Join(extracted, env.GetRaw("strs.session-meta-file")))
+	meta[SessionMetaImportedFrom] = origin
+	meta[SessionMetaImportedAt] = time.Now().Format(SessionTimeFormat)
+	if err = saveSessionMetaFile(filepath.Join(extracted, env.GetRaw("strs.session-meta-file")), meta); err != nil {
+		return "", manifest, err
+	}
+
+	if _, statErr := os.Stat(target); statErr == nil {
+		if !force {
+			return "", manifest, fmt.Errorf("[ImportSession] session '%s' already imported", dirName)
+		}
+		if err = removeReadOnlyDir(target); err != nil {
+			return "", manifest, fmt.Errorf("[ImportSession] remove old imported session '%s' failed: %v", dirName, err)
+		}
+	}
+	if err = os.Rename(extracted, target); err != nil {
+		return "", manifest, fmt.Errorf("[ImportSession] move session to '%s' failed: %v", target, err)
+	}
+	setReadOnly(target)
+	return dirName, manifest, nil
+}
+
+func extractSessionArchive(r io.Reader, dest string) (dirName string, err error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return "", fmt.Errorf("[ImportSession] open gzip stream failed: %v", err)
+	}
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("[ImportSession] read archive failed: %v", err)
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("[ImportSession] bad path '%s' in archive", header.Name)
+		}
+		top := strings.SplitN(name, string(filepath.Separator), 2)[0]
+		if len(dirName) == 0 {
+			if _, _, ok := parseSessionDirName(top); !ok {
+				return "", fmt.Errorf("[ImportSession] bad session dir '%s' in archive", top)
+			}
+			dirName = top
+		} else if top != dirName {
+			return "", fmt.Errorf("[ImportSession] more than one session dir in archive: '%s', '%s'", dirName, top)
+		}
+
+		path := filepath.Join(dest, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return "", err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return "", err
+			}
+			file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				return "", err
+			}
+			_, err = io.Copy(file, tr)
+			closeErr := file.Close()
+			if err != nil {
+				return "", err
+			}
+			if closeErr != nil {
+				return "", closeErr
+			}
+		default:
+			// Skip links and other special files
+		}
+	}
+	if len(dirName) == 0 {
+		return "", fmt.Errorf("[ImportSession] empty archive")
+	}
+	return dirName, nil
+}
+
+// relocateSessionPaths rewrites the paths (eg: log file paths) recorded in status files
+func relocateSessionPaths(env *Env, dir string, origin string, target string) error {
+	if len(origin) == 0 || origin == target {
+		return nil
+	}
+	statusFileName := env.GetRaw("strs.session-status-file")
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() != statusFileName {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		content := strings.ReplaceAll(string(data), origin, target)
+		return os.WriteFile(path, []byte(content), 0644)
+	})
+}
+
+func setReadOnly(dir string) {
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			_ = os.Chmod(path, 0444)
+		}
+		return nil
+	})
+}
+
+func removeReadOnlyDir(dir string) error {
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			_ = os.Chmod(path, 0644)
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
+
+// RedactStatusContent redacts the env values in a status file (any format), and the 'key=val' args in the flows
+func RedactStatusContent(content string, redactor SessionRedactor) string {
+	envMarks := map[string]bool{"env-start": true, "env-finish": true}
+	lines := strings.Split(content, "\n")
+	inEnv := false
+	for i, line := range lines {
+		trimed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimed, "{") {
+			lines[i] = redactStatusEventLine(line, redactor)
+			continue
+		}
+		if strings.HasPrefix(trimed, StatusFileMarkBracketLeft) && strings.HasSuffix(trimed, StatusFileMarkBracketRight) {
+			mark := trimed[len(StatusFileMarkBracketLeft) : len(trimed)-len(StatusFileMarkBracketRight)]
+			if envMarks[mark] {
+				inEnv = true
+				continue
+			}
+			if envMarks[strings.TrimPrefix(mark, StatusFileMarkFinishMark)] {
+				inEnv = false
+				continue
+			}
+		}
+		if inEnv {
+			lines[i] = redactKvLine(line, redactor)
+		} else {
+			lines[i] = RedactKvArgs(line, redactor)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func redactStatusEventLine(line string, redactor SessionRedactor) string {
+	var event StatusEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return RedactKvArgs(line, redactor)
+	}
+	for k, v := range event.Env {
+		if redactor(k, v) {
+			event.Env[k] = SessionRedactedVal
+		}
+	}
+	event.Flow = RedactKvArgs(event.Flow, redactor)
+	event.Cmd = RedactKvArgs(event.Cmd, redactor)
+	data, err := json.Marshal(event)
+	if err != nil {
+		return line
+	}
+	return string(data)
+}
+
+// The shorter values are not replaced in logs, or the logs will be messed up
+const minRedactedLogValLen = 4
+
+// collectSessionSecrets returns the values should be redacted in the env and status files of a session dir
+func collectSessionSecrets(sessionDir string, statusFileName string, envFileName string,
+	redactor SessionRedactor) (secrets []string, err error) {
+
+	found := map[string]bool{}
+	collector := func(key string, val string) bool {
+		if !redactor(key, val) {
+			return false
+		}
+		if len(val) >= minRedactedLogValLen {
+			found[val] = true
+		}
+		return true
+	}
+	err = filepath.Walk(sessionDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		if info.Name() != statusFileName && info.Name() != envFileName {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if info.Name() == statusFileName {
+			_ = RedactStatusContent(string(data), collector)
+		} else {
+			_ = RedactEnvContent(string(data), collector)
+		}
+		return nil
+	})
+	for val := range found {
+		secrets = append(secrets, val)
+	}
+	// Replace the longer ones first, in case a value contains another one
+	sort.Slice(secrets, func(i, j int) bool {
+		if len(secrets[i]) != len(secrets[j]) {
+			return len(secrets[i]) > len(secrets[j])
+		}
+		return secrets[i] < secrets[j]
+	})
+	return
+}
+
+// RedactLogContent redacts the 'key=val' pieces in a log file, and the sensitive values found in the session
+func RedactLogContent(content string, redactor SessionRedactor, secrets []string) string {
+	content = RedactKvArgs(content, redactor)
+	if len(secrets) == 0 {
+		return content
+	}
+	var pairs []string
+	for _, it := range secrets {
+		pairs = append(pairs, it, SessionRedactedVal)
+	}
+	return strings.NewReplacer(pairs...).Replace(content)
+}
+
+// RedactEnvContent redacts an env file, one 'key=val' per line
+func RedactEnvContent(content string, redactor SessionRedactor) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = redactKvLine(line, redactor)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func redactKvLine(line string, redactor SessionRedactor) string {
+	i := strings.Index(line, "=")
+	if i <= 0 {
+		return line
+	}
+	key := strings.TrimSpace(line[:i])
+	if redactor(key, line[i+1:]) {
+		return line[:i+1] + SessionRedactedVal
+	}
+	return line
+}
+
+var kvArgPattern = regexp.MustCompile(`([^\s{}:=]+)=([^\s{}:]*)`)
+
+// RedactKvArgs redacts the 'key=val' pieces in a flow string
+func RedactKvArgs(line string, redactor SessionRedactor) string {
+	return kvArgPattern.ReplaceAllStringFunc(line, func(kv string) string {
+		i := strings.Index(kv, "=")
+		if redactor(kv[:i], kv[i+1:]) {
+			return kv[:i+1] + SessionRedactedVal
+		}
+		return kv
+	})
+}
+
+// NewSessionRedactor redacts the builtin sensitive keys, and the ones contain any of the extra patterns
+func NewSessionRedactor(extraPatterns []string) SessionRedactor {
+	return func(key string, val string) bool {
+		if len(val) == 0 {
+			return false
+		}
+		if IsSensitiveKeyVal(key, val) {
+			return true
+		}
+		lower := strings.ToLower(key)
+		for _, it := range extraPatterns {
+			it = strings.ToLower(strings.TrimSpace(it))
+			if len(it) != 0 && strings.Contains(lower, it) {
+				return true
+			}
+		}
+		return false
+	}
+}
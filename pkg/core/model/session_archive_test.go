@@ -0,0 +1,97 @@
+package model
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactStatusContent(t *testing.T) {
+	status := strings.Join([]string{
+		"<flow>",
+		"    db.connect password=abc : dummy",
+		"</flow>",
+		"<env-start>",
+		"    db.password=abc",
+		"    db.host=127.0.0.1",
+		"</env-start>",
+	}, "\n")
+	redacted := RedactStatusContent(status, NewSessionRedactor([]string{"host"}))
+	if strings.Contains(redacted, "abc") || strings.Contains(redacted, "127.0.0.1") {
+		t.Fatalf("sensitive values not redacted:\n%s", redacted)
+	}
+	if !strings.Contains(redacted, "db.connect password=***") {
+		t.Fatalf("flow args not redacted as expected:\n%s", redacted)
+	}
+}
+
+func TestSessionArchiveRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	env := NewEnv()
+	env.Set("sys.paths.sessions", filepath.Join(root, "sessions"))
+	env.Set("sys.paths.sessions.imported", filepath.Join(root, "imported"))
+	env.Set("strs.session-status-file", "status")
+	env.Set("strs.session-env-file", "env")
+	env.Set("strs.session-meta-file", "meta")
+
+	dirName := time.Now().Format(SessionDirTimeFormat) + ".123"
+	sessionDir := filepath.Join(root, "sessions", dirName)
+	if err := os.MkdirAll(sessionDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(sessionDir, "cmd.log")
+	writes := map[string]string{
+		"status":  "<log>\n    " + logPath + "\n</log>\n",
+		"env":     "user.token=xyz123\nuser.name=ticat\n",
+		"cmd.log": "hello\nlogin by xyz123\napi.token=abcd\n",
+	}
+	for name, content := range writes {
+		if err := os.WriteFile(filepath.Join(sessionDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := bytes.NewBuffer(nil)
+	session := SessionStatus{DirName: dirName}
+	err := ExportSession(env, session, buf, SessionArchiveManifest{Host: "test"}, NewSessionRedactor([]string{"token"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, manifest, err := ImportSession(env, bytes.NewReader(buf.Bytes()), "test.tar.gz", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != dirName || manifest.Host != "test" || !manifest.Redacted {
+		t.Fatalf("unexpected import result: %s, %+v", imported, manifest)
+	}
+	importedDir := filepath.Join(root, "imported", dirName)
+
+	envData, _ := os.ReadFile(filepath.Join(importedDir, "env"))
+	if strings.Contains(string(envData), "xyz123") || !strings.Contains(string(envData), "user.name=ticat") {
+		t.Fatalf("unexpected env file:\n%s", envData)
+	}
+	logData, _ := os.ReadFile(filepath.Join(importedDir, "cmd.log"))
+	if strings.Contains(string(logData), "xyz123") || strings.Contains(string(logData), "abcd") ||
+		!strings.Contains(string(logData), "hello") {
+		t.Fatalf("unexpected log file:\n%s", logData)
+	}
+	statusData, _ := os.ReadFile(filepath.Join(importedDir, "status"))
+	if !strings.Contains(string(statusData), filepath.Join(importedDir, "cmd.log")) {
+		t.Fatalf("log path not relocated:\n%s", statusData)
+	}
+	meta := loadSessionMetaFile(filepath.Join(importedDir, "meta"))
+	if meta[SessionMetaImportedFrom] != "test.tar.gz" {
+		t.Fatalf("unexpected meta: %v", meta)
+	}
+
+	if _, _, err := ImportSession(env, bytes.NewReader(buf.Bytes()), "test.tar.gz", false); err == nil {
+		t.Fatal("import twice without force should fail")
+	}
+	if _, _, err := ImportSession(env, bytes.NewReader(buf.Bytes()), "test.tar.gz", true); err != nil {
+		t.Fatal(err)
+	}
+}
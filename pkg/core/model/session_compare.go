@@ -0,0 +1,390 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/innerr/ticat/pkg/utils"
+)
+
+type CmdDiffKind string
+
+const (
+	CmdDiffSame    CmdDiffKind = "same"
+	CmdDiffChanged CmdDiffKind = "changed"
+	CmdDiffRemoved CmdDiffKind = "removed"
+	CmdDiffAdded   CmdDiffKind = "added"
+)
+
+// CmdDiff is a step of two aligned executed flows, 'A' or 'B' is nil if the step only exists on one side
+type CmdDiff struct {
+	Cmd       string         `json:"cmd"`
+	Kind      CmdDiffKind    `json:"kind"`
+	ResultA   ExecutedResult `json:"result-a,omitempty"`
+	ResultB   ExecutedResult `json:"result-b,omitempty"`
+	DurA      time.Duration  `json:"dur-a-ns"`
+	DurB      time.Duration  `json:"dur-b-ns"`
+	StartEnv  []EnvKeyDiff   `json:"start-env,omitempty"`
+	FinishEnv []EnvKeyDiff   `json:"finish-env,omitempty"`
+	SubFlow   []*CmdDiff     `json:"subflow,omitempty"`
+	// Only filled for diverged steps
+	LogDiff []LineDiff `json:"log-diff,omitempty"`
+
+	A *ExecutedCmd `json:"-"`
+	B *ExecutedCmd `json:"-"`
+}
+
+// Diverged means the result of the step is different, or it only exists on one side
+func (self *CmdDiff) Diverged() bool {
+	return self.Kind == CmdDiffAdded || self.Kind == CmdDiffRemoved || self.ResultA != self.ResultB
+}
+
+type EnvKeyDiff struct {
+	Key string `json:"key"`
+	// Empty if the key doesn't exist on that side
+	ValA string `json:"val-a,omitempty"`
+	ValB string `json:"val-b,omitempty"`
+}
+
+// CompareExecutedFlows aligns the cmds of two flows by cmd path (longest common subsequence),
+// so inserted or removed steps won't mess up the following ones.
+// A diverged env key is carried to all the following steps, it's only reported at the step it first diverges.
+func CompareExecutedFlows(a *ExecutedFlow, b *ExecutedFlow) (diffs []*CmdDiff) {
+	diffs = compareExecutedFlows(a, b)
+	dedupEnvDiffs(diffs, map[string]EnvKeyDiff{})
+	return diffs
+}
+
+func compareExecutedFlows(a *ExecutedFlow, b *ExecutedFlow) (diffs []*CmdDiff) {
+	var cmdsA, cmdsB []*ExecutedCmd
+	if a != nil {
+		cmdsA = a.Cmds
+	}
+	if b != nil {
+		cmdsB = b.Cmds
+	}
+
+	// lcs[i][j] is the LCS length of cmdsA[i:] and cmdsB[j:]
+	lcs := make([][]int, len(cmdsA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(cmdsB)+1)
+	}
+	for i := len(cmdsA) - 1; i >= 0; i-- {
+		for j := len(cmdsB) - 1; j >= 0; j-- {
+			if cmdsA[i].Cmd == cmdsB[j].Cmd {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(cmdsA) || j < len(cmdsB) {
+		if i < len(cmdsA) && j < len(cmdsB) && cmdsA[i].Cmd == cmdsB[j].Cmd {
+			diffs = append(diffs, compareExecutedCmds(cmdsA[i], cmdsB[j]))
+			i += 1
+			j += 1
+		} else if j >= len(cmdsB) || (i < len(cmdsA) && lcs[i+1][j] >= lcs[i][j+1]) {
+			diffs = append(diffs, oneSideCmdDiff(cmdsA[i], CmdDiffRemoved))
+			i += 1
+		} else {
+			diffs = append(diffs, oneSideCmdDiff(cmdsB[j], CmdDiffAdded))
+			j += 1
+		}
+	}
+	return diffs
+}
+
+func compareExecutedCmds(a *ExecutedCmd, b *ExecutedCmd) *CmdDiff {
+	diff := &CmdDiff{
+		Cmd:       a.Cmd,
+		Kind:      CmdDiffSame,
+		ResultA:   a.Result,
+		ResultB:   b.Result,
+		DurA:      executedCmdDur(a),
+		DurB:      executedCmdDur(b),
+		StartEnv:  compareEnvs(a.StartEnv, b.StartEnv),
+		FinishEnv: compareEnvs(a.FinishEnv, b.FinishEnv),
+		A:         a,
+		B:         b,
+	}
+	if a.SubFlow != nil || b.SubFlow != nil {
+		diff.SubFlow = compareExecutedFlows(a.SubFlow, b.SubFlow)
+	}
+	diff.Kind = sameOrChanged(diff)
+	return diff
+}
+
+// sameOrChanged checks the results and the env diffs, the durations are not counted, they are always different
+func sameOrChanged(diff *CmdDiff) CmdDiffKind {
+	if diff.ResultA != diff.ResultB || len(diff.StartEnv) != 0 || len(diff.FinishEnv) != 0 {
+		return CmdDiffChanged
+	}
+	for _, it := range diff.SubFlow {
+		if it.Kind != CmdDiffSame {
+			return CmdDiffChanged
+		}
+	}
+	return CmdDiffSame
+}
+
+// dedupEnvDiffs walks the steps in executing order, removes the env diffs which are already reported
+func dedupEnvDiffs(steps []*CmdDiff, reported map[string]EnvKeyDiff) {
+	for _, step := range steps {
+		if step.Kind == CmdDiffAdded || step.Kind == CmdDiffRemoved {
+			continue
+		}
+		step.StartEnv = filterReportedEnvDiffs(step.StartEnv, step.A.StartEnv, step.B.StartEnv, reported)
+		dedupEnvDiffs(step.SubFlow, reported)
+		step.FinishEnv = filterReportedEnvDiffs(step.FinishEnv, step.A.FinishEnv, step.B.FinishEnv, reported)
+		step.Kind = sameOrChanged(step)
+	}
+}
+
+func filterReportedEnvDiffs(diffs []EnvKeyDiff, a *Env, b *Env,
+	reported map[string]EnvKeyDiff) (remain []EnvKeyDiff) {
+
+	if a != nil && b != nil {
+		// The converged keys will be reported again if they diverge later
+		diverged := map[string]bool{}
+		for _, it := range diffs {
+			diverged[it.Key] = true
+		}
+		for k := range reported {
+			if !diverged[k] {
+				delete(reported, k)
+			}
+		}
+	}
+	for _, it := range diffs {
+		if last, ok := reported[it.Key]; ok && last == it {
+			continue
+		}
+		reported[it.Key] = it
+		remain = append(remain, it)
+	}
+	return
+}
+
+func oneSideCmdDiff(cmd *ExecutedCmd, kind CmdDiffKind) *CmdDiff {
+	diff := &CmdDiff{Cmd: cmd.Cmd, Kind: kind}
+	dur := executedCmdDur(cmd)
+	if kind == CmdDiffRemoved {
+		diff.A, diff.ResultA, diff.DurA = cmd, cmd.Result, dur
+	} else {
+		diff.B, diff.ResultB, diff.DurB = cmd, cmd.Result, dur
+	}
+	return diff
+}
+
+func executedCmdDur(cmd *ExecutedCmd) time.Duration {
+	if cmd.StartTs.IsZero() || cmd.FinishTs.IsZero() || cmd.FinishTs.Before(cmd.StartTs) {
+		return 0
+	}
+	return cmd.FinishTs.Sub(cmd.StartTs)
+}
+
+func compareEnvs(a *Env, b *Env) (diffs []EnvKeyDiff) {
+	kvsA := map[string]string{}
+	kvsB := map[string]string{}
+	if a != nil {
+		kvsA = a.FlattenAll()
+	}
+	if b != nil {
+		kvsB = b.FlattenAll()
+	}
+	for k, va := range kvsA {
+		if vb, ok := kvsB[k]; !ok || va != vb {
+			diffs = append(diffs, EnvKeyDiff{k, va, vb})
+		}
+	}
+	for k, vb := range kvsB {
+		if _, ok := kvsA[k]; !ok {
+			diffs = append(diffs, EnvKeyDiff{k, "", vb})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Key < diffs[j].Key })
+	return
+}
+
+type LineDiff struct {
+	// "-" for the line only in a, "+" for the line only in b, " " for common lines
+	Mark string `json:"mark"`
+	Line string `json:"line"`
+}
+
+// DiffLines is a simple LCS based line diff, for comparing log tails
+func DiffLines(a []string, b []string) (diffs []LineDiff) {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && j < len(b) && a[i] == b[j] {
+			diffs = append(diffs, LineDiff{" ", a[i]})
+			i += 1
+			j += 1
+		} else if j >= len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]) {
+			diffs = append(diffs, LineDiff{"-", a[i]})
+			i += 1
+		} else {
+			diffs = append(diffs, LineDiff{"+", b[j]})
+			j += 1
+		}
+	}
+	return
+}
+
+// SessionsComparison is the side-by-side comparison of two sessions
+type SessionsComparison struct {
+	A       string     `json:"a"`
+	B       string     `json:"b"`
+	ResultA string     `json:"result-a"`
+	ResultB string     `json:"result-b"`
+	Steps   []*CmdDiff `json:"steps"`
+
+	// Identical steps are hidden in text format if false
+	ShowSame bool `json:"-"`
+}
+
+func NewSessionsComparison(a SessionStatus, b SessionStatus, logLines int) *SessionsComparison {
+	cmp := &SessionsComparison{
+		A:     a.DirName,
+		B:     b.DirName,
+		Steps: CompareExecutedFlows(a.Status, b.Status),
+	}
+	if a.Status != nil {
+		cmp.ResultA = string(a.Status.Result)
+	}
+	if b.Status != nil {
+		cmp.ResultB = string(b.Status.Result)
+	}
+	if logLines > 0 {
+		fillLogDiffs(cmp.Steps, logLines)
+	}
+	return cmp
+}
+
+func fillLogDiffs(steps []*CmdDiff, logLines int) {
+	for _, step := range steps {
+		if step.Diverged() {
+			linesA := readCmdLogTail(step.A, logLines)
+			linesB := readCmdLogTail(step.B, logLines)
+			if len(linesA) != 0 || len(linesB) != 0 {
+				step.LogDiff = DiffLines(linesA, linesB)
+			}
+		}
+		fillLogDiffs(step.SubFlow, logLines)
+	}
+}
+
+func readCmdLogTail(cmd *ExecutedCmd, logLines int) []string {
+	if cmd == nil || len(cmd.LogFilePath) == 0 {
+		return nil
+	}
+	lines, _ := utils.ReadLogFileLastLines(cmd.LogFilePath, 1024*16, logLines)
+	return lines
+}
+
+func (self *SessionsComparison) FormatText() string {
+	var buf strings.Builder
+	buf.WriteString(fmt.Sprintf("a: %s (%s)\n", self.A, self.ResultA))
+	buf.WriteString(fmt.Sprintf("b: %s (%s)\n", self.B, self.ResultB))
+	if !self.ShowSame && !hasCmdDiff(self.Steps) {
+		buf.WriteString("no differences\n")
+		return buf.String()
+	}
+	self.formatSteps(&buf, self.Steps, 0)
+	return buf.String()
+}
+
+func hasCmdDiff(steps []*CmdDiff) bool {
+	for _, it := range steps {
+		if it.Kind != CmdDiffSame {
+			return true
+		}
+	}
+	return false
+}
+
+func (self *SessionsComparison) formatSteps(buf *strings.Builder, steps []*CmdDiff, depth int) {
+	indent := strings.Repeat("    ", depth)
+	for _, step := range steps {
+		if step.Kind == CmdDiffSame && !self.ShowSame {
+			continue
+		}
+		mark := " "
+		switch step.Kind {
+		case CmdDiffRemoved:
+			mark = "-"
+		case CmdDiffAdded:
+			mark = "+"
+		case CmdDiffChanged:
+			mark = "~"
+		}
+		buf.WriteString(indent + mark + " [" + step.Cmd + "] ")
+		switch step.Kind {
+		case CmdDiffRemoved:
+			buf.WriteString(fmt.Sprintf("only in a: %s %s\n", step.ResultA, fmtStatsDur(step.DurA)))
+		case CmdDiffAdded:
+			buf.WriteString(fmt.Sprintf("only in b: %s %s\n", step.ResultB, fmtStatsDur(step.DurB)))
+		default:
+			result := string(step.ResultA)
+			if step.ResultA != step.ResultB {
+				result += " -> " + string(step.ResultB)
+			}
+			buf.WriteString(fmt.Sprintf("%s, %s -> %s (%s)\n", result,
+				fmtStatsDur(step.DurA), fmtStatsDur(step.DurB), fmtDurDelta(step.DurB-step.DurA)))
+		}
+		formatEnvDiffs(buf, indent+"    ", "start env", step.StartEnv)
+		formatEnvDiffs(buf, indent+"    ", "finish env", step.FinishEnv)
+		if len(step.LogDiff) != 0 {
+			buf.WriteString(indent + "    log tail:\n")
+			for _, line := range step.LogDiff {
+				buf.WriteString(indent + "        " + line.Mark + " " + line.Line + "\n")
+			}
+		}
+		self.formatSteps(buf, step.SubFlow, depth+1)
+	}
+}
+
+func formatEnvDiffs(buf *strings.Builder, indent string, title string, diffs []EnvKeyDiff) {
+	if len(diffs) == 0 {
+		return
+	}
+	buf.WriteString(indent + title + ":\n")
+	for _, it := range diffs {
+		buf.WriteString(indent + "    " + it.Key + ": " + fmtEnvDiffVal(it.ValA) + " -> " + fmtEnvDiffVal(it.ValB) + "\n")
+	}
+}
+
+func fmtEnvDiffVal(val string) string {
+	if len(val) == 0 {
+		return "(none)"
+	}
+	return "'" + val + "'"
+}
+
+func fmtDurDelta(delta time.Duration) string {
+	if delta < 0 {
+		return "-" + fmtStatsDur(-delta)
+	}
+	return "+" + fmtStatsDur(delta)
+}
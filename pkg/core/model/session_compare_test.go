@@ -0,0 +1,169 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCompareFlowForTest(start time.Time, cmds ...*ExecutedCmd) *ExecutedFlow {
+	flow := NewExecutedFlow("test")
+	for i, cmd := range cmds {
+		cmd.StartTs = start.Add(time.Duration(i) * time.Minute)
+		if cmd.FinishTs.IsZero() {
+			cmd.FinishTs = cmd.StartTs.Add(time.Second)
+		}
+		flow.Cmds = append(flow.Cmds, cmd)
+	}
+	return flow
+}
+
+func newCompareCmdForTest(name string, result ExecutedResult) *ExecutedCmd {
+	cmd := NewExecutedCmd(name)
+	cmd.Result = result
+	return cmd
+}
+
+func TestCompareExecutedFlowsAlignment(t *testing.T) {
+	now := time.Now()
+	a := newCompareFlowForTest(now,
+		newCompareCmdForTest("init", ExecutedResultSucceeded),
+		newCompareCmdForTest("load", ExecutedResultSucceeded),
+		newCompareCmdForTest("check", ExecutedResultSucceeded))
+	b := newCompareFlowForTest(now,
+		newCompareCmdForTest("init", ExecutedResultSucceeded),
+		newCompareCmdForTest("warmup", ExecutedResultSucceeded),
+		newCompareCmdForTest("check", ExecutedResultError))
+
+	diffs := CompareExecutedFlows(a, b)
+	expected := []struct {
+		cmd  string
+		kind CmdDiffKind
+	}{
+		{"init", CmdDiffSame},
+		{"load", CmdDiffRemoved},
+		{"warmup", CmdDiffAdded},
+		{"check", CmdDiffChanged},
+	}
+	if len(diffs) != len(expected) {
+		t.Fatalf("expect %d steps, got %d", len(expected), len(diffs))
+	}
+	for i, it := range expected {
+		if diffs[i].Cmd != it.cmd || diffs[i].Kind != it.kind {
+			t.Errorf("step %d: expect %s %s, got %s %s", i, it.cmd, it.kind, diffs[i].Cmd, diffs[i].Kind)
+		}
+	}
+	if !diffs[3].Diverged() || diffs[0].Diverged() {
+		t.Errorf("unexpected diverged flags")
+	}
+}
+
+func TestCompareExecutedFlowsSubflowAndEnv(t *testing.T) {
+	now := time.Now()
+	subA := newCompareFlowForTest(now, newCompareCmdForTest("step", ExecutedResultSucceeded))
+	subB := newCompareFlowForTest(now,
+		newCompareCmdForTest("step", ExecutedResultSucceeded),
+		newCompareCmdForTest("extra", ExecutedResultSucceeded))
+
+	parentA := newCompareCmdForTest("parent", ExecutedResultSucceeded)
+	parentA.SubFlow = subA
+	parentA.StartEnv = NewEnv()
+	parentA.StartEnv.Set("host", "a.local")
+	parentA.StartEnv.Set("port", "80")
+	parentB := newCompareCmdForTest("parent", ExecutedResultSucceeded)
+	parentB.SubFlow = subB
+	parentB.StartEnv = NewEnv()
+	parentB.StartEnv.Set("host", "b.local")
+	parentB.StartEnv.Set("user", "root")
+	parentB.FinishTs = now.Add(3 * time.Second)
+
+	diffs := CompareExecutedFlows(newCompareFlowForTest(now, parentA), newCompareFlowForTest(now, parentB))
+	if len(diffs) != 1 || diffs[0].Kind != CmdDiffChanged {
+		t.Fatalf("expect one changed step, got %+v", diffs)
+	}
+	step := diffs[0]
+	if step.DurA != time.Second || step.DurB != 3*time.Second {
+		t.Errorf("unexpected durations: %v %v", step.DurA, step.DurB)
+	}
+	keys := []string{}
+	for _, it := range step.StartEnv {
+		keys = append(keys, it.Key)
+	}
+	if strings.Join(keys, ",") != "host,port,user" {
+		t.Errorf("unexpected env diffs: %v", step.StartEnv)
+	}
+	if len(step.SubFlow) != 2 || step.SubFlow[1].Kind != CmdDiffAdded {
+		t.Errorf("unexpected subflow diffs: %+v", step.SubFlow)
+	}
+}
+
+func TestSessionsComparisonLogDiff(t *testing.T) {
+	dir := t.TempDir()
+	writeLog := func(name string, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	now := time.Now()
+	cmdA := newCompareCmdForTest("run", ExecutedResultSucceeded)
+	cmdA.LogFilePath = writeLog("a.log", "start\nok\n")
+	cmdB := newCompareCmdForTest("run", ExecutedResultError)
+	cmdB.LogFilePath = writeLog("b.log", "start\nfailed\n")
+
+	cmp := NewSessionsComparison(
+		SessionStatus{DirName: "a", Status: newCompareFlowForTest(now, cmdA)},
+		SessionStatus{DirName: "b", Status: newCompareFlowForTest(now, cmdB)},
+		10)
+	diff := cmp.Steps[0].LogDiff
+	var marks []string
+	for _, it := range diff {
+		marks = append(marks, it.Mark+it.Line)
+	}
+	if strings.Join(marks, "|") != " start|-ok|+failed" {
+		t.Errorf("unexpected log diff: %v", marks)
+	}
+	text := cmp.FormatText()
+	if !strings.Contains(text, "~ [run] OK -> ERR") || !strings.Contains(text, "+ failed") {
+		t.Errorf("unexpected text: %s", text)
+	}
+}
+
+func TestCompareExecutedFlowsNoise(t *testing.T) {
+	now := time.Now()
+	newSteps := func(host string, dur time.Duration) *ExecutedFlow {
+		var cmds []*ExecutedCmd
+		for i, name := range []string{"init", "load", "check"} {
+			cmd := newCompareCmdForTest(name, ExecutedResultSucceeded)
+			cmd.FinishTs = now.Add(time.Duration(i)*time.Minute + dur)
+			cmd.StartEnv = NewEnv()
+			cmd.FinishEnv = NewEnv()
+			if i > 0 {
+				cmd.StartEnv.Set("host", host)
+			}
+			cmd.FinishEnv.Set("host", host)
+			cmds = append(cmds, cmd)
+		}
+		return newCompareFlowForTest(now, cmds...)
+	}
+
+	// Only the durations are different
+	cmp := &SessionsComparison{Steps: CompareExecutedFlows(newSteps("a", time.Second), newSteps("a", 2*time.Second))}
+	if text := cmp.FormatText(); !strings.Contains(text, "no differences") {
+		t.Errorf("the durations should not be counted as differences: %s", text)
+	}
+
+	// The changed env key is carried to the following steps, only reported in the first step
+	diffs := CompareExecutedFlows(newSteps("a", time.Second), newSteps("b", time.Second))
+	if len(diffs[0].FinishEnv) != 1 || diffs[0].Kind != CmdDiffChanged {
+		t.Fatalf("the first step should be changed: %+v", diffs[0])
+	}
+	for _, step := range diffs[1:] {
+		if step.Kind != CmdDiffSame || len(step.StartEnv) != 0 || len(step.FinishEnv) != 0 {
+			t.Errorf("the env diff of '%s' should not be reported again: %+v", step.Cmd, step)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package model
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/innerr/ticat/pkg/utils"
+)
+
+const (
+	// The session is running in a detached ticat process, stdout and stderr are in the detached log file
+	SessionMetaDetached = "detached"
+	// The reason of 'sessions.kill'
+	SessionMetaKilled = "killed"
+
+	SessionDetachedLogFileName = "detached.log"
+)
+
+type DetachedFlow struct {
+	Pid int
+	// Empty if the session dir is not found in time
+	SessionDir string
+	LogPath    string
+}
+
+// StartDetachedFlow runs the flow in a new ticat process, it's in a new unix session (by setsid),
+// so it won't be killed when the current process or terminal exits.
+// The new process owns its own ticat session, the stdout and stderr are written to the session dir.
+func StartDetachedFlow(env *Env, flow string, waitSession time.Duration) (detached DetachedFlow, err error) {
+	bin := env.GetRaw("sys.paths.ticat")
+	if len(bin) == 0 {
+		return detached, fmt.Errorf("[StartDetachedFlow] can't get ticat binary path")
+	}
+	root := env.GetRaw("sys.paths.sessions")
+	if len(root) == 0 {
+		return detached, fmt.Errorf("[StartDetachedFlow] can't get sessions' root path")
+	}
+	if err = os.MkdirAll(root, os.ModePerm); err != nil {
+		return detached, fmt.Errorf("[StartDetachedFlow] create sessions' root '%s' failed: %v", root, err)
+	}
+
+	// The session dir is created by the new process, log to a temp file before it's found
+	logFile, err := os.CreateTemp(root, ".detached-*.log")
+	if err != nil {
+		return detached, fmt.Errorf("[StartDetachedFlow] create log file failed: %v", err)
+	}
+	detached.LogPath = logFile.Name()
+
+	cmd := exec.Command(bin, flow)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	started := time.Now()
+	err = cmd.Start()
+	_ = logFile.Close()
+	if err != nil {
+		_ = os.Remove(detached.LogPath)
+		return detached, fmt.Errorf("[StartDetachedFlow] start '%s' failed: %v", bin, err)
+	}
+	detached.Pid = cmd.Process.Pid
+
+	// Reap the process if it ends before the current one, or it will be a zombie and looks like running
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	deadline := time.Now().Add(waitSession)
+	for {
+		dirName := findSessionDirByPid(root, detached.Pid, started)
+		if len(dirName) != 0 {
+			detached.SessionDir = dirName
+			logPath := filepath.Join(root, dirName, SessionDetachedLogFileName)
+			if os.Rename(detached.LogPath, logPath) == nil {
+				detached.LogPath = logPath
+			}
+			err = SetSessionMeta(env, dirName, SessionMetaDetached, "true")
+			return
+		}
+		if time.Now().After(deadline) || !utils.IsPidRunning(detached.Pid) {
+			// Check again, the process may end right after creating the session dir
+			if len(findSessionDirByPid(root, detached.Pid, started)) != 0 {
+				continue
+			}
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// findSessionDirByPid only accepts the dirs started after 'since', the pid may be reused by the new process.
+// The dir names are in seconds, so 'since' is truncated to seconds.
+func findSessionDirByPid(root string, pid int, since time.Time) string {
+	since = since.Truncate(time.Second)
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return ""
+	}
+	suffix := "." + strconv.Itoa(pid)
+	for _, dir := range dirs {
+		if !dir.IsDir() || !strings.HasSuffix(dir.Name(), suffix) {
+			continue
+		}
+		dirPid, startTs, ok := parseSessionDirName(dir.Name())
+		if ok && dirPid == pid && !startTs.Before(since) {
+			return dir.Name()
+		}
+	}
+	return ""
+}
+
+func IsSessionDetached(meta SessionMeta) bool {
+	return StrToTrue(meta[SessionMetaDetached])
+}
+
+// DetachedLogPath returns empty if the session is not detached
+func DetachedLogPath(env *Env, session SessionStatus) string {
+	if !IsSessionDetached(session.Meta) {
+		return ""
+	}
+	return filepath.Join(SessionsRoot(env, session.Imported), session.DirName, SessionDetachedLogFileName)
+}
+
+// KillSession sends SIGTERM (or SIGKILL if force) to a running session,
+// a detached session is the leader of its process group, so the whole group is killed
+func KillSession(env *Env, session SessionStatus, force bool) error {
+	if session.Imported {
+		return fmt.Errorf("session [%s] is imported, can't be killed", session.DirName)
+	}
+	if session.Pid == os.Getpid() {
+		return fmt.Errorf("session [%s] is the current one, can't be killed", session.DirName)
+	}
+	if !session.Running || !utils.IsPidRunning(session.Pid) {
+		return fmt.Errorf("session [%s] is not running", session.DirName)
+	}
+
+	sig := syscall.SIGTERM
+	reason := "terminated"
+	if force {
+		sig = syscall.SIGKILL
+		reason = "killed"
+	}
+	pid := session.Pid
+	if IsSessionDetached(session.Meta) {
+		pid = -pid
+	}
+	if err := syscall.Kill(pid, sig); err != nil {
+		return fmt.Errorf("kill session [%s] (pid %d) failed: %v", session.DirName, session.Pid, err)
+	}
+	return SetSessionMeta(env, session.DirName, SessionMetaKilled,
+		fmt.Sprintf("%s at %s", reason, time.Now().Format(SessionTimeFormat)))
+}
@@ -0,0 +1,65 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindSessionDirByPid(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"20240102-030405.123", "20240102-030405.1234", ".detached-1.log"} {
+		if err := os.MkdirAll(filepath.Join(root, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "20240102-030406.99"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	since := time.Date(2024, 1, 2, 3, 4, 5, 500, time.Local)
+	if dir := findSessionDirByPid(root, 123, since); dir != "20240102-030405.123" {
+		t.Errorf("expected session dir of pid 123, got '%s'", dir)
+	}
+	if dir := findSessionDirByPid(root, 23, since); dir != "" {
+		t.Errorf("pid 23 should not match pid 123 or 1234, got '%s'", dir)
+	}
+	if dir := findSessionDirByPid(root, 99, since); dir != "" {
+		t.Errorf("files should not be treated as session dirs, got '%s'", dir)
+	}
+	if dir := findSessionDirByPid(filepath.Join(root, "not-exists"), 123, since); dir != "" {
+		t.Errorf("expected empty result for missing root, got '%s'", dir)
+	}
+	if dir := findSessionDirByPid(root, 123, since.Add(time.Second)); dir != "" {
+		t.Errorf("the old session of a reused pid should not match, got '%s'", dir)
+	}
+}
+
+func TestDetachedLogPath(t *testing.T) {
+	env := NewEnv()
+	env.Set("sys.paths.sessions", "/sessions")
+
+	session := SessionStatus{DirName: "20240102-030405.123", Meta: SessionMeta{}}
+	if path := DetachedLogPath(env, session); path != "" {
+		t.Errorf("expected no detached log for normal session, got '%s'", path)
+	}
+	session.Meta[SessionMetaDetached] = "true"
+	expected := filepath.Join("/sessions", "20240102-030405.123", SessionDetachedLogFileName)
+	if path := DetachedLogPath(env, session); path != expected {
+		t.Errorf("expected '%s', got '%s'", expected, path)
+	}
+}
+
+func TestKillSessionNotRunning(t *testing.T) {
+	env := NewEnv()
+	if err := KillSession(env, SessionStatus{DirName: "x", Imported: true}, false); err == nil {
+		t.Error("expected error when killing imported session")
+	}
+	if err := KillSession(env, SessionStatus{DirName: "x", Pid: os.Getpid(), Running: true}, false); err == nil {
+		t.Error("expected error when killing current session")
+	}
+	if err := KillSession(env, SessionStatus{DirName: "x", Pid: 1 << 22, Running: false}, false); err == nil {
+		t.Error("expected error when killing finished session")
+	}
+}
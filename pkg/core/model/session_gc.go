@@ -0,0 +1,245 @@
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/innerr/ticat/pkg/utils"
+)
+
+const (
+	SessionMetaPinned = "pinned"
+
+	SessionGCReasonExpired   = "expired"
+	SessionGCReasonOverCount = "over-count"
+	SessionGCReasonOverSize  = "over-size"
+	SessionGCReasonLeftover  = "leftover"
+
+	// A session dir is renamed with this prefix before removing, so a half-removed one won't be listed
+	sessionGCTombstonePrefix = ".gc."
+)
+
+type SessionsRetention struct {
+	KeepDur       time.Duration
+	KeepFailedDur time.Duration
+	// Zero means no limit
+	MaxCount int
+	MaxSize  int64
+}
+
+// GetSessionsRetention reads the retention policies from env, the optional ones could be empty
+func GetSessionsRetention(env *Env) (retention SessionsRetention, err error) {
+	retention.KeepDur = env.GetDur("sys.sessions.keep-status-duration")
+	retention.KeepFailedDur = retention.KeepDur
+
+	if val := env.GetRaw("sys.sessions.keep-failed-duration"); len(val) != 0 {
+		retention.KeepFailedDur, err = time.ParseDuration(utils.NormalizeDurStr(val))
+		if err != nil {
+			return retention, fmt.Errorf("[SessionsRetention] bad duration '%s' of key 'sys.sessions.keep-failed-duration': %v", val, err)
+		}
+	}
+	if val := env.GetRaw("sys.sessions.max-count"); len(val) != 0 {
+		retention.MaxCount, err = strconv.Atoi(val)
+		if err != nil || retention.MaxCount < 0 {
+			return retention, fmt.Errorf("[SessionsRetention] bad count '%s' of key 'sys.sessions.max-count'", val)
+		}
+	}
+	if val := env.GetRaw("sys.sessions.max-size"); len(val) != 0 {
+		retention.MaxSize, err = ParseByteSize(val)
+		if err != nil {
+			return retention, fmt.Errorf("[SessionsRetention] bad size '%s' of key 'sys.sessions.max-size': %v", val, err)
+		}
+	}
+	return retention, nil
+}
+
+func (self SessionsRetention) IsExpired(startTs time.Time, failed bool, now time.Time) bool {
+	keepDur := self.KeepDur
+	if failed {
+		keepDur = self.KeepFailedDur
+	}
+	return startTs.Add(keepDur).Before(now)
+}
+
+// ParseByteSize parses sizes like '512M', '2G', '1.5GB' or '1024'
+func ParseByteSize(str string) (int64, error) {
+	str = strings.ToUpper(strings.TrimSpace(str))
+	str = strings.TrimSuffix(strings.TrimSuffix(str, "IB"), "B")
+	unit := int64(1)
+	if len(str) != 0 {
+		switch str[len(str)-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		case 'T':
+			unit = 1 << 40
+		}
+		if unit != 1 {
+			str = str[:len(str)-1]
+		}
+	}
+	val, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil || val < 0 {
+		return 0, fmt.Errorf("bad size format, should be like '512M', '2G'")
+	}
+	return int64(val * float64(unit)), nil
+}
+
+func IsSessionPinned(meta SessionMeta) bool {
+	return StrToTrue(meta[SessionMetaPinned])
+}
+
+// IsSessionProtected tells if a session should never be collected automatically: pinned or tagged
+func IsSessionProtected(meta SessionMeta) bool {
+	return IsSessionPinned(meta) || len(SessionTags(meta)) != 0
+}
+
+type SessionGCItem struct {
+	DirName string
+	Reason  string
+	StartTs time.Time
+	Failed  bool
+	// Only calculated when there is a size limit
+	Size int64
+}
+
+// SessionsGC holds everything it needs, so it could run in a background goroutine without touching the env
+type SessionsGC struct {
+	Root           string
+	StatusFileName string
+	MetaFileName   string
+	Retention      SessionsRetention
+}
+
+func NewSessionsGC(env *Env) (*SessionsGC, error) {
+	root := env.GetRaw("sys.paths.sessions")
+	if len(root) == 0 {
+		return nil, fmt.Errorf("[SessionsGC] can't get sessions' root path")
+	}
+	retention, err := GetSessionsRetention(env)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionsGC{
+		root,
+		env.GetRaw("strs.session-status-file"),
+		env.GetRaw("strs.session-meta-file"),
+		retention,
+	}, nil
+}
+
+// Plan finds the sessions should be removed, running, pinned and tagged ones are never collected
+func (self *SessionsGC) Plan(now time.Time) (items []SessionGCItem, err error) {
+	entrys, err := os.ReadDir(self.Root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("[SessionsGC] can't read sessions' root path '%s': %v", self.Root, err)
+	}
+
+	var dirs []string
+	for _, it := range entrys {
+		if strings.HasPrefix(it.Name(), sessionGCTombstonePrefix) {
+			items = append(items, SessionGCItem{DirName: it.Name(), Reason: SessionGCReasonLeftover})
+			continue
+		}
+		dirs = append(dirs, it.Name())
+	}
+	// Newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+
+	kept := 0
+	var keptSize int64
+	for _, dir := range dirs {
+		pid, startTs, ok := parseSessionDirName(dir)
+		if !ok {
+			continue
+		}
+		sessionDir := filepath.Join(self.Root, dir)
+		protected := utils.IsPidRunning(pid) ||
+			IsSessionProtected(loadSessionMetaFile(filepath.Join(sessionDir, self.MetaFileName)))
+
+		item := SessionGCItem{DirName: dir, StartTs: startTs}
+		if self.Retention.MaxSize > 0 {
+			item.Size = dirSize(sessionDir)
+		}
+
+		if !protected {
+			item.Failed = !isSessionSucceeded(filepath.Join(sessionDir, self.StatusFileName))
+			if self.Retention.IsExpired(startTs, item.Failed, now) {
+				item.Reason = SessionGCReasonExpired
+			} else if self.Retention.MaxCount > 0 && kept >= self.Retention.MaxCount {
+				item.Reason = SessionGCReasonOverCount
+			} else if self.Retention.MaxSize > 0 && keptSize+item.Size > self.Retention.MaxSize {
+				item.Reason = SessionGCReasonOverSize
+			}
+		}
+
+		if len(item.Reason) != 0 {
+			items = append(items, item)
+		} else {
+			kept += 1
+			keptSize += item.Size
+		}
+	}
+	return items, nil
+}
+
+func (self *SessionsGC) Run(items []SessionGCItem) (removed int, err error) {
+	var errs []string
+	for _, it := range items {
+		path := filepath.Join(self.Root, it.DirName)
+		if it.Reason != SessionGCReasonLeftover {
+			tombstone := filepath.Join(self.Root, sessionGCTombstonePrefix+it.DirName)
+			if err := os.Rename(path, tombstone); err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			path = tombstone
+		}
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		removed += 1
+	}
+	if len(errs) != 0 {
+		return removed, fmt.Errorf("[SessionsGC] remove sessions failed: %s", strings.Join(errs, "; "))
+	}
+	return removed, nil
+}
+
+// isSessionSucceeded only reads the tail of the status file, to keep the GC cheap
+func isSessionSucceeded(statusPath string) bool {
+	lines, err := utils.ReadLogFileLastLines(statusPath, 512, 2)
+	if err != nil || len(lines) == 0 {
+		return false
+	}
+	last := []byte(lines[len(lines)-1])
+	if DetectStatusFormat(last) == StatusFormatJsonl {
+		return bytes.Contains(last, []byte(`"event":"`+StatusEventFlowFinish+`"`)) &&
+			bytes.Contains(last, []byte(`"result":"`+string(ExecutedResultSucceeded)+`"`))
+	}
+	return strings.TrimSpace(string(last)) ==
+		strings.TrimSpace(markedOneLineContent("flow-result", 0, string(ExecutedResultSucceeded)))
+}
+
+func dirSize(dir string) (size int64) {
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,165 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	cases := map[string]int64{
+		"1024": 1024,
+		"2K":   2048,
+		"1.5M": 3 << 19,
+		"2GB":  2 << 30,
+		"1gib": 1 << 30,
+	}
+	for str, expected := range cases {
+		if size, err := ParseByteSize(str); err != nil || size != expected {
+			t.Errorf("'%s': expect %d, got %d, %v", str, expected, size, err)
+		}
+	}
+	if _, err := ParseByteSize("x1"); err == nil {
+		t.Errorf("'x1' should be invalid")
+	}
+}
+
+func TestSessionsGCPlan(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	// Use a pid which could never be running
+	pid := 1 << 30
+
+	addSession := func(age time.Duration, succeeded bool, pinned bool) string {
+		dirName := now.Add(-age).Format(SessionDirTimeFormat) + "." + strconv.Itoa(pid)
+		pid += 1
+		dir := filepath.Join(root, dirName)
+		_ = os.MkdirAll(dir, 0755)
+		result := ExecutedResultError
+		if succeeded {
+			result = ExecutedResultSucceeded
+		}
+		_ = os.WriteFile(filepath.Join(dir, "status"), []byte(markedOneLineContent("flow-result", 0, string(result))), 0644)
+		if pinned {
+			_ = saveSessionMetaFile(filepath.Join(dir, "meta"), SessionMeta{SessionMetaPinned: "true"})
+		}
+		return dirName
+	}
+
+	oldOk := addSession(10*time.Hour, true, false)
+	oldFailed := addSession(9*time.Hour, false, false)
+	addSession(8*time.Hour, true, true)
+	tagged := addSession(7*time.Hour, true, false)
+	_ = saveSessionMetaFile(filepath.Join(root, tagged, "meta"), SessionMeta{SessionMetaTags: "release"})
+	addSession(3*time.Hour, true, false)
+	addSession(2*time.Hour, true, false)
+	newest := addSession(1*time.Hour, true, false)
+	_ = os.MkdirAll(filepath.Join(root, sessionGCTombstonePrefix+newest), 0755)
+
+	gc := &SessionsGC{root, "status", "meta", SessionsRetention{
+		KeepDur:       5 * time.Hour,
+		KeepFailedDur: 24 * time.Hour,
+		MaxCount:      3,
+	}}
+	items, err := gc.Plan(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := map[string]string{}
+	for _, it := range items {
+		reasons[it.DirName] = it.Reason
+	}
+	expected := map[string]string{
+		sessionGCTombstonePrefix + newest: SessionGCReasonLeftover,
+		oldOk:                             SessionGCReasonExpired,
+		oldFailed:                         SessionGCReasonOverCount,
+	}
+	if len(reasons) != len(expected) {
+		t.Fatalf("unexpected plan: %v", reasons)
+	}
+	for dir, reason := range expected {
+		if reasons[dir] != reason {
+			t.Errorf("'%s': expect '%s', got '%s'", dir, reason, reasons[dir])
+		}
+	}
+
+	removed, err := gc.Run(items)
+	if err != nil || removed != len(items) {
+		t.Fatalf("run gc failed: %d, %v", removed, err)
+	}
+	entrys, _ := os.ReadDir(root)
+	if len(entrys) != 5 {
+		t.Errorf("expect 5 sessions left, got %d", len(entrys))
+	}
+}
+
+func TestSessionTags(t *testing.T) {
+	tags := ParseSessionTags("release, v1 release,,nightly")
+	if len(tags) != 3 || tags[0] != "release" || tags[1] != "v1" || tags[2] != "nightly" {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+
+	root := t.TempDir()
+	env := NewEnv()
+	env.Set("sys.paths.sessions", root)
+	env.Set("strs.session-meta-file", "meta")
+	dirName := "20260101-000000.1"
+	_ = os.MkdirAll(filepath.Join(root, dirName), 0755)
+
+	if _, err := AddSessionTags(env, dirName, "release", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	tags, err := AddSessionTags(env, dirName, "v1", "nightly")
+	if err != nil || len(tags) != 3 {
+		t.Fatalf("unexpected tags: %v, %v", tags, err)
+	}
+	if !IsSessionProtected(LoadSessionMeta(env, dirName)) {
+		t.Errorf("tagged session should be protected")
+	}
+	if tags, _ = RemoveSessionTags(env, dirName, "v1"); len(tags) != 2 {
+		t.Errorf("unexpected tags after removing: %v", tags)
+	}
+	if _, err = RemoveSessionTags(env, dirName); err != nil {
+		t.Fatal(err)
+	}
+	if IsSessionProtected(LoadSessionMeta(env, dirName)) {
+		t.Errorf("untagged session should not be protected")
+	}
+
+	if err = SetSessionNote(env, dirName, "used for\nthe release"); err != nil {
+		t.Fatal(err)
+	}
+	if note := LoadSessionMeta(env, dirName)[SessionMetaNote]; note != "used for the release" {
+		t.Errorf("unexpected note: '%s'", note)
+	}
+}
+
+func TestGCSessionsOnInitBackground(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	old := now.Add(-10*time.Hour).Format(SessionDirTimeFormat) + "." + strconv.Itoa(1<<30)
+	_ = os.MkdirAll(filepath.Join(root, old), 0755)
+	_ = os.WriteFile(filepath.Join(root, old, "status"),
+		[]byte(markedOneLineContent("flow-result", 0, string(ExecutedResultSucceeded))), 0644)
+
+	env := NewEnv()
+	env.Set("sys.paths.sessions", root)
+	env.Set("strs.session-status-file", "status")
+	env.Set("strs.session-meta-file", "meta")
+	env.SetDur("sys.sessions.keep-status-duration", "1h")
+	env.SetBool("sys.sessions.gc.background", true)
+
+	screen := &QuietScreen{}
+	gcSessionsOnInit(&Cli{Screen: screen}, env, now)
+	if err := WaitSessionsGC(); err != nil {
+		t.Fatal(err)
+	}
+	if screen.OutputtedLines() != 0 {
+		t.Errorf("the background gc should print nothing")
+	}
+	if _, err := os.Stat(filepath.Join(root, old)); !os.IsNotExist(err) {
+		t.Errorf("the expired session should be removed after waiting")
+	}
+}
@@ -0,0 +1,279 @@
+package model
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/innerr/ticat/pkg/core/filter"
+)
+
+// The index caches the summaries of sessions, so sessions could be filtered without parsing status files.
+// An entry is refreshed when any status file (including the ones of bg tasks) of the session changed.
+const SessionIndexFileName = ".index"
+
+type SessionIndexEntry struct {
+	Size     int64             `json:"size"`
+	ModTime  int64             `json:"mtime"`
+	Flow     string            `json:"flow"`
+	Result   ExecutedResult    `json:"result"`
+	StartTs  int64             `json:"start"`
+	FinishTs int64             `json:"finish"`
+	Cmds     []string          `json:"cmds,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+}
+
+type SessionIndex struct {
+	path    string
+	Entries map[string]*SessionIndexEntry `json:"sessions"`
+	dirty   bool
+}
+
+func LoadSessionIndex(sessionsRoot string) *SessionIndex {
+	index := &SessionIndex{
+		path:    filepath.Join(sessionsRoot, SessionIndexFileName),
+		Entries: map[string]*SessionIndexEntry{},
+	}
+	data, err := os.ReadFile(index.path)
+	if err != nil {
+		return index
+	}
+	if err = json.Unmarshal(data, index); err != nil || index.Entries == nil {
+		// The index is only a cache, rebuild it if it's broken
+		index.Entries = map[string]*SessionIndexEntry{}
+		index.dirty = true
+	}
+	return index
+}
+
+// Lookup returns the index entry of a session, the status file will be parsed if the entry is stale,
+// in that case the parsed status is returned too.
+// The entry of a running session is not cached, its status file keeps changing, caching it makes the index
+// rewritten in every listing.
+func (self *SessionIndex) Lookup(path ExecutedStatusFilePath, running bool) (
+	entry *SessionIndexEntry, parsed *ExecutedFlow) {
+
+	size, modTime := statusFilesStamp(path)
+	entry, ok := self.Entries[path.DirName]
+	if ok && entry.Size == size && entry.ModTime == modTime {
+		return entry, nil
+	}
+
+	parsed = SafeParseExecutedFlow(path)
+	if parsed == nil || running {
+		if ok {
+			delete(self.Entries, path.DirName)
+			self.dirty = true
+		}
+		if parsed == nil {
+			return nil, nil
+		}
+		return newSessionIndexEntry(parsed), parsed
+	}
+	entry = newSessionIndexEntry(parsed)
+	entry.Size = size
+	entry.ModTime = modTime
+	self.Entries[path.DirName] = entry
+	self.dirty = true
+	return entry, parsed
+}
+
+// Prune removes the entries of the sessions not existed anymore
+func (self *SessionIndex) Prune(dirs []string) {
+	exists := map[string]bool{}
+	for _, dir := range dirs {
+		exists[dir] = true
+	}
+	for dir := range self.Entries {
+		if !exists[dir] {
+			delete(self.Entries, dir)
+			self.dirty = true
+		}
+	}
+}
+
+// Save writes the index if it's changed, errors are ignored since it's only a cache
+func (self *SessionIndex) Save() {
+	if !self.dirty {
+		return
+	}
+	data, err := json.Marshal(self)
+	if err != nil {
+		return
+	}
+	// A unique temp file, the sessions in other processes may save the index at the same time
+	file, err := os.CreateTemp(filepath.Dir(self.path), ".index.*.tmp")
+	if err != nil {
+		return
+	}
+	tmp := file.Name()
+	_, err = file.Write(data)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, self.path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return
+	}
+	self.dirty = false
+}
+
+func newSessionIndexEntry(status *ExecutedFlow) *SessionIndexEntry {
+	entry := &SessionIndexEntry{
+		Flow:     status.Flow,
+		Result:   status.Result,
+		StartTs:  status.StartTs.Unix(),
+		FinishTs: status.FinishTs.Unix(),
+		Env:      map[string]string{},
+	}
+	visited := map[string]bool{}
+	var collect func(flow *ExecutedFlow)
+	collect = func(flow *ExecutedFlow) {
+		for _, cmd := range flow.Cmds {
+			if !visited[cmd.Cmd] {
+				visited[cmd.Cmd] = true
+				entry.Cmds = append(entry.Cmds, cmd.Cmd)
+			}
+			// The later envs overwrite the earlier ones
+			for _, env := range []*Env{cmd.StartEnv, cmd.FinishEnv} {
+				if env != nil {
+					for k, v := range env.FlattenAll() {
+						entry.Env[k] = v
+					}
+				}
+			}
+			if cmd.SubFlow != nil {
+				collect(cmd.SubFlow)
+			}
+		}
+	}
+	collect(status)
+	return entry
+}
+
+// statusFilesStamp sums the sizes and finds the latest modify time of the status files of a session
+func statusFilesStamp(path ExecutedStatusFilePath) (size int64, modTime int64) {
+	files := []string{path.Full()}
+	if entrys, err := os.ReadDir(filepath.Join(path.RootPath, path.DirName)); err == nil {
+		for _, it := range entrys {
+			if it.IsDir() {
+				files = append(files, filepath.Join(path.RootPath, path.DirName, it.Name(), path.FileName))
+			}
+		}
+	}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		size += info.Size()
+		if info.ModTime().UnixNano() > modTime {
+			modTime = info.ModTime().UnixNano()
+		}
+	}
+	return
+}
+
+// SessionQuerySchema declares the fields could be used in session queries, eg:
+// 'status=error cmd~deploy since=2d env.cluster.name=prod duration>10m'
+var SessionQuerySchema = filter.Schema{
+	Fields: map[string]filter.Kind{
+		"id":       filter.KindString,
+		"flow":     filter.KindString,
+		"status":   filter.KindString,
+		"cmd":      filter.KindString,
+		"pinned":   filter.KindString,
+		"tag":      filter.KindString,
+		"start":    filter.KindTime,
+		"finish":   filter.KindTime,
+		"duration": filter.KindDuration,
+	},
+	Prefixes: map[string]filter.Kind{
+		"env.":  filter.KindString,
+		"meta.": filter.KindString,
+	},
+	TimeField: "start",
+}
+
+const (
+	SessionQueryStatusOk      = "ok"
+	SessionQueryStatusError   = "error"
+	SessionQueryStatusRunning = "running"
+)
+
+func ParseSessionQuery(str string) (*filter.Query, error) {
+	return filter.Parse(str, SessionQuerySchema, time.Now())
+}
+
+// sessionRecord adapts an index entry to a filter record
+type sessionRecord struct {
+	dirName string
+	entry   *SessionIndexEntry
+	running bool
+	meta    SessionMeta
+	now     time.Time
+}
+
+func (self sessionRecord) Text() []string {
+	text := append([]string{self.dirName, self.entry.Flow}, SessionTags(self.meta)...)
+	if note := self.meta[SessionMetaNote]; len(note) != 0 {
+		text = append(text, note)
+	}
+	return text
+}
+
+func (self sessionRecord) Values(key string) []string {
+	switch key {
+	case "id":
+		return []string{self.dirName}
+	case "flow":
+		return []string{self.entry.Flow}
+	case "status":
+		if self.running {
+			return []string{SessionQueryStatusRunning}
+		}
+		if self.entry.Result == ExecutedResultSucceeded {
+			return []string{SessionQueryStatusOk}
+		}
+		return []string{SessionQueryStatusError}
+	case "cmd":
+		return self.entry.Cmds
+	case "pinned":
+		return []string{strconv.FormatBool(IsSessionPinned(self.meta))}
+	case "tag":
+		return SessionTags(self.meta)
+	case "start":
+		return []string{filter.FormatTime(time.Unix(self.entry.StartTs, 0))}
+	case "finish":
+		if self.running {
+			return nil
+		}
+		return []string{filter.FormatTime(time.Unix(self.entry.FinishTs, 0))}
+	case "duration":
+		finish := time.Unix(self.entry.FinishTs, 0)
+		if self.running {
+			finish = self.now
+		}
+		return []string{filter.FormatDuration(finish.Sub(time.Unix(self.entry.StartTs, 0)))}
+	}
+	if strings.HasPrefix(key, "env.") {
+		if val, ok := self.entry.Env[key[len("env."):]]; ok {
+			return []string{val}
+		}
+	} else if strings.HasPrefix(key, "meta.") {
+		if val, ok := self.meta[key[len("meta."):]]; ok {
+			return []string{val}
+		}
+	}
+	return nil
+}
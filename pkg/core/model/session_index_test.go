@@ -0,0 +1,99 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionIndexLookup(t *testing.T) {
+	root := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(root, "sid"), 0755)
+	path := ExecutedStatusFilePath{root, "sid", "status"}
+
+	env := newTestEnv()
+	env.Set("cluster.name", "prod")
+	writeNestedStatusForTest(env, path.Full())
+
+	index := LoadSessionIndex(root)
+	entry, parsed := index.Lookup(path, false)
+	if entry == nil || parsed == nil {
+		t.Fatalf("first lookup should parse the status file")
+	}
+	if entry.Env["cluster.name"] != "prod" || len(entry.Cmds) != 1 || entry.Result != ExecutedResultError {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	index.Save()
+	if tmps, _ := filepath.Glob(filepath.Join(root, ".index.*.tmp")); len(tmps) != 0 {
+		t.Errorf("the temp files should not be left: %v", tmps)
+	}
+
+	index = LoadSessionIndex(root)
+	entry, parsed = index.Lookup(path, false)
+	if entry == nil || parsed != nil {
+		t.Fatalf("should use the cached entry")
+	}
+
+	// Modify the status file, the entry should be refreshed
+	time.Sleep(10 * time.Millisecond)
+	f, _ := os.OpenFile(path.Full(), os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.WriteString(markedOneLineContent("cmd", 0, "more"))
+	_ = f.Close()
+	if _, parsed = index.Lookup(path, false); parsed == nil {
+		t.Fatalf("stale entry should be refreshed")
+	}
+
+	// The entry of a running session is not cached, the index won't be rewritten for it
+	index.Save()
+	index = LoadSessionIndex(root)
+	f, _ = os.OpenFile(path.Full(), os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.WriteString(markedOneLineContent("cmd", 0, "running"))
+	_ = f.Close()
+	if entry, parsed = index.Lookup(path, true); entry == nil || parsed == nil {
+		t.Fatalf("the running session should be parsed")
+	}
+	if _, ok := index.Entries["sid"]; ok {
+		t.Errorf("the entry of a running session should not be cached")
+	}
+	index.dirty = false
+	if entry, _ = index.Lookup(path, true); entry == nil || index.dirty {
+		t.Errorf("the index should not be changed by a running session")
+	}
+
+	index.Prune(nil)
+	if len(index.Entries) != 0 {
+		t.Errorf("entries should be pruned")
+	}
+}
+
+func TestSessionRecordQuery(t *testing.T) {
+	now := time.Now()
+	entry := &SessionIndexEntry{
+		Flow:     "deploy : test",
+		Result:   ExecutedResultSucceeded,
+		StartTs:  now.Add(-time.Hour).Unix(),
+		FinishTs: now.Add(-time.Hour + 20*time.Minute).Unix(),
+		Cmds:     []string{"deploy", "test"},
+		Env:      map[string]string{"cluster.name": "prod"},
+	}
+	record := sessionRecord{"sid", entry, false, SessionMeta{SessionMetaPinned: "true"}, now}
+
+	for str, expected := range map[string]bool{
+		"status=ok cmd~deploy since=2d env.cluster.name=prod duration>10m": true,
+		"status=error":     false,
+		"pinned=true":      true,
+		"since=30m":        false,
+		"meta.pinned=true": true,
+		"id=sid deploy":    true,
+		"duration>1h":      false,
+	} {
+		query, err := ParseSessionQuery(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query.Match(record) != expected {
+			t.Errorf("'%s': expect %v", str, expected)
+		}
+	}
+}
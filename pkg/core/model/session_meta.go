@@ -0,0 +1,183 @@
+package model
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Session meta is a small key-value file in the session dir,
+// use for the info not belong to the executing status, eg: which session this one retried from
+type SessionMeta map[string]string
+
+const (
+	SessionMetaRetryOf   = "retry-of"
+	SessionMetaRetryFrom = "retry-from"
+	SessionMetaRetrySkip = "retry-skip"
+
+	SessionMetaImportedFrom = "imported-from"
+	SessionMetaImportedAt   = "imported-at"
+
+	// Tags are comma separated, tagged sessions are protected from automatic cleanup
+	SessionMetaTags = "tags"
+	SessionMetaNote = "note"
+
+	// In the session subdir of a background task, the reason of 'bg.kill' or timeout
+	SessionMetaAborted = "aborted"
+)
+
+func sessionMetaPath(env *Env, dirName string) (string, error) {
+	sessionsRoot := env.GetRaw("sys.paths.sessions")
+	if len(sessionsRoot) == 0 {
+		return "", fmt.Errorf("[SessionMeta] can't get sessions' root path")
+	}
+	fileName := env.GetRaw("strs.session-meta-file")
+	if len(fileName) == 0 {
+		return "", fmt.Errorf("[SessionMeta] session meta file name not found in env")
+	}
+	return filepath.Join(sessionsRoot, dirName, fileName), nil
+}
+
+// LoadSessionMeta returns an empty meta if the file not exists or can't be read
+func LoadSessionMeta(env *Env, dirName string) SessionMeta {
+	path, err := sessionMetaPath(env, dirName)
+	if err != nil {
+		return SessionMeta{}
+	}
+	return loadSessionMetaFile(path)
+}
+
+func loadSessionMetaFile(path string) SessionMeta {
+	meta := SessionMeta{}
+	file, err := os.Open(path)
+	if err != nil {
+		return meta
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			continue
+		}
+		meta[line[:i]] = line[i+1:]
+	}
+	return meta
+}
+
+func SaveSessionMeta(env *Env, dirName string, meta SessionMeta) error {
+	path, err := sessionMetaPath(env, dirName)
+	if err != nil {
+		return err
+	}
+	return saveSessionMetaFile(path, meta)
+}
+
+func saveSessionMetaFile(path string, meta SessionMeta) error {
+	var keys []string
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf strings.Builder
+	for _, k := range keys {
+		buf.WriteString(k + "=" + meta[k] + "\n")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0644); err != nil {
+		return fmt.Errorf("[SaveSessionMeta] write session meta file '%s' failed: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("[SaveSessionMeta] rename session meta file '%s' failed: %v", path, err)
+	}
+	return nil
+}
+
+func SetSessionMeta(env *Env, dirName string, kvs ...string) error {
+	if len(kvs)%2 != 0 {
+		// PANIC: Programming error - key-values should be pairs
+		panic(fmt.Errorf("[SetSessionMeta] key-values are not paired: %v", kvs))
+	}
+	meta := LoadSessionMeta(env, dirName)
+	for i := 0; i < len(kvs); i += 2 {
+		if len(kvs[i+1]) == 0 {
+			delete(meta, kvs[i])
+		} else {
+			meta[kvs[i]] = kvs[i+1]
+		}
+	}
+	return SaveSessionMeta(env, dirName, meta)
+}
+
+// MarkBgTaskAborted records the abort reason in the session subdir of a background task
+func MarkBgTaskAborted(env *Env, bgSessionDir string, reason string) error {
+	path := filepath.Join(bgSessionDir, env.GetRaw("strs.session-meta-file"))
+	meta := loadSessionMetaFile(path)
+	meta[SessionMetaAborted] = reason
+	return saveSessionMetaFile(path, meta)
+}
+
+// ParseSessionTags splits tags by comma or spaces, empty and duplicated tags are removed
+func ParseSessionTags(str string) (tags []string) {
+	fields := strings.FieldsFunc(str, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	return MergeSessionTags(nil, fields...)
+}
+
+func SessionTags(meta SessionMeta) []string {
+	return ParseSessionTags(meta[SessionMetaTags])
+}
+
+func MergeSessionTags(tags []string, added ...string) []string {
+	exists := map[string]bool{}
+	for _, tag := range tags {
+		exists[tag] = true
+	}
+	for _, tag := range added {
+		tag = strings.TrimSpace(tag)
+		if len(tag) == 0 || exists[tag] {
+			continue
+		}
+		exists[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// AddSessionTags returns the tags of the session after adding
+func AddSessionTags(env *Env, dirName string, tags ...string) ([]string, error) {
+	meta := LoadSessionMeta(env, dirName)
+	merged := MergeSessionTags(SessionTags(meta), tags...)
+	return merged, SetSessionMeta(env, dirName, SessionMetaTags, strings.Join(merged, ","))
+}
+
+// RemoveSessionTags removes all tags if 'tags' is empty, returns the tags of the session after removing
+func RemoveSessionTags(env *Env, dirName string, tags ...string) ([]string, error) {
+	removing := map[string]bool{}
+	for _, tag := range tags {
+		removing[tag] = true
+	}
+	var kept []string
+	if len(tags) != 0 {
+		for _, tag := range SessionTags(LoadSessionMeta(env, dirName)) {
+			if !removing[tag] {
+				kept = append(kept, tag)
+			}
+		}
+	}
+	return kept, SetSessionMeta(env, dirName, SessionMetaTags, strings.Join(kept, ","))
+}
+
+// SetSessionNote sets the note of a session, the meta file is line based so line breaks are folded
+func SetSessionNote(env *Env, dirName string, text string) error {
+	text = strings.Join(strings.Fields(text), " ")
+	return SetSessionMeta(env, dirName, SessionMetaNote, text)
+}
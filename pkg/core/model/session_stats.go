@@ -0,0 +1,211 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SessionsStats aggregates the executed cmds over sessions, the sessions should be sorted from old to new
+type SessionsStats struct {
+	Sessions int         `json:"sessions"`
+	Cmds     []*CmdStats `json:"cmds"`
+}
+
+type CmdStats struct {
+	Cmd         string          `json:"cmd"`
+	Runs        int             `json:"runs"`
+	Succeeded   int             `json:"succeeded"`
+	Failed      int             `json:"failed"`
+	SuccessRate float64         `json:"success-rate"`
+	P50         time.Duration   `json:"p50-ns"`
+	P95         time.Duration   `json:"p95-ns"`
+	Max         time.Duration   `json:"max-ns"`
+	RecentP50   time.Duration   `json:"recent-p50-ns"`
+	Slower      bool            `json:"slower"`
+	TopErrors   []CmdErrorCount `json:"top-errors,omitempty"`
+
+	durs   []time.Duration
+	errors map[string]int
+}
+
+type CmdErrorCount struct {
+	Error string `json:"error"`
+	Count int    `json:"count"`
+}
+
+type SessionsStatsArgs struct {
+	// The latest runs of a cmd are compared with the earlier runs to tell if it's newly slower
+	RecentRuns  int
+	SlowerRatio float64
+	TopErrors   int
+}
+
+func NewSessionsStats(sessions []SessionStatus, args SessionsStatsArgs) *SessionsStats {
+	stats := &SessionsStats{}
+	index := map[string]*CmdStats{}
+	for _, session := range sessions {
+		if session.Status == nil || session.Running {
+			continue
+		}
+		stats.Sessions += 1
+		stats.collect(session.Status, index)
+	}
+	for _, it := range stats.Cmds {
+		it.finish(args)
+	}
+	sort.Slice(stats.Cmds, func(i, j int) bool {
+		if stats.Cmds[i].Runs != stats.Cmds[j].Runs {
+			return stats.Cmds[i].Runs > stats.Cmds[j].Runs
+		}
+		return stats.Cmds[i].Cmd < stats.Cmds[j].Cmd
+	})
+	return stats
+}
+
+func (self *SessionsStats) collect(flow *ExecutedFlow, index map[string]*CmdStats) {
+	for _, cmd := range flow.Cmds {
+		if cmd.SubFlow != nil {
+			self.collect(cmd.SubFlow, index)
+		}
+		// The delayed cmd is recorded in its subflow
+		if cmd.IsDelay {
+			continue
+		}
+		if cmd.Result != ExecutedResultSucceeded && cmd.Result != ExecutedResultError {
+			continue
+		}
+		stats, ok := index[cmd.Cmd]
+		if !ok {
+			stats = &CmdStats{Cmd: cmd.Cmd, errors: map[string]int{}}
+			index[cmd.Cmd] = stats
+			self.Cmds = append(self.Cmds, stats)
+		}
+		stats.Runs += 1
+		if cmd.Result == ExecutedResultSucceeded {
+			stats.Succeeded += 1
+		} else {
+			stats.Failed += 1
+			if msg := firstErrLine(cmd.ErrStrs); len(msg) != 0 {
+				stats.errors[msg] += 1
+			}
+		}
+		if !cmd.StartTs.IsZero() && !cmd.FinishTs.IsZero() {
+			stats.durs = append(stats.durs, cmd.FinishTs.Sub(cmd.StartTs))
+		}
+	}
+}
+
+func (self *CmdStats) finish(args SessionsStatsArgs) {
+	if self.Runs > 0 {
+		self.SuccessRate = float64(self.Succeeded) / float64(self.Runs)
+	}
+
+	if len(self.durs) != 0 {
+		sorted := sortedDurs(self.durs)
+		self.P50 = DurPercentile(sorted, 50)
+		self.P95 = DurPercentile(sorted, 95)
+		self.Max = sorted[len(sorted)-1]
+
+		// Need enough earlier runs to compare with
+		if args.RecentRuns > 0 && len(self.durs) >= args.RecentRuns*2 {
+			recent := self.durs[len(self.durs)-args.RecentRuns:]
+			earlier := self.durs[:len(self.durs)-args.RecentRuns]
+			self.RecentP50 = DurPercentile(sortedDurs(recent), 50)
+			earlierP50 := DurPercentile(sortedDurs(earlier), 50)
+			self.Slower = float64(self.RecentP50) > float64(earlierP50)*args.SlowerRatio
+		}
+	}
+
+	for msg, cnt := range self.errors {
+		self.TopErrors = append(self.TopErrors, CmdErrorCount{msg, cnt})
+	}
+	sort.Slice(self.TopErrors, func(i, j int) bool {
+		if self.TopErrors[i].Count != self.TopErrors[j].Count {
+			return self.TopErrors[i].Count > self.TopErrors[j].Count
+		}
+		return self.TopErrors[i].Error < self.TopErrors[j].Error
+	})
+	if args.TopErrors >= 0 && len(self.TopErrors) > args.TopErrors {
+		self.TopErrors = self.TopErrors[:args.TopErrors]
+	}
+}
+
+func sortedDurs(durs []time.Duration) []time.Duration {
+	sorted := append([]time.Duration{}, durs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// DurPercentile returns the nearest-rank percentile of sorted durations
+func DurPercentile(sorted []time.Duration, percent int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (percent*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func firstErrLine(errStrs []string) string {
+	for _, line := range errStrs {
+		line = strings.TrimSpace(line)
+		if len(line) != 0 {
+			return line
+		}
+	}
+	return ""
+}
+
+func (self *SessionsStats) FormatText() string {
+	if len(self.Cmds) == 0 {
+		return fmt.Sprintf("no executed cmds in %d sessions\n", self.Sessions)
+	}
+
+	header := []string{"cmd", "runs", "ok%", "p50", "p95", "max", "recent-p50", "trend"}
+	rows := [][]string{header}
+	for _, it := range self.Cmds {
+		trend := ""
+		recent := "-"
+		if it.RecentP50 != 0 {
+			recent = fmtStatsDur(it.RecentP50)
+		}
+		if it.Slower {
+			trend = "slower"
+		}
+		rows = append(rows, []string{
+			it.Cmd,
+			fmt.Sprintf("%d", it.Runs),
+			fmt.Sprintf("%.1f", it.SuccessRate*100),
+			fmtStatsDur(it.P50),
+			fmtStatsDur(it.P95),
+			fmtStatsDur(it.Max),
+			recent,
+			trend,
+		})
+	}
+
+	var buf strings.Builder
+	buf.WriteString(FormatTextTable(rows))
+
+	for _, it := range self.Cmds {
+		if len(it.TopErrors) == 0 {
+			continue
+		}
+		buf.WriteString("\n[" + it.Cmd + "] frequent errors:\n")
+		for _, err := range it.TopErrors {
+			buf.WriteString(fmt.Sprintf("    %dx %s\n", err.Count, err.Error))
+		}
+	}
+	return buf.String()
+}
+
+func fmtStatsDur(dur time.Duration) string {
+	if dur < time.Second {
+		return dur.Round(time.Millisecond).String()
+	}
+	return dur.Round(time.Second).String()
+}
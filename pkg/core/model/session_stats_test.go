@@ -0,0 +1,65 @@
+package model
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStatsSessionForTest(start time.Time, dur time.Duration, result ExecutedResult, errStr string) SessionStatus {
+	flow := NewExecutedFlow("test")
+	cmd := NewExecutedCmd("db.query")
+	cmd.StartTs = start
+	cmd.FinishTs = start.Add(dur)
+	cmd.Result = result
+	if len(errStr) != 0 {
+		cmd.ErrStrs = []string{errStr, "detail"}
+	}
+	flow.Cmds = append(flow.Cmds, cmd)
+	return SessionStatus{Status: flow}
+}
+
+func TestDurPercentile(t *testing.T) {
+	var durs []time.Duration
+	for i := 1; i <= 20; i++ {
+		durs = append(durs, time.Duration(i)*time.Second)
+	}
+	if p := DurPercentile(durs, 50); p != 10*time.Second {
+		t.Errorf("expect p50 = 10s, got %v", p)
+	}
+	if p := DurPercentile(durs, 95); p != 19*time.Second {
+		t.Errorf("expect p95 = 19s, got %v", p)
+	}
+	if p := DurPercentile(nil, 95); p != 0 {
+		t.Errorf("expect 0 for empty durations, got %v", p)
+	}
+}
+
+func TestSessionsStats(t *testing.T) {
+	now := time.Now()
+	var sessions []SessionStatus
+	for i := 0; i < 6; i++ {
+		sessions = append(sessions, newStatsSessionForTest(now, time.Second, ExecutedResultSucceeded, ""))
+	}
+	sessions = append(sessions, newStatsSessionForTest(now, 5*time.Second, ExecutedResultError, "timeout"))
+	sessions = append(sessions, newStatsSessionForTest(now, 5*time.Second, ExecutedResultError, "timeout"))
+	sessions = append(sessions, newStatsSessionForTest(now, 5*time.Second, ExecutedResultSucceeded, ""))
+
+	stats := NewSessionsStats(sessions, SessionsStatsArgs{RecentRuns: 3, SlowerRatio: 1.2, TopErrors: 3})
+	if stats.Sessions != 9 || len(stats.Cmds) != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	cmd := stats.Cmds[0]
+	if cmd.Runs != 9 || cmd.Failed != 2 || cmd.Max != 5*time.Second || cmd.P50 != time.Second {
+		t.Errorf("unexpected cmd stats: %+v", cmd)
+	}
+	if !cmd.Slower || cmd.RecentP50 != 5*time.Second {
+		t.Errorf("should be marked as slower: %+v", cmd)
+	}
+	if len(cmd.TopErrors) != 1 || cmd.TopErrors[0].Error != "timeout" || cmd.TopErrors[0].Count != 2 {
+		t.Errorf("unexpected top errors: %+v", cmd.TopErrors)
+	}
+	if text := stats.FormatText(); !strings.Contains(text, "slower") || !strings.Contains(text, "2x timeout") {
+		t.Errorf("unexpected text output:\n%s", text)
+	}
+}
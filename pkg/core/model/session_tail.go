@@ -0,0 +1,127 @@
+package model
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+type SessionLogLine struct {
+	Cmd  string
+	Line string
+}
+
+// SessionLogFollower follows the log files of the cmds in a session, it's polled with the re-parsed status.
+// The cmds in the main flow are followed one by one in order, it switches to the next one when the current one
+// finished or the next one started. The cmds in bg tasks are running concurrently, they are followed all the time.
+type SessionLogFollower struct {
+	offsets map[string]int64
+	pending map[string]string
+	curr    int
+}
+
+func NewSessionLogFollower() *SessionLogFollower {
+	return &SessionLogFollower{
+		offsets: map[string]int64{},
+		pending: map[string]string{},
+	}
+}
+
+// Poll returns the new lines since last poll, all logs will be drained if 'final' is true
+func (self *SessionLogFollower) Poll(status *ExecutedFlow, final bool) (lines []SessionLogLine) {
+	var mains []*ExecutedCmd
+	var bgs []*ExecutedCmd
+	collectLoggedCmds(status, false, &mains, &bgs)
+
+	for self.curr < len(mains) {
+		cmd := mains[self.curr]
+		done := final || cmd.Result != ExecutedResultIncompleted || self.curr < len(mains)-1
+		lines = append(lines, self.read(cmd, done)...)
+		if !done {
+			break
+		}
+		self.curr += 1
+	}
+	for _, cmd := range bgs {
+		lines = append(lines, self.read(cmd, final || cmd.Result != ExecutedResultIncompleted)...)
+	}
+	return
+}
+
+func (self *SessionLogFollower) read(cmd *ExecutedCmd, flush bool) (lines []SessionLogLine) {
+	for _, line := range self.readLines(cmd.LogFilePath, flush) {
+		lines = append(lines, SessionLogLine{cmd.Cmd, line})
+	}
+	return
+}
+
+// PollFile returns the new lines of a single file since last poll, eg: the output of a detached session
+func (self *SessionLogFollower) PollFile(path string, final bool) []string {
+	return self.readLines(path, final)
+}
+
+func (self *SessionLogFollower) readLines(path string, flush bool) []string {
+	data := self.pending[path]
+	if file, err := os.Open(path); err == nil {
+		if _, err = file.Seek(self.offsets[path], io.SeekStart); err == nil {
+			if newData, err := io.ReadAll(file); err == nil {
+				self.offsets[path] += int64(len(newData))
+				data += string(newData)
+			}
+		}
+		_ = file.Close()
+	}
+
+	i := strings.LastIndex(data, "\n")
+	complete := ""
+	if i >= 0 {
+		complete = data[:i]
+		data = data[i+1:]
+	}
+	if flush && len(data) != 0 {
+		if i >= 0 {
+			complete += "\n"
+		}
+		complete += data
+		data = ""
+	}
+	self.pending[path] = data
+
+	if i < 0 && len(complete) == 0 {
+		return nil
+	}
+	return strings.Split(complete, "\n")
+}
+
+// HasRunningBgTasks returns true if any delayed(bg) task in the flow is not finished,
+// the logs of them could still be written after the main flow finished
+func HasRunningBgTasks(flow *ExecutedFlow) bool {
+	if flow == nil {
+		return false
+	}
+	for _, cmd := range flow.Cmds {
+		if cmd.IsDelay && cmd.Result == ExecutedResultIncompleted {
+			return true
+		}
+		if HasRunningBgTasks(cmd.SubFlow) {
+			return true
+		}
+	}
+	return false
+}
+
+func collectLoggedCmds(flow *ExecutedFlow, inBg bool, mains *[]*ExecutedCmd, bgs *[]*ExecutedCmd) {
+	if flow == nil {
+		return
+	}
+	for _, cmd := range flow.Cmds {
+		if len(cmd.LogFilePath) != 0 {
+			if inBg {
+				*bgs = append(*bgs, cmd)
+			} else {
+				*mains = append(*mains, cmd)
+			}
+		}
+		collectLoggedCmds(cmd.SubFlow, inBg || cmd.IsDelay, mains, bgs)
+	}
+}
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSessionLogFollower(t *testing.T) {
+	dir := t.TempDir()
+	log1 := filepath.Join(dir, "log1")
+	log2 := filepath.Join(dir, "log2")
+	_ = os.WriteFile(log1, []byte("a1\na2"), 0644)
+
+	status := NewExecutedFlow("sid")
+	cmd1 := NewExecutedCmd("cmd1")
+	cmd1.LogFilePath = log1
+	status.Cmds = append(status.Cmds, cmd1)
+
+	follower := NewSessionLogFollower()
+	lines := follower.Poll(status, false)
+	if len(lines) != 1 || lines[0].Cmd != "cmd1" || lines[0].Line != "a1" {
+		t.Fatalf("unexpected lines: %+v", lines)
+	}
+
+	// The next cmd started, the partial line of the current one should be flushed
+	f, _ := os.OpenFile(log1, os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = f.WriteString("-end\n")
+	_ = f.Close()
+	_ = os.WriteFile(log2, []byte("b1\n"), 0644)
+	cmd2 := NewExecutedCmd("cmd2")
+	cmd2.LogFilePath = log2
+	status.Cmds = append(status.Cmds, cmd2)
+
+	lines = follower.Poll(status, false)
+	if len(lines) != 2 || lines[0].Line != "a2-end" || lines[1].Cmd != "cmd2" || lines[1].Line != "b1" {
+		t.Fatalf("unexpected lines: %+v", lines)
+	}
+
+	_ = os.WriteFile(log2, []byte("b1\nb2"), 0644)
+	lines = follower.Poll(status, true)
+	if len(lines) != 1 || lines[0].Line != "b2" {
+		t.Fatalf("unexpected lines: %+v", lines)
+	}
+	if lines = follower.Poll(status, true); len(lines) != 0 {
+		t.Fatalf("should be no more lines: %+v", lines)
+	}
+}
+
+func TestHasRunningBgTasks(t *testing.T) {
+	status := NewExecutedFlow("sid")
+	main := NewExecutedCmd("main")
+	main.Result = ExecutedResultSucceeded
+	status.Cmds = append(status.Cmds, main)
+	if HasRunningBgTasks(status) {
+		t.Fatalf("no bg tasks")
+	}
+
+	bg := NewExecutedCmd("bg")
+	bg.IsDelay = true
+	bg.Result = ExecutedResultIncompleted
+	main.SubFlow = NewExecutedFlow("sub")
+	main.SubFlow.Cmds = append(main.SubFlow.Cmds, bg)
+	if !HasRunningBgTasks(status) {
+		t.Fatalf("the bg task in the subflow is running")
+	}
+
+	bg.Result = ExecutedResultSucceeded
+	if HasRunningBgTasks(status) {
+		t.Fatalf("the bg task is finished")
+	}
+}
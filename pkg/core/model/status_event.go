@@ -0,0 +1,384 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The status file could be written in two formats:
+//   - text: the nested marked-text format, the default one
+//   - jsonl: append-only JSON Lines, one event per line, easy to be consumed by other tools
+// Both of them are generated from the same status events, and both could be parsed by 'ParseExecutedFlow'
+
+const (
+	StatusFormatText  = "text"
+	StatusFormatJsonl = "jsonl"
+)
+
+const (
+	StatusEventFlowStart     = "flow-start"
+	StatusEventFlowFinish    = "flow-finish"
+	StatusEventCmdStart      = "cmd-start"
+	StatusEventCmdFinish     = "cmd-finish"
+	StatusEventEnv           = "env"
+	StatusEventAsyncSchedule = "async-schedule"
+	StatusEventSubFlowStart  = "subflow-start"
+	StatusEventSubFlowFinish = "subflow-finish"
+)
+
+const (
+	StatusEnvPhaseStart  = "start"
+	StatusEnvPhaseFinish = "finish"
+)
+
+type StatusEvent struct {
+	Event  string            `json:"event"`
+	Level  int               `json:"level"`
+	Ts     string            `json:"ts,omitempty"`
+	Flow   string            `json:"flow,omitempty"`
+	Cmd    string            `json:"cmd,omitempty"`
+	Log    string            `json:"log,omitempty"`
+	Tid    string            `json:"tid,omitempty"`
+	Phase  string            `json:"phase,omitempty"`
+	Env    map[string]string `json:"env,omitempty"`
+	Result string            `json:"result,omitempty"`
+	Error  []string          `json:"error,omitempty"`
+}
+
+func NormalizeStatusFormat(format string) string {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == StatusFormatJsonl || format == "json" || format == "jsonlines" {
+		return StatusFormatJsonl
+	}
+	return StatusFormatText
+}
+
+// DetectStatusFormat tells the format by the content of a status file
+func DetectStatusFormat(data []byte) string {
+	trimed := bytes.TrimSpace(data)
+	if len(trimed) != 0 && trimed[0] == '{' {
+		return StatusFormatJsonl
+	}
+	return StatusFormatText
+}
+
+func newEnvStatusEvent(env *Env, phase string, level int) StatusEvent {
+	return StatusEvent{
+		Event: StatusEventEnv,
+		Level: level,
+		Phase: phase,
+		Env:   statusEnvKvs(env),
+	}
+}
+
+func writeStatusEvent(w io.Writer, event StatusEvent, format string) {
+	// Empty env snapshots are not recorded, same as the text format
+	if event.Event == StatusEventEnv && len(event.Env) == 0 {
+		return
+	}
+	if format == StatusFormatJsonl {
+		data, err := json.Marshal(event)
+		if err != nil {
+			// PANIC: Programming error - status event should always be encodable
+			panic(fmt.Errorf("[StatusEvent] encode event '%s' failed: %v", event.Event, err))
+		}
+		fprintf(w, "%s\n", data)
+		return
+	}
+	writeStatusEventAsText(w, event)
+}
+
+func writeStatusEventAsText(w io.Writer, event StatusEvent) {
+	level := event.Level
+	switch event.Event {
+	case StatusEventFlowStart:
+		fprintf(w, "%s", markedContent("flow", level, event.Flow))
+		fprintf(w, "%s", markedOneLineContent("flow-start-time", level, event.Ts))
+	case StatusEventSubFlowStart:
+		fprintf(w, "%s\n", markStartStr("subflow", level-1))
+		fprintf(w, "%s", markedContent("flow", level, event.Flow))
+		fprintf(w, "%s", markedOneLineContent("flow-start-time", level, event.Ts))
+	case StatusEventFlowFinish, StatusEventSubFlowFinish:
+		fprintf(w, "%s", markedOneLineContent("flow-finish-time", level, event.Ts))
+		fprintf(w, "%s", markedOneLineContent("flow-result", level, event.Result))
+		if event.Event == StatusEventSubFlowFinish {
+			fprintf(w, "%s\n", markFinishStr("subflow", level-1))
+		}
+	case StatusEventCmdStart:
+		fprintf(w, "%s", markedOneLineContent("cmd", level, event.Cmd))
+		fprintf(w, "%s", markedOneLineContent("cmd-start-time", level, event.Ts))
+		if len(event.Log) != 0 {
+			fprintf(w, "%s", markedOneLineContent("log", level, event.Log))
+		}
+	case StatusEventAsyncSchedule:
+		fprintf(w, "%s", markedOneLineContent("cmd", level, event.Cmd))
+		fprintf(w, "%s", markedOneLineContent("cmd-start-time", level, event.Ts))
+		fprintf(w, "%s", markedOneLineContent("scheduled", level, event.Tid))
+	case StatusEventEnv:
+		writeEnvKvs(w, event.Env, "env-"+event.Phase, level)
+	case StatusEventCmdFinish:
+		fprintf(w, "%s", markedOneLineContent("cmd-finish-time", level, event.Ts))
+		fprintf(w, "%s", markedOneLineContent("cmd-result", level, event.Result))
+		if len(event.Error) != 0 {
+			fprintf(w, "%s", markedContent("error", level, event.Error...))
+		}
+	default:
+		// PANIC: Programming error - unknown status event
+		panic(fmt.Errorf("[StatusEvent] unknown event '%s'", event.Event))
+	}
+}
+
+// parseExecutedFlowJsonl rebuilds the executed flow from the events, a stack of flows tracks the subflows.
+// Unparsable lines (eg: the last line is being written) are tolerated, and recorded as corrupted
+func parseExecutedFlowJsonl(path ExecutedStatusFilePath, lines []string) (lastActiveTs time.Time, executed *ExecutedFlow) {
+	executed = NewExecutedFlow(path.DirName)
+	flows := []*ExecutedFlow{executed}
+	var corrupted []string
+
+	currCmd := func() *ExecutedCmd {
+		flow := flows[len(flows)-1]
+		if len(flow.Cmds) == 0 {
+			return nil
+		}
+		return flow.Cmds[len(flow.Cmds)-1]
+	}
+
+	for i, line := range lines {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		var event StatusEvent
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			corrupted = lines[i:]
+			break
+		}
+		var ts time.Time
+		if len(event.Ts) != 0 {
+			var err error
+			ts, err = time.ParseInLocation(SessionTimeFormat, event.Ts, time.Local)
+			if err != nil {
+				corrupted = lines[i:]
+				break
+			}
+			lastActiveTs = ts
+		}
+
+		flow := flows[len(flows)-1]
+		cmd := currCmd()
+		ok := true
+		switch event.Event {
+		case StatusEventFlowStart:
+			flow.Flow = event.Flow
+			flow.StartTs = ts
+		case StatusEventSubFlowStart:
+			if cmd == nil {
+				ok = false
+				break
+			}
+			cmd.SubFlow = NewExecutedFlow(path.DirName)
+			cmd.SubFlow.Flow = event.Flow
+			cmd.SubFlow.StartTs = ts
+			flows = append(flows, cmd.SubFlow)
+		case StatusEventFlowFinish, StatusEventSubFlowFinish:
+			flow.FinishTs = ts
+			flow.Result = ExecutedResult(event.Result)
+			if event.Event == StatusEventSubFlowFinish {
+				if len(flows) == 1 {
+					ok = false
+					break
+				}
+				flows = flows[:len(flows)-1]
+			}
+		case StatusEventCmdStart:
+			cmd = NewExecutedCmd(strings.TrimSpace(event.Cmd))
+			cmd.StartTs = ts
+			cmd.LogFilePath = event.Log
+			flow.Cmds = append(flow.Cmds, cmd)
+		case StatusEventAsyncSchedule:
+			cmd = NewExecutedCmd(strings.TrimSpace(event.Cmd))
+			cmd.StartTs = ts
+			flow.Cmds = append(flow.Cmds, cmd)
+			if bgLastActiveTs := loadScheduledCmd(cmd, path, event.Tid); bgLastActiveTs.After(lastActiveTs) {
+				lastActiveTs = bgLastActiveTs
+			}
+		case StatusEventEnv:
+			if cmd == nil {
+				ok = false
+				break
+			}
+			env := NewEnvEx(EnvLayerSession)
+			for k, v := range event.Env {
+				env.Set(k, v)
+			}
+			if event.Phase == StatusEnvPhaseFinish {
+				cmd.FinishEnv = env
+			} else {
+				cmd.StartEnv = env
+			}
+		case StatusEventCmdFinish:
+			if cmd == nil {
+				ok = false
+				break
+			}
+			cmd.FinishTs = ts
+			cmd.Result = ExecutedResult(event.Result)
+			cmd.ErrStrs = event.Error
+			cmd.CalResultInCaseIncompleted()
+		default:
+			ok = false
+		}
+		if !ok {
+			corrupted = lines[i:]
+			break
+		}
+	}
+
+	fillUnfinishedTs(executed, lastActiveTs)
+	if len(corrupted) != 0 {
+		executed.Corrupted = getSampleLines(corrupted)
+	}
+	return
+}
+
+// fillUnfinishedTs sets the finish ts of the unfinished cmds and flows to the last active ts, same as the text parser
+func fillUnfinishedTs(flow *ExecutedFlow, lastActiveTs time.Time) {
+	if flow.FinishTs.IsZero() {
+		flow.FinishTs = lastActiveTs
+	}
+	for _, cmd := range flow.Cmds {
+		if cmd.FinishTs.IsZero() {
+			cmd.FinishTs = lastActiveTs
+		}
+		if cmd.SubFlow != nil && !cmd.IsDelay {
+			fillUnfinishedTs(cmd.SubFlow, lastActiveTs)
+		}
+	}
+}
+
+// GenStatusEvents generates the status events of an executed flow, which can be written as any format.
+// The delayed(bg) tasks only have their schedule events, their own status files are in the sub dirs
+func (self *ExecutedFlow) GenStatusEvents() (events []StatusEvent) {
+	return self.genStatusEvents(0, nil)
+}
+
+func (self *ExecutedFlow) genStatusEvents(level int, events []StatusEvent) []StatusEvent {
+	if level == 0 {
+		events = append(events, StatusEvent{Event: StatusEventFlowStart, Level: level,
+			Ts: formatStatusTs(self.StartTs), Flow: self.Flow})
+	} else {
+		// The flow strs of subflows parsed from text format have indents
+		events = append(events, StatusEvent{Event: StatusEventSubFlowStart, Level: level,
+			Ts: formatStatusTs(self.StartTs), Flow: strings.TrimSpace(self.Flow)})
+	}
+
+	for _, cmd := range self.Cmds {
+		if cmd.IsDelay {
+			tid := ""
+			if cmd.SubFlow != nil {
+				tid = filepath.Base(cmd.SubFlow.DirName)
+			}
+			events = append(events, StatusEvent{Event: StatusEventAsyncSchedule, Level: level,
+				Ts: formatStatusTs(cmd.StartTs), Cmd: cmd.Cmd, Tid: tid})
+			continue
+		}
+		events = append(events, StatusEvent{Event: StatusEventCmdStart, Level: level,
+			Ts: formatStatusTs(cmd.StartTs), Cmd: cmd.Cmd, Log: cmd.LogFilePath})
+		if cmd.StartEnv != nil {
+			events = append(events, StatusEvent{Event: StatusEventEnv, Level: level,
+				Phase: StatusEnvPhaseStart, Env: cmd.StartEnv.FlattenAll()})
+		}
+		if cmd.SubFlow != nil {
+			events = cmd.SubFlow.genStatusEvents(level+1, events)
+		}
+		if cmd.FinishEnv != nil {
+			events = append(events, StatusEvent{Event: StatusEventEnv, Level: level,
+				Phase: StatusEnvPhaseFinish, Env: cmd.FinishEnv.FlattenAll()})
+		}
+		if cmd.Result != ExecutedResultIncompleted {
+			events = append(events, StatusEvent{Event: StatusEventCmdFinish, Level: level,
+				Ts: formatStatusTs(cmd.FinishTs), Result: string(cmd.Result), Error: cmd.ErrStrs})
+		}
+	}
+
+	if self.Result != ExecutedResultIncompleted {
+		event := StatusEventFlowFinish
+		if level != 0 {
+			event = StatusEventSubFlowFinish
+		}
+		events = append(events, StatusEvent{Event: event, Level: level,
+			Ts: formatStatusTs(self.FinishTs), Result: string(self.Result)})
+	}
+	return events
+}
+
+func formatStatusTs(ts time.Time) string {
+	if ts.IsZero() {
+		return ""
+	}
+	return ts.Format(SessionTimeFormat)
+}
+
+// ConvertStatusFile rewrites a status file in another format, the corrupted ones are refused to avoid losing data.
+// Returns false if it's already in that format
+func ConvertStatusFile(path ExecutedStatusFilePath, format string) (converted bool, err error) {
+	format = NormalizeStatusFormat(format)
+	data, err := os.ReadFile(path.Full())
+	if err != nil {
+		return false, fmt.Errorf("[ConvertStatusFile] read status file '%s' failed: %v", path.Short(), err)
+	}
+	if DetectStatusFormat(data) == format {
+		return false, nil
+	}
+
+	_, executed, err := ParseExecutedFlow(path)
+	if err != nil {
+		return false, err
+	}
+	if len(executed.Corrupted) != 0 {
+		return false, fmt.Errorf("[ConvertStatusFile] status file '%s' is corrupted, can't be converted", path.Short())
+	}
+
+	buf := bytes.NewBuffer(nil)
+	for _, event := range executed.GenStatusEvents() {
+		writeStatusEvent(buf, event, format)
+	}
+	tmp := path.Full() + ".tmp"
+	if err = os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return false, fmt.Errorf("[ConvertStatusFile] write status file '%s' failed: %v", tmp, err)
+	}
+	if err = os.Rename(tmp, path.Full()); err != nil {
+		return false, fmt.Errorf("[ConvertStatusFile] rename status file '%s' failed: %v", path.Short(), err)
+	}
+	return true, nil
+}
+
+// ConvertSessionStatus converts the status files of a session, including the ones of the bg tasks
+func ConvertSessionStatus(env *Env, session SessionStatus, format string) (converted int, err error) {
+	if session.Running {
+		return 0, fmt.Errorf("[ConvertSessionStatus] session '%s' is running, can't be converted", session.DirName)
+	}
+	root := SessionsRoot(env, session.Imported)
+	statusFileName := env.GetRaw("strs.session-status-file")
+	sessionDir := filepath.Join(root, session.DirName)
+	err = filepath.Walk(sessionDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() != statusFileName {
+			return err
+		}
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		ok, err := ConvertStatusFile(ExecutedStatusFilePath{root, rel, statusFileName}, format)
+		if ok {
+			converted += 1
+		}
+		return err
+	})
+	return
+}
@@ -0,0 +1,111 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeNestedStatusForTest(env *Env, path string) {
+	flow := newTestFlow("parent")
+	env.Set("user.key", "v1")
+	executing := NewExecutingFlow(path, flow, env)
+	executing.OnCmdStart(flow, 0, env, "/tmp/parent.log")
+	executing.OnSubFlowStart(env, "child1 : child2")
+	executing.OnCmdStart(flow, 0, env, "")
+	executing.OnCmdFinish(flow, 0, env, true, nil, false)
+	executing.OnCmdStart(flow, 0, env, "")
+	env.Set("user.key", "v2")
+	executing.OnCmdFinish(flow, 0, env, false, errForTest("line1\nline2"), false)
+	executing.OnSubFlowFinish(env, false, false)
+	executing.OnCmdFinish(flow, 0, env, false, nil, false)
+	executing.OnFlowFinish(env, false)
+}
+
+type errForTest string
+
+func (self errForTest) Error() string {
+	return string(self)
+}
+
+func checkNestedStatusForTest(t *testing.T, executed *ExecutedFlow) {
+	if len(executed.Corrupted) != 0 {
+		t.Fatalf("unexpected corrupted lines: %v", executed.Corrupted)
+	}
+	if executed.Result != ExecutedResultError || len(executed.Cmds) != 1 {
+		t.Fatalf("unexpected flow: %+v", executed)
+	}
+	parent := executed.Cmds[0]
+	if parent.LogFilePath != "/tmp/parent.log" || parent.SubFlow == nil || len(parent.SubFlow.Cmds) != 2 {
+		t.Fatalf("unexpected parent cmd: %+v", parent)
+	}
+	if strings.TrimSpace(parent.SubFlow.Flow) != "child1 : child2" {
+		t.Errorf("unexpected subflow '%s'", parent.SubFlow.Flow)
+	}
+	child := parent.SubFlow.Cmds[1]
+	if child.Result != ExecutedResultError || len(child.ErrStrs) != 2 || child.ErrStrs[1] != "line2" {
+		t.Errorf("unexpected child cmd: %+v", child)
+	}
+	if child.FinishEnv == nil || child.FinishEnv.GetRaw("user.key") != "v2" {
+		t.Errorf("finish env not recorded")
+	}
+}
+
+func TestStatusEventJsonlRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	env := newTestEnv()
+	env.Set("sys.session.status-format", "jsonl")
+	_ = os.MkdirAll(filepath.Join(dir, "sid"), 0755)
+	writeNestedStatusForTest(env, filepath.Join(dir, "sid", "status"))
+
+	path := ExecutedStatusFilePath{dir, "sid", "status"}
+	_, executed, err := ParseExecutedFlow(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkNestedStatusForTest(t, executed)
+
+	data, _ := os.ReadFile(path.Full())
+	if DetectStatusFormat(data) != StatusFormatJsonl {
+		t.Fatalf("expect jsonl format, got:\n%s", data)
+	}
+
+	converted, err := ConvertStatusFile(path, StatusFormatText)
+	if err != nil || !converted {
+		t.Fatalf("convert failed: %v", err)
+	}
+	data, _ = os.ReadFile(path.Full())
+	if DetectStatusFormat(data) != StatusFormatText || !strings.Contains(string(data), "<subflow>") {
+		t.Fatalf("expect text format, got:\n%s", data)
+	}
+	_, executed, _ = ParseExecutedFlow(path)
+	checkNestedStatusForTest(t, executed)
+
+	converted, err = ConvertStatusFile(path, StatusFormatJsonl)
+	if err != nil || !converted {
+		t.Fatalf("convert back failed: %v", err)
+	}
+	_, executed, _ = ParseExecutedFlow(path)
+	checkNestedStatusForTest(t, executed)
+}
+
+func TestStatusEventJsonlPartialLine(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, "sid"), 0755)
+	content := `{"event":"flow-start","level":0,"ts":"2024-01-01 00:00:00","flow":"a : b"}
+{"event":"cmd-start","level":0,"ts":"2024-01-01 00:00:01","cmd":"a"}
+{"event":"cmd-fin`
+	_ = os.WriteFile(filepath.Join(dir, "sid", "status"), []byte(content), 0644)
+
+	_, executed, err := ParseExecutedFlow(ExecutedStatusFilePath{dir, "sid", "status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(executed.Cmds) != 1 || executed.Cmds[0].Result != ExecutedResultIncompleted {
+		t.Fatalf("unexpected cmds: %+v", executed.Cmds)
+	}
+	if executed.Cmds[0].FinishTs.IsZero() || len(executed.Corrupted) != 1 {
+		t.Errorf("unexpected parsing result: %+v", executed)
+	}
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -17,7 +18,7 @@ func SysArgRealnameAndNormalizedValue(
 		return
 	}
 	raw := name[len(sysArgPrefix):]
-	if raw == SysArgNameDelay {
+	if raw == SysArgNameDelay || raw == SysArgNameTimeout {
 		_, parseErr := strconv.ParseFloat(value, 64)
 		if parseErr == nil {
 			value += "s"
@@ -29,6 +30,18 @@ func SysArgRealnameAndNormalizedValue(
 				name, SysArgNameDelayEnvApplyPolicy, SysArgValueDelayEnvApplyPolicyApply)
 		}
 		return name, value, nil
+	} else if raw == SysArgNameDetach {
+		if !StrToTrue(value) && !StrToFalse(value) {
+			return "", "", fmt.Errorf("[Args.SysArgRealname] %s: the value of sys arg '%s' should be bool, got '%s'",
+				name, SysArgNameDetach, value)
+		}
+		return name, strconv.FormatBool(StrToTrue(value)), nil
+	} else if raw == SysArgNamePool {
+		if len(value) == 0 || strings.ContainsAny(value, " \t") {
+			return "", "", fmt.Errorf("[Args.SysArgRealname] %s: the value of sys arg '%s' should be a name without spaces, got '%s'",
+				name, SysArgNamePool, value)
+		}
+		return name, value, nil
 	} else if raw == SysArgNameError {
 		if value != SysArgValueOK {
 			return "", "", fmt.Errorf("[Args.SysArgRealname] %s: the value of sys arg '%s' could only be '%s'",
@@ -61,10 +74,40 @@ func (self SysArgVals) GetDelayDuration() (time.Duration, error) {
 	return dur, nil
 }
 
+func (self SysArgVals) HasTimeout() bool {
+	return len(self[SysArgNameTimeout]) != 0
+}
+
+// GetTimeoutDuration returns zero if there is no timeout
+func (self SysArgVals) GetTimeoutDuration() (time.Duration, error) {
+	timeoutStr := self[SysArgNameTimeout]
+	if len(timeoutStr) == 0 {
+		return 0, nil
+	}
+	dur, err := time.ParseDuration(timeoutStr)
+	if err != nil || dur <= 0 {
+		return 0, &ArgValErrWrongType{
+			fmt.Sprintf("[Cmd.AsyncExecute] sys arg '%s = %s' is not valid positive golang duration", SysArgNameTimeout, timeoutStr),
+			SysArgNameTimeout, timeoutStr, "golang duration format", err,
+		}
+	}
+	return dur, nil
+}
+
 func (self SysArgVals) IsDelayEnvEarlyApply() bool {
 	return self[SysArgNameDelayEnvApplyPolicy] == SysArgValueDelayEnvApplyPolicyApply
 }
 
+// IsDetach means the cmd should run in a new ticat process which owns its own session
+func (self SysArgVals) IsDetach() bool {
+	return StrToTrue(self[SysArgNameDetach])
+}
+
+// GetPool returns the pool name of a background cmd, empty is the default pool
+func (self SysArgVals) GetPool() string {
+	return self[SysArgNamePool]
+}
+
 func (self SysArgVals) AllowError() bool {
 	return self[SysArgNameError] == SysArgValueOK
 }
@@ -72,8 +115,11 @@ func (self SysArgVals) AllowError() bool {
 // TODO: put sys arg names into env strs
 const (
 	SysArgNameDelay               string = "delay"
+	SysArgNameTimeout             string = "timeout"
 	SysArgNameDelayEnvApplyPolicy string = "env"
 	SysArgNameError               string = "err"
+	SysArgNameDetach              string = "detach"
+	SysArgNamePool                string = "pool"
 
 	SysArgValueDelayEnvApplyPolicyApply string = "apply"
 	SysArgValueOK                       string = "ok"
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/innerr/ticat/pkg/core/model"
@@ -14,6 +15,7 @@ type CmdParser struct {
 	cmdRootNodeName string
 	TrivialMark     string
 	fakeSepSuffixs  map[byte]bool
+	prefixMatch     bool
 }
 
 func NewCmdParser(
@@ -37,15 +39,33 @@ func NewCmdParser(
 		cmdRootNodeName,
 		TrivialMark,
 		fakeSepSuffixMap,
+		false,
 	}
 }
 
+// SetPrefixMatch enables matching sub commands, arg names and env key segments by unambiguous prefixes
+func (self *CmdParser) SetPrefixMatch(enabled bool) {
+	self.prefixMatch = enabled
+}
+
 func (self *CmdParser) Parse(
 	cmds *model.CmdTree,
 	envAbbrs *model.EnvAbbrs,
 	input []string) (parsed model.ParsedCmd) {
 
-	segs, trivialLvl, err, isMinorErr := self.parse(cmds, envAbbrs, input)
+	line, tokens := ArgvToTokens(input)
+	return self.ParseTokens(cmds, envAbbrs, line, tokens)
+}
+
+// ParseTokens parses a cmd from the tokens of a command line,
+// the line is the source of the tokens' positions, use for error displaying
+func (self *CmdParser) ParseTokens(
+	cmds *model.CmdTree,
+	envAbbrs *model.EnvAbbrs,
+	line string,
+	input []Token) (parsed model.ParsedCmd) {
+
+	segs, trivialLvl, err, errPos, isMinorErr := self.parse(cmds, envAbbrs, input)
 
 	curr := model.ParsedCmdSeg{Matched: model.MatchedCmd{}}
 	var path []string
@@ -77,7 +97,13 @@ func (self *CmdParser) Parse(
 		parsed.Segments = append(parsed.Segments, curr)
 	}
 
-	parsed.ParseResult = model.ParseResult{Input: input, Error: err, IsMinorErr: isMinorErr}
+	parsed.ParseResult = model.ParseResult{
+		Input:      TokenVals(input),
+		Error:      err,
+		IsMinorErr: isMinorErr,
+		Line:       line,
+		ErrPos:     errPos,
+	}
 	parsed.TrivialLvl = trivialLvl
 	return parsed
 }
@@ -85,15 +111,28 @@ func (self *CmdParser) Parse(
 func (self *CmdParser) parse(
 	cmds *model.CmdTree,
 	envAbbrs *model.EnvAbbrs,
-	input []string) (parsed []parsedSeg, trivialLvl int, err error, isMinorErr bool) {
+	input []Token) (parsed []parsedSeg, trivialLvl int, err error, errPos int, isMinorErr bool) {
 
 	if len(input) == 0 {
-		return nil, 0, nil, false
+		return nil, 0, nil, -1, false
 	}
 
 	input, trivialLvl = self.stripTrivialMarks(input)
 
+	for _, token := range input {
+		if idx, ok := CheckQuotes(token.Val); !ok {
+			err = newUnterminatedQuoteErr(token, idx)
+			return nil, trivialLvl, model.ParseErrQuote{Origin: err}, token.Pos + idx, false
+		}
+	}
+
 	tokens := self.tokenize(input)
+	for _, token := range tokens {
+		if token.typ == ENV && !strings.HasSuffix(token.str, self.envParser.brackets.Right) {
+			err = fmt.Errorf("[CmdParser.parse] unmatched env brackets '%s'", token.str)
+			return nil, trivialLvl, model.ParseErrEnv{Origin: err}, token.pos, false
+		}
+	}
 
 	ctx := &yaccParseContext{
 		cmdParser:    self,
@@ -105,24 +144,29 @@ func (self *CmdParser) parse(
 		matchedPath:  nil,
 		trivialLvl:   trivialLvl,
 		allowSub:     true,
+		errPos:       -1,
 	}
 
 	lexer := newYYLex(tokens, ctx)
 	yyParse(lexer)
 
 	if ctx.err != nil {
-		return lexer.result, ctx.trivialLvl, model.ParseErrExpectCmd{Origin: ctx.err}, ctx.isMinorErr
+		if ambiguous, ok := ctx.err.(model.ErrAmbiguousPrefix); ok {
+			return lexer.result, ctx.trivialLvl, ambiguous, ctx.errPos, false
+		}
+		return lexer.result, ctx.trivialLvl, model.ParseErrExpectCmd{Origin: ctx.err}, ctx.errPos, ctx.isMinorErr
 	}
 
-	return lexer.result, ctx.trivialLvl, nil, false
+	return lexer.result, ctx.trivialLvl, nil, -1, false
 }
 
-func (self *CmdParser) stripTrivialMarks(input []string) ([]string, int) {
+func (self *CmdParser) stripTrivialMarks(input []Token) ([]Token, int) {
 	trivialLvl := 0
+	input = append([]Token(nil), input...)
 	for len(input) > 0 {
-		stripped := strings.TrimLeft(input[0], self.TrivialMark)
-		trivialLvl += len(input[0]) - len(stripped)
-		if len(stripped) == 0 {
+		stripped := input[0].TrimLeft(self.TrivialMark)
+		trivialLvl += len(input[0].Val) - len(stripped.Val)
+		if len(stripped.Val) == 0 {
 			input = input[1:]
 		} else {
 			input[0] = stripped
@@ -132,7 +176,7 @@ func (self *CmdParser) stripTrivialMarks(input []string) ([]string, int) {
 	return input, trivialLvl
 }
 
-func (self *CmdParser) tokenize(input []string) []yyToken {
+func (self *CmdParser) tokenize(input []Token) []yyToken {
 	var tokens []yyToken
 
 	for _, s := range input {
@@ -142,23 +186,23 @@ func (self *CmdParser) tokenize(input []string) []yyToken {
 	return tokens
 }
 
-func (self *CmdParser) tokenizeString(s string) []yyToken {
+func (self *CmdParser) tokenizeString(s Token) []yyToken {
 	var tokens []yyToken
 
-	for len(s) > 0 {
-		s = strings.TrimLeft(s, self.cmdSpaces)
-		if len(s) == 0 {
+	for len(s.Val) > 0 {
+		s = s.TrimLeft(self.cmdSpaces)
+		if len(s.Val) == 0 {
 			break
 		}
 
-		envIdx := strings.Index(s, self.envParser.brackets.Left)
+		envIdx := IndexUnquoted(s.Val, self.envParser.brackets.Left)
 		if envIdx >= 0 {
 			if envIdx > 0 {
-				tokens = append(tokens, self.tokenizePlain(s[:envIdx])...)
+				tokens = append(tokens, self.tokenizePlain(s.Sub(0, envIdx))...)
 			}
-			envStr, rest := self.extractEnvBlock(s[envIdx:])
-			if envStr != "" {
-				tokens = append(tokens, yyToken{typ: ENV, str: envStr})
+			envStr, rest := self.extractEnvBlock(s.Sub(envIdx, len(s.Val)))
+			if envStr.Val != "" {
+				tokens = append(tokens, yyToken{typ: ENV, str: envStr.Val, pos: envStr.Pos})
 				s = rest
 				continue
 			}
@@ -172,40 +216,40 @@ func (self *CmdParser) tokenizeString(s string) []yyToken {
 	return tokens
 }
 
-func (self *CmdParser) tokenizePlain(s string) []yyToken {
+func (self *CmdParser) tokenizePlain(s Token) []yyToken {
 	var tokens []yyToken
 
-	for len(s) > 0 {
-		s = strings.TrimLeft(s, self.cmdSpaces)
-		if len(s) == 0 {
+	for len(s.Val) > 0 {
+		s = s.TrimLeft(self.cmdSpaces)
+		if len(s.Val) == 0 {
 			break
 		}
 
 		// If the string contains '=', treat it as a key=value pair and don't split by '.'
 		// This handles cases like "key=1.2.3.4" where dots are in the value
-		if strings.Contains(s, self.envParser.kvSep) {
-			tokens = append(tokens, yyToken{typ: WORD, str: s})
+		if ContainsUnquoted(s.Val, self.envParser.kvSep) {
+			tokens = append(tokens, yyToken{typ: WORD, str: s.Val, pos: s.Pos})
 			break
 		}
 
-		sepIdx := strings.IndexAny(s, self.cmdAlterSeps)
+		sepIdx := IndexAnyUnquoted(s.Val, self.cmdAlterSeps)
 		if sepIdx == 0 {
-			if self.isFakeSep(s) {
-				tokens = append(tokens, yyToken{typ: WORD, str: s})
+			if self.isFakeSep(s.Val) {
+				tokens = append(tokens, yyToken{typ: WORD, str: s.Val, pos: s.Pos})
 				break
 			}
-			tokens = append(tokens, yyToken{typ: SEP, str: string(s[0])})
-			s = s[1:]
+			tokens = append(tokens, yyToken{typ: SEP, str: s.Val[:1], pos: s.Pos})
+			s = s.Sub(1, len(s.Val))
 		} else if sepIdx > 0 {
-			head := strings.TrimRight(s[:sepIdx], self.cmdSpaces)
+			head := strings.TrimRight(s.Val[:sepIdx], self.cmdSpaces)
 			if len(head) > 0 {
-				tokens = append(tokens, yyToken{typ: WORD, str: head})
+				tokens = append(tokens, yyToken{typ: WORD, str: head, pos: s.Pos})
 			}
-			tokens = append(tokens, yyToken{typ: SEP, str: string(s[sepIdx])})
-			s = s[sepIdx+1:]
+			tokens = append(tokens, yyToken{typ: SEP, str: s.Val[sepIdx : sepIdx+1], pos: s.Pos + sepIdx})
+			s = s.Sub(sepIdx+1, len(s.Val))
 		} else {
-			if len(s) > 0 {
-				tokens = append(tokens, yyToken{typ: WORD, str: s})
+			if len(s.Val) > 0 {
+				tokens = append(tokens, yyToken{typ: WORD, str: s.Val, pos: s.Pos})
 			}
 			break
 		}
@@ -214,32 +258,28 @@ func (self *CmdParser) tokenizePlain(s string) []yyToken {
 	return tokens
 }
 
-func (self *CmdParser) extractEnvBlock(s string) (string, string) {
-	if !strings.HasPrefix(s, self.envParser.brackets.Left) {
-		return "", s
-	}
-
+func (self *CmdParser) extractEnvBlock(s Token) (Token, Token) {
 	left := self.envParser.brackets.Left
 	right := self.envParser.brackets.Right
-	depth := 0
-	pos := 0
+	if !strings.HasPrefix(s.Val, left) {
+		return Token{"", s.Pos}, s
+	}
 
-	for pos < len(s) {
-		if strings.HasPrefix(s[pos:], left) {
+	depth := 0
+	end := scanUnquoted(s.Val, 0, func(i int) bool {
+		if strings.HasPrefix(s.Val[i:], left) {
 			depth++
-			pos += len(left)
-		} else if strings.HasPrefix(s[pos:], right) {
+		} else if strings.HasPrefix(s.Val[i:], right) {
 			depth--
-			pos += len(right)
-			if depth == 0 {
-				return s[:pos], s[pos:]
-			}
-		} else {
-			pos++
+			return depth == 0
 		}
+		return false
+	})
+	if end < 0 {
+		return s, Token{"", s.End()}
 	}
-
-	return s, ""
+	end += len(right)
+	return s.Sub(0, end), s.Sub(end, len(s.Val))
 }
 
 func (self *CmdParser) isFakeSep(s string) bool {
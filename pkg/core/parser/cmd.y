@@ -22,6 +22,7 @@ type yaccParseContext struct {
 	allowSub     bool
 	rest         []string
 	argIdx       int
+	errPos       int
 }
 
 %}
@@ -108,23 +109,27 @@ segment:
 %%
 
 type yyLex struct {
-	tokens     []yyToken
-	pos        int
-	result     []parsedSeg
-	ctx        *yaccParseContext
-	hasError   bool
+	tokens   []yyToken
+	pos      int
+	result   []parsedSeg
+	ctx      *yaccParseContext
+	hasError bool
+	// map[cmd-path.arg-name]values, for the list args provided multi times
+	listVals map[string][]string
 }
 
 type yyToken struct {
 	typ int
 	str string
+	pos int
 }
 
 func newYYLex(tokens []yyToken, ctx *yaccParseContext) *yyLex {
 	return &yyLex{
-		tokens: tokens,
-		pos:    0,
-		ctx:    ctx,
+		tokens:   tokens,
+		pos:      0,
+		ctx:      ctx,
+		listVals: map[string][]string{},
 	}
 }
 
@@ -148,33 +153,38 @@ func (l *yyLex) SetResult(segs []parsedSeg) {
 
 func (l *yyLex) ProcessWord(word string) parsedSeg {
 	ctx := l.ctx
-	
+
 	if ctx.allowSub && ctx.currCmd != nil {
-		sub := ctx.currCmd.GetSub(word)
+		sub, err := l.matchSub(Unquote(word))
+		if err != nil {
+			l.setError(err)
+			return parsedSeg{Type: parsedSegTypeCmd, Val: model.MatchedCmd{Name: word}}
+		}
 		if sub != nil {
 			ctx.currCmd = sub
 			if ctx.currEnvAbbrs != nil {
-				ctx.currEnvAbbrs = ctx.currEnvAbbrs.GetSub(word)
+				ctx.currEnvAbbrs = ctx.currEnvAbbrs.GetSub(sub.Name())
 			}
 			ctx.matchedPath = append(ctx.matchedPath, word)
 			ctx.allowSub = false
 			return parsedSeg{Type: parsedSegTypeCmd, Val: model.MatchedCmd{Name: word, Cmd: sub}}
 		}
 	}
-	
+
 	if ctx.allowSub {
 		errStr := "unknow input '" + word + "' ..., should be sub cmd"
 		ctx.err = fmt.Errorf("[CmdParser.parse] %s: %s", l.displayPath(), errStr)
+		ctx.errPos = l.currPos()
 		ctx.isMinorErr = false
 		l.hasError = true
 		return parsedSeg{Type: parsedSegTypeCmd, Val: model.MatchedCmd{Name: word}}
 	}
-	
+
 	env := l.tryParseAsArg(word)
 	if env != nil {
 		return parsedSeg{Type: parsedSegTypeEnv, Val: env}
 	}
-	
+
 	return parsedSeg{Type: parsedSegTypeCmd, Val: model.MatchedCmd{Name: word}}
 }
 
@@ -183,40 +193,49 @@ func (l *yyLex) tryParseAsArg(word string) model.ParsedEnv {
 	if ctx.currCmd == nil || ctx.currCmd.Cmd() == nil {
 		return nil
 	}
-	
+
+	// Sys args (eg: '%delay=10s') are available for all cmds, including the ones without args
+	if env := l.tryParseAsSysArg(word); env != nil {
+		return env
+	}
+
 	args := ctx.currCmd.Args()
 	if args.IsEmpty() {
 		return nil
 	}
-	
+
 	env := model.ParsedEnv{}
-	
-	realName := args.Realname(word)
+
+	realName := args.Realname(Unquote(word))
 	if len(realName) > 0 {
 		if l.pos < len(l.tokens) {
 			nextTok := l.tokens[l.pos]
 			if nextTok.typ == WORD {
 				l.pos++
-				env[realName] = model.NewParsedEnvArgv(realName, nextTok.str)
+				env[realName] = l.newArgVal(args, realName, Unquote(nextTok.str))
 				return env
 			}
 		}
 	}
-	
+
 	kvSep := ctx.cmdParser.envParser.kvSep
-	if strings.Contains(word, kvSep) {
-		kv := strings.SplitN(word, kvSep, 2)
+	if ContainsUnquoted(word, kvSep) {
+		kv := SplitUnquotedN(word, kvSep, 2)
 		if len(kv) == 2 {
-			key := kv[0]
-			val := kv[1]
-			realName := args.Realname(key)
+			key := Unquote(kv[0])
+			val := Unquote(kv[1])
+			realName, err := l.matchArg(args, key)
+			if err != nil {
+				l.setError(err)
+				return nil
+			}
 			if len(realName) > 0 {
-				env[realName] = model.NewParsedEnvArgv(realName, val)
+				env[realName] = l.newArgVal(args, realName, val)
 				return env
 			}
 		}
 	}
-	
+
 	names := args.Names()
 	if len(names) > ctx.argIdx {
 		name := names[ctx.argIdx]
@@ -234,21 +253,50 @@ func (l *yyLex) tryParseAsArg(word string) model.ParsedEnv {
 				break
 			}
 		}
-		env[name] = model.NewParsedEnvArgv(name, value)
+		env[name] = l.newArgVal(args, name, Unquote(value))
 		ctx.argIdx++
 		return env
 	}
-	
+
 	return nil
 }
 
+func (l *yyLex) tryParseAsSysArg(word string) model.ParsedEnv {
+	envParser := l.ctx.cmdParser.envParser
+	if len(envParser.sysArgPrefix) == 0 || !ContainsUnquoted(word, envParser.kvSep) {
+		return nil
+	}
+	kv := SplitUnquotedN(word, envParser.kvSep, 2)
+	if len(kv) != 2 {
+		return nil
+	}
+	key := Unquote(kv[0])
+	if !strings.HasPrefix(key, envParser.sysArgPrefix) {
+		return nil
+	}
+	name, val, err := model.SysArgRealnameAndNormalizedValue(key, envParser.sysArgPrefix, Unquote(kv[1]))
+	if err != nil {
+		l.setError(err)
+		return nil
+	}
+	return model.ParsedEnv{name: model.NewParsedSysArgv(name, val)}
+}
+
 func (l *yyLex) ProcessEnv(envStr string) parsedSeg {
 	ctx := l.ctx
 	env := parseEnvString(envStr, ctx.cmdParser.envParser)
-	
+
 	// Debug: print env parsing result
 	// fmt.Printf("ProcessEnv: %q -> env=%v\n", envStr, env)
-	
+
+	// The keys are kept as they are if prefix matching is off
+	if env != nil && ctx.currEnvAbbrs != nil && ctx.cmdParser.prefixMatch {
+		if err := l.matchEnvAbbrs(env); err != nil {
+			l.setError(err)
+			return parsedSeg{Type: parsedSegTypeEnv, Val: nil}
+		}
+	}
+
 	if len(ctx.matchedPath) > 0 && env != nil {
 		for k, v := range env {
 			env[k] = model.ParsedEnvVal{
@@ -260,10 +308,80 @@ func (l *yyLex) ProcessEnv(envStr string) parsedSeg {
 			}
 		}
 	}
-	
+
 	return parsedSeg{Type: parsedSegTypeEnv, Val: env}
 }
 
+func (l *yyLex) matchSub(name string) (*model.CmdTree, error) {
+	ctx := l.ctx
+	sub := ctx.currCmd.GetSub(name)
+	if sub != nil || !ctx.cmdParser.prefixMatch {
+		return sub, nil
+	}
+	return ctx.currCmd.MatchSubPrefix(name)
+}
+
+// newArgVal appends the value to the previous ones if it's a list arg,
+// the later one overwrites the previous one in env merging, so it carries all values
+func (l *yyLex) newArgVal(args model.Args, name string, val string) model.ParsedEnvVal {
+	if !args.IsList(name) {
+		return model.NewParsedEnvArgv(name, val)
+	}
+	listSep := l.ctx.currCmd.Strs.ListSep
+	key := l.ctx.currCmd.DisplayPath() + l.ctx.currCmd.Strs.PathSep + name
+	vals := append(l.listVals[key], val)
+	l.listVals[key] = vals
+	return model.NewParsedEnvArgv(name, strings.Join(vals, listSep))
+}
+
+func (l *yyLex) matchArg(args model.Args, name string) (string, error) {
+	realName := args.Realname(name)
+	if len(realName) != 0 || !l.ctx.cmdParser.prefixMatch {
+		return realName, nil
+	}
+	return args.MatchPrefix(l.ctx.currCmd, name)
+}
+
+// matchEnvAbbrs replaces the env keys with the realnames if they could be matched by env abbrs
+func (l *yyLex) matchEnvAbbrs(env model.ParsedEnv) error {
+	ctx := l.ctx
+	sep := ctx.envParser.envPathSep
+	var keys []string
+	for k := range env {
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		path, matched, err := ctx.currEnvAbbrs.TryMatchEx(k, sep, ctx.cmdParser.prefixMatch)
+		if err != nil {
+			return err
+		}
+		key := strings.Join(path, sep)
+		if !matched || key == k {
+			continue
+		}
+		v := env[k]
+		delete(env, k)
+		env[key] = model.ParsedEnvVal{Val: v.Val, IsArg: v.IsArg, IsSysArg: v.IsSysArg,
+			MatchedPath: path, MatchedPathStr: key}
+	}
+	return nil
+}
+
+func (l *yyLex) setError(err error) {
+	l.ctx.err = err
+	l.ctx.errPos = l.currPos()
+	l.ctx.isMinorErr = false
+	l.hasError = true
+}
+
+// currPos returns the position of the token being processed in the origin line
+func (l *yyLex) currPos() int {
+	if l.pos == 0 || l.pos > len(l.tokens) {
+		return -1
+	}
+	return l.tokens[l.pos-1].pos
+}
+
 func (l *yyLex) displayPath() string {
 	ctx := l.ctx
 	if len(ctx.matchedPath) == 0 {
@@ -276,16 +394,16 @@ func parseEnvString(s string, envParser *EnvParser) model.ParsedEnv {
 	if !strings.HasPrefix(s, envParser.brackets.Left) || !strings.HasSuffix(s, envParser.brackets.Right) {
 		return nil
 	}
-	
+
 	content := s[len(envParser.brackets.Left) : len(s)-len(envParser.brackets.Right)]
 	content = strings.TrimSpace(content)
 	if len(content) == 0 {
 		return nil
 	}
-	
+
 	env := make(model.ParsedEnv)
 	parts := splitBySep(content, envParser.kvSep)
-	
+
 	i := 0
 	for i < len(parts) {
 		part := strings.TrimSpace(parts[i])
@@ -305,42 +423,40 @@ func parseEnvString(s string, envParser *EnvParser) model.ParsedEnv {
 					break
 				}
 			}
-			val := strings.TrimSpace(strings.Join(valParts, ""))
+			val := Unquote(strings.TrimSpace(strings.Join(valParts, "")))
+			key = Unquote(key)
 			env[key] = model.NewParsedEnvVal(key, val)
 		} else if i+1 < len(parts) && strings.Contains(part, envParser.kvSep) {
 			// Handle inline key=value (split on first '=' only)
-			kv := strings.SplitN(part, envParser.kvSep, 2)
+			kv := SplitUnquotedN(part, envParser.kvSep, 2)
 			if len(kv) == 2 {
-				env[strings.TrimSpace(kv[0])] = model.NewParsedEnvVal(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+				key := Unquote(strings.TrimSpace(kv[0]))
+				env[key] = model.NewParsedEnvVal(key, Unquote(strings.TrimSpace(kv[1])))
 			}
 			i++
 		} else {
 			i++
 		}
 	}
-	
+
 	return env
 }
 
 func splitBySep(s string, sep string) []string {
 	var parts []string
-	current := ""
-	i := 0
-	for i < len(s) {
-		if i+len(sep) <= len(s) && s[i:i+len(sep)] == sep {
-			if len(current) > 0 {
-				parts = append(parts, current)
-			}
-			parts = append(parts, sep)
-			current = ""
-			i += len(sep)
-		} else {
-			current += string(s[i])
-			i++
+	for len(s) > 0 {
+		i := IndexUnquoted(s, sep)
+		if i < 0 {
+			break
+		}
+		if i > 0 {
+			parts = append(parts, s[:i])
 		}
+		parts = append(parts, sep)
+		s = s[i+len(sep):]
 	}
-	if len(current) > 0 {
-		parts = append(parts, current)
+	if len(s) > 0 {
+		parts = append(parts, s)
 	}
 	return parts
 }
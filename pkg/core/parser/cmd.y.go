@@ -28,9 +28,10 @@ type yaccParseContext struct {
 	allowSub     bool
 	rest         []string
 	argIdx       int
+	errPos       int
 }
 
-//line cmd.y:29
+//line cmd.y:30
 type yySymType struct {
 	yys     int
 	str     string
@@ -59,7 +60,7 @@ const yyEofCode = 1
 const yyErrCode = 2
 const yyInitialStackSize = 16
 
-//line cmd.y:108
+//line cmd.y:109
 
 type yyLex struct {
 	tokens   []yyToken
@@ -67,18 +68,22 @@ type yyLex struct {
 	result   []parsedSeg
 	ctx      *yaccParseContext
 	hasError bool
+	// map[cmd-path.arg-name]values, for the list args provided multi times
+	listVals map[string][]string
 }
 
 type yyToken struct {
 	typ int
 	str string
+	pos int
 }
 
 func newYYLex(tokens []yyToken, ctx *yaccParseContext) *yyLex {
 	return &yyLex{
-		tokens: tokens,
-		pos:    0,
-		ctx:    ctx,
+		tokens:   tokens,
+		pos:      0,
+		ctx:      ctx,
+		listVals: map[string][]string{},
 	}
 }
 
@@ -104,11 +109,15 @@ func (l *yyLex) ProcessWord(word string) parsedSeg {
 	ctx := l.ctx
 
 	if ctx.allowSub && ctx.currCmd != nil {
-		sub := ctx.currCmd.GetSub(word)
+		sub, err := l.matchSub(Unquote(word))
+		if err != nil {
+			l.setError(err)
+			return parsedSeg{Type: parsedSegTypeCmd, Val: model.MatchedCmd{Name: word}}
+		}
 		if sub != nil {
 			ctx.currCmd = sub
 			if ctx.currEnvAbbrs != nil {
-				ctx.currEnvAbbrs = ctx.currEnvAbbrs.GetSub(word)
+				ctx.currEnvAbbrs = ctx.currEnvAbbrs.GetSub(sub.Name())
 			}
 			ctx.matchedPath = append(ctx.matchedPath, word)
 			ctx.allowSub = false
@@ -119,6 +128,7 @@ func (l *yyLex) ProcessWord(word string) parsedSeg {
 	if ctx.allowSub {
 		errStr := "unknow input '" + word + "' ..., should be sub cmd"
 		ctx.err = fmt.Errorf("[CmdParser.parse] %s: %s", l.displayPath(), errStr)
+		ctx.errPos = l.currPos()
 		ctx.isMinorErr = false
 		l.hasError = true
 		return parsedSeg{Type: parsedSegTypeCmd, Val: model.MatchedCmd{Name: word}}
@@ -138,6 +148,11 @@ func (l *yyLex) tryParseAsArg(word string) model.ParsedEnv {
 		return nil
 	}
 
+	// Sys args (eg: '%delay=10s') are available for all cmds, including the ones without args
+	if env := l.tryParseAsSysArg(word); env != nil {
+		return env
+	}
+
 	args := ctx.currCmd.Args()
 	if args.IsEmpty() {
 		return nil
@@ -145,27 +160,31 @@ func (l *yyLex) tryParseAsArg(word string) model.ParsedEnv {
 
 	env := model.ParsedEnv{}
 
-	realName := args.Realname(word)
+	realName := args.Realname(Unquote(word))
 	if len(realName) > 0 {
 		if l.pos < len(l.tokens) {
 			nextTok := l.tokens[l.pos]
 			if nextTok.typ == WORD {
 				l.pos++
-				env[realName] = model.NewParsedEnvArgv(realName, nextTok.str)
+				env[realName] = l.newArgVal(args, realName, Unquote(nextTok.str))
 				return env
 			}
 		}
 	}
 
 	kvSep := ctx.cmdParser.envParser.kvSep
-	if strings.Contains(word, kvSep) {
-		kv := strings.SplitN(word, kvSep, 2)
+	if ContainsUnquoted(word, kvSep) {
+		kv := SplitUnquotedN(word, kvSep, 2)
 		if len(kv) == 2 {
-			key := kv[0]
-			val := kv[1]
-			realName := args.Realname(key)
+			key := Unquote(kv[0])
+			val := Unquote(kv[1])
+			realName, err := l.matchArg(args, key)
+			if err != nil {
+				l.setError(err)
+				return nil
+			}
 			if len(realName) > 0 {
-				env[realName] = model.NewParsedEnvArgv(realName, val)
+				env[realName] = l.newArgVal(args, realName, val)
 				return env
 			}
 		}
@@ -188,7 +207,7 @@ func (l *yyLex) tryParseAsArg(word string) model.ParsedEnv {
 				break
 			}
 		}
-		env[name] = model.NewParsedEnvArgv(name, value)
+		env[name] = l.newArgVal(args, name, Unquote(value))
 		ctx.argIdx++
 		return env
 	}
@@ -196,6 +215,27 @@ func (l *yyLex) tryParseAsArg(word string) model.ParsedEnv {
 	return nil
 }
 
+func (l *yyLex) tryParseAsSysArg(word string) model.ParsedEnv {
+	envParser := l.ctx.cmdParser.envParser
+	if len(envParser.sysArgPrefix) == 0 || !ContainsUnquoted(word, envParser.kvSep) {
+		return nil
+	}
+	kv := SplitUnquotedN(word, envParser.kvSep, 2)
+	if len(kv) != 2 {
+		return nil
+	}
+	key := Unquote(kv[0])
+	if !strings.HasPrefix(key, envParser.sysArgPrefix) {
+		return nil
+	}
+	name, val, err := model.SysArgRealnameAndNormalizedValue(key, envParser.sysArgPrefix, Unquote(kv[1]))
+	if err != nil {
+		l.setError(err)
+		return nil
+	}
+	return model.ParsedEnv{name: model.NewParsedSysArgv(name, val)}
+}
+
 func (l *yyLex) ProcessEnv(envStr string) parsedSeg {
 	ctx := l.ctx
 	env := parseEnvString(envStr, ctx.cmdParser.envParser)
@@ -203,6 +243,14 @@ func (l *yyLex) ProcessEnv(envStr string) parsedSeg {
 	// Debug: print env parsing result
 	// fmt.Printf("ProcessEnv: %q -> env=%v\n", envStr, env)
 
+	// The keys are kept as they are if prefix matching is off
+	if env != nil && ctx.currEnvAbbrs != nil && ctx.cmdParser.prefixMatch {
+		if err := l.matchEnvAbbrs(env); err != nil {
+			l.setError(err)
+			return parsedSeg{Type: parsedSegTypeEnv, Val: nil}
+		}
+	}
+
 	if len(ctx.matchedPath) > 0 && env != nil {
 		for k, v := range env {
 			env[k] = model.ParsedEnvVal{
@@ -218,6 +266,76 @@ func (l *yyLex) ProcessEnv(envStr string) parsedSeg {
 	return parsedSeg{Type: parsedSegTypeEnv, Val: env}
 }
 
+func (l *yyLex) matchSub(name string) (*model.CmdTree, error) {
+	ctx := l.ctx
+	sub := ctx.currCmd.GetSub(name)
+	if sub != nil || !ctx.cmdParser.prefixMatch {
+		return sub, nil
+	}
+	return ctx.currCmd.MatchSubPrefix(name)
+}
+
+// newArgVal appends the value to the previous ones if it's a list arg,
+// the later one overwrites the previous one in env merging, so it carries all values
+func (l *yyLex) newArgVal(args model.Args, name string, val string) model.ParsedEnvVal {
+	if !args.IsList(name) {
+		return model.NewParsedEnvArgv(name, val)
+	}
+	listSep := l.ctx.currCmd.Strs.ListSep
+	key := l.ctx.currCmd.DisplayPath() + l.ctx.currCmd.Strs.PathSep + name
+	vals := append(l.listVals[key], val)
+	l.listVals[key] = vals
+	return model.NewParsedEnvArgv(name, strings.Join(vals, listSep))
+}
+
+func (l *yyLex) matchArg(args model.Args, name string) (string, error) {
+	realName := args.Realname(name)
+	if len(realName) != 0 || !l.ctx.cmdParser.prefixMatch {
+		return realName, nil
+	}
+	return args.MatchPrefix(l.ctx.currCmd, name)
+}
+
+// matchEnvAbbrs replaces the env keys with the realnames if they could be matched by env abbrs
+func (l *yyLex) matchEnvAbbrs(env model.ParsedEnv) error {
+	ctx := l.ctx
+	sep := ctx.envParser.envPathSep
+	var keys []string
+	for k := range env {
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		path, matched, err := ctx.currEnvAbbrs.TryMatchEx(k, sep, ctx.cmdParser.prefixMatch)
+		if err != nil {
+			return err
+		}
+		key := strings.Join(path, sep)
+		if !matched || key == k {
+			continue
+		}
+		v := env[k]
+		delete(env, k)
+		env[key] = model.ParsedEnvVal{Val: v.Val, IsArg: v.IsArg, IsSysArg: v.IsSysArg,
+			MatchedPath: path, MatchedPathStr: key}
+	}
+	return nil
+}
+
+func (l *yyLex) setError(err error) {
+	l.ctx.err = err
+	l.ctx.errPos = l.currPos()
+	l.ctx.isMinorErr = false
+	l.hasError = true
+}
+
+// currPos returns the position of the token being processed in the origin line
+func (l *yyLex) currPos() int {
+	if l.pos == 0 || l.pos > len(l.tokens) {
+		return -1
+	}
+	return l.tokens[l.pos-1].pos
+}
+
 func (l *yyLex) displayPath() string {
 	ctx := l.ctx
 	if len(ctx.matchedPath) == 0 {
@@ -259,13 +377,15 @@ func parseEnvString(s string, envParser *EnvParser) model.ParsedEnv {
 					break
 				}
 			}
-			val := strings.TrimSpace(strings.Join(valParts, ""))
+			val := Unquote(strings.TrimSpace(strings.Join(valParts, "")))
+			key = Unquote(key)
 			env[key] = model.NewParsedEnvVal(key, val)
 		} else if i+1 < len(parts) && strings.Contains(part, envParser.kvSep) {
 			// Handle inline key=value (split on first '=' only)
-			kv := strings.SplitN(part, envParser.kvSep, 2)
+			kv := SplitUnquotedN(part, envParser.kvSep, 2)
 			if len(kv) == 2 {
-				env[strings.TrimSpace(kv[0])] = model.NewParsedEnvVal(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+				key := Unquote(strings.TrimSpace(kv[0]))
+				env[key] = model.NewParsedEnvVal(key, Unquote(strings.TrimSpace(kv[1])))
 			}
 			i++
 		} else {
@@ -278,23 +398,19 @@ func parseEnvString(s string, envParser *EnvParser) model.ParsedEnv {
 
 func splitBySep(s string, sep string) []string {
 	var parts []string
-	current := ""
-	i := 0
-	for i < len(s) {
-		if i+len(sep) <= len(s) && s[i:i+len(sep)] == sep {
-			if len(current) > 0 {
-				parts = append(parts, current)
-			}
-			parts = append(parts, sep)
-			current = ""
-			i += len(sep)
-		} else {
-			current += string(s[i])
-			i++
+	for len(s) > 0 {
+		i := IndexUnquoted(s, sep)
+		if i < 0 {
+			break
+		}
+		if i > 0 {
+			parts = append(parts, s[:i])
 		}
+		parts = append(parts, sep)
+		s = s[i+len(sep):]
 	}
-	if len(current) > 0 {
-		parts = append(parts, current)
+	if len(s) > 0 {
+		parts = append(parts, s)
 	}
 	return parts
 }
@@ -689,20 +805,20 @@ yydefault:
 
 	case 1:
 		yyDollar = yyS[yypt-0 : yypt+1]
-//line cmd.y:47
+//line cmd.y:48
 		{
 			yyVAL.segs = nil
 		}
 	case 2:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line cmd.y:51
+//line cmd.y:52
 		{
 			yyVAL.segs = yyDollar[1].segs
 			yylex.(*yyLex).SetResult(yyVAL.segs)
 		}
 	case 3:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line cmd.y:58
+//line cmd.y:59
 		{
 			if yyDollar[1].seg.Type == parsedSegTypeSep && len(yyVAL.segs) == 0 {
 				yyVAL.segs = nil
@@ -718,7 +834,7 @@ yydefault:
 		}
 	case 4:
 		yyDollar = yyS[yypt-2 : yypt+1]
-//line cmd.y:72
+//line cmd.y:73
 		{
 			if yyDollar[2].seg.Type == parsedSegTypeEnv {
 				if env, ok := yyDollar[2].seg.Val.(model.ParsedEnv); !ok || len(env) == 0 {
@@ -738,13 +854,13 @@ yydefault:
 		}
 	case 5:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line cmd.y:92
+//line cmd.y:93
 		{
 			yyVAL.seg = yylex.(*yyLex).ProcessWord(yyDollar[1].str)
 		}
 	case 6:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line cmd.y:96
+//line cmd.y:97
 		{
 			yyVAL.seg = yylex.(*yyLex).ProcessEnv(yyDollar[1].str)
 			// After processing env, allow sub command
@@ -752,7 +868,7 @@ yydefault:
 		}
 	case 7:
 		yyDollar = yyS[yypt-1 : yypt+1]
-//line cmd.y:102
+//line cmd.y:103
 		{
 			yyVAL.seg = parsedSeg{Type: parsedSegTypeSep, Val: nil}
 			// After separator, allow sub command
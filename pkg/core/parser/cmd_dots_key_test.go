@@ -15,7 +15,7 @@ func TestCmdParserParseEnvWithDotsInKey(t *testing.T) {
 
 	parser := &CmdParser{
 		&EnvParser{Brackets{"{", "}"}, "\t ", "=", ".", "%"},
-		".", "./", "\t ", "<root>", "^", map[byte]bool{'/': true, '\\': true},
+		".", "./", "\t ", "<root>", "^", map[byte]bool{'/': true, '\\': true}, false,
 	}
 
 	t.Run("env key with dots should not be mapped to positional arg", func(t *testing.T) {
@@ -13,7 +13,7 @@ func newCmdTree() *model.CmdTree {
 func newTestParser() *CmdParser {
 	return &CmdParser{
 		&EnvParser{Brackets{"{", "}"}, "\t ", "=", ".", "%"},
-		".", "./", "\t ", "<root>", "^", map[byte]bool{'/': true, '\\': true},
+		".", "./", "\t ", "<root>", "^", map[byte]bool{'/': true, '\\': true}, false,
 	}
 }
 
@@ -420,3 +420,161 @@ func assertEnvValue(t *testing.T, env model.ParsedEnv, key, value string) {
 		t.Errorf("expected env[%s]=%q, got %q", key, value, env[key].Val)
 	}
 }
+
+func TestCmdParserPrefixMatch(t *testing.T) {
+	root := newCmdTree()
+	deploy := root.AddSub("deploy", "dp")
+	deploy.RegEmptyCmd("deploy command").AddArg("host", "", "h").AddArg("hops", "")
+	deploy.AddSub("cluster").RegEmptyCmd("deploy cluster")
+	root.AddSub("describe").RegEmptyCmd("describe command")
+
+	parser := newTestParser()
+	parsed := parser.Parse(root, nil, []string{"depl"})
+	if parsed.ParseResult.Error == nil {
+		t.Fatal("prefix should not match if prefix-match is disabled")
+	}
+
+	parser.SetPrefixMatch(true)
+
+	t.Run("sub cmd prefixes", func(t *testing.T) {
+		parsed := parser.Parse(root, nil, []string{"depl.clu"})
+		assertParseResult(t, parsed, 2, "depl")
+		if path := parsed.LastCmdNode().DisplayPath(); path != "deploy.cluster" {
+			t.Errorf("expected matched path deploy.cluster, got %s", path)
+		}
+	})
+
+	t.Run("declared abbrs first", func(t *testing.T) {
+		parsed := parser.Parse(root, nil, []string{"dp"})
+		assertParseResult(t, parsed, 1, "dp")
+		if path := parsed.LastCmdNode().DisplayPath(); path != "deploy" {
+			t.Errorf("expected matched path deploy, got %s", path)
+		}
+	})
+
+	t.Run("arg name prefix", func(t *testing.T) {
+		parsed := parser.Parse(root, nil, []string{"deploy", "hos=127.0.0.1"})
+		assertParseResult(t, parsed, 1, "deploy")
+		assertEnvValue(t, parsed.Segments[0].Env, "deploy.host", "127.0.0.1")
+	})
+
+	t.Run("ambiguous cmd prefix", func(t *testing.T) {
+		parsed := parser.Parse(root, nil, []string{"de"})
+		err, ok := parsed.ParseResult.Error.(model.ErrAmbiguousPrefix)
+		if !ok {
+			t.Fatalf("expected ambiguous prefix error, got %v", parsed.ParseResult.Error)
+		}
+		if len(err.Candidates) != 2 || err.Candidates[0] != "deploy" || err.Candidates[1] != "describe" {
+			t.Errorf("unexpected candidates %v", err.Candidates)
+		}
+	})
+
+	t.Run("ambiguous arg prefix", func(t *testing.T) {
+		parsed := parser.Parse(root, nil, []string{"deploy", "ho=x"})
+		if _, ok := parsed.ParseResult.Error.(model.ErrAmbiguousPrefix); !ok {
+			t.Fatalf("expected ambiguous prefix error, got %v", parsed.ParseResult.Error)
+		}
+		if parsed.ParseResult.ErrPos != 7 {
+			t.Errorf("expected error pos 7, got %d", parsed.ParseResult.ErrPos)
+		}
+	})
+}
+
+func TestCmdParserEnvAbbrs(t *testing.T) {
+	root := newCmdTree()
+	root.AddSub("deploy").RegEmptyCmd("deploy command")
+	abbrs := model.NewEnvAbbrs("<root>")
+	abbrs.AddSub("display", "disp").AddSub("width", "w")
+
+	// The keys are not rewritten if prefix-match is disabled
+	parser := newTestParser()
+	parsed := parser.Parse(root, abbrs, []string{"{disp.w=40}", "deploy"})
+	assertEnvValue(t, parsed.Segments[0].Env, "disp.w", "40")
+
+	parser.SetPrefixMatch(true)
+	parsed = parser.Parse(root, abbrs, []string{"{disp.w=40}", "deploy"})
+	assertEnvValue(t, parsed.Segments[0].Env, "display.width", "40")
+	parsed = parser.Parse(root, abbrs, []string{"{displ.wid=40}", "deploy"})
+	assertEnvValue(t, parsed.Segments[0].Env, "display.width", "40")
+}
+
+func TestCmdParserListArgs(t *testing.T) {
+	root := newCmdTree()
+	root.AddSub("deploy").RegEmptyCmd("deploy command").
+		AddArg("hosts", "", "h").
+		AddArg("port", "").
+		SetArgIsList("hosts")
+	parser := newTestParser()
+
+	tests := []struct {
+		name   string
+		input  []string
+		envKey string
+		envVal string
+	}{
+		{"joined", []string{"deploy", "hosts=a,b"}, "deploy.hosts", "a,b"},
+		{"repeated", []string{"deploy", "hosts=a", "h=b", "hosts=c"}, "deploy.hosts", "a,b,c"},
+		{"repeated name and value", []string{"deploy", "hosts", "a", "hosts", "b"}, "deploy.hosts", "a,b"},
+		{"positional then repeated", []string{"deploy", "a", "hosts=b"}, "deploy.hosts", "a,b"},
+		{"not list arg overwrites", []string{"deploy", "port=1", "port=2"}, "deploy.port", "2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parser.Parse(root, nil, tt.input)
+			assertParseResult(t, parsed, 1, "deploy")
+			assertEnvValue(t, parsed.Segments[0].Env, tt.envKey, tt.envVal)
+		})
+	}
+}
+
+func TestCmdParserParseSysArgs(t *testing.T) {
+	root := newCmdTree()
+	root.AddSub("noargs").RegEmptyCmd("cmd without args")
+	echo := root.AddSub("echo")
+	echo.RegEmptyCmd("print message").AddArg("message", "", "msg", "m")
+	parser := newTestParser()
+
+	t.Run("sys arg of cmd without args", func(t *testing.T) {
+		parsed := parser.Parse(root, nil, []string{"noargs", "%delay=1", "%timeout=2m"})
+		assertParseResult(t, parsed, 1, "noargs")
+		env := parsed.Segments[0].Env
+		assertEnvValue(t, env, "noargs.%delay", "1s")
+		assertEnvValue(t, env, "noargs.%timeout", "2m")
+		if !env["noargs.%delay"].IsSysArg {
+			t.Error("expected 'delay' to be a sys arg")
+		}
+	})
+
+	t.Run("sys arg mixed with args", func(t *testing.T) {
+		parsed := parser.Parse(root, nil, []string{"echo", "hi", "%delay=0"})
+		assertParseResult(t, parsed, 1, "echo")
+		assertEnvValue(t, parsed.Segments[0].Env, "echo.message", "hi")
+		assertEnvValue(t, parsed.Segments[0].Env, "echo.%delay", "0s")
+	})
+
+	t.Run("detach sys arg", func(t *testing.T) {
+		parsed := parser.Parse(root, nil, []string{"echo", "hi", "%detach=on"})
+		assertParseResult(t, parsed, 1, "echo")
+		assertEnvValue(t, parsed.Segments[0].Env, "echo.%detach", "true")
+
+		stripped := parsed.WithoutSysArg("%detach")
+		if _, ok := stripped.Segments[0].Env["echo.%detach"]; ok {
+			t.Error("expected the detach sys arg to be removed")
+		}
+		assertEnvValue(t, stripped.Segments[0].Env, "echo.message", "hi")
+		assertEnvValue(t, parsed.Segments[0].Env, "echo.%detach", "true")
+
+		parsed = parser.Parse(root, nil, []string{"noargs", "%detach=maybe"})
+		if parsed.ParseResult.Error == nil {
+			t.Error("expected error for non-bool detach value")
+		}
+	})
+
+	t.Run("unknown sys arg", func(t *testing.T) {
+		parsed := parser.Parse(root, nil, []string{"noargs", "%unknown=1"})
+		if parsed.ParseResult.Error == nil {
+			t.Error("expected error for unknown sys arg")
+		}
+	})
+}
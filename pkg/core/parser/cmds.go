@@ -26,6 +26,10 @@ func NewParser(seqParser *SequenceParser, cmdParser *CmdParser) *Parser {
 	}
 }
 
+func (self *Parser) SetPrefixMatch(enabled bool) {
+	self.cmdParser.SetPrefixMatch(enabled)
+}
+
 func (self *Parser) isEnvBlock(arg string) bool {
 	return strings.HasPrefix(arg, self.envPrefix) && strings.HasSuffix(arg, self.envSuffix)
 }
@@ -104,10 +108,11 @@ func (self *Parser) Parse(
 
 	input = self.transformHelpFlag(input)
 
-	seqs, firstIsGlobal := self.seqParser.Parse(input)
+	line, tokens := ArgvToTokens(input)
+	seqs, firstIsGlobal := self.seqParser.ParseTokens(tokens)
 	flow := model.ParsedCmds{GlobalEnv: model.ParsedEnv{}, Cmds: nil, GlobalCmdIdx: -1}
 	for _, seq := range seqs {
-		flow.Cmds = append(flow.Cmds, self.cmdParser.Parse(cmds, envAbbrs, seq))
+		flow.Cmds = append(flow.Cmds, self.cmdParser.ParseTokens(cmds, envAbbrs, line, seq))
 	}
 	if firstIsGlobal && len(flow.Cmds) != 0 {
 		flow.GlobalCmdIdx = 0
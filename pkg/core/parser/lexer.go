@@ -0,0 +1,263 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Quoting rules shared by all the parsers in this package:
+//   "..."  double quotes, '\' escapes '"', '\', and makes '\n' '\t' '\r' control chars
+//   '...'  single quotes, '\' only escapes '\'' and '\'
+//   `...`  raw string, nothing is escaped inside
+//   \c     outside quotes, a backslash escapes any punctuation or space char,
+//          it's kept as it is when followed by a letter or a digit (eg: windows paths)
+//
+// A quote char only opens a quoted string at the beginning of a word or a value,
+// that is: the head of the input, or after a space or a '='.
+// In other places it's a normal char, so values like `it's` or `{"k":"v"}` are kept as they are.
+//
+// Quoted or escaped chars never work as separators (':', '.', '=', '{', '}', ...).
+// Tokens keep the raw text (with quotes) until the final values are extracted by 'Unquote',
+// so each parsing stage could see the quoting info.
+
+const (
+	QuoteDouble byte = '"'
+	QuoteSingle byte = '\''
+	QuoteRaw    byte = '`'
+	EscapeChar  byte = '\\'
+)
+
+// Token is a piece of the command line, with the position in the origin line
+type Token struct {
+	Val string
+	Pos int
+}
+
+func (self Token) End() int {
+	return self.Pos + len(self.Val)
+}
+
+// Sub returns a sub token of [start, end) in Val, with the right position
+func (self Token) Sub(start int, end int) Token {
+	return Token{self.Val[start:end], self.Pos + start}
+}
+
+func (self Token) TrimSpace() Token {
+	val := strings.TrimLeftFunc(self.Val, unicode.IsSpace)
+	pos := self.Pos + len(self.Val) - len(val)
+	return Token{strings.TrimRightFunc(val, unicode.IsSpace), pos}
+}
+
+func (self Token) TrimLeft(cutset string) Token {
+	val := strings.TrimLeft(self.Val, cutset)
+	return Token{val, self.Pos + len(self.Val) - len(val)}
+}
+
+func TokenVals(tokens []Token) (vals []string) {
+	for _, token := range tokens {
+		vals = append(vals, token.Val)
+	}
+	return
+}
+
+// ArgvToTokens joins argv into one line (separated by a single space) as the source,
+// each arg become a token with the position in that line
+func ArgvToTokens(argv []string) (line string, tokens []Token) {
+	pos := 0
+	for i, arg := range argv {
+		if i != 0 {
+			pos += 1
+		}
+		tokens = append(tokens, Token{arg, pos})
+		pos += len(arg)
+	}
+	return strings.Join(argv, " "), tokens
+}
+
+type TokenizeErr struct {
+	Str string
+	Pos int
+}
+
+func (self TokenizeErr) Error() string {
+	return self.Str
+}
+
+func isQuote(c byte) bool {
+	return c == QuoteDouble || c == QuoteSingle || c == QuoteRaw
+}
+
+func opensQuote(s string, i int) bool {
+	if !isQuote(s[i]) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	prev := s[i-1]
+	return prev == '=' || prev == ' ' || prev == '\t' || prev == '\n' || prev == '\r'
+}
+
+func isEscapable(c byte) bool {
+	return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80)
+}
+
+// skipQuoted returns the index after the closing quote, or -1 if it's unterminated,
+// s[start] should be a quote char
+func skipQuoted(s string, start int) int {
+	quote := s[start]
+	for i := start + 1; i < len(s); i++ {
+		c := s[i]
+		if c == quote {
+			return i + 1
+		}
+		if c == EscapeChar && quote != QuoteRaw && i+1 < len(s) {
+			next := s[i+1]
+			if next == quote || next == EscapeChar {
+				i += 1
+			}
+		}
+	}
+	return -1
+}
+
+// scanUnquoted calls 'match' on every index of s which is not quoted or escaped,
+// returns the first index matched, or -1 if not found.
+// Unterminated quotes are treated as quoted-to-the-end here, use 'CheckQuotes' to find them.
+func scanUnquoted(s string, from int, match func(i int) bool) int {
+	for i := from; i < len(s); i++ {
+		c := s[i]
+		if c == EscapeChar && i+1 < len(s) && isEscapable(s[i+1]) {
+			i += 1
+			continue
+		}
+		if opensQuote(s, i) {
+			end := skipQuoted(s, i)
+			if end < 0 {
+				return -1
+			}
+			i = end - 1
+			continue
+		}
+		if match(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+func IndexUnquoted(s string, sub string) int {
+	if len(sub) == 0 {
+		return 0
+	}
+	return scanUnquoted(s, 0, func(i int) bool {
+		return strings.HasPrefix(s[i:], sub)
+	})
+}
+
+func IndexAnyUnquoted(s string, chars string) int {
+	return scanUnquoted(s, 0, func(i int) bool {
+		return strings.IndexByte(chars, s[i]) >= 0
+	})
+}
+
+func ContainsUnquoted(s string, sub string) bool {
+	return IndexUnquoted(s, sub) >= 0
+}
+
+// SplitUnquotedN is like 'strings.SplitN', but skips the quoted and escaped seps
+func SplitUnquotedN(s string, sep string, n int) (res []string) {
+	for n < 0 || len(res) < n-1 {
+		i := IndexUnquoted(s, sep)
+		if i < 0 {
+			break
+		}
+		res = append(res, s[:i])
+		s = s[i+len(sep):]
+	}
+	return append(res, s)
+}
+
+// CheckQuotes returns the position of the first unterminated quote in s
+func CheckQuotes(s string) (pos int, ok bool) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == EscapeChar && i+1 < len(s) && isEscapable(s[i+1]) {
+			i += 1
+			continue
+		}
+		if opensQuote(s, i) {
+			end := skipQuoted(s, i)
+			if end < 0 {
+				return i, false
+			}
+			i = end - 1
+		}
+	}
+	return -1, true
+}
+
+// Unquote removes the quotes and escapes from a raw token value
+func Unquote(s string) string {
+	if strings.IndexByte(s, EscapeChar) < 0 && strings.IndexAny(s, "\"'`") < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == EscapeChar && i+1 < len(s) && isEscapable(s[i+1]) {
+			b.WriteByte(s[i+1])
+			i += 1
+			continue
+		}
+		if !opensQuote(s, i) {
+			b.WriteByte(c)
+			continue
+		}
+		end := skipQuoted(s, i)
+		if end < 0 {
+			end = len(s) + 1
+		}
+		b.WriteString(unquoteBody(s[i+1:end-1], c))
+		i = end - 1
+	}
+	return b.String()
+}
+
+func unquoteBody(body string, quote byte) string {
+	if quote == QuoteRaw || strings.IndexByte(body, EscapeChar) < 0 {
+		return body
+	}
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c != EscapeChar || i+1 >= len(body) {
+			b.WriteByte(c)
+			continue
+		}
+		next := body[i+1]
+		switch {
+		case next == quote || next == EscapeChar:
+			b.WriteByte(next)
+		case quote == QuoteDouble && next == 'n':
+			b.WriteByte('\n')
+		case quote == QuoteDouble && next == 't':
+			b.WriteByte('\t')
+		case quote == QuoteDouble && next == 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(c)
+			continue
+		}
+		i += 1
+	}
+	return b.String()
+}
+
+func newUnterminatedQuoteErr(token Token, idx int) TokenizeErr {
+	return TokenizeErr{
+		fmt.Sprintf("unterminated quote %c in '%s'", token.Val[idx], token.Val),
+		token.Pos + idx,
+	}
+}
@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/innerr/ticat/pkg/core/model"
+)
+
+func TestLexerUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{``, ``},
+		{`abc`, `abc`},
+		{`"a b"`, `a b`},
+		{`'a b'`, `a b`},
+		{"`a b`", `a b`},
+		{`k="a:b"`, `k=a:b`},
+		{`"a\"b"`, `a"b`},
+		{`"a\nb"`, "a\nb"},
+		{`'a\'b'`, `a'b`},
+		{`'a\nb'`, `a\nb`},
+		{"`a\\\"b`", `a\"b`},
+		{`a\:b`, `a:b`},
+		{`a\\b`, `a\b`},
+		{`a\ b`, `a b`},
+		{`C:\Users\test`, `C:\Users\test`},
+		{`it's`, `it's`},
+		{`{"k":"v"}`, `{"k":"v"}`},
+		{`a="x"y`, `a=xy`},
+	}
+	for _, tt := range tests {
+		if got := Unquote(tt.input); got != tt.expected {
+			t.Errorf("Unquote(%q): expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLexerIndexUnquoted(t *testing.T) {
+	tests := []struct {
+		input    string
+		sub      string
+		expected int
+	}{
+		{`a:b`, ":", 1},
+		{`a\:b`, ":", -1},
+		{`a\:b:c`, ":", 4},
+		{`"a:b"`, ":", -1},
+		{`"a:b":c`, ":", 5},
+		{`k='a:b':c`, ":", 7},
+		{"k=`a\\`:c", ":", 6},
+		{`it's:x`, ":", 4},
+	}
+	for _, tt := range tests {
+		if got := IndexUnquoted(tt.input, tt.sub); got != tt.expected {
+			t.Errorf("IndexUnquoted(%q, %q): expected %d, got %d", tt.input, tt.sub, tt.expected, got)
+		}
+	}
+
+	kv := SplitUnquotedN(`"a=b"=c=d`, "=", 2)
+	if len(kv) != 2 || kv[0] != `"a=b"` || kv[1] != `c=d` {
+		t.Errorf("SplitUnquotedN: unexpected result %#v", kv)
+	}
+}
+
+func TestLexerCheckQuotes(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+		ok    bool
+	}{
+		{`abc`, -1, true},
+		{`"abc"`, -1, true},
+		{`k="abc`, 2, false},
+		{`k='a\'`, 2, false},
+		{`k=\"abc`, -1, true},
+		{`it's`, -1, true},
+		{"a `b", 2, false},
+	}
+	for _, tt := range tests {
+		pos, ok := CheckQuotes(tt.input)
+		if pos != tt.pos || ok != tt.ok {
+			t.Errorf("CheckQuotes(%q): expected (%d, %v), got (%d, %v)", tt.input, tt.pos, tt.ok, pos, ok)
+		}
+	}
+}
+
+func TestSequenceParserQuoting(t *testing.T) {
+	parser := SequenceParser{":", []string{"http", "HTTP"}, []string{"/"}}
+
+	_, tokens := ArgvToTokens([]string{"aa", `k="x:y":bb`, `k=a\:b`})
+	seqs, _ := parser.ParseTokens(tokens)
+	if len(seqs) != 2 {
+		t.Fatalf("expected 2 sequences, got %#v", seqs)
+	}
+	if vals := TokenVals(seqs[0]); len(vals) != 2 || vals[1] != `k="x:y"` {
+		t.Errorf("unexpected first sequence %#v", vals)
+	}
+	if vals := TokenVals(seqs[1]); len(vals) != 2 || vals[0] != "bb" || vals[1] != `k=a\:b` {
+		t.Errorf("unexpected second sequence %#v", vals)
+	}
+
+	// Positions are offsets in the line joined by spaces: `aa k="x:y":bb k=a\:b`
+	if seqs[1][0].Pos != 11 || seqs[1][1].Pos != 14 {
+		t.Errorf("unexpected token positions %#v", seqs[1])
+	}
+}
+
+func TestCmdParserQuotedValues(t *testing.T) {
+	root := newCmdTree()
+	deploy := root.AddSub("deploy")
+	deploy.RegEmptyCmd("deploy command").AddArg("msg", "").AddArg("path", "")
+	parser := newTestParser()
+
+	tests := []struct {
+		name   string
+		input  []string
+		envKey string
+		envVal string
+	}{
+		{"double quoted arg", []string{"deploy", `msg="a.b:c d"`}, "deploy.msg", "a.b:c d"},
+		{"single quoted arg", []string{"deploy", `msg='x=y'`}, "deploy.msg", "x=y"},
+		{"raw string arg", []string{"deploy", "msg=`{a}\\n`"}, "deploy.msg", `{a}\n`},
+		{"escaped chars", []string{"deploy", `msg=a\ b\=c`}, "deploy.msg", "a b=c"},
+		{"quoted positional arg", []string{"deploy", `"1.2 3"`}, "deploy.msg", "1.2 3"},
+		{"quoted value in env block", []string{"deploy", `{k="a}b"}`}, "deploy.k", "a}b"},
+		{"quoted value with space in env block", []string{"deploy", `{k='c d'}`}, "deploy.k", "c d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parser.Parse(root, nil, tt.input)
+			assertParseResult(t, parsed, 1, "deploy")
+			assertEnvValue(t, parsed.Segments[0].Env, tt.envKey, tt.envVal)
+		})
+	}
+}
+
+func TestCmdParserErrPos(t *testing.T) {
+	root := newCmdTree()
+	deploy := root.AddSub("deploy")
+	deploy.RegEmptyCmd("deploy command").AddArg("msg", "")
+	deploy.AddSub("sub").RegEmptyCmd("sub command")
+	parser := newTestParser()
+
+	tests := []struct {
+		name   string
+		input  []string
+		errPos int
+		errTyp interface{}
+	}{
+		{"unknown cmd", []string{"deploi"}, 0, model.ParseErrExpectCmd{}},
+		{"unknown sub cmd", []string{"deploy.sub.x"}, 11, model.ParseErrExpectCmd{}},
+		{"unterminated quote", []string{"deploy", `msg="abc`}, 11, model.ParseErrQuote{}},
+		{"unterminated quote in trivial mark cmd", []string{"^^deploy", `msg='a`}, 13, model.ParseErrQuote{}},
+		{"unmatched env bracket", []string{"deploy", "{a=b"}, 7, model.ParseErrEnv{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed := parser.Parse(root, nil, tt.input)
+			result := parsed.ParseResult
+			if result.Error == nil {
+				t.Fatal("expected error, got nil")
+			}
+			switch tt.errTyp.(type) {
+			case model.ParseErrExpectCmd:
+				if _, ok := result.Error.(model.ParseErrExpectCmd); !ok {
+					t.Errorf("unexpected error type %T", result.Error)
+				}
+			case model.ParseErrQuote:
+				if _, ok := result.Error.(model.ParseErrQuote); !ok {
+					t.Errorf("unexpected error type %T", result.Error)
+				}
+			case model.ParseErrEnv:
+				if _, ok := result.Error.(model.ParseErrEnv); !ok {
+					t.Errorf("unexpected error type %T", result.Error)
+				}
+			}
+			if result.ErrPos != tt.errPos {
+				t.Errorf("expected error pos %d, got %d", tt.errPos, result.ErrPos)
+			}
+			line, caret, ok := result.ErrCaret()
+			if !ok || line != strings.Join(tt.input, " ") || len(caret) != tt.errPos+1 || caret[tt.errPos] != '^' {
+				t.Errorf("unexpected caret:\n%s\n%s", line, caret)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"strings"
+
+	"github.com/innerr/ticat/pkg/core/model"
+)
+
+// MountFlow adds the mount path to the cmds in the flow which are defined under the mount path,
+// so a flow from a mounted repo could call the cmds of the same repo by the paths in the repo.
+// The lines are scanned with the same quoting and sequence-sep rules as parsing,
+// a cmd could start in a line after a sep in the previous lines.
+func (self *Parser) MountFlow(cmds *model.CmdTree, mountPath []string, flow []string) []string {
+	mount := cmds.GetSub(mountPath...)
+	if mount == nil {
+		return flow
+	}
+	pathSep := self.cmdParser.cmdSep
+	prefix := strings.Join(mountPath, pathSep) + pathSep
+	sep := self.seqParser.sep
+
+	isSep := func(line string, i int) bool {
+		return strings.HasPrefix(line[i:], sep) && !self.seqParser.isUnbreakable(line, i)
+	}
+	isSpace := func(c byte) bool {
+		return strings.IndexByte(self.cmdParser.cmdSpaces, c) >= 0
+	}
+	isCmdNameEnd := func(line string, i int) bool {
+		return isSpace(line[i]) || isSep(line, i) || strings.HasPrefix(line[i:], self.envPrefix) ||
+			strings.HasPrefix(line[i:], pathSep) || strings.IndexByte(self.cmdParser.cmdAlterSeps, line[i]) >= 0
+	}
+
+	expectCmd := true
+	result := make([]string, 0, len(flow))
+	for _, line := range flow {
+		var buf strings.Builder
+		i := 0
+		for i < len(line) {
+			if !expectCmd {
+				j := scanUnquoted(line, i, func(j int) bool {
+					return isSep(line, j)
+				})
+				if j < 0 {
+					buf.WriteString(line[i:])
+					break
+				}
+				buf.WriteString(line[i : j+len(sep)])
+				i = j + len(sep)
+				expectCmd = true
+				continue
+			}
+			if isSpace(line[i]) {
+				buf.WriteByte(line[i])
+				i += 1
+				continue
+			}
+			if isSep(line, i) {
+				buf.WriteString(sep)
+				i += len(sep)
+				continue
+			}
+			if strings.HasPrefix(line[i:], self.envPrefix) {
+				end := IndexUnquoted(line[i:], self.envSuffix)
+				if end < 0 {
+					// Let the parser report the error
+					buf.WriteString(line[i:])
+					break
+				}
+				end += i + len(self.envSuffix)
+				buf.WriteString(line[i:end])
+				i = end
+				continue
+			}
+
+			start := i
+			for len(self.cmdParser.TrivialMark) != 0 && strings.HasPrefix(line[start:], self.cmdParser.TrivialMark) {
+				start += len(self.cmdParser.TrivialMark)
+			}
+			end := scanUnquoted(line, start, func(j int) bool {
+				return isCmdNameEnd(line, j)
+			})
+			if end < 0 {
+				end = len(line)
+			}
+			buf.WriteString(line[i:start])
+			name := line[start:end]
+			if len(name) != 0 && mount.GetSub(name) != nil {
+				buf.WriteString(prefix)
+			}
+			buf.WriteString(name)
+			i = end
+			expectCmd = false
+		}
+		result = append(result, buf.String())
+	}
+	return result
+}
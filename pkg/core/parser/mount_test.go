@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParserMountFlow(t *testing.T) {
+	root := newCmdTree()
+	root.AddSub("echo").RegEmptyCmd("global cmd")
+	mount := root.AddSub("team").AddSub("sub")
+	deploy := mount.AddSub("deploy", "dep")
+	deploy.AddSub("run", "r").RegEmptyCmd("cmd in mounted repo")
+	mount.AddSub("echo").RegEmptyCmd("cmd in mounted repo, same name as the global one")
+
+	seqParser := NewSequenceParser(":", []string{"http", "HTTP"}, []string{"/"})
+	envParser := &EnvParser{Brackets{"{", "}"}, "\t ", "=", ".", "%"}
+	cmdParser := NewCmdParser(envParser, ".", "./", "\t ", "<root>", "^", "/\\")
+	parser := NewParser(seqParser, cmdParser)
+
+	mountPath := []string{"team", "sub"}
+
+	tests := []struct {
+		name     string
+		flow     []string
+		expected []string
+	}{
+		{
+			name:     "cmds of the repo",
+			flow:     []string{"deploy.run : dep.r"},
+			expected: []string{"team.sub.deploy.run : team.sub.dep.r"},
+		},
+		{
+			name:     "cmds outside the repo",
+			flow:     []string{"dbg.args : deploy.run"},
+			expected: []string{"dbg.args : team.sub.deploy.run"},
+		},
+		{
+			name:     "env blocks and trivial marks",
+			flow:     []string{"{a=1} ^^deploy.run{b=2} : {c=3}dep"},
+			expected: []string{"{a=1} ^^team.sub.deploy.run{b=2} : {c=3}team.sub.dep"},
+		},
+		{
+			name:     "args are not cmds",
+			flow:     []string{"dbg.args deploy : dbg.args str=deploy.run"},
+			expected: []string{"dbg.args deploy : dbg.args str=deploy.run"},
+		},
+		{
+			name:     "quoted seps are not seps",
+			flow:     []string{"dbg.args \"x : deploy\" : deploy"},
+			expected: []string{"dbg.args \"x : deploy\" : team.sub.deploy"},
+		},
+		{
+			name:     "cmd after a sep of the previous line",
+			flow:     []string{"dbg.args :", "  deploy.run", "  dbg.args deploy"},
+			expected: []string{"dbg.args :", "  team.sub.deploy.run", "  dbg.args deploy"},
+		},
+		{
+			name:     "cmds in the repo shadow the global ones",
+			flow:     []string{"echo hi"},
+			expected: []string{"team.sub.echo hi"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := parser.MountFlow(root, mountPath, tt.flow)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("MountFlow(%q) = %q, expected %q", tt.flow, result, tt.expected)
+			}
+		})
+	}
+
+	t.Run("mount path not exists", func(t *testing.T) {
+		flow := []string{"deploy.run"}
+		result := parser.MountFlow(root, []string{"none"}, flow)
+		if !reflect.DeepEqual(result, flow) {
+			t.Errorf("expected flow unchanged, got %q", result)
+		}
+	})
+}
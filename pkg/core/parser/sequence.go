@@ -23,83 +23,86 @@ func NewSequenceParser(
 }
 
 func (self *SequenceParser) Normalize(argv []string) []string {
+	_, tokens := ArgvToTokens(argv)
+	return TokenVals(self.Tokenize(tokens))
+}
+
+// Tokenize breaks the input tokens by the unquoted and unescaped sequence seps,
+// the seps will be in the result as standalone tokens.
+// Unterminated quotes are not reported here, the cmd parser will do it with the position.
+func (self *SequenceParser) Tokenize(input []Token) (res []Token) {
 	sepN := len(self.sep)
-	res := []string{}
-	for _, arg := range argv {
+	for _, token := range input {
+		arg := token.Val
 		if len(arg) == 0 {
-			res = append(res, arg)
+			res = append(res, token)
 		}
 		handledIdx := 0
 		searchIdx := 0
-		for ; handledIdx < len(arg); searchIdx += sepN {
-			i := strings.Index(arg[searchIdx:], self.sep)
+		for handledIdx < len(arg) {
+			i := scanUnquoted(arg, searchIdx, func(i int) bool {
+				return strings.HasPrefix(arg[i:], self.sep)
+			})
 			if i < 0 {
-				res = append(res, arg[handledIdx:])
+				res = append(res, token.Sub(handledIdx, len(arg)))
 				break
 			}
-			searchIdx += i
-			// TODO:
-			//  1. put '\' to SequenceParser's init args
-			//  2. this is a workaround, we also need to handle '\\', '\\\', ... things like that
-			if searchIdx >= 1 && "\\" == arg[searchIdx-1:searchIdx] {
-				arg = arg[0:searchIdx-1] + arg[searchIdx:]
-				continue
-			}
-			unbreakable := false
-			for _, prefix := range self.unbreakPrefixs {
-				if searchIdx >= len(prefix) &&
-					prefix == arg[searchIdx-len(prefix):searchIdx] {
-					unbreakable = true
-					break
-				}
-			}
-			if unbreakable {
+			searchIdx = i + sepN
+			if self.isUnbreakable(arg, i) {
 				continue
 			}
-			for _, suffix := range self.unbreakSuffixs {
-				if searchIdx+sepN+len(suffix) <= len(arg) &&
-					suffix == arg[searchIdx+sepN:searchIdx+sepN+len(suffix)] {
-					unbreakable = true
-					break
-				}
+			if handledIdx != i {
+				res = append(res, token.Sub(handledIdx, i))
 			}
-			if unbreakable {
-				continue
-			}
-			if handledIdx != searchIdx {
-				res = append(res, arg[handledIdx:searchIdx])
-			}
-			res = append(res, self.sep)
-			handledIdx = searchIdx + sepN
+			res = append(res, token.Sub(i, i+sepN))
+			handledIdx = i + sepN
 		}
 	}
-	return res
+	return
+}
+
+func (self *SequenceParser) isUnbreakable(arg string, sepIdx int) bool {
+	for _, prefix := range self.unbreakPrefixs {
+		if sepIdx >= len(prefix) && prefix == arg[sepIdx-len(prefix):sepIdx] {
+			return true
+		}
+	}
+	end := sepIdx + len(self.sep)
+	for _, suffix := range self.unbreakSuffixs {
+		if end+len(suffix) <= len(arg) && suffix == arg[end:end+len(suffix)] {
+			return true
+		}
+	}
+	return false
 }
 
 func (self *SequenceParser) Parse(argv []string) (parsed [][]string, firstIsGlobal bool) {
-	argv = self.Normalize(argv)
+	_, tokens := ArgvToTokens(argv)
+	seqs, firstIsGlobal := self.ParseTokens(tokens)
+	for _, seq := range seqs {
+		parsed = append(parsed, TokenVals(seq))
+	}
+	return
+}
+
+func (self *SequenceParser) ParseTokens(input []Token) (parsed [][]Token, firstIsGlobal bool) {
+	tokens := self.Tokenize(input)
 
 	firstIsGlobal = true
-	if len(argv) != 0 && argv[0] == self.sep {
+	if len(tokens) != 0 && tokens[0].Val == self.sep {
 		firstIsGlobal = false
 	}
 
-	parsed = [][]string{}
-	curr := []string{}
-	for _, arg := range argv {
-		if arg != self.sep {
-			arg = strings.TrimSpace(arg)
-			//if len(arg) != 0 {
-			curr = append(curr, arg)
-			//}
-			//} else if len(curr) != 0 {
+	parsed = [][]Token{}
+	curr := []Token{}
+	for _, token := range tokens {
+		if token.Val != self.sep {
+			curr = append(curr, token.TrimSpace())
 		} else {
 			parsed = append(parsed, curr)
-			curr = []string{}
+			curr = []Token{}
 		}
 	}
-	//if len(curr) != 0 {
 	parsed = append(parsed, curr)
-	//}
 	return
 }
@@ -54,6 +54,51 @@ func ApiCmdMeta(
 	return currCmdIdx, nil
 }
 
+// ApiCmdMetaMerged outputs the merged meta of a cmd as JSON, with the files defining the keys
+func ApiCmdMetaMerged(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	if err := assertNotTailMode(flow, currCmdIdx); err != nil {
+		return currCmdIdx, err
+	}
+	cmdStr, err := getAndCheckArg(argv, flow.Cmds[currCmdIdx], "cmd")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	meta, err := readCmdMeta(cc, env, flow.Cmds[currCmdIdx], cc.NormalizeCmd(true, cmdStr))
+	if err != nil {
+		return currCmdIdx, err
+	}
+
+	type metaKey struct {
+		Section string `json:"section"`
+		Key     string `json:"key"`
+		Value   string `json:"value"`
+		Origin  string `json:"origin"`
+	}
+	keys := []metaKey{}
+	for _, name := range meta.SectionNames() {
+		section := meta.GetSection(name)
+		for _, key := range section.Keys() {
+			keys = append(keys, metaKey{name, key, section.GetUnTrim(key), meta.Origin(name, key)})
+		}
+	}
+	includes := meta.Includes()
+	if includes == nil {
+		includes = []string{}
+	}
+	return currCmdIdx, model.OutputJson(cc, map[string]any{
+		"command":   cmdStr,
+		"meta_file": meta.Path(),
+		"includes":  includes,
+		"keys":      keys,
+	})
+}
+
 func ApiCmdPath(
 	argv model.ArgVals,
 	cc *model.Cli,
@@ -1,6 +1,9 @@
 package builtin
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/innerr/ticat/pkg/cli/display"
 	"github.com/innerr/ticat/pkg/core/model"
 	"github.com/innerr/ticat/pkg/utils"
@@ -88,6 +91,84 @@ func WaitForAllBgTasksFinish(
 	return currCmdIdx, nil
 }
 
+func ListBgTasks(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	listing := model.NewBgTasksListing(cc.BgTasks.GetStat(), time.Now())
+	if err := model.Output(cc, env, listing); err != nil {
+		return currCmdIdx, err
+	}
+	return currCmdIdx, nil
+}
+
+func KillBgTask(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	tid, err := getAndCheckArg(argv, flow.Cmds[currCmdIdx], "tid")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	if tid == utils.GoRoutineIdStr() {
+		return currCmdIdx, model.NewCmdError(flow.Cmds[currCmdIdx], "can't kill the current thread")
+	}
+	task, ok := cc.BgTasks.GetTask(tid)
+	if !ok {
+		return currCmdIdx, model.NewCmdError(flow.Cmds[currCmdIdx], "no background task in thread '"+tid+"'")
+	}
+	if !task.Abort("killed by bg.kill") {
+		display.PrintTipTitle(cc.Screen, env, "thread "+tid+" is already "+task.GetStat().State())
+		return currCmdIdx, nil
+	}
+	waitBgTasksAborted(task)
+	display.PrintTipTitle(cc.Screen, env, "thread "+tid+" is "+task.GetStat().State())
+	return currCmdIdx, nil
+}
+
+func KillAllBgTasks(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	if utils.GoRoutineIdStr() != utils.GoRoutineIdStrMain {
+		return currCmdIdx, model.NewCmdError(flow.Cmds[currCmdIdx],
+			"must be in main thread to kill all background tasks")
+	}
+	tids := cc.BgTasks.AbortAll("killed by bg.kill.all")
+	if len(tids) == 0 {
+		display.PrintTipTitle(cc.Screen, env, "no running or waiting background tasks")
+		return currCmdIdx, nil
+	}
+	var tasks []*model.BgTask
+	for _, tid := range tids {
+		if task, ok := cc.BgTasks.GetTask(tid); ok {
+			tasks = append(tasks, task)
+		}
+	}
+	waitBgTasksAborted(tasks...)
+	display.PrintTipTitle(cc.Screen, env, fmt.Sprintf("killed %d background tasks", len(tids)))
+	return currCmdIdx, nil
+}
+
+// waitBgTasksAborted waits a while for the killed tasks to stop, the tasks are still in the list until waited
+func waitBgTasksAborted(tasks ...*model.BgTask) {
+	deadline := time.Now().Add(3 * time.Second)
+	for _, task := range tasks {
+		for !task.GetStat().Finished && time.Now().Before(deadline) {
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+}
+
 func WaitBgTask(cc *model.Cli, env *model.Env, tid string, task *model.BgTask) (errs []error) {
 	info := task.GetStat()
 	display.PrintSwitchingThreadDisplay(utils.GoRoutineIdStr(), info, env, cc.Screen, true)
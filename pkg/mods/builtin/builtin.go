@@ -220,6 +220,11 @@ func RegisterCmdsListCmds(cmds *model.CmdTree) {
 			"list commands by command-path-branch, keywords, source and tag, with full info")
 	addDumpCmdsArgs(listFull)
 
+	registerSimpleSwitch(list.Owner(),
+		"matching commands, args and env keys by unambiguous prefixes",
+		"sys.parser.prefix-match",
+		"prefix-match", "prefix")
+
 	list.AddSub("tree", "t").
 		RegPowerCmd(DumpCmdsTree,
 			"list commands in tree form by command-path-branch").
@@ -310,6 +315,22 @@ func RegisterCmdAndHelpCmds(cmds *model.CmdTree) {
 		SetPriority().
 		AddArg("cmd-path", "", "path", "p")
 
+	meta := cmd.AddSub("meta")
+	meta.RegPowerCmd(DumpCmdMeta,
+		"display command meta with the included files merged, and the origin of the included keys").
+		SetAllowTailModeCall().
+		SetQuiet().
+		SetIgnoreFollowingDeps().
+		SetPriority().
+		AddArg("cmd-path", "", "path", "p")
+
+	meta.AddSub("to-yaml", "yaml").
+		RegPowerCmd(ConvertMetaToYaml,
+			"convert the '.ticat' and '.tiflow' files in a dir (or a file) to YAML meta files, the origin files are removed").
+		SetAllowTailModeCall().
+		AddArg("path", "", "p").
+		AddArg("dry-run", "false", "dry", "n")
+
 	cmd.AddSub("full-with-flow", "fwf", "more-with-flow", "mwf", "more.flow", "more.wf").
 		RegPowerCmd(DumpCmdWithDetailsAndFlow,
 			"display command full info, show flow preview if it's a flow").
@@ -503,10 +524,12 @@ func RegisterHubManageCmds(cmds *model.CmdTree) {
 
 	add := hub.AddSub("add-and-update", "add", "a")
 	add.RegPowerCmd(AddGitRepoToHub,
-		"add and pull a git address to hub, do update if it already exists").
+		"add and pull a git address (or a 'file://' archive or dir) to hub, do update if it already exists").
 		SetAllowTailModeCall().
 		AddArg("git-address", "", "git", "address", "addr").
-		AddArg("git-branch", "", "branch", "b")
+		AddArg("git-branch", "", "branch", "b").
+		AddArg("ref", "", "tag", "commit", "pin").
+		AddArg("mount", "", "mnt", "m")
 
 	repoStatus := hub.AddSub("git-status", "status").
 		RegPowerCmd(CheckGitRepoStatus,
@@ -517,11 +540,13 @@ func RegisterHubManageCmds(cmds *model.CmdTree) {
 		RegPowerCmd(AddLocalDirToHub,
 			"add a local dir (could be a git repo) to hub").
 		SetAllowTailModeCall().
-		AddArg("path", "", "p")
+		AddArg("path", "", "p").
+		AddArg("mount", "", "mnt", "m")
 
 	add.AddSub("pwd", "here", "p", "h").
 		RegPowerCmd(AddPwdToHub,
-			"add current working dir to hub")
+			"add current working dir to hub").
+		AddArg("mount", "", "mnt", "m")
 
 	purge := hub.AddSub("purge", "p")
 	purge.RegPowerCmd(PurgeInactiveRepoFromHub,
@@ -537,6 +562,75 @@ func RegisterHubManageCmds(cmds *model.CmdTree) {
 			"update all repos and mods defined in hub").
 		AddArg("show-tip", "true", "tip")
 
+	lock := hub.AddSub("lock").
+		RegPowerCmd(LockHub,
+			"record the current commits of all enabled git repos to the hub lock file")
+	lock.AddSub("apply").
+		RegPowerCmd(ApplyHubLock,
+			"clone or checkout repos to the commits in a hub lock file, use the local one if path is empty").
+		AddArg("path", "", "p")
+
+	bundle := hub.AddSub("bundle").
+		RegEmptyCmd(
+			"pack repos in hub to a bundle file, to install them on machines without network").Owner()
+	bundle.AddSub("export", "exp", "e").
+		RegPowerCmd(ExportHubBundle,
+			"pack all enabled repos (with git metadata) and their hub entries to a bundle file").
+		AddArg("path", "", "p")
+	bundle.AddSub("import", "imp", "i").
+		RegPowerCmd(ImportHubBundle,
+			"unpack a bundle file to hub and load the mods, the changed repos are replaced").
+		AddArg("path", "", "p")
+
+	hub.AddSub("conflicts", "conflict", "conf").
+		RegPowerCmd(ListHubConflicts,
+			"list commands defined by more than one repo/dir, with the winners and the shadowed ones")
+
+	priority := hub.AddSub("priority", "prio")
+	priority.RegPowerCmd(SetHubRepoPriority,
+		"set the priority level of a repo, the higher one wins when commands conflict, list the rules if repo is empty").
+		AddArg("repo", "", "r").
+		AddArg("level", "", "lv", "l")
+	priority.AddSub("cmd", "c").
+		RegPowerCmd(SetHubCmdPriority,
+			"set the winner repo of a conflicted command, remove the rule if repo is empty").
+		AddArg("cmd", "", "c").
+		AddArg("repo", "", "r")
+
+	hub.AddSub("verify", "check").
+		RegPowerCmd(VerifyHub,
+			"check the files of all enabled repos with their 'hub.sum' manifests and signatures")
+
+	trust := hub.AddSub("trust")
+	trust.RegPowerCmd(ListHubTrustedKeys,
+		"list the trusted public keys for verifying the signatures of repo manifests")
+	trust.AddSub("add", "a").
+		RegPowerCmd(AddHubTrustedKey,
+			"trust an ed25519 public key (hex), the repos with manifests signed by it pass the strict check").
+		AddArg("key", "", "k").
+		AddArg("name", "", "n")
+	trust.AddSub("remove", "rm", "delete", "del").
+		RegPowerCmd(RemoveHubTrustedKey,
+			"remove a trusted key by name").
+		AddArg("name", "", "n")
+
+	sum := hub.AddSub("sum").
+		RegEmptyCmd(
+			"generate the integrity manifest 'hub.sum' of a repo, for the users to verify it").Owner()
+	sum.AddSub("gen", "g").
+		RegPowerCmd(GenHubSum,
+			"hash all files of a repo dir to the manifest, sign it if the private key file is provided").
+		AddArg("path", "", "p").
+		AddArg("sign-key", "", "key", "k")
+	sum.AddSub("keygen", "key").
+		RegPowerCmd(GenHubSumKey,
+			"generate an ed25519 key pair for signing manifests, save the private key to a new file").
+		AddArg("path", "", "p")
+
+	hub.AddSub("shadowed").
+		RegEmptyCmd(
+			"the losers of command conflicts between repos, call them by '" + model.ShadowedCmdsPath + ".<repo>.<cmd-path>'")
+
 	hub.AddSub("enable-repo", "enable", "en", "e").
 		RegPowerCmd(EnableRepoInHub,
 			"enable matched git repos in hub").
@@ -763,6 +857,31 @@ func RegisterBgManageCmds(cmds *model.CmdTree) {
 			"wait for a background command to finish").
 		AddArg("command", "", "cmd", "c")
 
+	bg.AddSub("list", "ls").
+		RegPowerCmd(ListBgTasks,
+			"list background commands with state, elapsed time and the owning command").
+		SetQuiet()
+
+	kill := bg.AddSub("kill").
+		RegPowerCmd(KillBgTask,
+			"kill a background command by thread id, its child process will be killed and the task is marked aborted").
+		SetQuiet().
+		AddArg("tid", "", "thread", "t")
+	kill.AddSub("all").
+		RegPowerCmd(KillAllBgTasks,
+			"kill all running or waiting background commands").
+		SetQuiet()
+
+	cmds.AddSub("run").
+		RegEmptyCmd(
+			"run flows in different ways").
+		AddSub("detached", "detach", "d").
+		RegPowerCmd(RunDetached,
+			"run a flow in a new ticat process with its own session, it keeps running after the current one exits, "+
+				"the current env is not passed, same as the sys arg '%detach'").
+		SetQuiet().
+		AddArg("flow", "", "f")
+
 	afterMain := wait.AddSub("after-main", "on-main", "at-main", "auto")
 	afterMain.RegEmptyCmd(
 		"auto wait for all background commands to finish after main flow ends").
@@ -789,6 +908,7 @@ func RegisterSessionCmds(cmds *model.CmdTree) {
 		SetAllowTailModeCall().
 		SetQuiet()
 	addFindStrArgs(sessionsList)
+	sessionsList.AddArg("query", "", "filter", "q")
 	sessionsList.AddArg("max-count", "32", "limit", "max-cnt", "max")
 
 	sessionsErr := sessions.AddSub("error", "failed", "fail", "err", "e", "f").
@@ -797,6 +917,7 @@ func RegisterSessionCmds(cmds *model.CmdTree) {
 		SetAllowTailModeCall().
 		SetQuiet()
 	addFindStrArgs(sessionsErr)
+	sessionsErr.AddArg("query", "", "filter", "q")
 	sessionsErr.AddArg("max-count", "32", "limit", "max-cnt", "max")
 
 	sessionsDone := sessions.AddSub("done", "ok", "o").
@@ -805,6 +926,7 @@ func RegisterSessionCmds(cmds *model.CmdTree) {
 		SetAllowTailModeCall().
 		SetQuiet()
 	addFindStrArgs(sessionsDone)
+	sessionsDone.AddArg("query", "", "filter", "q")
 	sessionsDone.AddArg("max-count", "32", "limit", "max-cnt", "max")
 
 	sessionsRunning := sessions.AddSub("running", "run", "ing", "i").
@@ -813,6 +935,7 @@ func RegisterSessionCmds(cmds *model.CmdTree) {
 		SetAllowTailModeCall().
 		SetQuiet()
 	addFindStrArgs(sessionsRunning)
+	sessionsRunning.AddArg("query", "", "filter", "q")
 	sessionsRunning.AddArg("max-count", "32", "limit", "max-cnt", "max")
 
 	errDesc := sessionsErr.AddSub("desc", "d", "-").
@@ -957,9 +1080,35 @@ func RegisterSessionCmds(cmds *model.CmdTree) {
 		AddArg("unfold-trivial", "1", "unfold", "unf", "uf", "u", "trivial", "triv", "tri", "t").
 		AddArg("depth", "32", "d")
 
-	sessions.AddSub("retry", "r").
-		RegAdHotFlowCmd(SessionRetry,
-			"find a session by id, retry running it, executed commands will be skipped").
+	sessions.AddSub("tail", "follow", "t").
+		RegPowerCmd(SessionsTail,
+			"follow the command logs of a session until it ends, use the last running session if id is empty").
+		SetQuiet().
+		AddArg("session-id", "", "session", "id").
+		AddArg("interval", "500ms", "int")
+
+	sessions.AddSub("kill").
+		RegPowerCmd(KillSession,
+			"kill a running session by SIGTERM (SIGKILL if 'force'), use the last running session if id is empty").
+		SetQuiet().
+		AddArg("session-id", "", "session", "id").
+		AddArg("force", "false", "f")
+
+	retry := sessions.AddSub("retry", "r")
+	retry.RegAdHotFlowCmd(SessionRetry,
+		"find a session by id, retry running it, executed commands will be skipped").
+		AddArg("session-id", "", "session", "id")
+
+	retry.AddSub("from", "f").
+		RegAdHotFlowCmd(SessionRetryFrom,
+			"re-run a session from the command at index (1-based, path like 2.1.3 for subflow), use the last session if id is empty").
+		AddArg("idx", "", "index", "i").
+		AddArg("session-id", "", "session", "id")
+
+	retry.AddSub("skip", "s").
+		RegAdHotFlowCmd(SessionRetrySkip,
+			"retry a session, skip the command at index (1-based, path like 2.1.3 for subflow), use the last session if id is empty").
+		AddArg("idx", "", "index", "i").
 		AddArg("session-id", "", "session", "id")
 
 	last.AddSub("retry", "r", "R").
@@ -984,16 +1133,106 @@ func RegisterSessionCmds(cmds *model.CmdTree) {
 		SetAllowTailModeCall().
 		SetQuiet()
 	addFindStrArgs(removeByFind)
+	removeByFind.AddArg("query", "", "filter", "q")
 	removeByFind.AddArg("remove-running", "false", "force")
 
 	remove.AddSub("all", "a").
 		RegPowerCmd(RemoveAllSessions,
 			"clear all executed sessions")
 
+	sessionsStats := sessions.AddSub("stats", "stat").
+		RegPowerCmd(SessionsStats,
+			"aggregate per-command run count, success rate, durations and errors over the matched sessions").
+		SetAllowTailModeCall().
+		SetQuiet()
+	addFindStrArgs(sessionsStats)
+	sessionsStats.AddArg("query", "", "filter", "q")
+	sessionsStats.AddArg("max-count", "0", "limit", "max-cnt", "max").
+		AddArg("recent", "5", "recent-runs").
+		AddArg("slower-ratio", "1.2", "ratio").
+		AddArg("top-errors", "3", "errors").
+		AddArg("json", "false", "j")
+
+	sessions.AddSub("compare", "cmp", "diff").
+		RegPowerCmd(SessionsCompare,
+			"compare two sessions step by step: results, durations, env and log tails of diverged steps").
+		SetQuiet().
+		AddArg("a", "", "session-a").
+		AddArg("b", "", "session-b").
+		AddArg("log-lines", "10", "lines", "log").
+		AddArg("show-same", "false", "all").
+		AddArg("json", "false", "j")
+
+	sessions.AddSub("export", "exp").
+		RegPowerCmd(ExportSession,
+			"export a session to a tar.gz archive, use the last session if id is empty").
+		AddArg("session-id", "", "session", "id").
+		AddArg("path", "", "file", "p").
+		AddArg("redact", "true", "r")
+
+	sessionsImport := sessions.AddSub("import", "imp")
+	sessionsImport.RegPowerCmd(ImportSession,
+		"import a session from a tar.gz archive, imported sessions are read-only").
+		AddArg("path", "", "file", "p").
+		AddArg("force", "false", "f")
+
+	sessionsImportList := sessionsImport.AddSub("list", "ls").
+		RegPowerCmd(ListImportedSessions,
+			"list imported sessions").
+		SetAllowTailModeCall()
+	addFindStrArgs(sessionsImportList)
+
+	sessions.AddSub("convert-status", "convert", "conv").
+		RegPowerCmd(ConvertSessionStatus,
+			"convert the status files of a session (or all sessions if id is empty) to the format 'text' or 'jsonl'").
+		AddArg("format", "jsonl", "fmt", "f").
+		AddArg("session-id", "", "session", "id")
+
 	sessions.AddSub("set-keep-duration", "keep-duration", "keep", "kd").
 		RegPowerCmd(SetSessionsKeepDur,
 			"set the keeping duration of executed sessions").
 		AddArg("duration", "72h", "dur")
+
+	sessions.AddSub("pin").
+		RegPowerCmd(PinSession,
+			"pin a session so it will never be collected by the retention policies").
+		SetQuiet().
+		AddArg("session-id", "", "session", "id")
+
+	sessions.AddSub("unpin").
+		RegPowerCmd(UnpinSession,
+			"unpin a session, let it be collected by the retention policies").
+		SetQuiet().
+		AddArg("session-id", "", "session", "id")
+
+	sessions.AddSub("tag").
+		RegPowerCmd(TagSession,
+			"add tags (comma separated) to a session, tagged sessions are searchable and never collected automatically, use the last session if id is empty").
+		SetQuiet().
+		AddArg("tag", "", "tags").
+		AddArg("session-id", "", "session", "id")
+
+	sessions.AddSub("untag").
+		RegPowerCmd(UntagSession,
+			"remove tags (comma separated) from a session, remove all tags if arg 'tag' is empty").
+		SetQuiet().
+		AddArg("tag", "", "tags").
+		AddArg("session-id", "", "session", "id")
+
+	sessions.AddSub("note").
+		RegPowerCmd(NoteSession,
+			"set a note to a session, clear it if the text is empty, use the last session if id is empty").
+		SetQuiet().
+		AddArg("text", "", "note").
+		AddArg("session-id", "", "session", "id")
+
+	gc := sessions.AddSub("gc")
+	gc.RegPowerCmd(SessionsGC,
+		"remove the sessions out of the retention policies (keep duration, max count, max size)")
+
+	gc.AddSub("dry", "dry-run", "plan").
+		RegPowerCmd(SessionsGCDry,
+			"show the sessions would be removed by the retention policies")
 }
 
 func RegisterBlenderCmds(cmds *model.CmdTree) {
@@ -1437,7 +1676,8 @@ func RegisterJoinCmds(cmds *model.CmdTree) {
 		RegPowerCmd(JoinNew,
 			"add new argument").
 		AddArg("key", "").
-		AddArg("value", "", "val")
+		AddArg("value", "", "val").
+		SetArgIsList("value")
 	join.AddSub("run").
 		RegPowerCmd(JoinRun,
 			"run with arguments").
@@ -1486,10 +1726,17 @@ func RegisterApiCmds(cmds *model.CmdTree) {
 		SetIsApi().
 		AddArg("cmd", "")
 
-	cmd.AddSub("meta").
+	meta := cmd.AddSub("meta").
 		RegPowerCmd(ApiCmdMeta,
 			"get command meta file path").
 		SetIsApi().
+		AddArg("cmd", "").
+		Owner()
+
+	meta.AddSub("merged").
+		RegPowerCmd(ApiCmdMetaMerged,
+			"get command meta with the included files merged as JSON, with the origin of each key").
+		SetIsApi().
 		AddArg("cmd", "")
 
 	cmd.AddSub("dir").
@@ -0,0 +1,48 @@
+package builtin
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/innerr/ticat/pkg/cli/display"
+	"github.com/innerr/ticat/pkg/core/model"
+)
+
+// The max time to wait for the detached process to create its session
+const detachedSessionWaitTime = 5 * time.Second
+
+func RunDetached(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	flowStr := strings.TrimSpace(argv.GetRaw("flow"))
+	if len(flowStr) == 0 {
+		return currCmdIdx, model.NewCmdError(flow.Cmds[currCmdIdx], "arg 'flow' is empty")
+	}
+	return currCmdIdx, StartDetachedFlow(cc, env, flowStr)
+}
+
+// StartDetachedFlow runs the flow in a new ticat process, which is not affected by the exiting of current one
+func StartDetachedFlow(cc *model.Cli, env *model.Env, flowStr string) error {
+	detached, err := model.StartDetachedFlow(env, flowStr, detachedSessionWaitTime)
+	if err != nil {
+		return err
+	}
+	if len(detached.SessionDir) == 0 {
+		return fmt.Errorf("detached process (pid %d) started, but its session not found, output is in '%s'",
+			detached.Pid, detached.LogPath)
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("flow detached to session [%s], pid %d, output is in:", detached.SessionDir, detached.Pid),
+		"",
+		"    "+detached.LogPath,
+		"",
+		"follow or kill it by:",
+		"",
+		display.SuggestDetachedSession(env, detached.SessionDir))
+	return nil
+}
@@ -1,10 +1,13 @@
 package builtin
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/innerr/ticat/pkg/cli/display"
 	"github.com/innerr/ticat/pkg/core/model"
+	"github.com/innerr/ticat/pkg/mods/persist/meta_file"
+	"github.com/innerr/ticat/pkg/mods/persist/mod_meta"
 )
 
 func DumpCmdUsage(
@@ -70,6 +73,76 @@ func DumpCmdWithDetailsAndFlow(
 	return currCmdIdx, nil
 }
 
+// DumpCmdMeta displays the meta of a cmd with the included files merged, and where the included keys are from
+func DumpCmdMeta(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmdPath, err := tailModeCallArg(flow, currCmdIdx, argv, "cmd-path")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	meta, err := readCmdMeta(cc, env, flow.Cmds[currCmdIdx], cmdPath)
+	if err != nil {
+		return currCmdIdx, err
+	}
+
+	display.PrintTipTitle(cc.Screen, env, "merged meta of command '"+cmdPath+"':")
+	_ = cc.Screen.Print(display.ColorProp("- meta: ", env) + meta.Path() + "\n")
+	for _, path := range meta.Includes() {
+		_ = cc.Screen.Print(display.ColorProp("- include: ", env) + path + "\n")
+	}
+	for _, name := range meta.SectionNames() {
+		section := meta.GetSection(name)
+		if len(section.Keys()) == 0 {
+			continue
+		}
+		_ = cc.Screen.Print("\n")
+		if name != meta_file.GlobalSectionName {
+			_ = cc.Screen.Print(display.ColorSymbol("["+name+"]", env) + "\n")
+		}
+		for _, key := range section.Keys() {
+			lines := strings.Split(section.GetUnTrim(key), meta_file.LineSep)
+			line := display.ColorKey(key, env) + display.ColorSymbol(" = ", env) + lines[0]
+			if len(lines) > 1 {
+				line += " " + string(meta_file.MultiLineBreaker)
+			}
+			if origin := meta.Origin(name, key); origin != meta.Path() {
+				line += display.ColorExplain("  <- "+origin, env)
+			}
+			_ = cc.Screen.Print(line + "\n")
+			for i, it := range lines[1:] {
+				if i != len(lines)-2 {
+					it += " " + string(meta_file.MultiLineBreaker)
+				}
+				_ = cc.Screen.Print("    " + it + "\n")
+			}
+		}
+	}
+	return currCmdIdx, nil
+}
+
+// readCmdMeta parses the meta file of the cmd, it's not kept in the cmd after registering
+func readCmdMeta(cc *model.Cli, env *model.Env, cmd model.ParsedCmd, cmdPath string) (*meta_file.MetaFile, error) {
+	cmdTree := cc.Cmds.GetSubByPath(cmdPath, true)
+	if cmdTree == nil || cmdTree.Cmd() == nil {
+		return nil, model.NewCmdError(cmd, fmt.Sprintf("command '%s' not found", cmdPath))
+	}
+	metaPath := cmdTree.Cmd().MetaFile()
+	if len(metaPath) == 0 {
+		return nil, model.NewCmdError(cmd, fmt.Sprintf("command '%s' has no meta file", cmdPath))
+	}
+	meta, err := mod_meta.ReadCmdMeta(metaPath, cmdTree.Path(), env.GetRaw("strs.flow-ext"),
+		cc.Cmds.Strs.PathSep)
+	if err != nil {
+		return nil, model.WrapCmdError(cmd, err)
+	}
+	return meta, nil
+}
+
 func printUsageExample(cc *model.Cli, env *model.Env, cmdPath string, cmdTree *model.CmdTree) {
 	selfName := env.GetRaw("strs.self-name")
 	argsExample := ""
@@ -19,6 +19,9 @@ func LoadDefaultEnv(env *model.Env, info *model.EnvKeysInfo) {
 	env.SetInt("sys.stack-depth", 0)
 
 	env.SetBool("sys.bg.wait", true)
+	// Max running background tasks of a pool, zero means unlimited.
+	// A pool named by '%pool=name' could use 'sys.bg.pool.<name>.max-concurrency' to override this.
+	env.SetInt("sys.bg.max-concurrency", 0)
 
 	env.SetBool("sys.panic.recover", true)
 	env.SetInt("sys.execute-wait-sec", 0)
@@ -27,17 +30,44 @@ func LoadDefaultEnv(env *model.Env, info *model.EnvKeysInfo) {
 	env.Set("sys.version", "1.6")
 	env.Set("sys.dev.name", "stone-age")
 	env.Set("sys.mods.integrated", "builtin")
+	// Cache the registered mods of each hub repo, the meta files are parsed only when the cmds are used
+	env.SetBool("sys.mods.index", true)
 
 	env.Set("sys.output.format", "text")
 
 	env.Set("display.help.cmds", "")
 
 	env.SetBool("sys.env.use-cmd-abbrs", false)
+	env.SetBool("sys.parser.prefix-match", false)
 
 	// 100 days
 	env.SetDur("sys.sessions.keep-status-duration", "2400h")
+	// Empty means the same as 'keep-status-duration'
+	env.Set("sys.sessions.keep-failed-duration", "")
+	// Zero or empty means no limit, the size is like '512M' or '2G'
+	env.SetInt("sys.sessions.max-count", 0)
+	env.Set("sys.sessions.max-size", "")
+	// The background GC prints nothing while running, it's waited and its error is displayed before exiting
+	env.SetBool("sys.sessions.gc.background", true)
+	// Extra sensitive key patterns (besides the builtin ones) for redacting exported sessions
+	env.Set("sys.sessions.export.redact-keys", "")
+	// Format of session status files: 'text' or 'jsonl'
+	env.Set("sys.session.status-format", "text")
 
 	env.Set("sys.hub.init-repo", "ticat-mods/marsh")
+	// Integrity check policy when loading repos with 'hub.sum' manifest:
+	//   off:    no check
+	//   warn:   report the mismatched repos but still load them
+	//   refuse: don't load the mismatched repos
+	//   strict: only load the repos with manifests signed by trusted keys, except the local dirs without manifests
+	// In 'warn', the results are cached until the files of the repo change, so the repos are not hashed on every loading,
+	// the files are always hashed in 'refuse' and 'strict'
+	env.Set("sys.hub.verify", "warn")
+	// Max repos updating (git clone/pull) at the same time
+	env.SetInt("sys.hub.update-concurrency", 8)
+	// The dir to find newer versions of the file repos (eg: 'file:///share/mods-1.4.tar.gz') when updating,
+	// empty means the dir of the current version
+	env.Set("sys.hub.file-repo-source", "")
 	env.Set("sys.self.repo", "https://github.com/innerr/ticat")
 
 	row, col := utils.GetTerminalWidth(50, 100)
@@ -153,6 +183,7 @@ func LoadRuntimeEnv(
 
 	env.Set("sys.paths.sessions", filepath.Join(data, "sessions"))
 	paths.GetOrAddSub("sessions").AddAbbrs("session", "s", "S")
+	env.Set("sys.paths.sessions.imported", filepath.Join(data, "sessions-imported"))
 
 	ip := utils.IpId()
 	env.Set("sys.session.id.ip", ip)
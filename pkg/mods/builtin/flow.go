@@ -392,8 +392,38 @@ func loadFlowsFromDir(
 
 	flowExt := env.GetRaw("strs.flow-ext")
 	envPathSep := env.GetRaw("strs.env-path-sep")
+	abbrsSep := cc.Cmds.Strs.AbbrsSep
 	panicRecover := env.GetBool("sys.panic.recover")
 
+	if !env.GetBool("sys.mods.index") {
+		_ = loadFlowFiles(cc, root, flowExt, abbrsSep, envPathSep, source, nil, panicRecover)
+		return nil
+	}
+	fingerprint, err := mod_meta.FlowsFingerprint(root, []string{flowExt}, abbrsSep, envPathSep, cc.Cmds.Strs.PathSep)
+	if err != nil {
+		_ = loadFlowFiles(cc, root, flowExt, abbrsSep, envPathSep, source, nil, panicRecover)
+		return nil
+	}
+	indexPath := filepath.Join(env.GetRaw("sys.paths.cache"), "mods-index", mod_meta.ModIndexFileName(root))
+	loadWithModIndex(cc, indexPath, fingerprint, nil, flowExt, abbrsSep, envPathSep, source, panicRecover,
+		func(index *mod_meta.ModIndex) bool {
+			return loadFlowFiles(cc, root, flowExt, abbrsSep, envPathSep, source, index, panicRecover)
+		})
+	return nil
+}
+
+// loadFlowFiles registers the flow files in the dir (the hidden dirs are included), returns false if any failed
+func loadFlowFiles(
+	cc *model.Cli,
+	root string,
+	flowExt string,
+	abbrsSep string,
+	envPathSep string,
+	source string,
+	index *mod_meta.ModIndex,
+	panicRecover bool) (allLoaded bool) {
+
+	allLoaded = true
 	_ = filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
 			return nil
@@ -406,8 +436,9 @@ func loadFlowsFromDir(
 		}
 		cmdPath := filepath.Base(path[0 : len(path)-len(flowExt)])
 		cmdPaths := strings.Split(cmdPath, cc.Cmds.Strs.PathSep)
-		if err := mod_meta.RegMod(cc, path, "", false, true, cmdPaths, flowExt,
-			cc.Cmds.Strs.AbbrsSep, envPathSep, source, panicRecover); err != nil {
+		if err := mod_meta.RegMod(cc, path, "", false, true, cmdPaths, nil, flowExt,
+			abbrsSep, envPathSep, source, index, panicRecover); err != nil {
+			allLoaded = false
 			if panicRecover {
 				return nil
 			}
@@ -415,7 +446,7 @@ func loadFlowsFromDir(
 		}
 		return nil
 	})
-	return nil
+	return
 }
 
 func getCmdRealPath(
@@ -538,5 +569,5 @@ func loadFlowAfterSave(cc *model.Cli, env *model.Env, filePath string, cmdPath s
 	envPathSep := env.GetRaw("strs.env-path-sep")
 	panicRecover := env.GetBool("sys.panic.recover")
 	cmdPaths := strings.Split(cmdPath, cc.Cmds.Strs.PathSep)
-	_ = mod_meta.RegMod(cc, filePath, "", false, true, cmdPaths, flowExt, abbrsSep, envPathSep, "flow.save", panicRecover)
+	_ = mod_meta.RegMod(cc, filePath, "", false, true, cmdPaths, nil, flowExt, abbrsSep, envPathSep, "flow.save", nil, panicRecover)
 }
@@ -11,6 +11,7 @@ import (
 	"github.com/innerr/ticat/pkg/core/model"
 	meta "github.com/innerr/ticat/pkg/mods/persist/hub_meta"
 	"github.com/innerr/ticat/pkg/utils"
+	"github.com/innerr/ticat/pkg/version"
 )
 
 func LoadModsFromHub(
@@ -32,6 +33,12 @@ func LoadModsFromHub(
 	if err != nil {
 		return currCmdIdx, err
 	}
+	priorities, err := meta.ReadHubPriorityFile(getHubPriorityPath(env, flow.Cmds[currCmdIdx]), fieldSep)
+	if err != nil {
+		return currCmdIdx, err
+	}
+	cc.CmdConflicts.Priorities = toCmdPriorities(priorities, infos)
+
 	for _, info := range infos {
 		if info.OnOff != "on" {
 			continue
@@ -53,7 +60,12 @@ func AddGitRepoToHub(
 		return currCmdIdx, err
 	}
 	branch := argv.GetRaw("git-branch")
-	if _, _, err := addRepoToHubAndLoadMods(cc, meta.RepoAddr{Addr: addr, Branch: branch},
+	ref := argv.GetRaw("ref")
+	mount, err := normalizeMount(cc, flow.Cmds[currCmdIdx], argv.GetRaw("mount"))
+	if err != nil {
+		return currCmdIdx, err
+	}
+	if _, _, err := addRepoToHubAndLoadMods(cc, meta.RepoAddr{Addr: addr, Branch: branch, Ref: ref}, mount, true,
 		argv, cc.Screen, env, flow.Cmds[currCmdIdx]); err != nil {
 		return currCmdIdx, err
 	}
@@ -63,7 +75,7 @@ func AddGitRepoToHub(
 		sep := env.GetRaw("strs.list-sep")
 		addrs := strings.Split(initAddr, sep)
 		for _, addr := range addrs {
-			if _, _, err := addRepoToHubAndLoadMods(cc, meta.RepoAddr{Addr: addr, Branch: ""},
+			if _, _, err := addRepoToHubAndLoadMods(cc, meta.RepoAddr{Addr: addr, Branch: ""}, "", false,
 				argv, cc.Screen, env, flow.Cmds[currCmdIdx]); err != nil {
 				return currCmdIdx, err
 			}
@@ -142,7 +154,7 @@ func AddDefaultGitRepoToHub(
 	sep := env.GetRaw("strs.list-sep")
 	addrs := strings.Split(addr, sep)
 	for _, addr := range addrs {
-		if _, _, err := addRepoToHubAndLoadMods(cc, meta.RepoAddr{Addr: addr, Branch: ""},
+		if _, _, err := addRepoToHubAndLoadMods(cc, meta.RepoAddr{Addr: addr, Branch: ""}, "", false,
 			argv, cc.Screen, env, flow.Cmds[currCmdIdx]); err != nil {
 			return currCmdIdx, err
 		}
@@ -320,7 +332,7 @@ func CheckGitRepoStatus(
 	// Do not do exactl-match for readonly commands
 
 	for _, info := range infos {
-		if len(info.Addr.Str()) == 0 {
+		if len(info.Addr.Str()) == 0 || info.Addr.IsFile() {
 			continue
 		}
 		if len(findStrs) != 0 {
@@ -357,7 +369,6 @@ func UpdateHub(
 	cmd := flow.Cmds[currCmdIdx]
 	metaPath := getReposInfoPath(env, cmd)
 	listFileName := env.GetRaw("strs.repos-file-name")
-	repoExt := env.GetRaw("strs.mods-repo-ext")
 
 	path := getHubPath(env, cmd)
 	fieldSep := env.GetRaw("strs.proto-sep")
@@ -369,24 +380,35 @@ func UpdateHub(
 	finisheds := map[string]bool{}
 	for _, info := range oldInfos {
 		if info.OnOff != "on" {
-			finisheds[info.Addr.Str()] = true
+			finisheds[info.Addr.Key()] = true
 		}
 	}
 
 	selfName := env.GetRaw("strs.self-name")
 	var infos []meta.RepoInfo
+	changed := false
+
+	updater := meta.NewRepoUpdater(cc.Screen, env, finisheds, path, listFileName, selfName,
+		env.GetInt("sys.hub.update-concurrency"), cmd)
+	updater.UpgradeFileRepos(env.GetRaw("sys.hub.file-repo-source"))
+	for _, info := range oldInfos {
+		if len(info.Addr.Str()) != 0 {
+			updater.Start(info.Addr)
+		}
+	}
+	printRepoUpdateSummary(cc.Screen, env, updater.Wait())
 
 	for _, info := range oldInfos {
 		if len(info.Addr.Str()) == 0 {
 			continue
 		}
-		_, addrs, helpStrs, err := meta.UpdateRepoAndSubRepos(
-			cc.Screen, env, finisheds, path, info.Addr, repoExt, listFileName, selfName, cmd)
+		_, addrs, helpStrs, err := updater.Collect(info.Addr)
 		if err != nil {
 			return currCmdIdx, err
 		}
 		for i, addr := range addrs {
-			if oldList[addr.Str()] {
+			if oldList[addr.Key()] {
+				changed = updateRepoPin(oldInfos, addr) || changed
 				continue
 			}
 			repoPath, err := meta.GetRepoPath(path, addr)
@@ -397,13 +419,21 @@ func UpdateHub(
 		}
 	}
 
+	upgradedPaths := upgradeFileRepos(oldInfos, updater, path)
+	changed = changed || len(upgradedPaths) != 0
+
 	infos = append(oldInfos, infos...)
-	if len(infos) != len(oldInfos) {
+	if changed || len(infos) != len(oldInfos) {
 		if err := meta.WriteReposInfoFile(hubDir, metaPath, infos, fieldSep); err != nil {
 			return currCmdIdx, err
 		}
 	}
-
+	// The old versions are removed after the new ones are recorded
+	for _, oldPath := range upgradedPaths {
+		if err := osRemoveDir(oldPath, cmd); err != nil {
+			return currCmdIdx, err
+		}
+	}
 	if showTip := argv.GetBool("show-tip"); showTip {
 		display.PrintTipTitle(cc.Screen, env, fmt.Sprintf(
 			"local dir could also add to %s, use command 'hub.add.local'",
@@ -412,6 +442,244 @@ func UpdateHub(
 	return currCmdIdx, nil
 }
 
+func LockHub(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	if !isOsCmdExists("git") {
+		return currCmdIdx, model.NewCmdError(cmd, "cant't find 'git'")
+	}
+	metaPath := getReposInfoPath(env, cmd)
+	fieldSep := env.GetRaw("strs.proto-sep")
+	hubDir := env.GetRaw("sys.paths.hub")
+	infos, _, err := meta.ReadReposInfoFile(hubDir, metaPath, true, fieldSep)
+	if err != nil {
+		return currCmdIdx, err
+	}
+	locks, err := meta.GenHubLock(infos)
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	lockPath := getHubLockPath(env, cmd)
+	if err := meta.WriteHubLockFile(lockPath, locks, fieldSep); err != nil {
+		return currCmdIdx, err
+	}
+
+	for _, lock := range locks {
+		_ = cc.Screen.Print(display.ColorHub("["+meta.AddrDisplayName(lock.Addr)+"]", env) + "\n")
+		_ = cc.Screen.Print("    " + display.ColorProp("commit:", env) + " " + lock.Commit + "\n")
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("%d repos locked to the current commits in '%s',", len(locks), lockPath),
+		"copy it to other machines and use 'hub.lock.apply' to reproduce them")
+	return currCmdIdx, nil
+}
+
+func ApplyHubLock(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	if !isOsCmdExists("git") {
+		return currCmdIdx, model.NewCmdError(cmd, "cant't find 'git'")
+	}
+	fieldSep := env.GetRaw("strs.proto-sep")
+	lockPath := argv.GetRaw("path")
+	if len(lockPath) == 0 {
+		lockPath = getHubLockPath(env, cmd)
+	}
+	locks, err := meta.ReadHubLockFile(lockPath, fieldSep)
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+
+	path := getHubPath(env, cmd)
+	if err := os.MkdirAll(path, os.ModePerm); err != nil {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("create hub path '%s' failed: %v", path, err))
+	}
+	metaPath := getReposInfoPath(env, cmd)
+	hubDir := env.GetRaw("sys.paths.hub")
+	infos, list, err := meta.ReadReposInfoFile(hubDir, metaPath, true, fieldSep)
+	if err != nil {
+		return currCmdIdx, err
+	}
+
+	selfName := env.GetRaw("strs.self-name")
+	listFileName := env.GetRaw("strs.repos-file-name")
+	applied := map[string]bool{}
+	for _, lock := range locks {
+		repoPath, err := meta.CheckoutRepoToLock(cc.Screen, env, path, lock, cmd)
+		if err != nil {
+			return currCmdIdx, err
+		}
+		applied[lock.Addr.Key()] = true
+		if list[lock.Addr.Key()] {
+			for i, info := range infos {
+				if info.Addr.Key() == lock.Addr.Key() {
+					infos[i].Addr = lock.Addr
+					infos[i].OnOff = "on"
+				}
+			}
+			continue
+		}
+		helpStr, _, _, _ := meta.ReadRepoListFromFile(selfName, filepath.Join(repoPath, listFileName))
+		info := meta.RepoInfo{Addr: lock.Addr, AddReason: lock.AddReason, Path: repoPath, HelpStr: helpStr, OnOff: "on"}
+		loadRepoMods(cc, env, info)
+		infos = append(infos, info)
+	}
+	if err := meta.WriteReposInfoFile(hubDir, metaPath, infos, fieldSep); err != nil {
+		return currCmdIdx, err
+	}
+	// The applied lock is refreshed with the extra repos, it's not necessary so only warn on failure
+	if err := writeHubLock(env, cmd, infos); err != nil {
+		display.PrintErrTitle(cc.Screen, env, fmt.Sprintf("refresh the hub lock file failed: %v", err))
+	}
+
+	var extras []string
+	for _, info := range infos {
+		if !info.IsLocal() && info.OnOff == "on" && !applied[info.Addr.Key()] {
+			extras = append(extras, "    "+meta.AddrDisplayName(info.Addr))
+		}
+	}
+	if len(extras) != 0 {
+		display.PrintTipTitle(cc.Screen, env,
+			fmt.Sprintf("%d repos checked out to the locked commits, these repos are not in the lock file:", len(locks)),
+			"",
+			extras,
+			"",
+			"disable them by 'hub.disable' to get the exact same repos")
+	} else {
+		display.PrintTipTitle(cc.Screen, env,
+			fmt.Sprintf("%d repos checked out to the locked commits", len(locks)))
+	}
+	return currCmdIdx, nil
+}
+
+func ExportHubBundle(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	metaPath := getReposInfoPath(env, cmd)
+	fieldSep := env.GetRaw("strs.proto-sep")
+	hubDir := env.GetRaw("sys.paths.hub")
+	infos, _, err := meta.ReadReposInfoFile(hubDir, metaPath, true, fieldSep)
+	if err != nil {
+		return currCmdIdx, err
+	}
+
+	path := argv.GetRaw("path")
+	if len(path) == 0 {
+		path = env.GetRaw("strs.self-name") + "-hub.tar.gz"
+	}
+
+	manifest := meta.HubBundleManifest{TicatVersion: env.GetRaw("sys.version")}
+	if len(version.GitHash) != 0 {
+		manifest.TicatVersion += " " + version.GitHash
+	}
+	manifest.Host, _ = os.Hostname()
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("create bundle file '%s' failed: %v", path, err))
+	}
+	manifest, err = meta.ExportHubBundle(file, infos, manifest)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+
+	for _, repo := range manifest.Repos {
+		name := repo.Dir
+		if !repo.IsLocal() {
+			name = meta.AddrDisplayName(meta.ParseRepoAddr(repo.Addr))
+		}
+		_ = cc.Screen.Print(display.ColorHub("["+name+"]", env) + "\n")
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("%d enabled repos exported to bundle '%s',", len(manifest.Repos), path),
+		"copy it to other machines and use 'hub.bundle.import' to install them")
+	return currCmdIdx, nil
+}
+
+func ImportHubBundle(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	path, err := getAndCheckArg(argv, cmd, "path")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("open bundle file '%s' failed: %v", path, err))
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	metaPath := getReposInfoPath(env, cmd)
+	fieldSep := env.GetRaw("strs.proto-sep")
+	hubDir := env.GetRaw("sys.paths.hub")
+	infos, _, err := meta.ReadReposInfoFile(hubDir, metaPath, true, fieldSep)
+	if err != nil {
+		return currCmdIdx, err
+	}
+
+	infos, results, manifest, err := meta.ImportHubBundle(file, getHubPath(env, cmd), infos)
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	if err := meta.WriteReposInfoFile(hubDir, metaPath, infos, fieldSep); err != nil {
+		return currCmdIdx, err
+	}
+
+	// The replaced repos are loaded on bootstrap with the old content, remove them before loading
+	updated := 0
+	for _, it := range results {
+		displayHubRepo(cc.Screen, env, it.Info)
+		_ = cc.Screen.Print(fmt.Sprintf(display.ColorProp("    - bundle:  ", env)+"%s\n", it.Result))
+		if it.Result == meta.HubBundleRepoUnchanged || it.Info.OnOff != "on" {
+			continue
+		}
+		if it.Result == meta.HubBundleRepoUpdated {
+			cc.Cmds.RemoveSource(repoSource(it.Info))
+			updated += 1
+		}
+		loadRepoMods(cc, env, it.Info)
+	}
+
+	tip := fmt.Sprintf("%d repos imported from bundle '%s'", len(results), path)
+	if len(manifest.Host) != 0 {
+		tip += ", exported on host '" + manifest.Host + "'"
+	}
+	if updated != 0 {
+		display.PrintTipTitle(cc.Screen, env, tip+",",
+			fmt.Sprintf("%d changed repos are replaced and reloaded", updated))
+	} else {
+		display.PrintTipTitle(cc.Screen, env, tip)
+	}
+	return currCmdIdx, nil
+}
+
 func EnableRepoInHub(
 	argv model.ArgVals,
 	cc *model.Cli,
@@ -520,7 +788,11 @@ func AddLocalDirToHub(
 	if err != nil {
 		return currCmdIdx, err
 	}
-	return addLocalDirToHub(argv, cc, env, flow, currCmdIdx, path)
+	mount, err := normalizeMount(cc, flow.Cmds[currCmdIdx], argv.GetRaw("mount"))
+	if err != nil {
+		return currCmdIdx, err
+	}
+	return addLocalDirToHub(argv, cc, env, flow, currCmdIdx, path, mount)
 }
 
 func AddPwdToHub(
@@ -530,7 +802,11 @@ func AddPwdToHub(
 	flow *model.ParsedCmds,
 	currCmdIdx int) (int, error) {
 
-	return addLocalDirToHub(argv, cc, env, flow, currCmdIdx, ".")
+	mount, err := normalizeMount(cc, flow.Cmds[currCmdIdx], argv.GetRaw("mount"))
+	if err != nil {
+		return currCmdIdx, err
+	}
+	return addLocalDirToHub(argv, cc, env, flow, currCmdIdx, ".", mount)
 }
 
 func addLocalDirToHub(
@@ -539,7 +815,8 @@ func addLocalDirToHub(
 	env *model.Env,
 	flow *model.ParsedCmds,
 	currCmdIdx int,
-	path string) (int, error) {
+	path string,
+	mount string) (int, error) {
 
 	cmd := flow.Cmds[currCmdIdx]
 
@@ -568,7 +845,7 @@ func addLocalDirToHub(
 	found := false
 	for i, info := range infos {
 		if info.Path == path {
-			if info.OnOff == "on" {
+			if info.OnOff == "on" && info.Mount == mount {
 				_ = screen.Print(fmt.Sprintf("%s (exists)\n", repoDisplayName(info, env)))
 				printInfoProps(screen, env, info)
 				display.PrintTipTitle(cc.Screen, env,
@@ -576,6 +853,7 @@ func addLocalDirToHub(
 				return currCmdIdx, nil
 			}
 			info.OnOff = "on"
+			info.Mount = mount
 			infos[i] = info
 			_ = screen.Print(fmt.Sprintf("%s%s\n", repoDisplayName(info, env), enabledStr(env, true)))
 			printInfoProps(screen, env, info)
@@ -588,7 +866,7 @@ func addLocalDirToHub(
 		listFileName := env.GetRaw("strs.repos-file-name")
 		listFilePath := filepath.Join(path, listFileName)
 		helpStr, _, _, _ := meta.ReadRepoListFromFile(env.GetRaw("strs.self-name"), listFilePath)
-		info := meta.RepoInfo{Addr: meta.RepoAddr{Addr: "", Branch: ""}, AddReason: "<local>", Path: path, HelpStr: helpStr, OnOff: "on"}
+		info := meta.RepoInfo{Addr: meta.RepoAddr{Addr: "", Branch: ""}, AddReason: "<local>", Path: path, HelpStr: helpStr, OnOff: "on", Mount: mount}
 		infos = append(infos, info)
 		_ = screen.Print(fmt.Sprintf("%s\n", repoDisplayName(info, env)))
 		printInfoProps(screen, env, info)
@@ -602,7 +880,7 @@ func addLocalDirToHub(
 			"local dir added to hub")
 	} else {
 		display.PrintTipTitle(cc.Screen, env,
-			"local dir re-enabled")
+			"local dir re-enabled or re-mounted")
 	}
 	screen.WriteTo(cc.Screen)
 
@@ -795,6 +1073,9 @@ func displayHubRepo(screen model.Screen, env *model.Env, info meta.RepoInfo) {
 	}
 	_ = screen.Print(fmt.Sprintf(display.ColorProp("    - from:    ", env)+"%s\n", getDisplayReason(info)))
 	_ = screen.Print(fmt.Sprintf(display.ColorProp("    - path:    ", env)+"%s\n", info.Path))
+	if len(info.Mount) != 0 {
+		_ = screen.Print(fmt.Sprintf(display.ColorProp("    - mount:   ", env)+"%s\n", info.Mount))
+	}
 }
 
 func purgeInactiveRepoFromHub(findStr string, cc *model.Cli, env *model.Env, cmd model.ParsedCmd) error {
@@ -891,20 +1172,20 @@ func moveSavedFlowsToLocalDir(toDir string, cc *model.Cli, env *model.Env, cmd m
 	return count
 }
 
+// The pinned ref and the mount point of an existing repo are changed only if 'override' is true
 func addRepoToHubAndLoadMods(
 	cc *model.Cli,
 	gitAddr meta.RepoAddr,
+	mount string,
+	override bool,
 	argv model.ArgVals,
 	screen model.Screen,
 	env *model.Env,
 	cmd model.ParsedCmd) (addrs []meta.RepoAddr, helpStrs []string, err error) {
 
-	// A repo with this suffix should be a well controlled one, that we could assume some things
-	repoExt := env.GetRaw("strs.mods-repo-ext")
-
 	gitAddr.Addr = meta.NormalizeGitAddr(gitAddr.Addr)
 
-	if !isOsCmdExists("git") {
+	if !gitAddr.IsFile() && !isOsCmdExists("git") {
 		return nil, nil, model.NewCmdError(cmd, "cant't find 'git'")
 	}
 
@@ -923,20 +1204,30 @@ func addRepoToHubAndLoadMods(
 	}
 	finisheds := map[string]bool{}
 	for i, info := range oldInfos {
-		if info.Addr == gitAddr {
+		if info.Addr.Key() == gitAddr.Key() {
+			// Adding an existing repo could pin it to another ref or unpin it, and change the mount point
+			if override {
+				info.Addr = gitAddr
+				info.Mount = mount
+			} else {
+				gitAddr = info.Addr
+			}
 			info.OnOff = "on"
 			oldInfos[i] = info
 		}
 		if info.OnOff != "on" {
-			finisheds[info.Addr.Str()] = true
+			finisheds[info.Addr.Key()] = true
 		}
 	}
 
 	selfName := env.GetRaw("strs.self-name")
 	listFileName := env.GetRaw("strs.repos-file-name")
 	var topRepoHelpStr string
-	topRepoHelpStr, addrs, helpStrs, err = meta.UpdateRepoAndSubRepos(
-		screen, env, finisheds, path, gitAddr, repoExt, listFileName, selfName, cmd)
+	updater := meta.NewRepoUpdater(screen, env, finisheds, path, listFileName, selfName,
+		env.GetInt("sys.hub.update-concurrency"), cmd)
+	updater.Start(gitAddr)
+	printRepoUpdateSummary(screen, env, updater.Wait())
+	topRepoHelpStr, addrs, helpStrs, err = updater.Collect(gitAddr)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -946,7 +1237,10 @@ func addRepoToHubAndLoadMods(
 
 	var infos []meta.RepoInfo
 	for i, addr := range addrs {
-		if oldList[addr.Str()] {
+		if oldList[addr.Key()] {
+			if i != 0 {
+				updateRepoPin(oldInfos, addr)
+			}
 			continue
 		}
 		var repoPath string
@@ -955,6 +1249,9 @@ func addRepoToHubAndLoadMods(
 			return nil, nil, err
 		}
 		info := meta.RepoInfo{Addr: addr, AddReason: gitAddr.Str(), Path: repoPath, HelpStr: helpStrs[i], OnOff: "on"}
+		if i == 0 {
+			info.Mount = mount
+		}
 		loadRepoMods(cc, env, info)
 		infos = append(infos, info)
 	}
@@ -966,6 +1263,81 @@ func addRepoToHubAndLoadMods(
 	return addrs, helpStrs, nil
 }
 
+// printRepoUpdateSummary prints the git output of the failed repos and the counts of each status,
+// the rows of the progress table are printed by the updater when each repo finished
+func printRepoUpdateSummary(screen model.Screen, env *model.Env, results []meta.RepoUpdateResult) {
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Status] += 1
+		if result.Err == nil {
+			continue
+		}
+		_ = screen.Print(display.ColorHub("["+meta.AddrDisplayName(result.Addr)+"]", env) +
+			display.ColorError(" failed: ", env) + result.Err.Error() + "\n")
+		for _, line := range strings.Split(strings.TrimSpace(result.Output), "\n") {
+			if len(line) != 0 {
+				_ = screen.Print(display.ColorExplain("    "+line, env) + "\n")
+			}
+		}
+	}
+	if len(results) == 0 {
+		return
+	}
+	var strs []string
+	for _, status := range []string{meta.RepoCloned, meta.RepoUnpacked, meta.RepoUpdated, meta.RepoUnchanged, meta.RepoFailed} {
+		if counts[status] != 0 {
+			strs = append(strs, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	display.PrintTipTitle(screen, env, fmt.Sprintf("%d repos: %s", len(results), strings.Join(strs, ", ")))
+}
+
+// upgradeFileRepos updates the infos of the file repos upgraded to newer versions, returns the paths of the old versions
+func upgradeFileRepos(infos []meta.RepoInfo, updater *meta.RepoUpdater, hubPath string) (oldPaths []string) {
+	for i, info := range infos {
+		if !info.Addr.IsFile() {
+			continue
+		}
+		resolved := updater.Resolved(info.Addr)
+		if resolved.Addr == info.Addr.Addr {
+			continue
+		}
+		repoPath, err := meta.GetRepoPath(hubPath, resolved)
+		if err != nil {
+			continue
+		}
+		if info.Path != repoPath && strings.HasPrefix(info.Path, hubPath) {
+			oldPaths = append(oldPaths, info.Path)
+		}
+		// Keep it displayed as manually added
+		if info.AddReason == info.Addr.Str() {
+			infos[i].AddReason = resolved.Str()
+		}
+		infos[i].Addr = resolved
+		infos[i].Path = repoPath
+	}
+	return
+}
+
+// updateRepoPin updates the pinned ref of an existing repo, the pin may be changed in the hub-repo list
+func updateRepoPin(infos []meta.RepoInfo, addr meta.RepoAddr) (changed bool) {
+	for i, info := range infos {
+		if info.Addr.Key() == addr.Key() && info.Addr.Ref != addr.Ref {
+			infos[i].Addr = addr
+			changed = true
+		}
+	}
+	return
+}
+
+func writeHubLock(env *model.Env, cmd model.ParsedCmd, infos []meta.RepoInfo) error {
+	locks, err := meta.GenHubLock(infos)
+	if err != nil {
+		return model.WrapCmdError(cmd, err)
+	}
+	return meta.WriteHubLockFile(getHubLockPath(env, cmd), locks, env.GetRaw("strs.proto-sep"))
+}
+
 func loadRepoMods(cc *model.Cli, env *model.Env, info meta.RepoInfo) {
 	metaExt := env.GetRaw("strs.meta-ext")
 	flowExt := env.GetRaw("strs.flow-ext")
@@ -975,14 +1347,63 @@ func loadRepoMods(cc *model.Cli, env *model.Env, info meta.RepoInfo) {
 	reposFileName := env.GetRaw("strs.repos-file-name")
 	panicRecover := env.GetBool("sys.panic.recover")
 
+	if !checkRepoIntegrity(cc, env, info) {
+		return
+	}
+
+	var mountPath []string
+	if len(info.Mount) != 0 {
+		mountPath = strings.Split(info.Mount, cc.Cmds.Strs.PathSep)
+	}
+	if !env.GetBool("sys.mods.index") {
+		_ = loadLocalMods(cc, info.Path, reposFileName, metaExt, flowExt, helpExt,
+			abbrsSep, envPathSep, repoSource(info), mountPath, nil, panicRecover)
+		return
+	}
+	indexDir := filepath.Join(env.GetRaw("sys.paths.cache"), "mods-index")
+	loadIndexedLocalMods(cc, info.Path, indexDir, reposFileName, metaExt, flowExt, helpExt,
+		abbrsSep, envPathSep, repoSource(info), mountPath, panicRecover)
+}
+
+func isCmdNameStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// normalizeMount checks the mount point and converts the abbrs in it to real names
+func normalizeMount(cc *model.Cli, cmd model.ParsedCmd, mount string) (string, error) {
+	if len(mount) == 0 {
+		return "", nil
+	}
+	pathSep := cc.Cmds.Strs.PathSep
+	segs := strings.Split(strings.Trim(mount, pathSep), pathSep)
+	node := cc.Cmds
+	for i, seg := range segs {
+		if len(seg) == 0 || strings.ContainsAny(seg, " \t") || !isCmdNameStart(seg[0]) {
+			return "", model.NewCmdError(cmd, fmt.Sprintf("bad mount point '%s', segment '%s' is not a valid cmd name", mount, seg))
+		}
+		if node == nil {
+			continue
+		}
+		if sub := node.GetSub(seg); sub != nil {
+			if sub.Cmd() != nil && !sub.IsEmpty() {
+				return "", model.NewCmdError(cmd, fmt.Sprintf("bad mount point '%s', '%s' is an executable command",
+					mount, sub.DisplayPath()))
+			}
+			segs[i] = sub.Name()
+		}
+		node = node.GetSub(seg)
+	}
+	return strings.Join(segs, pathSep), nil
+}
+
+// The source of the mods loaded from a repo/dir
+func repoSource(info meta.RepoInfo) string {
 	// TODO: move this login to RepoAddr
 	source := info.Addr.Str()
 	if len(source) == 0 {
 		source = info.Path
 	}
-
-	loadLocalMods(cc, info.Path, reposFileName, metaExt, flowExt, helpExt,
-		abbrsSep, envPathSep, source, panicRecover)
+	return source
 }
 
 func printInfoProps(screen model.Screen, env *model.Env, info meta.RepoInfo) {
@@ -991,6 +1412,9 @@ func printInfoProps(screen model.Screen, env *model.Env, info meta.RepoInfo) {
 	}
 	_ = screen.Print(fmt.Sprintf(display.ColorProp("    - from: ", env)+"%s\n", getDisplayReason(info)))
 	_ = screen.Print(fmt.Sprintf(display.ColorProp("    - path: ", env)+"%s\n", info.Path))
+	if len(info.Mount) != 0 {
+		_ = screen.Print(fmt.Sprintf(display.ColorProp("    - mount: ", env)+"%s\n", info.Mount))
+	}
 }
 
 func getDisplayReason(info meta.RepoInfo) string {
@@ -1072,6 +1496,36 @@ func getReposInfoPath(env *model.Env, cmd model.ParsedCmd) string {
 	return filepath.Join(path, reposInfoFileName)
 }
 
+func getHubLockPath(env *model.Env, cmd model.ParsedCmd) string {
+	path := getHubPath(env, cmd)
+	lockFileName := env.GetRaw("strs.hub-lock-file-name")
+	if len(lockFileName) == 0 {
+		// PANIC: Programming error - hub lock file name not configured
+		panic(model.NewCmdError(cmd, "cant't get hub lock file name"))
+	}
+	return filepath.Join(path, lockFileName)
+}
+
+func getHubPriorityPath(env *model.Env, cmd model.ParsedCmd) string {
+	path := getHubPath(env, cmd)
+	priorityFileName := env.GetRaw("strs.hub-priority-file-name")
+	if len(priorityFileName) == 0 {
+		// PANIC: Programming error - hub priority file name not configured
+		panic(model.NewCmdError(cmd, "cant't get hub priority file name"))
+	}
+	return filepath.Join(path, priorityFileName)
+}
+
+func getHubTrustPath(env *model.Env, cmd model.ParsedCmd) string {
+	path := getHubPath(env, cmd)
+	trustFileName := env.GetRaw("strs.hub-trust-file-name")
+	if len(trustFileName) == 0 {
+		// PANIC: Programming error - hub trust file name not configured
+		panic(model.NewCmdError(cmd, "cant't get hub trust file name"))
+	}
+	return filepath.Join(path, trustFileName)
+}
+
 func repoDisplayName(info meta.RepoInfo, env *model.Env) string {
 	var name string
 	if len(info.Addr.Addr) == 0 {
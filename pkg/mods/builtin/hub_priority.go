@@ -0,0 +1,257 @@
+package builtin
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/innerr/ticat/pkg/cli/display"
+	"github.com/innerr/ticat/pkg/core/model"
+	meta "github.com/innerr/ticat/pkg/mods/persist/hub_meta"
+)
+
+func ListHubConflicts(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	type conflictRow struct {
+		cmdPath string
+		props   [][2]string
+	}
+	var rows []conflictRow
+
+	for _, it := range cc.CmdConflicts.List {
+		loser := it.Loser
+		props := [][2]string{{"winner:", it.Winner}, {"decided:", "by " + it.By}}
+		if len(it.ShadowPath) != 0 {
+			props = append(props, [2]string{"shadowed:", loser}, [2]string{"call-by:", it.ShadowPath})
+		} else {
+			props = append(props, [2]string{"dropped:", loser})
+		}
+		rows = append(rows, conflictRow{it.CmdPath, props})
+	}
+
+	sep := env.GetRaw("strs.cmd-path-sep")
+	addTolerableErr := func(oldSource string, err model.TolerableErr) {
+		conflicted := err.Err.(model.ErrConflicted)
+		cmdPath := strings.Join(conflicted.GetConflictedCmdPath(), sep)
+		if cc.CmdConflicts.Has(cmdPath, err.Source) {
+			return
+		}
+		if len(oldSource) == 0 {
+			oldSource = cc.Cmds.Strs.BuiltinDisplayName
+		}
+		rows = append(rows, conflictRow{cmdPath, [][2]string{
+			{"winner:", oldSource},
+			{"decided:", "not resolvable, the new one is not loaded"},
+			{"dropped:", err.Source},
+			{"detail:", conflicted.Error()},
+		}})
+	}
+	for _, list := range cc.TolerableErrs.ConflictedWithBuiltin {
+		for _, err := range list {
+			addTolerableErr("", err)
+		}
+	}
+	for oldSource, conflicteds := range cc.TolerableErrs.Conflicteds {
+		for _, list := range conflicteds {
+			for _, err := range list {
+				addTolerableErr(oldSource, err)
+			}
+		}
+	}
+
+	if len(rows) == 0 {
+		display.PrintTipTitle(cc.Screen, env, "no command conflicts between repos/dirs")
+		return currCmdIdx, nil
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].cmdPath < rows[j].cmdPath
+	})
+	for _, row := range rows {
+		_ = cc.Screen.Print(display.ColorCmd("["+row.cmdPath+"]", env) + "\n")
+		for _, prop := range row.props {
+			_ = cc.Screen.Print(fmt.Sprintf(display.ColorProp("    - %-10s", env)+"%s\n", prop[0], prop[1]))
+		}
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("%d command conflicts, use 'hub.priority' or 'hub.priority.cmd' to decide the winners,", len(rows)),
+		"the shadowed ones could be called by the 'call-by' paths")
+	return currCmdIdx, nil
+}
+
+func SetHubRepoPriority(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	infos, priorities, err := readHubPriorities(env, cmd)
+	if err != nil {
+		return currCmdIdx, err
+	}
+
+	findStr := argv.GetRaw("repo")
+	if len(findStr) == 0 {
+		dumpHubPriorities(cc.Screen, env, infos, priorities)
+		return currCmdIdx, nil
+	}
+	info, err := findOneRepoInHub(cmd, infos, findStr)
+	if err != nil {
+		return currCmdIdx, err
+	}
+	key := meta.RepoPriorityKey(info)
+
+	levelStr := argv.GetRaw("level")
+	if len(levelStr) == 0 {
+		_ = cc.Screen.Print(repoDisplayName(info, env) + "\n")
+		_ = cc.Screen.Print(fmt.Sprintf(display.ColorProp("    - level:   ", env)+"%d\n", priorities.RepoLevels[key]))
+		return currCmdIdx, nil
+	}
+	level, err := strconv.Atoi(levelStr)
+	if err != nil {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("level '%s' is not an integer", levelStr))
+	}
+	if level == 0 {
+		delete(priorities.RepoLevels, key)
+	} else {
+		priorities.RepoLevels[key] = level
+	}
+	if err := meta.WriteHubPriorityFile(getHubPriorityPath(env, cmd), priorities, env.GetRaw("strs.proto-sep")); err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+
+	_ = cc.Screen.Print(repoDisplayName(info, env) + "\n")
+	_ = cc.Screen.Print(fmt.Sprintf(display.ColorProp("    - level:   ", env)+"%d\n", level))
+	display.PrintTipTitle(cc.Screen, env,
+		"the repo with higher level wins when commands conflict, the default level is 0.",
+		"it takes effect from the next run")
+	return currCmdIdx, nil
+}
+
+func SetHubCmdPriority(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	cmdStr, err := getAndCheckArg(argv, cmd, "cmd")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	node := cc.Cmds.GetSubByPath(cmdStr, false)
+	if node == nil {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("command '%s' not found", cmdStr))
+	}
+	cmdPath := node.DisplayPath()
+
+	infos, priorities, err := readHubPriorities(env, cmd)
+	if err != nil {
+		return currCmdIdx, err
+	}
+
+	findStr := argv.GetRaw("repo")
+	if len(findStr) == 0 {
+		delete(priorities.CmdRepos, cmdPath)
+	} else {
+		info, err := findOneRepoInHub(cmd, infos, findStr)
+		if err != nil {
+			return currCmdIdx, err
+		}
+		priorities.CmdRepos[cmdPath] = meta.RepoPriorityKey(info)
+	}
+	if err := meta.WriteHubPriorityFile(getHubPriorityPath(env, cmd), priorities, env.GetRaw("strs.proto-sep")); err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+
+	if len(findStr) == 0 {
+		display.PrintTipTitle(cc.Screen, env,
+			"the winner rule of command '"+cmdPath+"' is removed, it takes effect from the next run")
+	} else {
+		display.PrintTipTitle(cc.Screen, env,
+			"the winner of command '"+cmdPath+"' is set to '"+priorities.CmdRepos[cmdPath]+"',",
+			"it takes effect from the next run")
+	}
+	return currCmdIdx, nil
+}
+
+func readHubPriorities(env *model.Env, cmd model.ParsedCmd) ([]meta.RepoInfo, meta.HubPriorities, error) {
+	fieldSep := env.GetRaw("strs.proto-sep")
+	hubDir := env.GetRaw("sys.paths.hub")
+	infos, _, err := meta.ReadReposInfoFile(hubDir, getReposInfoPath(env, cmd), true, fieldSep)
+	if err != nil {
+		return nil, meta.HubPriorities{}, err
+	}
+	priorities, err := meta.ReadHubPriorityFile(getHubPriorityPath(env, cmd), fieldSep)
+	if err != nil {
+		return nil, priorities, model.WrapCmdError(cmd, err)
+	}
+	return infos, priorities, nil
+}
+
+func findOneRepoInHub(cmd model.ParsedCmd, infos []meta.RepoInfo, findStr string) (meta.RepoInfo, error) {
+	extracted, _ := meta.ExtractAddrFromList(infos, findStr)
+	if len(extracted) == 0 {
+		return meta.RepoInfo{}, model.NewCmdError(cmd, fmt.Sprintf("no repo matched find string '%s'", findStr))
+	}
+	if len(extracted) > 1 {
+		return meta.RepoInfo{}, model.NewCmdError(cmd,
+			fmt.Sprintf("more than one repo (%d) matched find string '%s'", len(extracted), findStr))
+	}
+	return extracted[0], nil
+}
+
+func dumpHubPriorities(screen model.Screen, env *model.Env, infos []meta.RepoInfo, priorities meta.HubPriorities) {
+	if len(priorities.RepoLevels) == 0 && len(priorities.CmdRepos) == 0 {
+		display.PrintTipTitle(screen, env,
+			"no priority rules, the first loaded one wins when commands conflict")
+		return
+	}
+	for _, info := range infos {
+		level, ok := priorities.RepoLevels[meta.RepoPriorityKey(info)]
+		if !ok {
+			continue
+		}
+		_ = screen.Print(repoDisplayName(info, env) + "\n")
+		_ = screen.Print(fmt.Sprintf(display.ColorProp("    - level:   ", env)+"%d\n", level))
+	}
+	var cmdPaths []string
+	for cmdPath := range priorities.CmdRepos {
+		cmdPaths = append(cmdPaths, cmdPath)
+	}
+	sort.Strings(cmdPaths)
+	for _, cmdPath := range cmdPaths {
+		_ = screen.Print(display.ColorCmd("["+cmdPath+"]", env) + "\n")
+		_ = screen.Print(fmt.Sprintf(display.ColorProp("    - winner:  ", env)+"%s\n", priorities.CmdRepos[cmdPath]))
+	}
+	display.PrintTipTitle(screen, env,
+		"use 'hub.conflicts' to list the conflicted commands and the winners")
+}
+
+// toCmdPriorities converts the rules from repo keys to mod sources
+func toCmdPriorities(priorities meta.HubPriorities, infos []meta.RepoInfo) model.CmdPriorities {
+	result := model.NewCmdPriorities()
+	sources := map[string]string{}
+	for _, info := range infos {
+		key := meta.RepoPriorityKey(info)
+		sources[key] = repoSource(info)
+		if level, ok := priorities.RepoLevels[key]; ok {
+			result.SourceLevels[repoSource(info)] = level
+		}
+	}
+	for cmdPath, key := range priorities.CmdRepos {
+		if source, ok := sources[key]; ok {
+			result.CmdWinners[cmdPath] = source
+		}
+	}
+	return result
+}
@@ -0,0 +1,376 @@
+package builtin
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/innerr/ticat/pkg/cli/display"
+	"github.com/innerr/ticat/pkg/core/model"
+	meta "github.com/innerr/ticat/pkg/mods/persist/hub_meta"
+)
+
+func VerifyHub(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	fieldSep := env.GetRaw("strs.proto-sep")
+	infos, _, err := meta.ReadReposInfoFile(getHubPath(env, cmd), getReposInfoPath(env, cmd), true, fieldSep)
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	trusted, err := meta.ReadHubTrustFile(getHubTrustPath(env, cmd), fieldSep)
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	strict := env.GetRaw("sys.hub.verify") == "strict"
+
+	var failed []string
+	for _, info := range infos {
+		if info.OnOff != "on" {
+			continue
+		}
+		result, err := verifyRepo(env, info, trusted)
+		_ = cc.Screen.Print(repoDisplayName(info, env) + "\n")
+		if err != nil {
+			_ = cc.Screen.Print(fmt.Sprintf(display.ColorProp("    - integrity: ", env)+"%s\n",
+				display.ColorError("error: "+err.Error(), env)))
+			failed = append(failed, repoDisplayName(info, env))
+			continue
+		}
+		_ = cc.Screen.Print(fmt.Sprintf(display.ColorProp("    - integrity: ", env)+"%s\n", integrityStr(result, env)))
+		_ = cc.Screen.Print(fmt.Sprintf(display.ColorProp("    - signed-by: ", env)+"%s\n", signerStr(result)))
+		problems := result.Problems(requireTrusted(info, strict, result))
+		for _, problem := range problems {
+			_ = cc.Screen.Print(fmt.Sprintf(display.ColorProp("    - problem:   ", env)+"%s\n", problem))
+		}
+		if len(problems) != 0 {
+			failed = append(failed, repoDisplayName(info, env))
+		}
+	}
+
+	if len(failed) != 0 {
+		return currCmdIdx, model.NewCmdError(cmd,
+			fmt.Sprintf("integrity check failed for %d repos: %s", len(failed), strings.Join(failed, ", ")))
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		"all enabled repos passed the integrity check.",
+		"the repos without 'hub.sum' manifests are not checked unless 'sys.hub.verify' is 'strict',",
+		"the local dirs without manifests are not checked even in 'strict'")
+	return currCmdIdx, nil
+}
+
+func ListHubTrustedKeys(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	trusted, err := meta.ReadHubTrustFile(getHubTrustPath(env, cmd), env.GetRaw("strs.proto-sep"))
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	if len(trusted) == 0 {
+		display.PrintTipTitle(cc.Screen, env,
+			"no trusted keys, use 'hub.trust.add' to trust the public key of a repo signer")
+		return currCmdIdx, nil
+	}
+	var names []string
+	for name := range trusted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_ = cc.Screen.Print(fmt.Sprintf("[%s]\n", name))
+		_ = cc.Screen.Print(fmt.Sprintf(display.ColorProp("    - key: ", env)+"%s\n", trusted[name]))
+	}
+	return currCmdIdx, nil
+}
+
+func AddHubTrustedKey(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	keyStr, err := getAndCheckArg(argv, cmd, "key")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	key, err := meta.ParseEd25519PublicKey(keyStr)
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	keyStr = hex.EncodeToString(key)
+	name := argv.GetRaw("name")
+	if len(name) == 0 {
+		name = keyStr[:16]
+	}
+	fieldSep := env.GetRaw("strs.proto-sep")
+	if strings.Contains(name, fieldSep) || strings.ContainsAny(name, "\n\r") {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("bad key name '%s'", name))
+	}
+
+	path := getHubTrustPath(env, cmd)
+	trusted, err := meta.ReadHubTrustFile(path, fieldSep)
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	if old := trusted.Find(key); len(old) != 0 && old != name {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("key already trusted as '%s'", old))
+	}
+	trusted[name] = keyStr
+	if err := meta.WriteHubTrustFile(path, trusted, fieldSep); err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		"the repos with manifests signed by key '"+name+"' are trusted from the next run")
+	return currCmdIdx, nil
+}
+
+func RemoveHubTrustedKey(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	name, err := getAndCheckArg(argv, cmd, "name")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	fieldSep := env.GetRaw("strs.proto-sep")
+	path := getHubTrustPath(env, cmd)
+	trusted, err := meta.ReadHubTrustFile(path, fieldSep)
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	if _, ok := trusted[name]; !ok {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("no trusted key named '%s'", name))
+	}
+	delete(trusted, name)
+	if err := meta.WriteHubTrustFile(path, trusted, fieldSep); err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	display.PrintTipTitle(cc.Screen, env, "trusted key '"+name+"' removed")
+	return currCmdIdx, nil
+}
+
+func GenHubSum(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	dir, err := getAndCheckArg(argv, cmd, "path")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	if !dirExists(dir) {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("'%s' is not a dir", dir))
+	}
+	fieldSep := env.GetRaw("strs.proto-sep")
+	sumFileName := env.GetRaw("strs.hub-sum-file-name")
+	sigFileName := env.GetRaw("strs.hub-sum-sig-file-name")
+
+	var key ed25519.PrivateKey
+	keyPath := argv.GetRaw("sign-key")
+	if len(keyPath) != 0 {
+		data, err := os.ReadFile(keyPath)
+		if err != nil {
+			return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("read key file '%s' failed: %v", keyPath, err))
+		}
+		if key, err = meta.ParseEd25519PrivateKey(string(data)); err != nil {
+			return currCmdIdx, model.WrapCmdError(cmd, err)
+		}
+	}
+
+	sum, err := meta.GenHubSum(dir, sumFileName, sigFileName)
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	sumData := sum.Encode(fieldSep)
+	if err := os.WriteFile(filepath.Join(dir, sumFileName), sumData, 0644); err != nil {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("write manifest failed: %v", err))
+	}
+	sigPath := filepath.Join(dir, sigFileName)
+	if key == nil {
+		// The old signature doesn't match the new manifest
+		if err := os.Remove(sigPath); err != nil && !os.IsNotExist(err) {
+			return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("remove old signature failed: %v", err))
+		}
+		display.PrintTipTitle(cc.Screen, env,
+			fmt.Sprintf("manifest '%s' generated with %d files, not signed", sumFileName, len(sum)))
+		return currCmdIdx, nil
+	}
+	if err := os.WriteFile(sigPath, meta.SignHubSum(sumData, key, fieldSep), 0644); err != nil {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("write signature failed: %v", err))
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("manifest '%s' generated with %d files, signed by key:", sumFileName, len(sum)),
+		"",
+		"    "+hex.EncodeToString(key.Public().(ed25519.PublicKey)),
+		"",
+		"the users could trust it by 'hub.trust.add'")
+	return currCmdIdx, nil
+}
+
+func GenHubSumKey(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	path, err := getAndCheckArg(argv, cmd, "path")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("create key file '%s' failed: %v", path, err))
+	}
+	_, err = file.WriteString(hex.EncodeToString(key.Seed()) + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return currCmdIdx, model.NewCmdError(cmd, fmt.Sprintf("write key file '%s' failed: %v", path, err))
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		"private key saved to '"+path+"', keep it secret. the public key:",
+		"",
+		"    "+hex.EncodeToString(pub),
+		"",
+		"sign a repo by 'hub.sum.gen path=<repo> sign-key="+path+"'")
+	return currCmdIdx, nil
+}
+
+// checkRepoIntegrity checks the repo by the policy 'sys.hub.verify', the problems are reported as tolerable errors,
+// returns false if the repo should not be loaded
+func checkRepoIntegrity(cc *model.Cli, env *model.Env, info meta.RepoInfo) bool {
+	policy := env.GetRaw("sys.hub.verify")
+	source := repoSource(info)
+	var refuse, strict bool
+	switch policy {
+	case "", "off":
+		return true
+	case "warn":
+	case "refuse":
+		refuse = true
+	case "strict":
+		refuse, strict = true, true
+	default:
+		cc.TolerableErrs.OnErr(fmt.Errorf("unknown integrity check policy '%s' in 'sys.hub.verify'", policy),
+			source, info.Path, "repo not loaded, the policy should be one of: off, warn, refuse, strict")
+		return false
+	}
+
+	sumPath := filepath.Join(info.Path, env.GetRaw("strs.hub-sum-file-name"))
+	if !fileExists(sumPath) && (!strict || info.IsLocal()) {
+		return true
+	}
+	reason := "integrity check failed, the repo is still loaded by policy '" + policy + "'"
+	if refuse {
+		reason = "integrity check failed, the repo is not loaded by policy '" + policy + "'"
+	}
+
+	trusted, err := meta.ReadHubTrustFile(filepath.Join(env.GetRaw("sys.paths.hub"),
+		env.GetRaw("strs.hub-trust-file-name")), env.GetRaw("strs.proto-sep"))
+	if err != nil {
+		cc.TolerableErrs.OnErr(err, source, sumPath, reason)
+		return !refuse
+	}
+	// The cache stamp is only the file stats, they could be forged, so it's only trusted by 'warn'
+	var result meta.HubVerifyResult
+	if refuse {
+		result, err = verifyRepo(env, info, trusted)
+	} else {
+		result, err = verifyRepoWithCache(env, info, trusted)
+	}
+	if err != nil {
+		cc.TolerableErrs.OnErr(err, source, sumPath, reason)
+		return !refuse
+	}
+	problems := result.Problems(requireTrusted(info, strict, result))
+	if len(problems) == 0 {
+		return true
+	}
+	cc.TolerableErrs.OnErr(fmt.Errorf("%s", strings.Join(problems, "; ")), source, sumPath, reason)
+	return !refuse
+}
+
+func verifyRepo(env *model.Env, info meta.RepoInfo, trusted meta.HubTrustedKeys) (meta.HubVerifyResult, error) {
+	return meta.VerifyHubSum(info.Path, env.GetRaw("strs.hub-sum-file-name"),
+		env.GetRaw("strs.hub-sum-sig-file-name"), trusted, env.GetRaw("strs.proto-sep"))
+}
+
+// verifyRepoWithCache only hashes the files when the repo changed (or the trusted keys changed) since last check,
+// so the repos are verified once after updating, not on every loading.
+// The changes are detected by file stats (mtime could be restored), it should not be used by the refusing policies.
+func verifyRepoWithCache(env *model.Env, info meta.RepoInfo, trusted meta.HubTrustedKeys) (meta.HubVerifyResult, error) {
+	stamp, err := meta.HubSumStamp(info.Path, trusted)
+	if err != nil {
+		return verifyRepo(env, info, trusted)
+	}
+	cachePath := filepath.Join(env.GetRaw("sys.paths.cache"), "hub-verify", meta.HubVerifyCacheFileName(info.Path))
+	if cache, err := meta.ReadHubVerifyCache(cachePath); err == nil && cache.Stamp == stamp {
+		return cache.Result, nil
+	}
+	result, err := verifyRepo(env, info, trusted)
+	if err != nil {
+		return result, err
+	}
+	_ = meta.WriteHubVerifyCache(cachePath, meta.HubVerifyCache{Stamp: stamp, Result: result})
+	return result, nil
+}
+
+// requireTrusted decides if the repo should be signed by a trusted key in 'strict' policy,
+// the local dirs without manifests are not required, they are usually developing by the user
+func requireTrusted(info meta.RepoInfo, strict bool, result meta.HubVerifyResult) bool {
+	return strict && (result.HasSum || !info.IsLocal())
+}
+
+func integrityStr(result meta.HubVerifyResult, env *model.Env) string {
+	if !result.HasSum {
+		return "no manifest"
+	}
+	if result.Tampered() {
+		return display.ColorError("mismatched", env)
+	}
+	return "ok"
+}
+
+func signerStr(result meta.HubVerifyResult) string {
+	if !result.Signed {
+		return "(unsigned)"
+	}
+	if result.BadSig {
+		return "(invalid signature)"
+	}
+	if len(result.TrustedBy) == 0 {
+		return "(untrusted key) " + result.Signer
+	}
+	return result.TrustedBy
+}
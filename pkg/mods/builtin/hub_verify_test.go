@@ -0,0 +1,59 @@
+package builtin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/innerr/ticat/pkg/core/model"
+	meta "github.com/innerr/ticat/pkg/mods/persist/hub_meta"
+)
+
+func TestCheckRepoIntegrityForgedStats(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(repo, "run.bash")
+	if err := os.WriteFile(script, []byte("echo 1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := meta.GenHubSum(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "hub.sum"), sum.Encode("\t"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := model.NewEnv()
+	env.Set("strs.hub-sum-file-name", "hub.sum")
+	env.Set("strs.hub-sum-sig-file-name", "hub.sum.sig")
+	env.Set("strs.hub-trust-file-name", "trust.hub")
+	env.Set("strs.proto-sep", "\t")
+	env.Set("sys.paths.hub", filepath.Join(root, "hub"))
+	env.Set("sys.paths.cache", filepath.Join(root, "cache"))
+	info := meta.RepoInfo{Path: repo}
+	check := func(policy string) bool {
+		env.Set("sys.hub.verify", policy)
+		return checkRepoIntegrity(&model.Cli{TolerableErrs: model.NewTolerableErrs()}, env, info)
+	}
+
+	if !check("warn") || !check("refuse") {
+		t.Fatal("the repo should pass the check")
+	}
+
+	// Tamper the file with the same size and restore the mtime, the cached stamp won't change
+	stat, _ := os.Stat(script)
+	if err := os.WriteFile(script, []byte("echo 2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(script, time.Now(), stat.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if check("refuse") {
+		t.Errorf("the tampered repo should be refused, the cache should not be used")
+	}
+}
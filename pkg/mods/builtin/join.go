@@ -67,6 +67,7 @@ func JoinNew(
 			}
 		}
 	} else {
+		// Not 'argv.GetList', the items are kept as they are, not trimmed and the empty ones are not dropped
 		vals = strings.Split(val, env.GetRaw("strs.list-sep"))
 	}
 
@@ -0,0 +1,213 @@
+package builtin
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/innerr/ticat/pkg/cli/display"
+	"github.com/innerr/ticat/pkg/core/model"
+	"github.com/innerr/ticat/pkg/mods/persist/meta_file"
+)
+
+// ConvertMetaToYaml converts the '.ticat' and '.tiflow' files in a dir (or a single file) to YAML meta files
+func ConvertMetaToYaml(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	cmd := flow.Cmds[currCmdIdx]
+	path, err := tailModeCallArg(flow, currCmdIdx, argv, "path")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	if len(path) == 0 {
+		return currCmdIdx, model.NewCmdError(cmd, "arg 'path' is empty")
+	}
+	dryRun := argv.GetBool("dry-run")
+
+	paths, err := findMetaFilesToConvert(env, path)
+	if err != nil {
+		return currCmdIdx, model.WrapCmdError(cmd, err)
+	}
+	if len(paths) == 0 {
+		display.PrintTipTitle(cc.Screen, env, "no meta file to convert in '"+path+"'")
+		return currCmdIdx, nil
+	}
+
+	converted := 0
+	for _, metaPath := range paths {
+		targets, err := convertMetaFileToYaml(metaPath, dryRun)
+		if err != nil {
+			return currCmdIdx, model.WrapCmdError(cmd, err)
+		}
+		for _, target := range targets {
+			_ = cc.Screen.Print(display.ColorProp("- ", env) + metaPath +
+				display.ColorSymbol(" -> ", env) + target + "\n")
+		}
+		converted += 1
+	}
+
+	if dryRun {
+		display.PrintTipTitle(cc.Screen, env,
+			fmt.Sprintf("%d meta files would be converted, nothing changed (dry-run)", converted))
+	} else {
+		display.PrintTipTitle(cc.Screen, env,
+			fmt.Sprintf("%d meta files converted, the origin files are removed", converted),
+			"the included files are not converted, YAML meta files could include them as before")
+	}
+	return currCmdIdx, nil
+}
+
+// findMetaFilesToConvert returns the registerable meta files, the hidden dirs (shared included files) are skipped.
+// The saved flows are skipped too, the flow cmds (eg: 'flow.save', 'flow.rm') only handle the old format.
+func findMetaFilesToConvert(env *model.Env, path string) (paths []string, err error) {
+	metaExt := env.GetRaw("strs.meta-ext")
+	flowExt := env.GetRaw("strs.flow-ext")
+	reposFileName := env.GetRaw("strs.repos-file-name")
+	flowsDir := env.GetRaw("sys.paths.flows")
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if isInDir(flowsDir, path) {
+		return nil, fmt.Errorf("'%s' is in the saved flows dir '%s', the saved flows can't be converted", path, flowsDir)
+	}
+	if !info.IsDir() {
+		if !strings.HasSuffix(path, metaExt) && !strings.HasSuffix(path, flowExt) {
+			return nil, fmt.Errorf("'%s' is not a meta file, the ext should be '%s' or '%s'", path, metaExt, flowExt)
+		}
+		return []string{path}, nil
+	}
+
+	err = filepath.Walk(path, func(metaPath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			base := filepath.Base(metaPath)
+			if metaPath != path && len(base) > 0 && base[0] == '.' {
+				return filepath.SkipDir
+			}
+			if isInDir(flowsDir, metaPath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Base(metaPath) == reposFileName {
+			return nil
+		}
+		if strings.HasSuffix(metaPath, metaExt) || strings.HasSuffix(metaPath, flowExt) {
+			paths = append(paths, metaPath)
+		}
+		return nil
+	})
+	return
+}
+
+// convertMetaFileToYaml writes the YAML meta file(s) of a meta file, and removes the origin one if not dry-run.
+// A combined flow file is split into one YAML file for each virtual file.
+func convertMetaFileToYaml(metaPath string, dryRun bool) (targets []string, err error) {
+	metas, err := meta_file.NewRawMetaFile(metaPath)
+	if err != nil {
+		return nil, fmt.Errorf("parse meta file '%s' failed: %v", metaPath, err)
+	}
+
+	var contents [][]byte
+	seen := map[string]bool{}
+	for _, it := range metas {
+		target := metaPath + meta_file.YamlExts[0]
+		if !it.NotVirtual {
+			target = filepath.Join(filepath.Dir(metaPath), filepath.Base(it.VirtualPath)) + meta_file.YamlExts[0]
+		} else if len(metas) > 1 && isEmptyMeta(it.Meta) {
+			// The blank lines before the first virtual file in a combined file
+			continue
+		}
+		if _, err := os.Stat(target); err == nil || seen[target] {
+			return nil, fmt.Errorf("converting '%s' failed: '%s' already exists", metaPath, target)
+		}
+		seen[target] = true
+		targets = append(targets, target)
+		contents = append(contents, it.Meta.EncodeYaml())
+	}
+	if dryRun {
+		return
+	}
+
+	if err := writeFilesOrNone(targets, contents); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(metaPath); err != nil {
+		return nil, fmt.Errorf("remove the converted meta file '%s' failed: %v", metaPath, err)
+	}
+	return
+}
+
+// writeFilesOrNone writes the files to tmp files first, then renames them,
+// the written ones are removed if any one failed, so a combined file won't be partially converted
+func writeFilesOrNone(targets []string, contents [][]byte) (err error) {
+	var tmps []string
+	var written []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, it := range append(tmps, written...) {
+			_ = os.Remove(it)
+		}
+	}()
+
+	for i, target := range targets {
+		file, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+		if err != nil {
+			return fmt.Errorf("write yaml meta file '%s' failed: %v", target, err)
+		}
+		tmps = append(tmps, file.Name())
+		_, err = file.Write(contents[i])
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(file.Name(), 0644)
+		}
+		if err != nil {
+			return fmt.Errorf("write yaml meta file '%s' failed: %v", target, err)
+		}
+	}
+	for i, target := range targets {
+		if err := os.Rename(tmps[i], target); err != nil {
+			return fmt.Errorf("write yaml meta file '%s' failed: %v", target, err)
+		}
+		written = append(written, target)
+	}
+	return nil
+}
+
+// isInDir returns true if the path is the dir or in the dir
+func isInDir(dir string, path string) bool {
+	if len(dir) == 0 {
+		return false
+	}
+	absDir, err1 := filepath.Abs(dir)
+	absPath, err2 := filepath.Abs(path)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func isEmptyMeta(meta *meta_file.MetaFile) bool {
+	for _, name := range meta.SectionNames() {
+		if len(meta.GetSection(name).Keys()) != 0 {
+			return false
+		}
+	}
+	return true
+}
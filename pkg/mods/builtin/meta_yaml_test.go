@@ -0,0 +1,114 @@
+package builtin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/innerr/ticat/pkg/core/model"
+)
+
+func TestConvertMetaToYaml(t *testing.T) {
+	root := t.TempDir()
+	genSyntheticMods(t, root, 20)
+	combined := "### file: all.one.tiflow\nhelp = flow one\nflow = group1.mod1\n" +
+		"### file: all.two.tiflow\nhelp = flow two\nflow = group2.mod2 : group3.mod3\n"
+	if err := os.WriteFile(filepath.Join(root, "all.tiflow"), []byte(combined), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected := newModIndexTestCli()
+	loadSyntheticMods(expected, root, "", nil)
+
+	env := model.NewEnv()
+	env.Set("strs.meta-ext", ".ticat")
+	env.Set("strs.flow-ext", ".tiflow")
+	env.Set("strs.repos-file-name", "hub.ticat")
+	paths, err := findMetaFilesToConvert(env, root)
+	if err != nil || len(paths) != 23 {
+		t.Fatalf("expect 23 meta files to convert, got %d: %v", len(paths), err)
+	}
+
+	targets, err := convertMetaFileToYaml(filepath.Join(root, "all.tiflow"), true)
+	if err != nil || len(targets) != 2 || targets[1] != filepath.Join(root, "all.two.tiflow.yaml") {
+		t.Fatalf("unexpected targets of the combined file: %v, %v", targets, err)
+	}
+	if _, err := os.Stat(targets[0]); !os.IsNotExist(err) {
+		t.Errorf("nothing should be written in dry-run")
+	}
+
+	for _, path := range paths {
+		if _, err := convertMetaFileToYaml(path, false); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("'%s' should be removed after converting", path)
+		}
+	}
+
+	cc := newModIndexTestCli()
+	loadSyntheticMods(cc, root, "", nil)
+	for _, path := range []string{"group3.m3", "f10", "all.two", "group13.mod13"} {
+		mod := cc.Cmds.GetSubByPath(path, false)
+		origin := expected.Cmds.GetSubByPath(path, false)
+		if mod == nil || origin == nil {
+			t.Fatalf("cmd '%s' not found", path)
+		}
+		if mod.Cmd().Help() != origin.Cmd().Help() || mod.Cmd().Type() != origin.Cmd().Type() {
+			t.Errorf("cmd '%s' not the same after converting", path)
+		}
+	}
+	args := cc.Cmds.GetSubByPath("group3.mod3", false).Args()
+	if args.DefVal("port", 0) != "4003" || args.Realname("p") != "port" {
+		t.Errorf("args not the same after converting")
+	}
+	if flow := cc.Cmds.GetSubByPath("all.two", false).Cmd().FlowStrs(); len(flow) != 1 ||
+		flow[0] != "group2.mod2 : group3.mod3" {
+		t.Errorf("unexpected flow after converting: %v", flow)
+	}
+}
+
+func TestConvertMetaToYamlSkipSavedFlows(t *testing.T) {
+	root := t.TempDir()
+	flowsDir := filepath.Join(root, "flows")
+	if err := os.MkdirAll(flowsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(root, "a.tiflow"), filepath.Join(flowsDir, "saved.tiflow")} {
+		if err := os.WriteFile(path, []byte("flow = dummy\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env := model.NewEnv()
+	env.Set("strs.meta-ext", ".ticat")
+	env.Set("strs.flow-ext", ".tiflow")
+	env.Set("strs.repos-file-name", "hub.ticat")
+	env.Set("sys.paths.flows", flowsDir)
+	paths, err := findMetaFilesToConvert(env, root)
+	if err != nil || len(paths) != 1 || paths[0] != filepath.Join(root, "a.tiflow") {
+		t.Fatalf("the saved flows should be skipped: %v, %v", paths, err)
+	}
+	if _, err := findMetaFilesToConvert(env, filepath.Join(flowsDir, "saved.tiflow")); err == nil {
+		t.Errorf("converting a saved flow should fail")
+	}
+}
+
+func TestWriteFilesOrNone(t *testing.T) {
+	dir := t.TempDir()
+	targets := []string{filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")}
+	if err := writeFilesOrNone(targets, [][]byte{[]byte("a"), []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(targets[1]); string(data) != "b" {
+		t.Errorf("unexpected content: %s", data)
+	}
+
+	failed := []string{filepath.Join(dir, "c.yaml"), filepath.Join(dir, "missing", "d.yaml")}
+	if err := writeFilesOrNone(failed, [][]byte{[]byte("c"), []byte("d")}); err == nil {
+		t.Fatal("writing to a missing dir should fail")
+	}
+	entrys, _ := os.ReadDir(dir)
+	if len(entrys) != 2 {
+		t.Errorf("the written files should be removed on failure, got %d files", len(entrys))
+	}
+}
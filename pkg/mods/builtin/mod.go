@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/innerr/ticat/pkg/core/model"
+	"github.com/innerr/ticat/pkg/mods/persist/meta_file"
 	"github.com/innerr/ticat/pkg/mods/persist/mod_meta"
 	"github.com/innerr/ticat/pkg/utils"
 )
@@ -29,9 +30,12 @@ func SetExtExec(
 	return currCmdIdx, nil
 }
 
-func loadLocalMods(
+// loadIndexedLocalMods registers the mods from the index in 'indexDir' if the dir is not changed,
+// otherwise loads them by scanning the dir and rebuilds the index
+func loadIndexedLocalMods(
 	cc *model.Cli,
 	root string,
+	indexDir string,
 	reposFileName string,
 	metaExt string,
 	flowExt string,
@@ -39,11 +43,95 @@ func loadLocalMods(
 	abbrsSep string,
 	envPathSep string,
 	source string,
+	mountPath []string,
 	panicRecover bool) {
 
 	if len(root) > 0 && root[len(root)-1] == filepath.Separator {
 		root = root[:len(root)-1]
 	}
+	indexPath := filepath.Join(indexDir, mod_meta.ModIndexFileName(root))
+
+	metaExts := []string{metaExt, flowExt, helpExt}
+	for _, ext := range meta_file.YamlExts {
+		metaExts = append(metaExts, metaExt+ext, flowExt+ext)
+	}
+	fingerprint, err := mod_meta.ModsFingerprint(root, metaExts,
+		reposFileName, abbrsSep, envPathSep, cc.Cmds.Strs.PathSep)
+	if err != nil {
+		_ = loadLocalMods(cc, root, reposFileName, metaExt, flowExt, helpExt,
+			abbrsSep, envPathSep, source, mountPath, nil, panicRecover)
+		return
+	}
+
+	loadWithModIndex(cc, indexPath, fingerprint, mountPath, flowExt, abbrsSep, envPathSep, source, panicRecover,
+		func(index *mod_meta.ModIndex) bool {
+			return loadLocalMods(cc, root, reposFileName, metaExt, flowExt, helpExt,
+				abbrsSep, envPathSep, source, mountPath, index, panicRecover)
+		})
+}
+
+// loadWithModIndex registers the mods from the index if the fingerprint matches,
+// otherwise calls 'load' to scan the dir and rebuild the index, 'load' returns false if not all mods are loaded
+func loadWithModIndex(
+	cc *model.Cli,
+	indexPath string,
+	fingerprint string,
+	mountPath []string,
+	flowExt string,
+	abbrsSep string,
+	envPathSep string,
+	source string,
+	panicRecover bool,
+	load func(index *mod_meta.ModIndex) bool) {
+
+	index, err := mod_meta.ReadModIndex(indexPath)
+	if err == nil && index.Fingerprint == fingerprint && !index.IncludesChanged() {
+		_ = mod_meta.RegModsFromIndex(cc, index, indexPath, mountPath, flowExt, abbrsSep, envPathSep, source, panicRecover)
+		return
+	}
+
+	index = mod_meta.NewModIndex(fingerprint)
+	errCount := countLoadingErrs(cc, source)
+	allLoaded := load(index)
+
+	// Don't cache the broken ones, so they are handled the same as loading without index
+	if !allLoaded || countLoadingErrs(cc, source) != errCount {
+		_ = os.Remove(indexPath)
+		return
+	}
+	_ = mod_meta.WriteModIndex(indexPath, index)
+}
+
+// countLoadingErrs counts the errors except conflicts, the conflicts are reproduced when loading from index
+func countLoadingErrs(cc *model.Cli, source string) (count int) {
+	for _, err := range cc.TolerableErrs.Uncatalogeds {
+		if err.Source == source {
+			count += 1
+		}
+	}
+	return
+}
+
+func loadLocalMods(
+	cc *model.Cli,
+	root string,
+	reposFileName string,
+	metaExt string,
+	flowExt string,
+	helpExt string,
+	abbrsSep string,
+	envPathSep string,
+	source string,
+	mountPath []string,
+	// Record the loaded mods to the index if it's not nil
+	index *mod_meta.ModIndex,
+	panicRecover bool) (allLoaded bool) {
+
+	if len(root) > 0 && root[len(root)-1] == filepath.Separator {
+		root = root[:len(root)-1]
+	}
+
+	allLoaded = true
 
 	// TODO: return filepath.SkipDir to avoid some non-sense scanning
 	_ = filepath.Walk(root, func(metaPath string, info fs.FileInfo, err error) error {
@@ -55,20 +143,25 @@ func loadLocalMods(
 			}
 			return nil
 		}
-		if metaPath == filepath.Join(root, reposFileName) {
+		// The YAML meta files are the same as the others except the ext, eg: 'run.bash.ticat.yaml'
+		name := meta_file.TrimYamlExt(metaPath)
+		if name == filepath.Join(root, reposFileName) {
 			return nil
 		}
 
-		if strings.HasSuffix(metaPath, helpExt) {
-			_ = cc.Helps.RegHelpFile(metaPath)
+		if name == metaPath && strings.HasSuffix(metaPath, helpExt) {
+			if cc.Helps.RegHelpFile(metaPath) == nil && index != nil {
+				index.HelpFiles = append(index.HelpFiles, metaPath)
+			}
 			return nil
 		}
 
-		if strings.HasSuffix(metaPath, flowExt) {
-			cmdPath := filepath.Base(metaPath[0 : len(metaPath)-len(flowExt)])
+		if strings.HasSuffix(name, flowExt) {
+			cmdPath := filepath.Base(name[0 : len(name)-len(flowExt)])
 			cmdPaths := strings.Split(cmdPath, cc.Cmds.Strs.PathSep)
-			if err := mod_meta.RegMod(cc, metaPath, "", false, true, cmdPaths,
-				flowExt, abbrsSep, envPathSep, source, panicRecover); err != nil {
+			if err := mod_meta.RegMod(cc, metaPath, "", false, true, cmdPaths, mountPath,
+				flowExt, abbrsSep, envPathSep, source, index, panicRecover); err != nil {
+				allLoaded = false
 				if panicRecover {
 					return nil
 				}
@@ -77,11 +170,11 @@ func loadLocalMods(
 			return nil
 		}
 
-		ext := filepath.Ext(metaPath)
+		ext := filepath.Ext(name)
 		if ext != metaExt {
 			return nil
 		}
-		targetPath := metaPath[0 : len(metaPath)-len(ext)]
+		targetPath := name[0 : len(name)-len(ext)]
 
 		// Note: strip all ext(s) from cmd-path
 		cmdPath := targetPath[len(root)+1:]
@@ -103,8 +196,9 @@ func loadLocalMods(
 		}
 
 		cmdPaths := strings.Split(cmdPath, string(filepath.Separator))
-		if err := mod_meta.RegMod(cc, metaPath, targetPath, isDir, false, cmdPaths,
-			flowExt, abbrsSep, envPathSep, source, panicRecover); err != nil {
+		if err := mod_meta.RegMod(cc, metaPath, targetPath, isDir, false, cmdPaths, mountPath,
+			flowExt, abbrsSep, envPathSep, source, index, panicRecover); err != nil {
+			allLoaded = false
 			if panicRecover {
 				return nil
 			}
@@ -112,4 +206,5 @@ func loadLocalMods(
 		}
 		return nil
 	})
+	return
 }
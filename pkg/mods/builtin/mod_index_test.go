@@ -0,0 +1,260 @@
+package builtin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/innerr/ticat/pkg/core/model"
+	"github.com/innerr/ticat/pkg/mods/persist/mod_meta"
+)
+
+func newModIndexTestCli() *model.Cli {
+	return &model.Cli{
+		Screen:             &model.QuietScreen{},
+		Cmds:               model.NewCmdTree(model.CmdTreeStrsForTest()),
+		EnvAbbrs:           model.NewEnvAbbrs("test"),
+		TolerableErrs:      model.NewTolerableErrs(),
+		Helps:              model.NewHelps(),
+		Arg2EnvAutoMapCmds: model.Arg2EnvAutoMapCmds{},
+	}
+}
+
+// genSyntheticMods generates mods like a real repo: scripts with meta files, and flows calling them
+func genSyntheticMods(tb testing.TB, root string, count int) {
+	for i := 0; i < count; i++ {
+		dir := filepath.Join(root, fmt.Sprintf("group%d", i%50))
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			tb.Fatal(err)
+		}
+		name := fmt.Sprintf("mod%d", i)
+		script := filepath.Join(dir, name+".bash")
+		if err := os.WriteFile(script, []byte("#!/bin/bash\necho "+name+"\n"), 0755); err != nil {
+			tb.Fatal(err)
+		}
+		meta := fmt.Sprintf("help = synthetic mod %d\nabbrs = m%d\ntags = @synthetic\n"+
+			"[args]\nhost|h = 127.0.0.1\nport|p = %d\n"+
+			"[arg2env]\nsynthetic.host|sh = host\nsynthetic.port|sp = port\n"+
+			"[env]\nsynthetic.host|sh = read\nsynthetic.out = write\n", i, i, 4000+i)
+		if err := os.WriteFile(script+".ticat", []byte(meta), 0644); err != nil {
+			tb.Fatal(err)
+		}
+		if i%10 == 0 {
+			flow := fmt.Sprintf("help = synthetic flow %d\nabbrs = f%d\nflow = group%d.mod%d : group%d.mod%d\n",
+				i, i, i%50, i, i%50, i)
+			if err := os.WriteFile(filepath.Join(root, fmt.Sprintf("flow%d.tiflow", i)), []byte(flow), 0644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+}
+
+func loadSyntheticMods(cc *model.Cli, root string, indexDir string, mountPath []string) {
+	if len(indexDir) == 0 {
+		_ = loadLocalMods(cc, root, "hub.ticat", ".ticat", ".tiflow", ".tihelp", "|", ".", root, mountPath, nil, true)
+	} else {
+		loadIndexedLocalMods(cc, root, indexDir, "hub.ticat", ".ticat", ".tiflow", ".tihelp",
+			"|", ".", root, mountPath, true)
+	}
+}
+
+func TestLoadIndexedLocalMods(t *testing.T) {
+	root := t.TempDir()
+	indexDir := t.TempDir()
+	genSyntheticMods(t, root, 30)
+	indexPath := filepath.Join(indexDir, mod_meta.ModIndexFileName(root))
+
+	expected := newModIndexTestCli()
+	loadSyntheticMods(expected, root, "", nil)
+
+	check := func(cc *model.Cli, lazy bool) {
+		for _, path := range []string{"group3.m3", "f10", "group10.mod10"} {
+			mod := cc.Cmds.GetSubByPath(path, false)
+			if mod == nil {
+				t.Fatalf("cmd '%s' not found", path)
+			}
+			if mod.HasLazyCmd() != lazy {
+				t.Errorf("cmd '%s' expect lazy = %v", path, lazy)
+			}
+			origin := expected.Cmds.GetSubByPath(path, false)
+			if mod.Cmd().Help() != origin.Cmd().Help() || mod.Cmd().Type() != origin.Cmd().Type() ||
+				mod.Source() != origin.Source() {
+				t.Errorf("cmd '%s' not the same as loading without index", path)
+			}
+			if mod.HasLazyCmd() {
+				t.Errorf("cmd '%s' should be loaded after accessing", path)
+			}
+		}
+		args := cc.Cmds.GetSubByPath("group3.mod3", false).Args()
+		if args.DefVal("port", 0) != "4003" || args.Realname("p") != "port" {
+			t.Errorf("args not registered")
+		}
+		if !cc.Cmds.GetSubByPath("group3.mod3", false).MatchTags("@synthetic") {
+			t.Errorf("tags not registered")
+		}
+		if matched, ok := cc.EnvAbbrs.TryMatch("synthetic.sh", "."); !ok || matched[1] != "host" {
+			t.Errorf("env abbrs not registered")
+		}
+	}
+
+	cc := newModIndexTestCli()
+	loadSyntheticMods(cc, root, indexDir, nil)
+	if _, err := os.Stat(indexPath); err != nil {
+		t.Fatalf("index not written: %v", err)
+	}
+	check(cc, false)
+
+	cc = newModIndexTestCli()
+	loadSyntheticMods(cc, root, indexDir, nil)
+	check(cc, true)
+
+	t.Run("rebuild when changed", func(t *testing.T) {
+		metaPath := filepath.Join(root, "group3", "mod3.bash.ticat")
+		if err := os.WriteFile(metaPath, []byte("help = changed\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cc := newModIndexTestCli()
+		loadSyntheticMods(cc, root, indexDir, nil)
+		mod := cc.Cmds.GetSubByPath("group3.mod3", false)
+		if mod.HasLazyCmd() || mod.Cmd().Help() != "changed" {
+			t.Errorf("index should be rebuilt")
+		}
+		cc = newModIndexTestCli()
+		loadSyntheticMods(cc, root, indexDir, nil)
+		mod = cc.Cmds.GetSubByPath("group3.mod3", false)
+		if !mod.HasLazyCmd() || mod.Cmd().Help() != "changed" {
+			t.Errorf("rebuilt index should be used")
+		}
+	})
+
+	t.Run("mounted", func(t *testing.T) {
+		cc := newModIndexTestCli()
+		loadSyntheticMods(cc, root, indexDir, []string{"team"})
+		mod := cc.Cmds.GetSubByPath("team.f10", false)
+		if mod == nil || !mod.HasLazyCmd() {
+			t.Fatalf("mounted flow not registered from index")
+		}
+		flow := mod.Cmd().FlowStrs()
+		if len(flow) == 0 || mod.Cmd().MountPath()[0] != "team" {
+			t.Errorf("mount path not registered, flow: %v", flow)
+		}
+	})
+
+	t.Run("rebuild when included changed", func(t *testing.T) {
+		common := filepath.Join(t.TempDir(), "common.ticat")
+		if err := os.WriteFile(common, []byte("abbrs = inc\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		metaPath := filepath.Join(root, "group4", "mod4.bash.ticat")
+		if err := os.WriteFile(metaPath, []byte("include = "+common+"\nhelp = included\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		loadSyntheticMods(newModIndexTestCli(), root, indexDir, nil)
+		cc := newModIndexTestCli()
+		loadSyntheticMods(cc, root, indexDir, nil)
+		if mod := cc.Cmds.GetSubByPath("group4.inc", false); mod == nil || !mod.HasLazyCmd() {
+			t.Fatalf("expect the included abbrs registered from index")
+		}
+
+		if err := os.WriteFile(common, []byte("abbrs = inc2\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cc = newModIndexTestCli()
+		loadSyntheticMods(cc, root, indexDir, nil)
+		if mod := cc.Cmds.GetSubByPath("group4.inc2", false); mod == nil || mod.HasLazyCmd() {
+			t.Errorf("index should be rebuilt when the included file changed")
+		}
+	})
+
+	t.Run("broken after indexed", func(t *testing.T) {
+		root := t.TempDir()
+		genSyntheticMods(t, root, 10)
+		indexPath := filepath.Join(indexDir, mod_meta.ModIndexFileName(root))
+		loadSyntheticMods(newModIndexTestCli(), root, indexDir, nil)
+		cc := newModIndexTestCli()
+		loadSyntheticMods(cc, root, indexDir, nil)
+		mod := cc.Cmds.GetSubByPath("group5.mod5", false)
+		if !mod.HasLazyCmd() {
+			t.Fatalf("expect lazy cmd")
+		}
+		if err := os.Remove(filepath.Join(root, "group5", "mod5.bash.ticat")); err != nil {
+			t.Fatal(err)
+		}
+		if mod.Cmd() != nil || mod.LazyCmdErr() == nil {
+			t.Errorf("the broken cmd should not be registered")
+		}
+		if _, err := os.Stat(indexPath); !os.IsNotExist(err) {
+			t.Errorf("the outdated index should be removed")
+		}
+	})
+
+	t.Run("not cached when broken", func(t *testing.T) {
+		root := t.TempDir()
+		genSyntheticMods(t, root, 3)
+		metaPath := filepath.Join(root, "group1", "mod1.bash.ticat")
+		if err := os.WriteFile(metaPath, []byte("help = broken\ntrivial = x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cc := newModIndexTestCli()
+		loadSyntheticMods(cc, root, indexDir, nil)
+		if _, err := os.Stat(filepath.Join(indexDir, mod_meta.ModIndexFileName(root))); !os.IsNotExist(err) {
+			t.Errorf("broken mods should not be cached")
+		}
+	})
+}
+
+func BenchmarkLoadLocalMods(b *testing.B) {
+	root := b.TempDir()
+	indexDir := b.TempDir()
+	genSyntheticMods(b, root, 3000)
+	loadSyntheticMods(newModIndexTestCli(), root, indexDir, nil)
+
+	b.Run("no-index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			loadSyntheticMods(newModIndexTestCli(), root, "", nil)
+		}
+	})
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			loadSyntheticMods(newModIndexTestCli(), root, indexDir, nil)
+		}
+	})
+	b.Run("index-and-run-one", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			cc := newModIndexTestCli()
+			loadSyntheticMods(cc, root, indexDir, nil)
+			_ = cc.Cmds.GetSubByPath("group7.mod1007", true).Cmd()
+		}
+	})
+}
+
+func TestLoadIndexedFlows(t *testing.T) {
+	root := t.TempDir()
+	env := model.NewEnv()
+	env.Set("strs.flow-ext", ".tiflow")
+	env.Set("strs.env-path-sep", ".")
+	env.Set("sys.paths.cache", t.TempDir())
+	env.SetBool("sys.mods.index", true)
+	for i, content := range []string{"help = flow a\nflow = dbg.echo a\n", "help = flow b\nflow = dbg.echo b\n"} {
+		path := filepath.Join(root, fmt.Sprintf("my.flow%d.tiflow", i))
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flow := &model.ParsedCmds{Cmds: []model.ParsedCmd{{}}}
+
+	for i, lazy := range []bool{false, true} {
+		cc := newModIndexTestCli()
+		if err := loadFlowsFromDir(flow, 0, root, cc, env, root); err != nil {
+			t.Fatal(err)
+		}
+		mod := cc.Cmds.GetSubByPath("my.flow1", false)
+		if mod == nil || mod.HasLazyCmd() != lazy {
+			t.Fatalf("round %d: expect flow registered, lazy = %v", i, lazy)
+		}
+		if mod.Cmd().Help() != "flow b" {
+			t.Errorf("round %d: unexpected flow help '%s'", i, mod.Cmd().Help())
+		}
+	}
+}
@@ -2,11 +2,18 @@ package builtin
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/innerr/ticat/pkg/cli/display"
+	"github.com/innerr/ticat/pkg/core/filter"
 	"github.com/innerr/ticat/pkg/core/model"
+	"github.com/innerr/ticat/pkg/utils"
+	"github.com/innerr/ticat/pkg/version"
 )
 
 func SetSessionsKeepDur(
@@ -125,14 +132,22 @@ func listSessions(
 	includeDone bool,
 	includeRunning bool) (int, error) {
 
-	findStrs := getFindStrsFromArgvAndFlow(flow, currCmdIdx, argv)
+	query, err := getSessionsQuery(flow, currCmdIdx, argv)
+	if err != nil {
+		return currCmdIdx, err
+	}
 	cntLimit := argv.GetInt("max-count")
-	sessions, total := findSessions(findStrs, "", cc, env, cntLimit, includeError, includeDone, includeRunning)
+	sessions, total := listSessionsWithImported(query, env, cntLimit, includeError, includeDone, includeRunning)
+	if len(sessions) == 0 {
+		printNoSessionsTip(cc, env, query, "")
+	}
 
 	screen := display.NewCacheScreen()
 	cnt := 0
 	for _, it := range sessions {
-		if it.Cleaning {
+		if it.Imported {
+			dumpSession(it, env, screen, "imported")
+		} else if it.Cleaning {
 			dumpSession(it, env, screen, "expired")
 		} else {
 			dumpSession(it, env, screen, "")
@@ -371,8 +386,11 @@ func FindAndRemoveSessions(
 
 	force := argv.GetBool("remove-running")
 
-	findStrs := getFindStrsFromArgvAndFlow(flow, currCmdIdx, argv)
-	sessions, _ := findSessions(findStrs, "", cc, env, 1, true, true, true)
+	query, err := getSessionsQuery(flow, currCmdIdx, argv)
+	if err != nil {
+		return currCmdIdx, err
+	}
+	sessions, _ := findSessionsByQuery(query, "", cc, env, 1, true, true, true)
 	if len(sessions) == 0 {
 		return currCmdIdx, nil
 	}
@@ -591,6 +609,75 @@ func LastErrorSessionRetry(argv model.ArgVals, cc *model.Cli, env *model.Env) (f
 	return retrySession(session, false)
 }
 
+func SessionRetryFrom(argv model.ArgVals, cc *model.Cli, env *model.Env) (flow []string, masks []*model.ExecuteMask, err error) {
+	session, path, err := getSessionAndCmdIdx(argv, cc, env)
+	if err != nil {
+		return nil, nil, err
+	}
+	masks, err = session.Status.GenExecMasksFrom(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[SessionRetryFrom] session [%s]: %v", session.DirName, err)
+	}
+	linkToRetriedSession(cc, env, session, model.SessionMetaRetryFrom, path)
+	return []string{session.Status.Flow}, masks, nil
+}
+
+func SessionRetrySkip(argv model.ArgVals, cc *model.Cli, env *model.Env) (flow []string, masks []*model.ExecuteMask, err error) {
+	session, path, err := getSessionAndCmdIdx(argv, cc, env)
+	if err != nil {
+		return nil, nil, err
+	}
+	masks, err = session.Status.GenExecMasksSkip(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[SessionRetrySkip] session [%s]: %v", session.DirName, err)
+	}
+	linkToRetriedSession(cc, env, session, model.SessionMetaRetrySkip, path)
+	return []string{session.Status.Flow}, masks, nil
+}
+
+// getSessionAndCmdIdx finds the session by id, or use the last session if the id is empty
+func getSessionAndCmdIdx(argv model.ArgVals, cc *model.Cli, env *model.Env) (
+	session model.SessionStatus, path []int, err error) {
+
+	idxStr := argv.GetRaw("idx")
+	if len(idxStr) == 0 {
+		return session, nil, fmt.Errorf("arg 'idx' is empty")
+	}
+	path, err = model.ParseCmdIdxPath(idxStr, env.GetRaw("strs.cmd-path-sep"))
+	if err != nil {
+		return
+	}
+
+	id := argv.GetRaw("session-id")
+	if len(id) == 0 {
+		var ok bool
+		session, ok = getLastSession(cc, env, true, true, false)
+		if !ok {
+			return session, nil, fmt.Errorf("no executed sessions")
+		}
+		return
+	}
+	sessions, _ := findSessions(nil, id, cc, env, 1, true, true, false)
+	if len(sessions) == 0 {
+		return session, nil, fmt.Errorf("no executed session with id = '%s'", normalizeSid(id))
+	}
+	return sessions[0], path, nil
+}
+
+func linkToRetriedSession(cc *model.Cli, env *model.Env, parent model.SessionStatus, mark string, path []int) {
+	// The ad-hot flow may be generated more than once (eg: for checking), the writing should be idempotent
+	sessionDir := env.GetRaw("session")
+	if len(sessionDir) == 0 {
+		return
+	}
+	currSession := filepath.Base(sessionDir)
+	idxStr := model.CmdIdxPathStr(path, env.GetRaw("strs.cmd-path-sep"))
+	err := model.SetSessionMeta(env, currSession, model.SessionMetaRetryOf, parent.DirName, mark, idxStr)
+	if err != nil {
+		display.PrintErrTitle(cc.Screen, env, err.Error())
+	}
+}
+
 func findSessions(
 	findStrs []string,
 	id string,
@@ -601,28 +688,85 @@ func findSessions(
 	includeDone bool,
 	includeRunning bool) (sessions []model.SessionStatus, total int) {
 
+	return findSessionsByQuery(filter.NewWordsQuery(findStrs), id, cc, env, cntLimit,
+		includeError, includeDone, includeRunning)
+}
+
+func findSessionsByQuery(
+	query *filter.Query,
+	id string,
+	cc *model.Cli,
+	env *model.Env,
+	cntLimit int,
+	includeError bool,
+	includeDone bool,
+	includeRunning bool) (sessions []model.SessionStatus, total int) {
+
 	id = normalizeSid(id)
 
-	sessions, total = model.ListSessions(env, findStrs, id, cntLimit, includeError, includeDone, includeRunning)
+	sessions, total = model.ListSessionsByQuery(env, query, id, cntLimit, includeError, includeDone, includeRunning)
 	if len(sessions) == 0 {
-		if len(id) == 0 {
-			if len(findStrs) > 0 {
-				display.PrintTipTitle(cc.Screen, env, "no executed sessions found by '"+strings.Join(findStrs, " ")+"'")
-			} else {
-				display.PrintTipTitle(cc.Screen, env, "no executed sessions")
-			}
-		} else {
-			if len(findStrs) > 0 {
-				display.PrintTipTitle(cc.Screen, env,
-					"no executed sessions found by '"+strings.Join(findStrs, " ")+"' with id = '"+id+"'")
-			} else {
-				display.PrintErrTitle(cc.Screen, env, "no executed sessiond with id = '"+id+"'")
-			}
+		printNoSessionsTip(cc, env, query, id)
+	}
+	return
+}
+
+// listSessionsWithImported lists the local sessions and the imported ones together, the newest first.
+// The imported sessions are never running, and not counted in 'last session'.
+func listSessionsWithImported(
+	query *filter.Query,
+	env *model.Env,
+	cntLimit int,
+	includeError bool,
+	includeDone bool,
+	includeRunning bool) (sessions []model.SessionStatus, total int) {
+
+	sessions, total = model.ListSessionsByQuery(env, query, "", 0, includeError, includeDone, includeRunning)
+	imported, _ := model.ListImportedSessionsByQuery(env, query, "", 0)
+	for _, it := range imported {
+		done := it.Status.Result == model.ExecutedResultSucceeded
+		if (done && !includeDone) || (!done && !includeError) {
+			continue
 		}
+		sessions = append(sessions, it)
+		total += 1
+	}
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].DirName > sessions[j].DirName
+	})
+	if cntLimit > 0 && len(sessions) > cntLimit {
+		sessions = sessions[:cntLimit]
 	}
 	return
 }
 
+func printNoSessionsTip(cc *model.Cli, env *model.Env, query *filter.Query, id string) {
+	if len(id) == 0 {
+		if !query.IsEmpty() {
+			display.PrintTipTitle(cc.Screen, env, "no executed sessions found by '"+query.String()+"'")
+		} else {
+			display.PrintTipTitle(cc.Screen, env, "no executed sessions")
+		}
+	} else {
+		if !query.IsEmpty() {
+			display.PrintTipTitle(cc.Screen, env,
+				"no executed sessions found by '"+query.String()+"' with id = '"+id+"'")
+		} else {
+			display.PrintErrTitle(cc.Screen, env, "no executed sessiond with id = '"+id+"'")
+		}
+	}
+}
+
+// getSessionsQuery combines the find strs (as keywords) and the query in arg 'query'
+func getSessionsQuery(flow *model.ParsedCmds, currCmdIdx int, argv model.ArgVals) (*filter.Query, error) {
+	words := filter.NewWordsQuery(getFindStrsFromArgvAndFlow(flow, currCmdIdx, argv))
+	query, err := model.ParseSessionQuery(argv.GetRaw("query"))
+	if err != nil {
+		return nil, err
+	}
+	return words.Merge(query), nil
+}
+
 func dumpSession(session model.SessionStatus, env *model.Env, screen model.Screen, status string) {
 	selfName := env.GetRaw("strs.self-name")
 
@@ -639,6 +783,47 @@ func dumpSession(session model.SessionStatus, env *model.Env, screen model.Scree
 		}
 	}
 
+	if parent, ok := session.Meta[model.SessionMetaRetryOf]; ok {
+		_ = screen.Print(display.ColorProp("    retry-of:\n", env))
+		retryStr := display.ColorSession("["+parent+"]", env)
+		if idx, ok := session.Meta[model.SessionMetaRetryFrom]; ok {
+			retryStr += display.ColorExplain(" from cmd "+idx, env)
+		} else if idx, ok := session.Meta[model.SessionMetaRetrySkip]; ok {
+			retryStr += display.ColorExplain(" skipped cmd "+idx, env)
+		}
+		_ = screen.Print("        " + retryStr + "\n")
+	}
+
+	if model.IsSessionPinned(session.Meta) {
+		_ = screen.Print(display.ColorProp("    pinned:\n", env))
+		_ = screen.Print("        true\n")
+	}
+
+	if tags := model.SessionTags(session.Meta); len(tags) != 0 {
+		_ = screen.Print(display.ColorProp("    tags:\n", env))
+		_ = screen.Print("        " + display.ColorTag(strings.Join(tags, " "), env) + "\n")
+	}
+
+	if note, ok := session.Meta[model.SessionMetaNote]; ok && len(note) != 0 {
+		_ = screen.Print(display.ColorProp("    note:\n", env))
+		_ = screen.Print("        " + note + "\n")
+	}
+
+	if logPath := model.DetachedLogPath(env, session); len(logPath) != 0 {
+		_ = screen.Print(display.ColorProp("    detached-log:\n", env))
+		_ = screen.Print("        " + logPath + "\n")
+	}
+
+	if killed, ok := session.Meta[model.SessionMetaKilled]; ok {
+		_ = screen.Print(display.ColorProp("    killed:\n", env))
+		_ = screen.Print("        " + killed + "\n")
+	}
+
+	if session.Imported {
+		_ = screen.Print(display.ColorProp("    imported-from:\n", env))
+		_ = screen.Print("        " + session.Meta[model.SessionMetaImportedFrom] + "\n")
+	}
+
 	_ = screen.Print(display.ColorProp("    start-at:\n", env))
 	_ = screen.Print(fmt.Sprintf("        %s\n", session.StartTs.Format(model.SessionTimeFormat)))
 	_ = screen.Print(fmt.Sprintf("        "+display.ColorExplain("%s ago\n", env),
@@ -753,3 +938,597 @@ func normalizeSid(id string) string {
 	// TODO: put brackets to env?
 	return strings.TrimRight(strings.TrimLeft(id, "["), "]")
 }
+
+func ExportSession(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	var session model.SessionStatus
+	id := argv.GetRaw("session-id")
+	if len(id) == 0 {
+		var ok bool
+		session, ok = getLastSession(cc, env, true, true, false)
+		if !ok {
+			return currCmdIdx, fmt.Errorf("no executed sessions")
+		}
+	} else {
+		sessions, _ := findSessions(nil, id, cc, env, 1, true, true, false)
+		if len(sessions) == 0 {
+			return currCmdIdx, fmt.Errorf("no executed session with id = '%s'", normalizeSid(id))
+		}
+		session = sessions[0]
+	}
+
+	path := argv.GetRaw("path")
+	if len(path) == 0 {
+		path = session.DirName + ".tar.gz"
+	}
+
+	var redactor model.SessionRedactor
+	if argv.GetBool("redact") {
+		redactor = model.NewSessionRedactor(
+			model.SplitListVal(env.GetRaw("sys.sessions.export.redact-keys"), env.GetRaw("strs.list-sep")))
+	}
+
+	manifest := model.SessionArchiveManifest{
+		TicatVersion: env.GetRaw("sys.version"),
+		Cmds:         collectSessionArchiveCmds(cc, session.Status),
+	}
+	if len(version.GitHash) != 0 {
+		manifest.TicatVersion += " " + version.GitHash
+	}
+	manifest.Host, _ = os.Hostname()
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return currCmdIdx, fmt.Errorf("create archive file '%s' failed: %v", path, err)
+	}
+	err = model.ExportSession(env, session, file, manifest, redactor)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return currCmdIdx, err
+	}
+
+	dumpSession(session, env, cc.Screen, "exported")
+	redactStr := "sensitive values redacted"
+	if redactor == nil {
+		redactStr = "not redacted"
+	}
+	display.PrintTipTitle(cc.Screen, env, "session exported to '"+path+"', "+redactStr)
+	return currCmdIdx, nil
+}
+
+func collectSessionArchiveCmds(cc *model.Cli, status *model.ExecutedFlow) (cmds []model.SessionArchiveCmd) {
+	if status == nil {
+		return
+	}
+	visited := map[string]bool{}
+	var collect func(flow *model.ExecutedFlow)
+	collect = func(flow *model.ExecutedFlow) {
+		for _, it := range flow.Cmds {
+			if it.SubFlow != nil {
+				collect(it.SubFlow)
+			}
+			parsed, ok := cc.ParseCmd(false, model.FlowStrToStrs(it.Cmd)...)
+			if !ok || parsed.LastCmd() == nil || parsed.LastCmdNode() == nil {
+				continue
+			}
+			node := parsed.LastCmdNode()
+			name := node.DisplayPath()
+			if visited[name] {
+				continue
+			}
+			visited[name] = true
+			cic := parsed.LastCmd()
+			cmds = append(cmds, model.SessionArchiveCmd{
+				Cmd:      name,
+				Type:     string(cic.Type()),
+				Source:   node.Source(),
+				MetaFile: cic.MetaFile(),
+				Flow:     cic.FlowStrs(),
+			})
+		}
+	}
+	collect(status)
+	return
+}
+
+func ImportSession(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	path, err := getAndCheckArg(argv, flow.Cmds[currCmdIdx], "path")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return currCmdIdx, fmt.Errorf("open archive file '%s' failed: %v", path, err)
+	}
+	defer file.Close()
+
+	origin := path
+	if abs, err := filepath.Abs(path); err == nil {
+		origin = abs
+	}
+	dirName, manifest, err := model.ImportSession(env, file, origin, argv.GetBool("force"))
+	if err != nil {
+		return currCmdIdx, err
+	}
+
+	sessions, _ := model.ListImportedSessions(env, nil, dirName, 1)
+	if len(sessions) != 0 {
+		dumpSession(sessions[0], env, cc.Screen, "imported")
+	}
+	tip := "session imported from '" + path + "'"
+	if len(manifest.Host) != 0 {
+		tip += ", exported on host '" + manifest.Host + "'"
+	}
+	display.PrintTipTitle(cc.Screen, env, tip)
+	return currCmdIdx, nil
+}
+
+func ListImportedSessions(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	findStrs := getFindStrsFromArgvAndFlow(flow, currCmdIdx, argv)
+	sessions, _ := model.ListImportedSessions(env, findStrs, "", 0)
+	if len(sessions) == 0 {
+		display.PrintTipTitle(cc.Screen, env, "no imported sessions")
+		return clearFlow(flow)
+	}
+	for _, it := range sessions {
+		dumpSession(it, env, cc.Screen, "")
+	}
+	display.PrintTipTitle(cc.Screen, env, fmt.Sprintf("%d imported sessions", len(sessions)))
+	return clearFlow(flow)
+}
+
+func ConvertSessionStatus(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	format := strings.ToLower(argv.GetRaw("format"))
+	if format != model.StatusFormatText && format != model.StatusFormatJsonl {
+		return currCmdIdx, fmt.Errorf("unknown status format '%s', should be '%s' or '%s'",
+			format, model.StatusFormatText, model.StatusFormatJsonl)
+	}
+
+	id := argv.GetRaw("session-id")
+	sessions, _ := findSessions(nil, id, cc, env, 0, true, true, len(id) != 0)
+	if len(sessions) == 0 {
+		return currCmdIdx, nil
+	}
+
+	total := 0
+	for _, it := range sessions {
+		converted, err := model.ConvertSessionStatus(env, it, format)
+		if err != nil {
+			display.PrintErrTitle(cc.Screen, env, err.Error())
+			continue
+		}
+		total += converted
+	}
+	display.PrintTipTitle(cc.Screen, env,
+		fmt.Sprintf("%d status files of %d sessions converted to '%s'", total, len(sessions), format))
+	return currCmdIdx, nil
+}
+
+func SessionsStats(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	query, err := getSessionsQuery(flow, currCmdIdx, argv)
+	if err != nil {
+		return currCmdIdx, err
+	}
+	cntLimit := argv.GetInt("max-count")
+	sessions, _ := findSessionsByQuery(query, "", cc, env, cntLimit, true, true, false)
+	if len(sessions) == 0 {
+		return clearFlow(flow)
+	}
+
+	ratio, err := strconv.ParseFloat(argv.GetRaw("slower-ratio"), 64)
+	if err != nil || ratio <= 0 {
+		return currCmdIdx, fmt.Errorf("arg 'slower-ratio' should be a positive float, got '%s'", argv.GetRaw("slower-ratio"))
+	}
+	stats := model.NewSessionsStats(sessions, model.SessionsStatsArgs{
+		RecentRuns:  argv.GetInt("recent"),
+		SlowerRatio: ratio,
+		TopErrors:   argv.GetInt("top-errors"),
+	})
+
+	if argv.GetBool("json") {
+		err = model.OutputJson(cc, stats)
+	} else {
+		if !model.IsJsonOutputMode(env) {
+			display.PrintTipTitle(cc.Screen, env, fmt.Sprintf("stats of %d sessions:", stats.Sessions))
+		}
+		err = model.Output(cc, env, stats)
+	}
+	if err != nil {
+		return currCmdIdx, err
+	}
+	return clearFlow(flow)
+}
+
+func SessionsCompare(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	a, err := findSessionToCompare(argv, flow, currCmdIdx, cc, env, "a")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	b, err := findSessionToCompare(argv, flow, currCmdIdx, cc, env, "b")
+	if err != nil {
+		return currCmdIdx, err
+	}
+
+	cmp := model.NewSessionsComparison(a, b, argv.GetInt("log-lines"))
+	cmp.ShowSame = argv.GetBool("show-same")
+	if argv.GetBool("json") {
+		err = model.OutputJson(cc, cmp)
+	} else {
+		if !model.IsJsonOutputMode(env) {
+			display.PrintTipTitle(cc.Screen, env, "comparison of sessions ["+a.DirName+"] and ["+b.DirName+"]:")
+		}
+		err = model.Output(cc, env, cmp)
+	}
+	if err != nil {
+		return currCmdIdx, err
+	}
+	return clearFlow(flow)
+}
+
+func findSessionToCompare(
+	argv model.ArgVals,
+	flow *model.ParsedCmds,
+	currCmdIdx int,
+	cc *model.Cli,
+	env *model.Env,
+	arg string) (session model.SessionStatus, err error) {
+
+	id, err := getAndCheckArg(argv, flow.Cmds[currCmdIdx], arg)
+	if err != nil {
+		return
+	}
+	sessions, _ := findSessions(nil, id, cc, env, 1, true, true, true)
+	if len(sessions) == 0 {
+		err = fmt.Errorf("no session with id = '%s'", normalizeSid(id))
+		return
+	}
+	session = sessions[0]
+	if session.Status == nil {
+		err = fmt.Errorf("can't read the status of session [%s]", session.DirName)
+	}
+	return
+}
+
+func PinSession(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	return setSessionPinned(argv, cc, env, flow, currCmdIdx, true)
+}
+
+func UnpinSession(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	return setSessionPinned(argv, cc, env, flow, currCmdIdx, false)
+}
+
+func setSessionPinned(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int,
+	pinned bool) (int, error) {
+
+	id, err := getAndCheckArg(argv, flow.Cmds[currCmdIdx], "session-id")
+	if err != nil {
+		return currCmdIdx, err
+	}
+	sessions, _ := findSessions(nil, id, cc, env, 1, true, true, true)
+	if len(sessions) == 0 {
+		return currCmdIdx, nil
+	}
+	session := sessions[0]
+	if session.Imported {
+		return currCmdIdx, fmt.Errorf("session '%s' is imported, it's never collected", session.DirName)
+	}
+
+	val := ""
+	status := "unpinned"
+	if pinned {
+		val = "true"
+		status = "pinned"
+	}
+	if err = model.SetSessionMeta(env, session.DirName, model.SessionMetaPinned, val); err != nil {
+		return currCmdIdx, err
+	}
+	session.Meta[model.SessionMetaPinned] = val
+	dumpSession(session, env, cc.Screen, status)
+	return currCmdIdx, nil
+}
+
+func TagSession(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	tags := model.ParseSessionTags(argv.GetRaw("tag"))
+	if len(tags) == 0 {
+		return currCmdIdx, model.NewCmdError(flow.Cmds[currCmdIdx], "arg 'tag' is empty")
+	}
+	session, err := findSessionToAnnotate(argv, cc, env, flow, currCmdIdx)
+	if err != nil {
+		return currCmdIdx, err
+	}
+	tags, err = model.AddSessionTags(env, session.DirName, tags...)
+	if err != nil {
+		return currCmdIdx, err
+	}
+	session.Meta[model.SessionMetaTags] = strings.Join(tags, ",")
+	dumpSession(session, env, cc.Screen, "tagged")
+	return currCmdIdx, nil
+}
+
+func UntagSession(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	session, err := findSessionToAnnotate(argv, cc, env, flow, currCmdIdx)
+	if err != nil {
+		return currCmdIdx, err
+	}
+	tags, err := model.RemoveSessionTags(env, session.DirName, model.ParseSessionTags(argv.GetRaw("tag"))...)
+	if err != nil {
+		return currCmdIdx, err
+	}
+	session.Meta[model.SessionMetaTags] = strings.Join(tags, ",")
+	dumpSession(session, env, cc.Screen, "untagged")
+	return currCmdIdx, nil
+}
+
+func NoteSession(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	session, err := findSessionToAnnotate(argv, cc, env, flow, currCmdIdx)
+	if err != nil {
+		return currCmdIdx, err
+	}
+	if err = model.SetSessionNote(env, session.DirName, argv.GetRaw("text")); err != nil {
+		return currCmdIdx, err
+	}
+	session.Meta = model.LoadSessionMeta(env, session.DirName)
+	dumpSession(session, env, cc.Screen, "noted")
+	return currCmdIdx, nil
+}
+
+// findSessionToAnnotate finds the session for tagging or noting, use the last session if id is empty
+func findSessionToAnnotate(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (session model.SessionStatus, err error) {
+
+	id := argv.GetRaw("session-id")
+	if len(id) == 0 {
+		var ok bool
+		session, ok = getLastSession(cc, env, true, true, false)
+		if !ok {
+			return session, fmt.Errorf("no executed sessions")
+		}
+	} else {
+		sessions, _ := findSessions(nil, id, cc, env, 1, true, true, true)
+		if len(sessions) == 0 {
+			return session, fmt.Errorf("no session with id = '%s'", normalizeSid(id))
+		}
+		session = sessions[0]
+	}
+	if session.Imported {
+		return session, fmt.Errorf("session '%s' is imported, it's read-only", session.DirName)
+	}
+	return session, nil
+}
+
+// KillSession kills a running session, use the last running one if id is empty
+func KillSession(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	var session model.SessionStatus
+	id := argv.GetRaw("session-id")
+	if len(id) == 0 {
+		var ok bool
+		session, ok = getLastSession(cc, env, false, false, true)
+		if !ok {
+			return currCmdIdx, fmt.Errorf("no running sessions")
+		}
+	} else {
+		sessions, _ := findSessions(nil, id, cc, env, 1, true, true, true)
+		if len(sessions) == 0 {
+			return currCmdIdx, fmt.Errorf("no session with id = '%s'", normalizeSid(id))
+		}
+		session = sessions[0]
+	}
+
+	if err := model.KillSession(env, session, argv.GetBool("force")); err != nil {
+		return currCmdIdx, err
+	}
+	display.PrintTipTitle(cc.Screen, env, fmt.Sprintf("session [%s] (pid %d) killed", session.DirName, session.Pid))
+	return currCmdIdx, nil
+}
+
+func SessionsGC(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	return sessionsGC(cc, env, currCmdIdx, false)
+}
+
+func SessionsGCDry(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	return sessionsGC(cc, env, currCmdIdx, true)
+}
+
+func sessionsGC(cc *model.Cli, env *model.Env, currCmdIdx int, dry bool) (int, error) {
+	gc, err := model.NewSessionsGC(env)
+	if err != nil {
+		return currCmdIdx, err
+	}
+	items, err := gc.Plan(time.Now())
+	if err != nil {
+		return currCmdIdx, err
+	}
+	if len(items) == 0 {
+		display.PrintTipTitle(cc.Screen, env, "no sessions need to be removed")
+		return currCmdIdx, nil
+	}
+
+	for _, it := range items {
+		line := display.ColorSession("["+it.DirName+"]", env) + " " + display.ColorExplain(it.Reason, env)
+		if it.Failed {
+			line += display.ColorExplain(", failed", env)
+		}
+		if it.Size > 0 {
+			line += display.ColorExplain(fmt.Sprintf(", %d bytes", it.Size), env)
+		}
+		_ = cc.Screen.Print(line + "\n")
+	}
+
+	if dry {
+		display.PrintTipTitle(cc.Screen, env, fmt.Sprintf("%d sessions would be removed", len(items)))
+		return currCmdIdx, nil
+	}
+	removed, err := gc.Run(items)
+	display.PrintTipTitle(cc.Screen, env, fmt.Sprintf("%d of %d sessions removed", removed, len(items)))
+	return currCmdIdx, err
+}
+
+func SessionsTail(
+	argv model.ArgVals,
+	cc *model.Cli,
+	env *model.Env,
+	flow *model.ParsedCmds,
+	currCmdIdx int) (int, error) {
+
+	interval, err := time.ParseDuration(utils.NormalizeDurStr(argv.GetRaw("interval")))
+	if err != nil || interval <= 0 {
+		return currCmdIdx, fmt.Errorf("arg 'interval' should be a positive duration, got '%s'", argv.GetRaw("interval"))
+	}
+
+	var session model.SessionStatus
+	id := argv.GetRaw("session-id")
+	if len(id) == 0 {
+		var ok bool
+		session, ok = getLastSession(cc, env, false, false, true)
+		if !ok {
+			return currCmdIdx, fmt.Errorf("no running sessions")
+		}
+	} else {
+		sessions, _ := findSessions(nil, id, cc, env, 1, true, true, true)
+		if len(sessions) == 0 {
+			return currCmdIdx, fmt.Errorf("no session with id = '%s'", normalizeSid(id))
+		}
+		session = sessions[0]
+	}
+
+	display.PrintTipTitle(cc.Screen, env, "following logs of session ["+session.DirName+"]")
+
+	statusPath := model.ExecutedStatusFilePath{
+		RootPath: model.SessionsRoot(env, session.Imported),
+		DirName:  session.DirName,
+		FileName: env.GetRaw("strs.session-status-file"),
+	}
+	follower := model.NewSessionLogFollower()
+	// The output of a detached session is all in one file, it's more complete than the cmd logs
+	detachedLog := model.DetachedLogPath(env, session)
+	var status *model.ExecutedFlow
+	for {
+		// Check the pid before parsing, so the final poll won't miss anything
+		running := !session.Imported && utils.IsPidRunning(session.Pid)
+		status = model.SafeParseExecutedFlow(statusPath)
+		if status == nil {
+			return currCmdIdx, fmt.Errorf("can't read the status of session [%s]", session.DirName)
+		}
+		// The bg tasks may still be writing logs after the main flow finished
+		final := !running || (status.Result != model.ExecutedResultIncompleted && !model.HasRunningBgTasks(status))
+		if len(detachedLog) != 0 {
+			for _, line := range follower.PollFile(detachedLog, final) {
+				_ = cc.Screen.Print(line + "\n")
+			}
+		} else {
+			for _, line := range follower.Poll(status, final) {
+				_ = cc.Screen.Print(display.ColorCmd("["+line.Cmd+"]", env) + " " + line.Line + "\n")
+			}
+		}
+		if final {
+			break
+		}
+		time.Sleep(interval)
+	}
+
+	result := status.Result
+	if result == model.ExecutedResultSucceeded {
+		display.PrintTipTitle(cc.Screen, env, "session ["+session.DirName+"] finished: "+string(result))
+		return currCmdIdx, nil
+	}
+	if result == model.ExecutedResultIncompleted {
+		result = "failed"
+	}
+	return currCmdIdx, fmt.Errorf("session [%s] ended with result: %s", session.DirName, result)
+}
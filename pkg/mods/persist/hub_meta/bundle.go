@@ -0,0 +1,453 @@
+package hub_meta
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A hub bundle is a tar.gz file for the machines without network,
+// it contains a manifest and the working trees (with git metadata) of the enabled repos in hub.
+// Git repos are imported as regular entries, so they could still be updated by git when the network is back,
+// local dirs are imported into the 'bundled' dir in hub as local entries.
+
+const (
+	HubBundleManifestFile = "bundle.json"
+	HubBundleReposDir     = "repos"
+	HubBundledLocalDir    = "bundled"
+)
+
+type HubBundleManifest struct {
+	ExportedAt   string          `json:"exported-at"`
+	Host         string          `json:"host"`
+	TicatVersion string          `json:"ticat-version"`
+	Repos        []HubBundleRepo `json:"repos"`
+}
+
+type HubBundleRepo struct {
+	// Empty if it's a local dir
+	Addr      string `json:"addr,omitempty"`
+	AddReason string `json:"add-reason"`
+	HelpStr   string `json:"help,omitempty"`
+	OnOff     string `json:"on-off"`
+	Mount     string `json:"mount,omitempty"`
+	// The dir name in the bundle
+	Dir    string `json:"dir"`
+	Digest string `json:"digest"`
+}
+
+func (self HubBundleRepo) IsLocal() bool {
+	return len(self.Addr) == 0
+}
+
+const (
+	HubBundleRepoAdded     = "added"
+	HubBundleRepoUpdated   = "updated"
+	HubBundleRepoUnchanged = "unchanged"
+)
+
+type HubBundleImportResult struct {
+	Info   RepoInfo
+	Result string
+}
+
+// ExportHubBundle packs the enabled repos, the manifest fields other than 'Repos' should be filled by the caller
+func ExportHubBundle(w io.Writer, infos []RepoInfo, manifest HubBundleManifest) (HubBundleManifest, error) {
+	manifest.ExportedAt = time.Now().Format(time.RFC3339)
+	manifest.Repos = nil
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	usedDirs := map[string]bool{}
+	for _, info := range infos {
+		if info.OnOff != "on" {
+			continue
+		}
+		dir := bundleRepoDirName(info, usedDirs)
+		digest, err := DirDigest(info.Path)
+		if err != nil {
+			return manifest, fmt.Errorf("[ExportHubBundle] read repo dir '%s' failed: %v", info.Path, err)
+		}
+		if err = packDir(tw, info.Path, HubBundleReposDir+"/"+dir); err != nil {
+			return manifest, fmt.Errorf("[ExportHubBundle] pack repo dir '%s' failed: %v", info.Path, err)
+		}
+		manifest.Repos = append(manifest.Repos, HubBundleRepo{
+			Addr:      info.Addr.Str(),
+			AddReason: info.AddReason,
+			HelpStr:   info.HelpStr,
+			OnOff:     info.OnOff,
+			Mount:     info.Mount,
+			Dir:       dir,
+			Digest:    digest,
+		})
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return manifest, fmt.Errorf("[ExportHubBundle] encode manifest failed: %v", err)
+	}
+	err = tw.WriteHeader(&tar.Header{Name: HubBundleManifestFile, Mode: 0644, Size: int64(len(data)),
+		ModTime: time.Now(), Typeflag: tar.TypeReg})
+	if err == nil {
+		_, err = tw.Write(data)
+	}
+	if err != nil {
+		return manifest, fmt.Errorf("[ExportHubBundle] write manifest failed: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		return manifest, fmt.Errorf("[ExportHubBundle] close tar writer failed: %v", err)
+	}
+	if err := gw.Close(); err != nil {
+		return manifest, fmt.Errorf("[ExportHubBundle] close gzip writer failed: %v", err)
+	}
+	return manifest, nil
+}
+
+func bundleRepoDirName(info RepoInfo, used map[string]bool) string {
+	name := filepath.Base(info.Path)
+	if !info.IsLocal() {
+		name = strings.NewReplacer("/", "_", ":", "_", "@", "_", "#", "_").Replace(info.Addr.Key())
+	}
+	dir := name
+	for i := 2; used[dir]; i++ {
+		dir = name + "-" + strconv.Itoa(i)
+	}
+	used[dir] = true
+	return dir
+}
+
+func packDir(tw *tar.Writer, root string, prefix string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := prefix + "/" + filepath.ToSlash(rel)
+		switch {
+		case info.IsDir():
+			return tw.WriteHeader(&tar.Header{Name: name + "/", Mode: 0755, ModTime: info.ModTime(), Typeflag: tar.TypeDir})
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return tw.WriteHeader(&tar.Header{Name: name, Linkname: link, Mode: 0777, ModTime: info.ModTime(), Typeflag: tar.TypeSymlink})
+		case info.Mode().IsRegular():
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = file.Close()
+			}()
+			err = tw.WriteHeader(&tar.Header{Name: name, Mode: int64(info.Mode().Perm()), Size: info.Size(),
+				ModTime: info.ModTime(), Typeflag: tar.TypeReg})
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(tw, file)
+			return err
+		}
+		return nil
+	})
+}
+
+// DirDigest is the hash of the files (paths, modes and contents) in a dir, the git metadata is not included
+func DirDigest(root string) (string, error) {
+	var paths []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() || info.Mode()&os.ModeSymlink != 0 {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(paths)
+
+	hash := sha256.New()
+	for _, path := range paths {
+		rel, _ := filepath.Rel(root, path)
+		info, err := os.Lstat(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s\x00%o\x00", filepath.ToSlash(rel), info.Mode())
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return "", err
+			}
+			hash.Write([]byte(link))
+		} else {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			hash.Write(data)
+		}
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ImportHubBundle unpacks a bundle into hub, the changed repos are replaced, the repo infos are merged and returned
+func ImportHubBundle(r io.Reader, hubPath string, infos []RepoInfo) (
+	merged []RepoInfo, results []HubBundleImportResult, manifest HubBundleManifest, err error) {
+
+	if err = os.MkdirAll(hubPath, os.ModePerm); err != nil {
+		return nil, nil, manifest, fmt.Errorf("[ImportHubBundle] create hub dir '%s' failed: %v", hubPath, err)
+	}
+	tmpDir, err := os.MkdirTemp(hubPath, ".importing-")
+	if err != nil {
+		return nil, nil, manifest, fmt.Errorf("[ImportHubBundle] create tmp dir failed: %v", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	if err = extractBundle(r, tmpDir); err != nil {
+		return nil, nil, manifest, err
+	}
+	data, err := os.ReadFile(filepath.Join(tmpDir, HubBundleManifestFile))
+	if err != nil {
+		return nil, nil, manifest, fmt.Errorf("[ImportHubBundle] read manifest failed, not a hub bundle? %v", err)
+	}
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, manifest, fmt.Errorf("[ImportHubBundle] parse manifest failed: %v", err)
+	}
+
+	merged = append([]RepoInfo{}, infos...)
+	for _, repo := range manifest.Repos {
+		if !isPlainDirName(repo.Dir) {
+			return nil, nil, manifest, fmt.Errorf("[ImportHubBundle] bad repo dir '%s' in manifest", repo.Dir)
+		}
+		info := RepoInfo{
+			Addr:      ParseRepoAddr(repo.Addr),
+			AddReason: repo.AddReason,
+			HelpStr:   repo.HelpStr,
+			OnOff:     repo.OnOff,
+			Mount:     repo.Mount,
+		}
+		if repo.IsLocal() {
+			info.Path = filepath.Join(hubPath, HubBundledLocalDir, repo.Dir)
+		} else {
+			info.Path, err = GetRepoPath(hubPath, info.Addr)
+			if err != nil {
+				return nil, nil, manifest, err
+			}
+		}
+		// The manifest is untrusted, the repo should not be put (and the old dir should not be removed) out of hub
+		info.Path = filepath.Clean(info.Path)
+		if !isStrictlyInDir(hubPath, info.Path) {
+			return nil, nil, manifest, fmt.Errorf("[ImportHubBundle] repo path '%s' of '%s' in manifest is out of hub",
+				info.Path, repo.Addr)
+		}
+
+		result := HubBundleRepoAdded
+		if _, statErr := os.Stat(info.Path); statErr == nil {
+			result = HubBundleRepoUpdated
+			if digest, _ := DirDigest(info.Path); digest == repo.Digest {
+				result = HubBundleRepoUnchanged
+			}
+		}
+		if result != HubBundleRepoUnchanged {
+			if err = replaceDir(filepath.Join(tmpDir, HubBundleReposDir, repo.Dir), info.Path); err != nil {
+				return nil, nil, manifest, fmt.Errorf("[ImportHubBundle] move repo to '%s' failed: %v", info.Path, err)
+			}
+		}
+		merged = mergeRepoInfo(merged, info)
+		results = append(results, HubBundleImportResult{info, result})
+	}
+	return merged, results, manifest, nil
+}
+
+func mergeRepoInfo(infos []RepoInfo, info RepoInfo) []RepoInfo {
+	for i, it := range infos {
+		same := it.Path == info.Path
+		if !info.IsLocal() {
+			same = !it.IsLocal() && it.Addr.Key() == info.Addr.Key()
+		}
+		if same {
+			infos[i] = info
+			return infos
+		}
+	}
+	return append(infos, info)
+}
+
+func replaceDir(from string, to string) error {
+	if _, err := os.Stat(from); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(to); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+func extractBundle(r io.Reader, dest string) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("[ImportHubBundle] open gzip stream failed: %v", err)
+	}
+	if err = extractTar(tar.NewReader(gr), dest); err != nil {
+		return fmt.Errorf("[ImportHubBundle] extract bundle failed: %v", err)
+	}
+	return nil
+}
+
+// extractTar extracts the regular files, dirs and symlinks, the paths and link targets should stay in 'dest',
+// nothing is written through the extracted links
+func extractTar(tr *tar.Reader, dest string) error {
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read archive failed: %v", err)
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if isEscapingPath(name) {
+			return fmt.Errorf("bad path '%s' in archive", header.Name)
+		}
+		path := filepath.Join(dest, name)
+		// The extracted links could be chained to escape from 'dest', never write through them
+		if err := checkNoSymlinkInPath(dest, name); err != nil {
+			return fmt.Errorf("bad path '%s' in archive: %v", header.Name, err)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			// The link target should stay in the archive, and should not go through another link
+			if filepath.IsAbs(header.Linkname) || !isLinkTargetInDir(dest, name, header.Linkname) {
+				return fmt.Errorf("bad link '%s' -> '%s' in archive", header.Name, header.Linkname)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, path); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeExtractedFile(path, os.FileMode(header.Mode).Perm(), tr); err != nil {
+				return err
+			}
+		default:
+			// Skip other special files
+		}
+	}
+	return nil
+}
+
+func writeExtractedFile(path string, mode os.FileMode, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	closeErr := file.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// checkNoSymlinkInPath checks every component of 'name' (including itself) under 'dir' is not a symlink
+func checkNoSymlinkInPath(dir string, name string) error {
+	curr := dir
+	for _, it := range strings.Split(name, string(filepath.Separator)) {
+		curr = filepath.Join(curr, it)
+		info, err := os.Lstat(curr)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("'%s' is a symlink", curr)
+		}
+	}
+	return nil
+}
+
+// isLinkTargetInDir resolves the link target component by component (not lexically),
+// the target should stay in 'dir', the components before the last one should be extracted dirs (not symlinks),
+// so the later extracted links can't change where it points to
+func isLinkTargetInDir(dir string, name string, target string) bool {
+	var stack []string
+	if parent := filepath.Dir(name); parent != "." {
+		stack = strings.Split(parent, string(filepath.Separator))
+	}
+	var parts []string
+	for _, it := range strings.Split(filepath.FromSlash(target), string(filepath.Separator)) {
+		if len(it) != 0 && it != "." {
+			parts = append(parts, it)
+		}
+	}
+	for i, it := range parts {
+		if it == ".." {
+			if len(stack) == 0 {
+				return false
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		stack = append(stack, it)
+		info, err := os.Lstat(filepath.Join(append([]string{dir}, stack...)...))
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return false
+		}
+		if i != len(parts)-1 && (err != nil || !info.IsDir()) {
+			return false
+		}
+	}
+	return true
+}
+
+// isPlainDirName checks if the name is a single path segment, not '.' or '..'
+func isPlainDirName(name string) bool {
+	return len(name) != 0 && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
+
+// isStrictlyInDir checks if the path is inside the dir, and is not the dir itself
+func isStrictlyInDir(dir string, path string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != "." && !isEscapingPath(rel)
+}
+
+func isEscapingPath(name string) bool {
+	return filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,197 @@
+package hub_meta
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHubBundleExportImport(t *testing.T) {
+	root := t.TempDir()
+	write := func(path string, content string) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srcHub := filepath.Join(root, "src-hub")
+	addr := ParseRepoAddr("https://github.com/a/mods@v1")
+	gitPath, _ := GetRepoPath(srcHub, addr)
+	write(filepath.Join(gitPath, "cmd.ticat"), "help = v1")
+	write(filepath.Join(gitPath, ".git", "HEAD"), "ref: refs/heads/master")
+	localPath := filepath.Join(root, "my-mods")
+	write(filepath.Join(localPath, "local.ticat"), "help = local")
+	if err := os.Symlink("local.ticat", filepath.Join(localPath, "link.ticat")); err != nil {
+		t.Fatal(err)
+	}
+
+	infos := []RepoInfo{
+		{Addr: addr, AddReason: addr.Str(), Path: gitPath, HelpStr: "git mods", OnOff: "on"},
+		{AddReason: "<local>", Path: localPath, OnOff: "on"},
+		{Addr: ParseRepoAddr("https://github.com/a/off"), AddReason: "x", Path: filepath.Join(root, "off"), OnOff: "off"},
+	}
+	export := func() []byte {
+		var buf bytes.Buffer
+		manifest, err := ExportHubBundle(&buf, infos, HubBundleManifest{Host: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(manifest.Repos) != 2 {
+			t.Fatalf("expect only enabled repos in bundle, got %+v", manifest.Repos)
+		}
+		return buf.Bytes()
+	}
+
+	dstHub := filepath.Join(root, "dst-hub")
+	imported, results, manifest, err := ImportHubBundle(bytes.NewReader(export()), dstHub, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Host != "test" || len(imported) != 2 || len(results) != 2 {
+		t.Fatalf("unexpected import: %+v, %+v", imported, results)
+	}
+	dstGitPath, _ := GetRepoPath(dstHub, addr)
+	if imported[0].Path != dstGitPath || imported[0].Addr.Ref != "v1" || imported[0].HelpStr != "git mods" ||
+		results[0].Result != HubBundleRepoAdded {
+		t.Errorf("unexpected git repo entry: %+v", results[0])
+	}
+	if _, err := os.Stat(filepath.Join(dstGitPath, ".git", "HEAD")); err != nil {
+		t.Errorf("expect git metadata in imported repo: %v", err)
+	}
+	if !imported[1].IsLocal() || imported[1].Path != filepath.Join(dstHub, HubBundledLocalDir, "my-mods") {
+		t.Errorf("unexpected local entry: %+v", imported[1])
+	}
+	if link, _ := os.Readlink(filepath.Join(imported[1].Path, "link.ticat")); link != "local.ticat" {
+		t.Errorf("expect symlink kept, got '%s'", link)
+	}
+
+	// Import a newer bundle, only the changed repo is replaced
+	write(filepath.Join(gitPath, "cmd.ticat"), "help = v2")
+	imported, results, _, err = ImportHubBundle(bytes.NewReader(export()), dstHub, imported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported) != 2 || results[0].Result != HubBundleRepoUpdated || results[1].Result != HubBundleRepoUnchanged {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dstGitPath, "cmd.ticat")); string(data) != "help = v2" {
+		t.Errorf("expect repo replaced, got '%s'", data)
+	}
+	if leftovers, _ := filepath.Glob(filepath.Join(dstHub, ".importing-*")); len(leftovers) != 0 {
+		t.Errorf("expect tmp dirs removed: %v", leftovers)
+	}
+}
+
+func TestHubBundleImportMaliciousManifest(t *testing.T) {
+	root := t.TempDir()
+	hubPath := filepath.Join(root, "hub")
+	victim := filepath.Join(root, "victim")
+	if err := os.MkdirAll(victim, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(victim, "keep"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := func(repo HubBundleRepo) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		write := func(name string, data []byte) {
+			if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))}); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tw.Write(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		manifest, _ := json.Marshal(HubBundleManifest{Repos: []HubBundleRepo{repo}})
+		write(HubBundleManifestFile, manifest)
+		write(HubBundleReposDir+"/x/cmd.ticat", []byte("help = x"))
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	for _, repo := range []HubBundleRepo{
+		{Addr: "../../../victim", Dir: "x", OnOff: "on"},
+		{Addr: "file://../victim", Dir: "x", OnOff: "on"},
+		{Dir: ".", OnOff: "on"},
+		{Dir: "..", OnOff: "on"},
+		{Addr: "https://github.com/a/mods", Dir: "../x", OnOff: "on"},
+	} {
+		if _, _, _, err := ImportHubBundle(bytes.NewReader(bundle(repo)), hubPath, nil); err == nil {
+			t.Errorf("expect error for bad repo in manifest: %+v", repo)
+		}
+		if data, err := os.ReadFile(filepath.Join(victim, "keep")); err != nil || string(data) != "keep" {
+			t.Fatalf("the dir out of hub should not be touched, repo: %+v", repo)
+		}
+	}
+}
+
+type tarEntryForTest struct {
+	name     string
+	linkname string
+	data     string
+}
+
+// newTarForTest builds a tar, an entry with 'linkname' is a symlink, otherwise it's a regular file
+func newTarForTest(t *testing.T, entries ...tarEntryForTest) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, it := range entries {
+		header := &tar.Header{Name: it.name, Mode: 0644, Size: int64(len(it.data)), Typeflag: tar.TypeReg}
+		if len(it.linkname) != 0 {
+			header = &tar.Header{Name: it.name, Mode: 0777, Linkname: it.linkname, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(it.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractTarSymlinkChain(t *testing.T) {
+	for _, entries := range [][]tarEntryForTest{
+		{{name: "x", linkname: "."}, {name: "x/y", linkname: ".."}, {name: "x/y/evil", data: "evil"}},
+		{{name: "a", linkname: "b/.."}, {name: "b", linkname: "."}, {name: "a/evil", data: "evil"}},
+		{{name: "d/x", data: "x"}, {name: "l", linkname: "d/x/.."}, {name: "d/evil", linkname: "../evil"}},
+	} {
+		root := t.TempDir()
+		dest := filepath.Join(root, "dest")
+		err := extractTar(tar.NewReader(bytes.NewReader(newTarForTest(t, entries...))), dest)
+		if err == nil {
+			t.Errorf("expect error for the links: %+v", entries)
+		}
+		if _, err := os.Lstat(filepath.Join(root, "evil")); !os.IsNotExist(err) {
+			t.Fatalf("the file out of the unpack dir should not be written: %+v", entries)
+		}
+	}
+
+	dest := filepath.Join(t.TempDir(), "dest")
+	data := newTarForTest(t, tarEntryForTest{name: "real/f", data: "f"},
+		tarEntryForTest{name: "lib", linkname: "real"}, tarEntryForTest{name: "sub/f", linkname: "../real/f"})
+	if err := extractTar(tar.NewReader(bytes.NewReader(data)), dest); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(filepath.Join(dest, "sub", "f")); err != nil || string(content) != "f" {
+		t.Errorf("the links in the archive should be extracted: %s, %v", content, err)
+	}
+}
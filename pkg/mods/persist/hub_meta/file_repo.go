@@ -0,0 +1,403 @@
+package hub_meta
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A file repo is an archive (eg: 'file:///share/mods-1.4.tar.gz') or a dir snapshot (eg: 'file:///share/mods-1.4'),
+// it's unpacked (or copied) into hub under a versioned path, the version is parsed from the file name.
+// A newer version in the source dir is picked up by 'hub.update', a file repo without version in name
+// is unpacked to the same path, and re-unpacked when the source changes.
+
+const (
+	FileRepoAddrPrefix = "file://"
+	// The dir in hub to unpack file repos
+	HubFileReposDir = "file"
+	// The file in unpacked dir recording the digest of the source
+	FileRepoDigestFile = ".ticat-source-digest"
+	// The version dir name of the file repos without version in name
+	FileRepoNoVersion = "snapshot"
+)
+
+var fileRepoArchiveExts = []string{".tar.gz", ".tgz", ".tar", ".zip"}
+
+// The version is the part after the first '-' or '_' followed by a digit (or 'v' and a digit)
+var fileRepoVersionRegexp = regexp.MustCompile(`^(.+?)[-_](v?[0-9][0-9A-Za-z.\-_]*)$`)
+
+func (self RepoAddr) IsFile() bool {
+	return strings.HasPrefix(self.Addr, FileRepoAddrPrefix)
+}
+
+type FileRepo struct {
+	// The archive file or the dir of the snapshot
+	Path    string
+	Name    string
+	Version string
+	// The archive ext, empty if it's a dir snapshot
+	Ext string
+}
+
+func (self FileRepo) IsDir() bool {
+	return len(self.Ext) == 0
+}
+
+func (self FileRepo) Addr() RepoAddr {
+	return RepoAddr{Addr: FileRepoAddrPrefix + filepath.ToSlash(self.Path)}
+}
+
+// ParseFileRepo parses the file repo from the address, the source is not accessed
+func ParseFileRepo(addr RepoAddr) (repo FileRepo, err error) {
+	if !addr.IsFile() {
+		return repo, fmt.Errorf("[ParseFileRepo] '%s' is not a file repo address", addr.Addr)
+	}
+	path := filepath.Clean(filepath.FromSlash(addr.Addr[len(FileRepoAddrPrefix):]))
+	if !filepath.IsAbs(path) {
+		return repo, fmt.Errorf("[ParseFileRepo] path of '%s' should be absolute", addr.Addr)
+	}
+	repo.Path = path
+	repo.Name, repo.Version, repo.Ext = splitFileRepoName(filepath.Base(path))
+	return repo, nil
+}
+
+// NormalizeFileRepoAddr converts the relative path in the address to absolute
+func NormalizeFileRepoAddr(addr string) string {
+	path := filepath.FromSlash(addr[len(FileRepoAddrPrefix):])
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return FileRepoAddrPrefix + filepath.ToSlash(path)
+}
+
+func splitFileRepoName(base string) (name string, version string, ext string) {
+	lower := strings.ToLower(base)
+	for _, it := range fileRepoArchiveExts {
+		if strings.HasSuffix(lower, it) && len(base) > len(it) {
+			ext = base[len(base)-len(it):]
+			base = base[:len(base)-len(it)]
+			break
+		}
+	}
+	matched := fileRepoVersionRegexp.FindStringSubmatch(base)
+	if matched == nil {
+		return base, "", ext
+	}
+	return matched[1], matched[2], ext
+}
+
+// fileRepoKey identifies a file repo without the version, so upgrading won't make it a new repo
+func fileRepoKey(addr RepoAddr) string {
+	repo, err := ParseFileRepo(addr)
+	if err != nil {
+		return addr.Addr
+	}
+	key := FileRepoAddrPrefix + filepath.ToSlash(filepath.Join(filepath.Dir(repo.Path), repo.Name))
+	if !repo.IsDir() {
+		key += strings.ToLower(repo.Ext)
+	}
+	return key
+}
+
+func getFileRepoPath(hubPath string, addr RepoAddr) (string, error) {
+	repo, err := ParseFileRepo(addr)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Dir(repo.Path)
+	dir = strings.TrimLeft(dir[len(filepath.VolumeName(dir)):], string(filepath.Separator))
+	version := repo.Version
+	if len(version) == 0 {
+		version = FileRepoNoVersion
+	}
+	return filepath.Join(hubPath, HubFileReposDir, dir, repo.Name, version), nil
+}
+
+// CompareFileRepoVersions compares the versions segment by segment, numeric segments are compared as numbers
+func CompareFileRepoVersions(a string, b string) int {
+	split := func(version string) []string {
+		version = strings.TrimPrefix(strings.ToLower(version), "v")
+		return strings.FieldsFunc(version, func(c rune) bool {
+			return c == '.' || c == '-' || c == '_'
+		})
+	}
+	as := split(a)
+	bs := split(b)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.ParseUint(as[i], 10, 64)
+		bn, bErr := strconv.ParseUint(bs[i], 10, 64)
+		if aErr == nil && bErr == nil {
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		// A numeric segment is newer than a non-numeric one: '1.0.1' > '1.0-rc1'
+		if aErr == nil {
+			return 1
+		}
+		if bErr == nil {
+			return -1
+		}
+		if cmp := strings.Compare(as[i], bs[i]); cmp != 0 {
+			return cmp
+		}
+	}
+	if len(as) == len(bs) {
+		return 0
+	}
+	// '1.0-rc1' < '1.0', but '1.0' < '1.0.1'
+	if len(as) > len(bs) {
+		if _, err := strconv.ParseUint(as[len(bs)], 10, 64); err == nil {
+			return 1
+		}
+		return -1
+	}
+	if _, err := strconv.ParseUint(bs[len(as)], 10, 64); err == nil {
+		return -1
+	}
+	return 1
+}
+
+// FindNewerFileRepo finds the newest version of the same repo (same name and same kind) in the source dir,
+// returns false if no newer one, the repos without versions are never upgraded
+func FindNewerFileRepo(addr RepoAddr, sourceDir string) (newer RepoAddr, found bool, err error) {
+	repo, err := ParseFileRepo(addr)
+	if err != nil || len(repo.Version) == 0 {
+		return
+	}
+	if len(sourceDir) == 0 {
+		sourceDir = filepath.Dir(repo.Path)
+	}
+	entries, err := os.ReadDir(sourceDir)
+	if err != nil {
+		return newer, false, fmt.Errorf("[FindNewerFileRepo] read source dir '%s' failed: %v", sourceDir, err)
+	}
+	best := repo
+	for _, entry := range entries {
+		name, version, ext := splitFileRepoName(entry.Name())
+		if name != repo.Name || len(version) == 0 || !strings.EqualFold(ext, repo.Ext) {
+			continue
+		}
+		if isDir := entry.IsDir(); isDir != repo.IsDir() {
+			continue
+		}
+		if CompareFileRepoVersions(version, best.Version) > 0 {
+			best = FileRepo{filepath.Join(sourceDir, entry.Name()), name, version, ext}
+			found = true
+		}
+	}
+	if found {
+		newer = best.Addr()
+		newer.Branch = addr.Branch
+	}
+	return
+}
+
+// FileRepoSourceDigest is the digest of the archive file or the snapshot dir
+func FileRepoSourceDigest(addr RepoAddr) (string, error) {
+	repo, err := ParseFileRepo(addr)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(repo.Path)
+	if err != nil {
+		return "", fmt.Errorf("[FileRepoSourceDigest] source of '%s' not found: %v", addr.Addr, err)
+	}
+	if info.IsDir() != repo.IsDir() {
+		return "", fmt.Errorf("[FileRepoSourceDigest] source '%s' should be an archive with ext %v or a dir",
+			repo.Path, fileRepoArchiveExts)
+	}
+	if info.IsDir() {
+		return DirDigest(repo.Path)
+	}
+	file, err := os.Open(repo.Path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// UpdateFileRepo unpacks (or copies) the source into hub if it's not there or the source changed,
+// returns the digests of the source recorded in hub before and after updating
+func UpdateFileRepo(hubPath string, addr RepoAddr) (repoPath string, oldDigest string, digest string, err error) {
+	repoPath, err = getFileRepoPath(hubPath, addr)
+	if err != nil {
+		return
+	}
+	digest, err = FileRepoSourceDigest(addr)
+	if err != nil {
+		return
+	}
+	if data, readErr := os.ReadFile(filepath.Join(repoPath, FileRepoDigestFile)); readErr == nil {
+		oldDigest = strings.TrimSpace(string(data))
+	}
+	if oldDigest == digest {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(repoPath), os.ModePerm); err != nil {
+		return
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(repoPath), ".unpacking-")
+	if err != nil {
+		return
+	}
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+
+	repo, _ := ParseFileRepo(addr)
+	root := tmpDir
+	if repo.IsDir() {
+		err = copyDir(repo.Path, tmpDir)
+	} else {
+		err = extractArchive(repo.Path, repo.Ext, tmpDir)
+		if err == nil {
+			root, err = stripArchiveTopDir(tmpDir, repo)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("[UpdateFileRepo] unpack '%s' failed: %v", repo.Path, err)
+		return
+	}
+	if err = os.WriteFile(filepath.Join(root, FileRepoDigestFile), []byte(digest+"\n"), 0644); err != nil {
+		return
+	}
+	if err = replaceDir(root, repoPath); err != nil {
+		err = fmt.Errorf("[UpdateFileRepo] move unpacked files to '%s' failed: %v", repoPath, err)
+	}
+	return
+}
+
+func extractArchive(path string, ext string, dest string) error {
+	if strings.EqualFold(ext, ".zip") {
+		return extractZip(path, dest)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	var r io.Reader = file
+	if !strings.EqualFold(ext, ".tar") {
+		gr, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("open gzip stream failed: %v", err)
+		}
+		r = gr
+	}
+	return extractTar(tar.NewReader(r), dest)
+}
+
+// extractZip extracts the regular files and dirs, symlinks and other special files are skipped
+func extractZip(path string, dest string) error {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = zr.Close()
+	}()
+	for _, it := range zr.File {
+		name := filepath.Clean(filepath.FromSlash(it.Name))
+		if isEscapingPath(name) {
+			return fmt.Errorf("bad path '%s' in archive", it.Name)
+		}
+		path := filepath.Join(dest, name)
+		mode := it.Mode()
+		if mode.IsDir() {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !mode.IsRegular() {
+			continue
+		}
+		r, err := it.Open()
+		if err != nil {
+			return err
+		}
+		err = writeExtractedFile(path, mode.Perm(), r)
+		_ = r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripArchiveTopDir returns the top dir if the archive is packed as 'mods-1.4/...' or 'mods/...'
+func stripArchiveTopDir(dir string, repo FileRepo) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return dir, nil
+	}
+	name := entries[0].Name()
+	base := filepath.Base(repo.Path)
+	if name == base[:len(base)-len(repo.Ext)] || name == repo.Name {
+		return filepath.Join(dir, name), nil
+	}
+	return dir, nil
+}
+
+// copyDir copies the files, dirs and symlinks, the git metadata is not copied
+func copyDir(from string, to string) error {
+	return filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		dest := filepath.Join(to, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(dest, 0755)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, dest)
+		case info.Mode().IsRegular():
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			err = writeExtractedFile(dest, info.Mode().Perm(), file)
+			_ = file.Close()
+			return err
+		}
+		return nil
+	})
+}
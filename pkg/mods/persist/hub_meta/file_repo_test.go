@@ -0,0 +1,221 @@
+package hub_meta
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/innerr/ticat/pkg/cli/display"
+	"github.com/innerr/ticat/pkg/core/model"
+)
+
+func TestSplitFileRepoName(t *testing.T) {
+	tests := []struct {
+		base    string
+		name    string
+		version string
+		ext     string
+	}{
+		{"mods-1.4.tar.gz", "mods", "1.4", ".tar.gz"},
+		{"tidb-mods_v2.0.1-rc1.tgz", "tidb-mods", "v2.0.1-rc1", ".tgz"},
+		{"mods.zip", "mods", "", ".zip"},
+		{"mods-1.4", "mods", "1.4", ""},
+		{"mods-latest", "mods-latest", "", ""},
+	}
+	for _, tt := range tests {
+		name, version, ext := splitFileRepoName(tt.base)
+		if name != tt.name || version != tt.version || ext != tt.ext {
+			t.Errorf("splitFileRepoName(%q) = %q, %q, %q", tt.base, name, version, ext)
+		}
+	}
+
+	a := RepoAddr{Addr: "file:///share/mods-1.4.tar.gz"}
+	b := RepoAddr{Addr: "file:///share/mods-1.10.tar.gz"}
+	if a.Key() != b.Key() || a.Key() == (RepoAddr{Addr: "file:///share/mods-1.4"}).Key() {
+		t.Errorf("the versions of a file repo should have the same key")
+	}
+	path, err := GetRepoPath("/hub", a)
+	if err != nil || path != filepath.Join("/hub", HubFileReposDir, "share", "mods", "1.4") {
+		t.Errorf("unexpected repo path: %s, %v", path, err)
+	}
+}
+
+func TestCompareFileRepoVersions(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"1.4", "1.4", 0},
+		{"1.4", "1.10", -1},
+		{"v2", "1.9.9", 1},
+		{"1.0", "1.0.1", -1},
+		{"1.0-rc1", "1.0", -1},
+		{"1.0-rc2", "1.0-rc1", 1},
+		{"1.0.1", "1.0-rc1", 1},
+	}
+	for _, tt := range tests {
+		if result := CompareFileRepoVersions(tt.a, tt.b); result != tt.expected {
+			t.Errorf("CompareFileRepoVersions(%q, %q) = %d, expected %d", tt.a, tt.b, result, tt.expected)
+		}
+		if result := CompareFileRepoVersions(tt.b, tt.a); result != -tt.expected {
+			t.Errorf("CompareFileRepoVersions(%q, %q) = %d, expected %d", tt.b, tt.a, result, -tt.expected)
+		}
+	}
+}
+
+func writeTestTarGz(t *testing.T, path string, files map[string]string) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)),
+			Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateFileRepo(t *testing.T) {
+	share := t.TempDir()
+	hub := t.TempDir()
+
+	readUnpacked := func(t *testing.T, path string, name string) string {
+		data, err := os.ReadFile(filepath.Join(path, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	t.Run("archive", func(t *testing.T) {
+		writeTestTarGz(t, filepath.Join(share, "mods-1.4.tar.gz"), map[string]string{
+			"mods-1.4/run.bash":       "echo 1.4\n",
+			"mods-1.4/run.bash.ticat": "help = run\n",
+		})
+		addr := RepoAddr{Addr: FileRepoAddrPrefix + filepath.ToSlash(filepath.Join(share, "mods-1.4.tar.gz"))}
+		path, oldDigest, digest, err := UpdateFileRepo(hub, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(oldDigest) != 0 || readUnpacked(t, path, "run.bash") != "echo 1.4\n" {
+			t.Errorf("expect unpacked with the top dir stripped")
+		}
+		_, oldDigest2, digest2, err := UpdateFileRepo(hub, addr)
+		if err != nil || oldDigest2 != digest || digest2 != digest {
+			t.Errorf("expect unchanged: %v", err)
+		}
+	})
+
+	t.Run("symlink chain", func(t *testing.T) {
+		data := newTarForTest(t, tarEntryForTest{name: "x", linkname: "."},
+			tarEntryForTest{name: "x/y", linkname: ".."}, tarEntryForTest{name: "x/y/evil", data: "evil"})
+		if err := os.WriteFile(filepath.Join(share, "evil.tar"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		addr := RepoAddr{Addr: FileRepoAddrPrefix + filepath.ToSlash(filepath.Join(share, "evil.tar"))}
+		if _, _, _, err := UpdateFileRepo(hub, addr); err == nil {
+			t.Errorf("expect error for the links escaping from the unpack dir")
+		}
+		_ = filepath.Walk(filepath.Dir(hub), func(path string, info os.FileInfo, err error) error {
+			if err == nil && info.Name() == "evil" && info.Mode().IsRegular() {
+				t.Errorf("the file out of the unpack dir should not be written: '%s'", path)
+			}
+			return nil
+		})
+	})
+
+	t.Run("zip", func(t *testing.T) {
+		file, err := os.Create(filepath.Join(share, "tools.zip"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := zip.NewWriter(file)
+		w, _ := zw.Create("bin/tool.bash")
+		_, _ = w.Write([]byte("echo tool\n"))
+		_ = zw.Close()
+		_ = file.Close()
+		addr := RepoAddr{Addr: FileRepoAddrPrefix + filepath.ToSlash(filepath.Join(share, "tools.zip"))}
+		path, _, _, err := UpdateFileRepo(hub, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Base(path) != FileRepoNoVersion || readUnpacked(t, path, "bin/tool.bash") != "echo tool\n" {
+			t.Errorf("unexpected unpacked zip at '%s'", path)
+		}
+	})
+
+	t.Run("dir snapshot", func(t *testing.T) {
+		src := filepath.Join(share, "snap")
+		if err := os.MkdirAll(filepath.Join(src, ".git"), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(src, "a.bash"), []byte("v1"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		addr := RepoAddr{Addr: FileRepoAddrPrefix + filepath.ToSlash(src)}
+		path, _, digest, err := UpdateFileRepo(hub, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); !os.IsNotExist(err) {
+			t.Errorf("git metadata should not be copied")
+		}
+		if err := os.WriteFile(filepath.Join(src, "a.bash"), []byte("v2"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, oldDigest, newDigest, err := UpdateFileRepo(hub, addr)
+		if err != nil || oldDigest != digest || newDigest == digest || readUnpacked(t, path, "a.bash") != "v2" {
+			t.Errorf("expect snapshot re-copied after the source changed: %v", err)
+		}
+	})
+
+	t.Run("upgrade", func(t *testing.T) {
+		for _, version := range []string{"1.10", "1.9", "1.11-rc1"} {
+			writeTestTarGz(t, filepath.Join(share, "mods-"+version+".tar.gz"), map[string]string{
+				"run.bash": "echo " + version + "\n",
+			})
+		}
+		addr := RepoAddr{Addr: FileRepoAddrPrefix + filepath.ToSlash(filepath.Join(share, "mods-1.4.tar.gz"))}
+		updater := NewRepoUpdater(display.NewCacheScreen(), model.NewEnv(), map[string]bool{}, hub,
+			"hub.ticat", "ticat", 2, model.ParsedCmd{})
+		updater.UpgradeFileRepos("")
+		updater.Start(addr)
+		results := updater.Wait()
+		resolved := updater.Resolved(addr)
+		if len(results) != 1 || results[0].Status != RepoUpdated || results[0].To != "1.11-rc1" {
+			t.Fatalf("unexpected results: %+v", results)
+		}
+		path, _ := GetRepoPath(hub, resolved)
+		if readUnpacked(t, path, "run.bash") != "echo 1.11-rc1\n" {
+			t.Errorf("expect upgraded to the newest version")
+		}
+
+		pinned := addr
+		pinned.Ref = "1.4"
+		updater = NewRepoUpdater(display.NewCacheScreen(), model.NewEnv(), map[string]bool{}, hub,
+			"hub.ticat", "ticat", 2, model.ParsedCmd{})
+		updater.UpgradeFileRepos("")
+		updater.Start(pinned)
+		updater.Wait()
+		if updater.Resolved(pinned).Addr != addr.Addr {
+			t.Errorf("pinned file repo should not be upgraded")
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package hub_meta
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/innerr/ticat/pkg/cli/display"
+	"github.com/innerr/ticat/pkg/core/model"
+)
+
+// RepoLock is the resolved commit of a repo in hub, the lock file could reproduce the same repos on other machines
+type RepoLock struct {
+	Addr      RepoAddr
+	Commit    string
+	AddReason string
+}
+
+func GetRepoHeadCommit(repoPath string) (string, error) {
+	c := exec.Command("git", "rev-parse", "HEAD")
+	c.Dir = repoPath
+	out, err := c.Output()
+	if err != nil {
+		return "", fmt.Errorf("[GetRepoHeadCommit] get head commit of repo '%s' failed: %v", repoPath, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// GenHubLock resolves the commits of the enabled git repos, the local dirs and file repos are not included
+func GenHubLock(infos []RepoInfo) (locks []RepoLock, err error) {
+	for _, info := range infos {
+		if info.IsLocal() || info.Addr.IsFile() || info.OnOff != "on" {
+			continue
+		}
+		var commit string
+		commit, err = GetRepoHeadCommit(info.Path)
+		if err != nil {
+			return
+		}
+		locks = append(locks, RepoLock{info.Addr, commit, info.AddReason})
+	}
+	return
+}
+
+func WriteHubLockFile(path string, locks []RepoLock, sep string) error {
+	var buf strings.Builder
+	for _, lock := range locks {
+		buf.WriteString(lock.Addr.Str() + sep + lock.Commit + sep + lock.AddReason + "\n")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0644); err != nil {
+		return fmt.Errorf("[WriteHubLockFile] write file '%s' failed: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("[WriteHubLockFile] rename file '%s' to '%s' failed: %v", tmp, path, err)
+	}
+	return nil
+}
+
+func ReadHubLockFile(path string, sep string) (locks []RepoLock, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("[ReadHubLockFile] open file '%s' failed: %v", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.Trim(scanner.Text(), "\n\r")
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.Split(line, sep)
+		if len(fields) != 3 || len(fields[0]) == 0 || len(fields[1]) == 0 {
+			return nil, fmt.Errorf("[ReadHubLockFile] file '%s' line '%s' can't be parsed", path, line)
+		}
+		locks = append(locks, RepoLock{ParseRepoAddr(fields[0]), fields[1], fields[2]})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("[ReadHubLockFile] read file '%s' failed: %v", path, err)
+	}
+	return
+}
+
+// CheckoutRepoToLock clones the repo if it's not in hub, then checks out the locked commit
+func CheckoutRepoToLock(
+	screen model.Screen,
+	env *model.Env,
+	hubPath string,
+	lock RepoLock,
+	cmd model.ParsedCmd) (repoPath string, err error) {
+
+	name := AddrDisplayName(lock.Addr)
+	repoPath, err = GetRepoPath(hubPath, lock.Addr)
+	if err != nil {
+		return
+	}
+
+	stat, statErr := os.Stat(repoPath)
+	if os.IsNotExist(statErr) {
+		_ = screen.Print(fmt.Sprintf(display.ColorHub("[%s]", env)+display.ColorSymbol(" => ", env)+
+			"git clone\n", name))
+		if err = os.MkdirAll(filepath.Dir(repoPath), os.ModePerm); err != nil {
+			return
+		}
+		err = cloneRepo(repoPath, lock.Addr, cmd, nil)
+	} else if !stat.IsDir() {
+		err = model.WrapCmdError(cmd, fmt.Errorf("repo path '%v' exists but is not dir", repoPath))
+	} else if head, headErr := GetRepoHeadCommit(repoPath); headErr == nil && head == lock.Commit {
+		_ = screen.Print(fmt.Sprintf(display.ColorHub("[%s]", env)+display.ColorSymbol(" => ", env)+
+			"already at %s\n", name, lock.Commit))
+		return
+	} else {
+		_ = screen.Print(fmt.Sprintf(display.ColorHub("[%s]", env)+display.ColorSymbol(" => ", env)+
+			"git fetch\n", name))
+		err = runGitCmd(repoPath, cmd, nil, "git", "fetch", "--tags", "--recurse-submodules", "origin")
+	}
+	if err != nil {
+		return
+	}
+
+	_ = screen.Print(fmt.Sprintf(display.ColorHub("[%s]", env)+display.ColorSymbol(" => ", env)+
+		"git checkout %s\n", name, lock.Commit))
+	err = checkoutRepoRef(repoPath, lock.Commit, cmd, nil)
+	return
+}
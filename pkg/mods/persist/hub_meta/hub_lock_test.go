@@ -0,0 +1,162 @@
+package hub_meta
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/innerr/ticat/pkg/cli/display"
+	"github.com/innerr/ticat/pkg/core/model"
+)
+
+func TestParseRepoAddrWithRef(t *testing.T) {
+	cases := []struct {
+		input  string
+		addr   string
+		branch string
+		ref    string
+	}{
+		{"innerr/tidb.ticat", "innerr/tidb.ticat", "", ""},
+		{"innerr/tidb.ticat@v1.2.0", "innerr/tidb.ticat", "", "v1.2.0"},
+		{"innerr/tidb.ticat#dev@1a2b3c", "innerr/tidb.ticat", "dev", "1a2b3c"},
+		{"git@github.com:innerr/tidb.ticat", "git@github.com:innerr/tidb.ticat", "", ""},
+		{"git@github.com:innerr/tidb.ticat#dev@v1", "git@github.com:innerr/tidb.ticat", "dev", "v1"},
+		{"git@github.com:repo", "git@github.com:repo", "", ""},
+	}
+	for _, c := range cases {
+		addr := ParseRepoAddr(c.input)
+		if addr.Addr != c.addr || addr.Branch != c.branch || addr.Ref != c.ref {
+			t.Errorf("parse '%s': expected (%s, %s, %s), got %+v", c.input, c.addr, c.branch, c.ref, addr)
+		}
+		if addr.Str() != c.input {
+			t.Errorf("expected '%s' after round trip, got '%s'", c.input, addr.Str())
+		}
+	}
+
+	pinned := ParseRepoAddr("innerr/tidb.ticat#dev@v1")
+	if pinned.Key() != "innerr/tidb.ticat#dev" || !pinned.IsPinned() {
+		t.Errorf("unexpected key of pinned addr: %s", pinned.Key())
+	}
+}
+
+func TestHubLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hub.lock")
+	locks := []RepoLock{
+		{ParseRepoAddr("https://github.com/a/b@v1"), "1111", "https://github.com/a/b@v1"},
+		{ParseRepoAddr("https://github.com/a/c"), "2222", "https://github.com/a/b@v1"},
+	}
+	if err := WriteHubLockFile(path, locks, "\t"); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadHubLockFile(path, "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || read[0].Addr.Ref != "v1" || read[1].Commit != "2222" || read[1].AddReason != locks[1].AddReason {
+		t.Errorf("unexpected locks: %+v", read)
+	}
+
+	if err := os.WriteFile(path, []byte("bad line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadHubLockFile(path, "\t"); err == nil {
+		t.Error("expected error for ill-format lock file")
+	}
+}
+
+func TestPinRepoAndApplyLock(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	root := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(root, "gitconfig"))
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@test")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@test")
+
+	git := func(dir string, args ...string) string {
+		c := exec.Command("git", args...)
+		c.Dir = dir
+		out, err := c.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+
+	bare := filepath.Join(root, "mods.git")
+	work := filepath.Join(root, "work")
+	git(root, "init", "-q", "--bare", bare)
+	git(root, "clone", "-q", bare, work)
+	write := func(content string) {
+		if err := os.WriteFile(filepath.Join(work, "version"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("v1")
+	git(work, "add", "-A")
+	git(work, "commit", "-qm", "v1")
+	git(work, "tag", "v1")
+	v1 := git(work, "rev-parse", "HEAD")
+	write("v2")
+	git(work, "commit", "-qam", "v2")
+	git(work, "push", "-q", "origin", "HEAD:master", "--tags")
+	git(bare, "symbolic-ref", "HEAD", "refs/heads/master")
+	v2 := git(work, "rev-parse", "HEAD")
+
+	screen := display.NewCacheScreen()
+	env := model.NewEnv()
+	cmd := model.ParsedCmd{}
+	hub := filepath.Join(root, "hub")
+	repoPath, _ := GetRepoPath(hub, RepoAddr{Addr: bare})
+
+	head := func() string {
+		commit, err := GetRepoHeadCommit(repoPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return commit
+	}
+
+	// Clone with a pin
+	pinned := RepoAddr{Addr: bare, Ref: "v1"}
+	if _, _, _, err := UpdateRepoAndSubRepos(screen, env, map[string]bool{}, hub, pinned, "", "hub.ticat", "ticat", cmd); err != nil {
+		t.Fatal(err)
+	}
+	if head() != v1 {
+		t.Errorf("expect pinned to v1")
+	}
+	// Update keeps the pin
+	if _, _, _, err := UpdateRepoAndSubRepos(screen, env, map[string]bool{}, hub, pinned, "", "hub.ticat", "ticat", cmd); err != nil {
+		t.Fatal(err)
+	}
+	if head() != v1 {
+		t.Errorf("expect still pinned to v1 after update")
+	}
+	// Unpin, back to the branch
+	if _, _, _, err := UpdateRepoAndSubRepos(screen, env, map[string]bool{}, hub, RepoAddr{Addr: bare}, "", "hub.ticat", "ticat", cmd); err != nil {
+		t.Fatal(err)
+	}
+	if head() != v2 {
+		t.Errorf("expect following master after unpinned")
+	}
+
+	locks, err := GenHubLock([]RepoInfo{{Addr: RepoAddr{Addr: bare}, Path: repoPath, OnOff: "on"}})
+	if err != nil || len(locks) != 1 || locks[0].Commit != v2 {
+		t.Fatalf("unexpected locks: %+v, %v", locks, err)
+	}
+
+	// Apply a lock to another hub
+	otherHub := filepath.Join(root, "other-hub")
+	locks[0].Commit = v1
+	otherPath, err := CheckoutRepoToLock(screen, env, otherHub, locks[0], cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit, _ := GetRepoHeadCommit(otherPath); commit != v1 {
+		t.Errorf("expect the other hub at the locked commit")
+	}
+}
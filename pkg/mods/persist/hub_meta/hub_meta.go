@@ -11,26 +11,53 @@ import (
 type RepoAddr struct {
 	Addr   string
 	Branch string
+	// A tag or commit the repo pinned to, empty means following the branch
+	Ref string
 }
 
 func (self RepoAddr) Str() string {
 	if len(self.Addr) == 0 {
 		return self.Addr
 	}
-	if len(self.Branch) == 0 {
-		return self.Addr
+	str := self.Addr
+	if len(self.Branch) != 0 {
+		str += RepoAddrBranchSep + self.Branch
+	}
+	if len(self.Ref) != 0 {
+		str += RepoAddrRefSep + self.Ref
+	}
+	return str
+}
+
+// Key identifies a repo, the pinned ref is not included, so re-pinning won't make it a new repo,
+// and the version of a file repo is not included either
+func (self RepoAddr) Key() string {
+	if self.IsFile() {
+		return fileRepoKey(self)
 	}
-	return self.Addr + RepoAddrBranchSep + self.Branch
+	return RepoAddr{self.Addr, self.Branch, ""}.Str()
+}
+
+func (self RepoAddr) IsPinned() bool {
+	return len(self.Ref) != 0
 }
 
 func ParseRepoAddr(addr string) RepoAddr {
+	// The ref sep '@' is also in ssh address like 'git@github.com:user/repo',
+	// so it's a ref sep only if it's in the last path segment
+	ref := ""
+	i := strings.LastIndex(addr, RepoAddrRefSep)
+	if i > 0 && i > strings.LastIndex(addr, "/") && i > strings.LastIndex(addr, ":") {
+		ref = addr[i+1:]
+		addr = addr[:i]
+	}
 	branch := ""
-	i := strings.LastIndex(addr, RepoAddrBranchSep)
+	i = strings.LastIndex(addr, RepoAddrBranchSep)
 	if i > 0 {
 		branch = addr[i+1:]
 		addr = addr[:i]
 	}
-	return RepoAddr{addr, branch}
+	return RepoAddr{addr, branch, ref}
 }
 
 type RepoInfo struct {
@@ -39,6 +66,8 @@ type RepoInfo struct {
 	Path      string
 	HelpStr   string
 	OnOff     string
+	// The cmd path prefix all cmds of this repo registered under, empty means the root
+	Mount string
 }
 
 func (self RepoInfo) IsLocal() bool {
@@ -65,8 +94,13 @@ func WriteReposInfoFile(
 	}()
 
 	for _, info := range infos {
-		_, err = fmt.Fprintf(file, "%s%s%s%s%s%s%s%s%s\n", info.Addr.Str(), sep, info.AddReason, sep,
+		line := fmt.Sprintf("%s%s%s%s%s%s%s%s%s", info.Addr.Str(), sep, info.AddReason, sep,
 			tryConvAbsPathToRelPath(hubRootPath, info.Path), sep, info.HelpStr, sep, info.OnOff)
+		// The mount field is optional, so the file could still be read by old versions if no repo is mounted
+		if len(info.Mount) != 0 {
+			line += sep + info.Mount
+		}
+		_, err = fmt.Fprintln(file, line)
 		if err != nil {
 			return fmt.Errorf("[WriteReposInfoFile] write file '%s' failed: %v", tmp, err)
 		}
@@ -113,7 +147,7 @@ func ReadReposInfoFile(
 	for scanner.Scan() {
 		line := strings.Trim(scanner.Text(), "\n\r")
 		fields := strings.Split(line, sep)
-		if len(fields) != 5 {
+		if len(fields) != 5 && len(fields) != 6 {
 			err = fmt.Errorf("[ReadReposInfoFile] file '%s' line '%s' can't be parsed",
 				path, line)
 			return
@@ -124,9 +158,13 @@ func ReadReposInfoFile(
 			tryConvRelPathToAbsPath(hubRootPath, fields[2]),
 			fields[3],
 			fields[4],
+			"",
+		}
+		if len(fields) == 6 {
+			info.Mount = fields[5]
 		}
 		infos = append(infos, info)
-		list[info.Addr.Str()] = true
+		list[info.Addr.Key()] = true
 	}
 	return
 }
@@ -173,5 +211,6 @@ func ExtractAddrFromList(
 
 const (
 	RepoAddrBranchSep = "#"
+	RepoAddrRefSep    = "@"
 	HubRootPathMark   = "<hub>:"
 )
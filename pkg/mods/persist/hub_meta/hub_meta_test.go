@@ -3,6 +3,7 @@ package hub_meta
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -165,3 +166,61 @@ func TestReadReposInfoFile_NotExistError(t *testing.T) {
 		t.Error("expected error for non-existent file when allowNotExist is false")
 	}
 }
+
+func TestReposInfoFile_Mount(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "hub_meta_test")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	hubDir := filepath.Join(tmpDir, "hub")
+	metaPath := filepath.Join(hubDir, "repos.hub")
+
+	infos := []RepoInfo{
+		{
+			Addr:      ParseRepoAddr("https://github.com/test/repo1"),
+			AddReason: "test",
+			Path:      "/path/to/repo1",
+			HelpStr:   "test repo 1",
+			OnOff:     "on",
+			Mount:     "team.sub",
+		},
+		{
+			Addr:      ParseRepoAddr("https://github.com/test/repo2"),
+			AddReason: "test",
+			Path:      "/path/to/repo2",
+			HelpStr:   "test repo 2",
+			OnOff:     "on",
+		},
+	}
+
+	if err := WriteReposInfoFile(hubDir, metaPath, infos, "|"); err != nil {
+		t.Fatalf("WriteReposInfoFile failed: %v", err)
+	}
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		t.Fatalf("failed to read repos.hub: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	if strings.Count(lines[1], "|") != 4 {
+		t.Errorf("expected the line without mount in the old format, got %q", lines[1])
+	}
+
+	readInfos, _, err := ReadReposInfoFile(hubDir, metaPath, false, "|")
+	if err != nil {
+		t.Fatalf("ReadReposInfoFile failed: %v", err)
+	}
+	if len(readInfos) != 2 {
+		t.Fatalf("expected 2 infos, got %d", len(readInfos))
+	}
+	if readInfos[0].Mount != "team.sub" {
+		t.Errorf("expected mount 'team.sub', got '%s'", readInfos[0].Mount)
+	}
+	if readInfos[1].Mount != "" {
+		t.Errorf("expected empty mount, got '%s'", readInfos[1].Mount)
+	}
+}
@@ -0,0 +1,102 @@
+package hub_meta
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HubPriorities are the rules deciding the winner when repos define the same command
+type HubPriorities struct {
+	// Repo key => level, the higher one wins
+	RepoLevels map[string]int
+	// Cmd path => repo key of the winner
+	CmdRepos map[string]string
+}
+
+const (
+	hubPriorityRepoMark = "repo"
+	hubPriorityCmdMark  = "cmd"
+)
+
+func NewHubPriorities() HubPriorities {
+	return HubPriorities{map[string]int{}, map[string]string{}}
+}
+
+// RepoPriorityKey is the key of a repo in the priority rules, the branch is included but the pinned ref is not
+func RepoPriorityKey(info RepoInfo) string {
+	if info.IsLocal() {
+		return info.Path
+	}
+	return info.Addr.Key()
+}
+
+func WriteHubPriorityFile(path string, priorities HubPriorities, sep string) error {
+	var lines []string
+	for key, level := range priorities.RepoLevels {
+		lines = append(lines, hubPriorityRepoMark+sep+key+sep+strconv.Itoa(level))
+	}
+	for cmdPath, key := range priorities.CmdRepos {
+		lines = append(lines, hubPriorityCmdMark+sep+cmdPath+sep+key)
+	}
+	sort.Strings(lines)
+
+	var buf strings.Builder
+	for _, line := range lines {
+		buf.WriteString(line + "\n")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0644); err != nil {
+		return fmt.Errorf("[WriteHubPriorityFile] write file '%s' failed: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("[WriteHubPriorityFile] rename file '%s' to '%s' failed: %v", tmp, path, err)
+	}
+	return nil
+}
+
+// ReadHubPriorityFile returns empty rules if the file not exists
+func ReadHubPriorityFile(path string, sep string) (priorities HubPriorities, err error) {
+	priorities = NewHubPriorities()
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return priorities, nil
+		}
+		return priorities, fmt.Errorf("[ReadHubPriorityFile] open file '%s' failed: %v", path, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.Trim(scanner.Text(), "\n\r")
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.Split(line, sep)
+		if len(fields) != 3 || len(fields[1]) == 0 || len(fields[2]) == 0 {
+			return priorities, fmt.Errorf("[ReadHubPriorityFile] file '%s' line '%s' can't be parsed", path, line)
+		}
+		switch fields[0] {
+		case hubPriorityRepoMark:
+			level, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return priorities, fmt.Errorf("[ReadHubPriorityFile] file '%s' line '%s' has bad level: %v", path, line, err)
+			}
+			priorities.RepoLevels[fields[1]] = level
+		case hubPriorityCmdMark:
+			priorities.CmdRepos[fields[1]] = fields[2]
+		default:
+			return priorities, fmt.Errorf("[ReadHubPriorityFile] file '%s' line '%s' has unknown type '%s'", path, line, fields[0])
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return priorities, fmt.Errorf("[ReadHubPriorityFile] read file '%s' failed: %v", path, err)
+	}
+	return
+}
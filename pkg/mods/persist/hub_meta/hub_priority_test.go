@@ -0,0 +1,39 @@
+package hub_meta
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHubPriorityFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "priority.hub")
+	priorities, err := ReadHubPriorityFile(path, "\t")
+	if err != nil || len(priorities.RepoLevels) != 0 || len(priorities.CmdRepos) != 0 {
+		t.Fatalf("expect empty rules if file not exists: %+v, %v", priorities, err)
+	}
+
+	git := RepoInfo{Addr: ParseRepoAddr("https://github.com/a/b#dev@v1")}
+	local := RepoInfo{Path: "/tmp/mods"}
+	priorities.RepoLevels[RepoPriorityKey(git)] = 10
+	priorities.RepoLevels[RepoPriorityKey(local)] = -1
+	priorities.CmdRepos["x.y"] = RepoPriorityKey(local)
+	if err := WriteHubPriorityFile(path, priorities, "\t"); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadHubPriorityFile(path, "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.RepoLevels["https://github.com/a/b#dev"] != 10 || read.RepoLevels["/tmp/mods"] != -1 ||
+		read.CmdRepos["x.y"] != "/tmp/mods" {
+		t.Errorf("unexpected rules: %+v", read)
+	}
+
+	if err := os.WriteFile(path, []byte("repo\tx\tnot-a-number\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadHubPriorityFile(path, "\t"); err == nil {
+		t.Error("expect error for bad level")
+	}
+}
@@ -2,6 +2,7 @@ package hub_meta
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 	"github.com/innerr/ticat/pkg/core/model"
 )
 
+// UpdateRepoAndSubRepos updates a repo and the sub repos listed in it with the default concurrency
 func UpdateRepoAndSubRepos(
 	screen model.Screen,
 	env *model.Env,
@@ -22,40 +24,20 @@ func UpdateRepoAndSubRepos(
 	selfName string,
 	cmd model.ParsedCmd) (topRepoHelpStr string, addrs []RepoAddr, helpStrs []string, err error) {
 
-	if finisheds[gitAddr.Str()] {
-		return
-	}
-	topRepoHelpStr, addrs, helpStrs, err = updateRepoAndReadSubList(
-		screen, env, hubPath, gitAddr, listFileName, selfName, cmd)
-	if err != nil {
-		return
-	}
-	finisheds[gitAddr.Str()] = true
-
-	for i, addr := range addrs {
-		var subTopHelpStr string
-		var subAddrs []RepoAddr
-		var subHelpStrs []string
-		subTopHelpStr, subAddrs, subHelpStrs, err = UpdateRepoAndSubRepos(
-			screen, env, finisheds, hubPath, addr, repoExt, listFileName, selfName, cmd)
-		if err != nil {
-			return
-		}
-		// If a repo has no help-str from hub-repo list, try to get the title from it's README
-		if len(helpStrs[i]) == 0 && len(subTopHelpStr) != 0 {
-			helpStrs[i] = subTopHelpStr
-		}
-		addrs = append(addrs, subAddrs...)
-		helpStrs = append(helpStrs, subHelpStrs...)
-	}
-
-	return topRepoHelpStr, addrs, helpStrs, nil
+	updater := NewRepoUpdater(screen, env, finisheds, hubPath, listFileName, selfName,
+		DefaultRepoUpdateConcurrency, cmd)
+	updater.Start(gitAddr)
+	updater.Wait()
+	return updater.Collect(gitAddr)
 }
 
 func NormalizeGitAddr(addr string) string {
 	if len(addr) == 0 {
 		return addr
 	}
+	if strings.HasPrefix(addr, FileRepoAddrPrefix) {
+		return NormalizeFileRepoAddr(addr)
+	}
 	if strings.HasPrefix(strings.ToLower(addr), "http") {
 		return addr
 	}
@@ -77,10 +59,13 @@ func AddrDisplayName(addr RepoAddr) string {
 	if len(abbr) == 0 {
 		return addr.Str()
 	}
-	return RepoAddr{abbr, addr.Branch}.Str()
+	return RepoAddr{abbr, addr.Branch, addr.Ref}.Str()
 }
 
 func GetRepoPath(hubPath string, originGitAddr RepoAddr) (string, error) {
+	if originGitAddr.IsFile() {
+		return getFileRepoPath(hubPath, originGitAddr)
+	}
 	addr := strings.ToLower(originGitAddr.Addr)
 	for _, prefix := range []string{"http://", "https://"} {
 		addr = strings.TrimPrefix(addr, prefix)
@@ -149,57 +134,95 @@ func CheckRepoGitStatus(
 	return nil
 }
 
-func updateRepoAndReadSubList(
-	screen model.Screen,
-	env *model.Env,
-	hubPath string,
-	gitAddr RepoAddr,
-	listFileName string,
-	selfName string,
-	cmd model.ParsedCmd) (helpStr string, addrs []RepoAddr, helpStrs []string, err error) {
-
-	name := AddrDisplayName(gitAddr)
-	repoPath, err := GetRepoPath(hubPath, gitAddr)
-	if err != nil {
-		return
-	}
-	var cmdStrs []string
-
+// updateRepo clones or pulls the repo, or fetches it if it's pinned, the git output goes to 'out' (or the terminal if it's nil)
+func updateRepo(out io.Writer, repoPath string, gitAddr RepoAddr, cmd model.ParsedCmd) (cloned bool, err error) {
 	stat, statErr := os.Stat(repoPath)
-	var pwd string
 	if !os.IsNotExist(statErr) {
 		if !stat.IsDir() {
 			err = model.WrapCmdError(cmd, fmt.Errorf("repo path '%v' exists but is not dir",
 				repoPath))
 			return
 		}
-		_ = screen.Print(fmt.Sprintf(display.ColorHub("[%s]", env)+display.ColorSymbol(" => ", env)+
-			"git update\n", name))
-		cmdStrs = []string{"git", "pull", "--recurse-submodules"}
-		pwd = repoPath
+		if gitAddr.IsPinned() {
+			err = runGitCmd(repoPath, cmd, out, "git", "fetch", "--tags", "--recurse-submodules", "origin")
+		} else {
+			// The repo may be detached by a pin before (or by 'hub.lock.apply'), back to the branch to pull
+			err = checkoutBranchIfDetached(repoPath, gitAddr, cmd, out)
+			if err == nil {
+				err = runGitCmd(repoPath, cmd, out, "git", "pull", "--recurse-submodules")
+			}
+		}
 	} else {
-		_ = screen.Print(fmt.Sprintf(display.ColorHub("[%s]", env)+display.ColorSymbol(" => ", env)+
-			"git clone\n", name))
-		cmdStrs = []string{"git", "clone", "--recursive", gitAddr.Addr}
-		if len(gitAddr.Branch) != 0 {
-			cmdStrs = append(cmdStrs, "-b", gitAddr.Branch)
+		cloned = true
+		err = cloneRepo(repoPath, gitAddr, cmd, out)
+	}
+	if err != nil {
+		return
+	}
+
+	if gitAddr.IsPinned() {
+		err = checkoutRepoRef(repoPath, gitAddr.Ref, cmd, out)
+	}
+	return
+}
+
+func cloneRepo(repoPath string, gitAddr RepoAddr, cmd model.ParsedCmd, out io.Writer) error {
+	cmdStrs := []string{"git", "clone", "--recursive", gitAddr.Addr}
+	if len(gitAddr.Branch) != 0 {
+		cmdStrs = append(cmdStrs, "-b", gitAddr.Branch)
+	}
+	cmdStrs = append(cmdStrs, repoPath)
+	return runGitCmd("", cmd, out, cmdStrs...)
+}
+
+// checkoutRepoRef checks out a tag or commit in detached mode, and the submodules too
+func checkoutRepoRef(repoPath string, ref string, cmd model.ParsedCmd, out io.Writer) error {
+	err := runGitCmd(repoPath, cmd, out, "git", "-c", "advice.detachedHead=false", "checkout", "--detach", ref)
+	if err != nil {
+		return err
+	}
+	return runGitCmd(repoPath, cmd, out, "git", "submodule", "update", "--init", "--recursive")
+}
+
+func checkoutBranchIfDetached(repoPath string, gitAddr RepoAddr, cmd model.ParsedCmd, out io.Writer) error {
+	c := exec.Command("git", "symbolic-ref", "-q", "HEAD")
+	c.Dir = repoPath
+	if c.Run() == nil {
+		return nil
+	}
+	branch := gitAddr.Branch
+	if len(branch) == 0 {
+		c = exec.Command("git", "rev-parse", "--abbrev-ref", "origin/HEAD")
+		c.Dir = repoPath
+		out, err := c.Output()
+		if err != nil {
+			return model.WrapCmdError(cmd, fmt.Errorf("repo '%s' is detached and its default branch is unknown: %v",
+				repoPath, err))
 		}
-		cmdStrs = append(cmdStrs, repoPath)
+		branch = strings.TrimPrefix(strings.TrimSpace(string(out)), "origin/")
 	}
+	return runGitCmd(repoPath, cmd, out, "git", "checkout", branch)
+}
 
+// runGitCmd runs git with the output to 'out', or to the terminal if it's nil.
+// The terminal prompts are disabled if the output is captured, they can't be answered when updating concurrently
+func runGitCmd(dir string, cmd model.ParsedCmd, out io.Writer, cmdStrs ...string) error {
 	c := exec.Command(cmdStrs[0], cmdStrs[1:]...)
-	if len(pwd) != 0 {
-		c.Dir = pwd
+	if len(dir) != 0 {
+		c.Dir = dir
 	}
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	runErr := c.Run()
-	if runErr != nil {
-		err = model.WrapCmdError(cmd, fmt.Errorf("run '%v' failed: %v", cmdStrs, runErr))
-		return
+	if out == nil {
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+	} else {
+		c.Stdout = out
+		c.Stderr = out
+		c.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
 	}
-	listFilePath := filepath.Join(repoPath, listFileName)
-	return ReadRepoListFromFile(selfName, listFilePath)
+	if err := c.Run(); err != nil {
+		return model.WrapCmdError(cmd, fmt.Errorf("run '%v' failed: %v", cmdStrs, err))
+	}
+	return nil
 }
 
 func githubAddrAbbr(addr string) (abbr string) {
@@ -0,0 +1,347 @@
+package hub_meta
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// HubSum is the integrity manifest of a repo: relative path (with '/') => sha256 of the file.
+// All files in the repo are listed, except the hidden ones and the manifest files themselves.
+type HubSum map[string]string
+
+// GenHubSum hashes the files in the dir, the hidden files and dirs are skipped the same as loading mods
+func GenHubSum(dir string, skipNames ...string) (HubSum, error) {
+	sum := HubSum{}
+	skips := map[string]bool{}
+	for _, name := range skipNames {
+		skips[name] = true
+	}
+	err := walkHubSumFiles(dir, func(rel string, path string, info fs.FileInfo) error {
+		if skips[rel] {
+			return nil
+		}
+		hash, err := hashFile(path, info)
+		if err != nil {
+			return err
+		}
+		sum[rel] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("[GenHubSum] hash files in '%s' failed: %v", dir, err)
+	}
+	return sum, nil
+}
+
+// walkHubSumFiles calls 'fn' for the non-hidden files in the dir, 'rel' is the relative path with '/'
+func walkHubSumFiles(dir string, fn func(rel string, path string, info fs.FileInfo) error) error {
+	return filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		base := filepath.Base(path)
+		if path != dir && len(base) > 0 && base[0] == '.' {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), path, info)
+	})
+}
+
+// hashFile hashes the content of a file, or the target of a symlink
+func hashFile(path string, info fs.FileInfo) (string, error) {
+	hash := sha256.New()
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return "", err
+		}
+		_, _ = hash.Write([]byte("symlink:" + target))
+	} else {
+		file, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		if _, err = io.Copy(hash, file); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Encode returns the content of the manifest file, the lines are sorted so the content is stable for signing
+func (self HubSum) Encode(sep string) []byte {
+	var paths []string
+	for path := range self {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var buf bytes.Buffer
+	for _, path := range paths {
+		buf.WriteString(self[path] + sep + path + "\n")
+	}
+	return buf.Bytes()
+}
+
+func ParseHubSum(data []byte, sep string) (HubSum, error) {
+	sum := HubSum{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.Trim(scanner.Text(), "\n\r")
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.SplitN(line, sep, 2)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 || len(fields[1]) == 0 {
+			return nil, fmt.Errorf("[ParseHubSum] line '%s' can't be parsed", line)
+		}
+		sum[fields[1]] = fields[0]
+	}
+	return sum, scanner.Err()
+}
+
+// SignHubSum signs the content of the manifest file, returns the content of the signature file
+func SignHubSum(sumData []byte, key ed25519.PrivateKey, sep string) []byte {
+	pub := key.Public().(ed25519.PublicKey)
+	sig := ed25519.Sign(key, sumData)
+	return []byte(hex.EncodeToString(pub) + sep + hex.EncodeToString(sig) + "\n")
+}
+
+// ParseHubSumSig returns the public key and the signature in the signature file
+func ParseHubSumSig(data []byte, sep string) (ed25519.PublicKey, []byte, error) {
+	fields := strings.Split(strings.TrimSpace(string(data)), sep)
+	if len(fields) != 2 {
+		return nil, nil, fmt.Errorf("[ParseHubSumSig] bad signature file format")
+	}
+	pub, err := ParseEd25519PublicKey(fields[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	sig, err := hex.DecodeString(fields[1])
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, nil, fmt.Errorf("[ParseHubSumSig] bad signature '%s'", fields[1])
+	}
+	return pub, sig, nil
+}
+
+func ParseEd25519PublicKey(str string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(str))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("[ParseEd25519PublicKey] '%s' is not a hex ed25519 public key", str)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// ParseEd25519PrivateKey accepts the hex of a seed or a full private key
+func ParseEd25519PrivateKey(str string) (ed25519.PrivateKey, error) {
+	key, err := hex.DecodeString(strings.TrimSpace(str))
+	if err != nil {
+		return nil, fmt.Errorf("[ParseEd25519PrivateKey] private key is not hex: %v", err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	}
+	return nil, fmt.Errorf("[ParseEd25519PrivateKey] private key length %d is not an ed25519 seed or key", len(key))
+}
+
+// HubTrustedKeys are the public keys trusted by the user: name => hex public key
+type HubTrustedKeys map[string]string
+
+// Find returns the name of the trusted key, empty if not trusted
+func (self HubTrustedKeys) Find(key ed25519.PublicKey) string {
+	str := hex.EncodeToString(key)
+	for name, it := range self {
+		if it == str {
+			return name
+		}
+	}
+	return ""
+}
+
+func WriteHubTrustFile(path string, keys HubTrustedKeys, sep string) error {
+	var lines []string
+	for name, key := range keys {
+		lines = append(lines, name+sep+key)
+	}
+	sort.Strings(lines)
+
+	var buf strings.Builder
+	for _, line := range lines {
+		buf.WriteString(line + "\n")
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(buf.String()), 0644); err != nil {
+		return fmt.Errorf("[WriteHubTrustFile] write file '%s' failed: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("[WriteHubTrustFile] rename file '%s' to '%s' failed: %v", tmp, path, err)
+	}
+	return nil
+}
+
+// ReadHubTrustFile returns empty keys if the file not exists
+func ReadHubTrustFile(path string, sep string) (HubTrustedKeys, error) {
+	keys := HubTrustedKeys{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return keys, nil
+		}
+		return keys, fmt.Errorf("[ReadHubTrustFile] read file '%s' failed: %v", path, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.Trim(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+		fields := strings.Split(line, sep)
+		if len(fields) != 2 || len(fields[0]) == 0 {
+			return keys, fmt.Errorf("[ReadHubTrustFile] file '%s' line '%s' can't be parsed", path, line)
+		}
+		if _, err := ParseEd25519PublicKey(fields[1]); err != nil {
+			return keys, fmt.Errorf("[ReadHubTrustFile] file '%s' line '%s' has bad key: %v", path, line, err)
+		}
+		keys[fields[0]] = fields[1]
+	}
+	return keys, nil
+}
+
+// HubVerifyResult is the integrity check result of a repo
+type HubVerifyResult struct {
+	HasSum   bool
+	Changed  []string
+	Missing  []string
+	Unlisted []string
+	Signed   bool
+	// Hex public key of the signer
+	Signer string
+	// The name of the trusted key of the signer, empty if not trusted
+	TrustedBy string
+	BadSig    bool
+}
+
+// Tampered returns true if the files not match the manifest, or the signature is invalid
+func (self HubVerifyResult) Tampered() bool {
+	return len(self.Changed) != 0 || len(self.Missing) != 0 || len(self.Unlisted) != 0 || self.BadSig
+}
+
+// Problems describes the reasons of failure, 'requireTrusted' means unsigned or untrusted repos also fail
+func (self HubVerifyResult) Problems(requireTrusted bool) (problems []string) {
+	if !self.HasSum {
+		if requireTrusted {
+			problems = append(problems, "no integrity manifest")
+		}
+		return
+	}
+	describe := func(files []string, desc string) {
+		if len(files) == 0 {
+			return
+		}
+		str := fmt.Sprintf("%d files %s: %s", len(files), desc, strings.Join(files, ", "))
+		if len(files) > 3 {
+			str = fmt.Sprintf("%d files %s: %s, ...", len(files), desc, strings.Join(files[:3], ", "))
+		}
+		problems = append(problems, str)
+	}
+	describe(self.Changed, "changed")
+	describe(self.Missing, "missing")
+	describe(self.Unlisted, "not in manifest")
+	if self.BadSig {
+		problems = append(problems, "the signature of the manifest is invalid")
+	} else if requireTrusted {
+		if !self.Signed {
+			problems = append(problems, "the manifest is not signed")
+		} else if len(self.TrustedBy) == 0 {
+			problems = append(problems, "the manifest is signed by an untrusted key "+self.Signer)
+		}
+	}
+	return
+}
+
+// VerifyHubSum checks the files in the dir with the manifest and the signature
+func VerifyHubSum(
+	dir string,
+	sumFileName string,
+	sigFileName string,
+	trusted HubTrustedKeys,
+	sep string) (result HubVerifyResult, err error) {
+
+	sumData, err := os.ReadFile(filepath.Join(dir, sumFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return result, fmt.Errorf("[VerifyHubSum] read manifest of '%s' failed: %v", dir, err)
+	}
+	result.HasSum = true
+	expected, err := ParseHubSum(sumData, sep)
+	if err != nil {
+		return result, fmt.Errorf("[VerifyHubSum] parse manifest of '%s' failed: %v", dir, err)
+	}
+	actual, err := GenHubSum(dir, sumFileName, sigFileName)
+	if err != nil {
+		return result, err
+	}
+	for path, hash := range expected {
+		actualHash, ok := actual[path]
+		if !ok {
+			result.Missing = append(result.Missing, path)
+		} else if actualHash != hash {
+			result.Changed = append(result.Changed, path)
+		}
+	}
+	for path := range actual {
+		if _, ok := expected[path]; !ok {
+			result.Unlisted = append(result.Unlisted, path)
+		}
+	}
+	sort.Strings(result.Changed)
+	sort.Strings(result.Missing)
+	sort.Strings(result.Unlisted)
+
+	sigData, err := os.ReadFile(filepath.Join(dir, sigFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return result, fmt.Errorf("[VerifyHubSum] read signature of '%s' failed: %v", dir, err)
+	}
+	result.Signed = true
+	pub, sig, err := ParseHubSumSig(sigData, sep)
+	if err != nil {
+		result.BadSig = true
+		return result, nil
+	}
+	result.Signer = hex.EncodeToString(pub)
+	if !ed25519.Verify(pub, sumData, sig) {
+		result.BadSig = true
+		return result, nil
+	}
+	result.TrustedBy = trusted.Find(pub)
+	return result, nil
+}
@@ -0,0 +1,148 @@
+package hub_meta
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyHubSum(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("run.bash", "echo run\n")
+	write("run.bash.ticat", "help = run\n")
+	write("sub/flow.tiflow", "flow = run\n")
+	write(".git/HEAD", "ref: refs/heads/main\n")
+
+	seed := make([]byte, ed25519.SeedSize)
+	key := ed25519.NewKeyFromSeed(seed)
+	pub := hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	trusted := HubTrustedKeys{"me": pub}
+
+	sign := func(key ed25519.PrivateKey) {
+		sum, err := GenHubSum(dir, "hub.sum", "hub.sum.sig")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := sum.Encode("\t")
+		write("hub.sum", string(data))
+		if key != nil {
+			write("hub.sum.sig", string(SignHubSum(data, key, "\t")))
+		}
+	}
+	verify := func() HubVerifyResult {
+		result, err := VerifyHubSum(dir, "hub.sum", "hub.sum.sig", trusted, "\t")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := verify()
+	if result.HasSum || len(result.Problems(false)) != 0 || len(result.Problems(true)) != 1 {
+		t.Errorf("unexpected result without manifest: %+v", result)
+	}
+
+	sign(nil)
+	sum, err := ParseHubSum([]byte(readFile(t, filepath.Join(dir, "hub.sum"))), "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sum) != 3 || len(sum["sub/flow.tiflow"]) == 0 {
+		t.Errorf("hidden dirs should be skipped and the others listed: %v", sum)
+	}
+	result = verify()
+	if !result.HasSum || result.Tampered() || len(result.Problems(false)) != 0 {
+		t.Errorf("expect unchanged: %+v", result)
+	}
+	if !reflect.DeepEqual(result.Problems(true), []string{"the manifest is not signed"}) {
+		t.Errorf("expect unsigned in strict mode: %v", result.Problems(true))
+	}
+
+	sign(key)
+	result = verify()
+	if !result.Signed || result.BadSig || result.TrustedBy != "me" || len(result.Problems(true)) != 0 {
+		t.Errorf("expect signed by trusted key: %+v", result)
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		write("run.bash", "rm -rf ~\n")
+		write("sub/new.bash", "echo new\n")
+		if err := os.Remove(filepath.Join(dir, "sub/flow.tiflow")); err != nil {
+			t.Fatal(err)
+		}
+		result := verify()
+		if !result.Tampered() || !reflect.DeepEqual(result.Changed, []string{"run.bash"}) ||
+			!reflect.DeepEqual(result.Missing, []string{"sub/flow.tiflow"}) ||
+			!reflect.DeepEqual(result.Unlisted, []string{"sub/new.bash"}) {
+			t.Errorf("unexpected result: %+v", result)
+		}
+
+		// Regenerating the manifest without the key breaks the signature
+		sum, err := GenHubSum(dir, "hub.sum", "hub.sum.sig")
+		if err != nil {
+			t.Fatal(err)
+		}
+		write("hub.sum", string(sum.Encode("\t")))
+		result = verify()
+		if !result.BadSig || !result.Tampered() {
+			t.Errorf("expect bad signature: %+v", result)
+		}
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		seed[0] = 1
+		sign(ed25519.NewKeyFromSeed(seed))
+		result := verify()
+		if result.Tampered() || len(result.TrustedBy) != 0 || len(result.Problems(true)) != 1 {
+			t.Errorf("expect untrusted signer: %+v", result)
+		}
+	})
+}
+
+func TestHubTrustFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trust.hub")
+	keys, err := ReadHubTrustFile(path, "\t")
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("expect empty keys if file not exists: %v, %v", keys, err)
+	}
+	key, err := ParseEd25519PrivateKey(hex.EncodeToString(make([]byte, ed25519.SeedSize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	keys["me"] = hex.EncodeToString(pub)
+	if err := WriteHubTrustFile(path, keys, "\t"); err != nil {
+		t.Fatal(err)
+	}
+	keys, err = ReadHubTrustFile(path, "\t")
+	if err != nil || keys.Find(pub) != "me" {
+		t.Errorf("unexpected keys: %v, %v", keys, err)
+	}
+
+	if err := os.WriteFile(path, []byte("bad\tnot-a-key\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadHubTrustFile(path, "\t"); err == nil {
+		t.Error("expect error for bad key")
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
@@ -0,0 +1,79 @@
+package hub_meta
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// HubVerifyCache is the integrity check result of a repo when its files are with the stamp,
+// so the repos are not hashed on every loading, see 'HubSumStamp'
+type HubVerifyCache struct {
+	Stamp  string
+	Result HubVerifyResult
+}
+
+// HubSumStamp sums up the paths, sizes and mtimes of the files checked by 'VerifyHubSum' (and the manifest files),
+// it's much cheaper than hashing the contents. The trusted keys are also summed up, they affect the result.
+// The stats could be forged (eg: 'touch -r'), the stamp is only for the non-refusing checks.
+func HubSumStamp(dir string, trusted HubTrustedKeys) (string, error) {
+	hash := sha256.New()
+	var names []string
+	for name := range trusted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, _ = hash.Write([]byte(name + "\t" + trusted[name] + "\n"))
+	}
+	err := walkHubSumFiles(dir, func(rel string, path string, info fs.FileInfo) error {
+		_, _ = hash.Write([]byte(rel + "\t" + info.Mode().String() + "\t" + strconv.FormatInt(info.Size(), 10) +
+			"\t" + strconv.FormatInt(info.ModTime().UnixNano(), 10) + "\n"))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("[HubSumStamp] scan dir '%s' failed: %v", dir, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// HubVerifyCacheFileName returns the cache file name of a repo dir
+func HubVerifyCacheFileName(dir string) string {
+	sum := sha256.Sum256([]byte(dir))
+	return hex.EncodeToString(sum[:8]) + ".json"
+}
+
+func ReadHubVerifyCache(path string) (cache HubVerifyCache, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache, err
+	}
+	if err = json.Unmarshal(data, &cache); err != nil {
+		return cache, fmt.Errorf("[ReadHubVerifyCache] parse file '%s' failed: %v", path, err)
+	}
+	return cache, nil
+}
+
+func WriteHubVerifyCache(path string, cache HubVerifyCache) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return fmt.Errorf("[WriteHubVerifyCache] encode failed: %v", err)
+	}
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("[WriteHubVerifyCache] create dir '%s' failed: %v", filepath.Dir(path), err)
+	}
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("[WriteHubVerifyCache] write file '%s' failed: %v", tmp, err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("[WriteHubVerifyCache] rename file '%s' to '%s' failed: %v", tmp, path, err)
+	}
+	return nil
+}
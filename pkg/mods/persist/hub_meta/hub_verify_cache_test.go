@@ -0,0 +1,51 @@
+package hub_meta
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHubSumStamp(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "run.bash")
+	if err := os.WriteFile(script, []byte("echo 1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	stamp, err := HubSumStamp(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := HubSumStamp(dir, nil); again != stamp {
+		t.Errorf("stamp should be stable")
+	}
+	if trusted, _ := HubSumStamp(dir, HubTrustedKeys{"a": "b"}); trusted == stamp {
+		t.Errorf("stamp should change when the trusted keys change")
+	}
+	if err := os.WriteFile(filepath.Join(dir, ".hidden"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if hidden, _ := HubSumStamp(dir, nil); hidden != stamp {
+		t.Errorf("hidden files are not verified, should not change the stamp")
+	}
+	if err := os.WriteFile(script, []byte("echo 2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(script, time.Now(), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _ := HubSumStamp(dir, nil); changed == stamp {
+		t.Errorf("stamp should change when a file changes")
+	}
+
+	cachePath := filepath.Join(t.TempDir(), "verify", HubVerifyCacheFileName(dir))
+	cache := HubVerifyCache{stamp, HubVerifyResult{HasSum: true, Changed: []string{"run.bash"}}}
+	if err := WriteHubVerifyCache(cachePath, cache); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadHubVerifyCache(cachePath)
+	if err != nil || read.Stamp != stamp || !read.Result.Tampered() {
+		t.Errorf("unexpected cache: %+v, %v", read, err)
+	}
+}
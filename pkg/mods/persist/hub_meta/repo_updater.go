@@ -0,0 +1,306 @@
+package hub_meta
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/innerr/ticat/pkg/cli/display"
+	"github.com/innerr/ticat/pkg/core/model"
+)
+
+const DefaultRepoUpdateConcurrency = 8
+
+const (
+	RepoCloned    = "cloned"
+	RepoUnpacked  = "unpacked"
+	RepoUpdated   = "updated"
+	RepoUnchanged = "unchanged"
+	RepoFailed    = "failed"
+)
+
+// RepoUpdateResult is the result of updating a repo, the git output is captured instead of printed
+type RepoUpdateResult struct {
+	Addr   RepoAddr
+	Status string
+	// The head commits before and after updating, 'From' is empty if the repo is cloned.
+	// For file repos, they are the versions if upgraded, otherwise the digests of the source
+	From   string
+	To     string
+	Output string
+	Err    error
+}
+
+// Reason returns the last line of the git output if failed, it's usually the most useful one
+func (self RepoUpdateResult) Reason() string {
+	if self.Err == nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(self.Output), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); len(last) != 0 {
+		return last
+	}
+	return self.Err.Error()
+}
+
+type updatingRepo struct {
+	// The address updated to, differs from the started one if it's a file repo upgraded to a newer version
+	addr       RepoAddr
+	topHelpStr string
+	addrs      []RepoAddr
+	helpStrs   []string
+	err        error
+}
+
+// RepoUpdater updates repos and the sub repos listed in them with bounded concurrency.
+// The sub repos are started as soon as the list of the parent repo is read,
+// then 'Collect' assembles the results in the same order as updating them one by one.
+type RepoUpdater struct {
+	screen       model.Screen
+	env          *model.Env
+	hubPath      string
+	listFileName string
+	selfName     string
+	cmd          model.ParsedCmd
+
+	// The repos (usually disabled ones) in it are not updated, and the collected ones are added to it
+	finisheds map[string]bool
+	// Upgrade the file repos to the newest versions in the source dir
+	upgradeFiles  bool
+	fileSourceDir string
+	workers       chan struct{}
+	wg            sync.WaitGroup
+
+	lock    sync.Mutex
+	repos   map[string]*updatingRepo
+	results []RepoUpdateResult
+}
+
+func NewRepoUpdater(
+	screen model.Screen,
+	env *model.Env,
+	finisheds map[string]bool,
+	hubPath string,
+	listFileName string,
+	selfName string,
+	concurrency int,
+	cmd model.ParsedCmd) *RepoUpdater {
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &RepoUpdater{
+		screen:       screen,
+		env:          env,
+		hubPath:      hubPath,
+		listFileName: listFileName,
+		selfName:     selfName,
+		cmd:          cmd,
+		finisheds:    finisheds,
+		workers:      make(chan struct{}, concurrency),
+		repos:        map[string]*updatingRepo{},
+	}
+}
+
+// UpgradeFileRepos enables upgrading the file repos to the newest versions in the source dir,
+// the dir of the current version is used if 'sourceDir' is empty
+func (self *RepoUpdater) UpgradeFileRepos(sourceDir string) {
+	self.upgradeFiles = true
+	self.fileSourceDir = sourceDir
+}
+
+// Start updates the repo and then its sub repos in background, the started ones are skipped
+func (self *RepoUpdater) Start(gitAddr RepoAddr) {
+	key := gitAddr.Key()
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.finisheds[key] || self.repos[key] != nil {
+		return
+	}
+	repo := &updatingRepo{addr: gitAddr}
+	self.repos[key] = repo
+	self.wg.Add(1)
+	go func() {
+		defer self.wg.Done()
+		self.workers <- struct{}{}
+		self.update(gitAddr, repo)
+		<-self.workers
+		if repo.err == nil {
+			for _, addr := range repo.addrs {
+				self.Start(addr)
+			}
+		}
+	}()
+}
+
+// Wait waits for all started repos and their sub repos, returns the results in finishing order
+func (self *RepoUpdater) Wait() []RepoUpdateResult {
+	self.wg.Wait()
+	return self.results
+}
+
+// Collect returns the sub repos of a started repo recursively, should be called after 'Wait'
+func (self *RepoUpdater) Collect(gitAddr RepoAddr) (topRepoHelpStr string, addrs []RepoAddr, helpStrs []string, err error) {
+	key := gitAddr.Key()
+	if self.finisheds[key] {
+		return
+	}
+	repo := self.repos[key]
+	if repo == nil {
+		// PANIC: Programming error - collecting a repo not started
+		panic(model.NewCmdError(self.cmd, fmt.Sprintf("repo '%s' is not started to update", gitAddr.Str())))
+	}
+	if repo.err != nil {
+		return "", nil, nil, repo.err
+	}
+	self.finisheds[key] = true
+
+	topRepoHelpStr = repo.topHelpStr
+	addrs = append([]RepoAddr{}, repo.addrs...)
+	helpStrs = append([]string{}, repo.helpStrs...)
+	for i, addr := range repo.addrs {
+		if addr.IsFile() {
+			addrs[i] = self.Resolved(addr)
+		}
+		var subTopHelpStr string
+		var subAddrs []RepoAddr
+		var subHelpStrs []string
+		subTopHelpStr, subAddrs, subHelpStrs, err = self.Collect(addr)
+		if err != nil {
+			return
+		}
+		// If a repo has no help-str from hub-repo list, try to get the title from it's README
+		if len(helpStrs[i]) == 0 && len(subTopHelpStr) != 0 {
+			helpStrs[i] = subTopHelpStr
+		}
+		addrs = append(addrs, subAddrs...)
+		helpStrs = append(helpStrs, subHelpStrs...)
+	}
+	return topRepoHelpStr, addrs, helpStrs, nil
+}
+
+// Resolved returns the address a started repo updated to, see 'updatingRepo.addr'
+func (self *RepoUpdater) Resolved(gitAddr RepoAddr) RepoAddr {
+	if repo := self.repos[gitAddr.Key()]; repo != nil && repo.err == nil {
+		return repo.addr
+	}
+	return gitAddr
+}
+
+func (self *RepoUpdater) update(gitAddr RepoAddr, repo *updatingRepo) {
+	result := RepoUpdateResult{Addr: gitAddr}
+	var output bytes.Buffer
+	defer func() {
+		result.Output = output.String()
+		result.Err = repo.err
+		if repo.err != nil {
+			result.Status = RepoFailed
+		}
+		self.onUpdated(result)
+	}()
+
+	var repoPath string
+	var err error
+	if gitAddr.IsFile() {
+		repoPath, err = self.updateFileRepo(gitAddr, repo, &result)
+	} else {
+		repoPath, err = self.updateGitRepo(gitAddr, &output, &result)
+	}
+	if err != nil {
+		repo.err = err
+		return
+	}
+
+	listFilePath := filepath.Join(repoPath, self.listFileName)
+	repo.topHelpStr, repo.addrs, repo.helpStrs, repo.err = ReadRepoListFromFile(self.selfName, listFilePath)
+}
+
+func (self *RepoUpdater) updateGitRepo(
+	gitAddr RepoAddr,
+	output io.Writer,
+	result *RepoUpdateResult) (repoPath string, err error) {
+
+	repoPath, err = GetRepoPath(self.hubPath, gitAddr)
+	if err != nil {
+		return "", model.WrapCmdError(self.cmd, err)
+	}
+	if from, err := GetRepoHeadCommit(repoPath); err == nil {
+		result.From = from
+	}
+	cloned, err := updateRepo(output, repoPath, gitAddr, self.cmd)
+	if err != nil {
+		return
+	}
+	result.To, _ = GetRepoHeadCommit(repoPath)
+	if cloned {
+		result.Status = RepoCloned
+	} else if result.From == result.To {
+		result.Status = RepoUnchanged
+	} else {
+		result.Status = RepoUpdated
+	}
+	return
+}
+
+func (self *RepoUpdater) updateFileRepo(
+	addr RepoAddr,
+	repo *updatingRepo,
+	result *RepoUpdateResult) (repoPath string, err error) {
+
+	if self.upgradeFiles && !addr.IsPinned() {
+		newer, found, err := FindNewerFileRepo(addr, self.fileSourceDir)
+		if err != nil {
+			return "", model.WrapCmdError(self.cmd, err)
+		}
+		if found {
+			repo.addr = newer
+		}
+	}
+	repoPath, oldDigest, digest, err := UpdateFileRepo(self.hubPath, repo.addr)
+	if err != nil {
+		return "", model.WrapCmdError(self.cmd, err)
+	}
+	if repo.addr.Addr != addr.Addr {
+		from, _ := ParseFileRepo(addr)
+		to, _ := ParseFileRepo(repo.addr)
+		result.Status, result.From, result.To = RepoUpdated, from.Version, to.Version
+	} else if len(oldDigest) == 0 {
+		result.Status, result.To = RepoUnpacked, digest
+	} else if oldDigest == digest {
+		result.Status, result.To = RepoUnchanged, digest
+	} else {
+		result.Status, result.From, result.To = RepoUpdated, oldDigest, digest
+	}
+	return
+}
+
+// onUpdated records the result and prints it as a row of the progress table
+func (self *RepoUpdater) onUpdated(result RepoUpdateResult) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.results = append(self.results, result)
+
+	env := self.env
+	var status string
+	switch result.Status {
+	case RepoFailed:
+		status = display.ColorError(fmt.Sprintf("%-10s", result.Status), env) + result.Reason()
+	case RepoUpdated:
+		status = fmt.Sprintf("%-10s%s..%s", result.Status, shortCommit(result.From), shortCommit(result.To))
+	default:
+		status = fmt.Sprintf("%-10s%s", result.Status, shortCommit(result.To))
+	}
+	_ = self.screen.Print(fmt.Sprintf("%4d ", len(self.results)) +
+		display.ColorHub(fmt.Sprintf("%-40s", "["+AddrDisplayName(result.Addr)+"]"), env) +
+		display.ColorSymbol(" => ", env) + status + "\n")
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
@@ -0,0 +1,119 @@
+package hub_meta
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/innerr/ticat/pkg/cli/display"
+	"github.com/innerr/ticat/pkg/core/model"
+)
+
+func TestRepoUpdater(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	root := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(root, "gitconfig"))
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@test")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@test")
+
+	git := func(dir string, args ...string) {
+		c := exec.Command("git", args...)
+		c.Dir = dir
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	// newRepo creates a bare repo with a hub.ticat listing the sub repos, returns the address
+	newRepo := func(name string, hubTicat string) string {
+		bare := filepath.Join(root, name+".git")
+		work := filepath.Join(root, name)
+		git(root, "init", "-q", "--bare", bare)
+		git(root, "clone", "-q", bare, work)
+		if err := os.WriteFile(filepath.Join(work, "hub.ticat"), []byte(hubTicat), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git(work, "add", "-A")
+		git(work, "commit", "-qm", "init")
+		git(work, "push", "-q", "origin", "HEAD:master")
+		git(bare, "symbolic-ref", "HEAD", "refs/heads/master")
+		return bare
+	}
+
+	c := newRepo("c", "help = repo c\n")
+	a := newRepo("a", "help = repo a\n[repos]\n"+c+" = \n")
+	b := newRepo("b", "help = repo b\n[repos]\n"+c+" = listed by b\n")
+	top := newRepo("top", "help = top repo\n[repos]\n"+a+" = \n"+b+" = listed by top\n")
+
+	screen := display.NewCacheScreen()
+	env := model.NewEnv()
+	hub := filepath.Join(root, "hub")
+
+	update := func(concurrency int, addr string) ([]RepoUpdateResult, []RepoAddr, []string, error) {
+		updater := NewRepoUpdater(screen, env, map[string]bool{}, hub, "hub.ticat", "ticat",
+			concurrency, model.ParsedCmd{})
+		updater.Start(RepoAddr{Addr: addr})
+		results := updater.Wait()
+		_, addrs, helpStrs, err := updater.Collect(RepoAddr{Addr: addr})
+		return results, addrs, helpStrs, err
+	}
+	statuses := func(results []RepoUpdateResult) map[string]string {
+		statuses := map[string]string{}
+		for _, result := range results {
+			statuses[filepath.Base(result.Addr.Addr)] = result.Status
+		}
+		return statuses
+	}
+
+	results, addrs, helpStrs, err := update(4, top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same as updating one by one: the direct sub repos first, then the ones listed by them
+	expectedAddrs := []RepoAddr{{Addr: a}, {Addr: b}, {Addr: c}, {Addr: c}}
+	if !reflect.DeepEqual(addrs, expectedAddrs) {
+		t.Errorf("unexpected addrs: %v", addrs)
+	}
+	if !reflect.DeepEqual(helpStrs, []string{"repo a", "listed by top", "repo c", "listed by b"}) {
+		t.Errorf("unexpected help strs: %q", helpStrs)
+	}
+	expected := map[string]string{"top.git": RepoCloned, "a.git": RepoCloned, "b.git": RepoCloned, "c.git": RepoCloned}
+	if len(results) != 4 || !reflect.DeepEqual(statuses(results), expected) {
+		t.Errorf("each repo should be updated once: %+v", results)
+	}
+
+	git(filepath.Join(root, "c"), "commit", "-q", "--allow-empty", "-m", "v2")
+	git(filepath.Join(root, "c"), "push", "-q", "origin", "HEAD:master")
+	results, _, _, err = update(1, top)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]string{"top.git": RepoUnchanged, "a.git": RepoUnchanged, "b.git": RepoUnchanged, "c.git": RepoUpdated}
+	if !reflect.DeepEqual(statuses(results), expected) {
+		t.Errorf("unexpected statuses: %v", statuses(results))
+	}
+
+	t.Run("failed", func(t *testing.T) {
+		missing := filepath.Join(root, "missing.git")
+		broken := newRepo("broken", "[repos]\n"+missing+" = \n"+c+" = \n")
+		results, _, _, err := update(4, broken)
+		if err == nil {
+			t.Fatal("expect error when a sub repo failed")
+		}
+		statuses := statuses(results)
+		if statuses["missing.git"] != RepoFailed || statuses["c.git"] != RepoUnchanged {
+			t.Errorf("the failed one should not stop the others: %v", statuses)
+		}
+		for _, result := range results {
+			if result.Status == RepoFailed && !strings.Contains(result.Reason(), "missing.git") {
+				t.Errorf("expect the reason from git output, got '%s'", result.Reason())
+			}
+		}
+	})
+}
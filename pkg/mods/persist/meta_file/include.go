@@ -0,0 +1,256 @@
+package meta_file
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The include rules:
+//   - 'include = a.ticat, b.ticat' in the global section includes all sections of the files,
+//     '@include = a.ticat' in a section only includes the section with the same name.
+//   - The paths are relative to the dir of the including file (the real file for combined files).
+//   - The included files are merged in order, the later ones override the earlier ones,
+//     the section-level includes override the file-level ones, the including file overrides all of them.
+//   - The keys keep the positions they first appear, so the included args are before the own ones.
+//   - The args and the env keys are matched by names, the abbrs are not counted,
+//     so 'port|p = 4001' overrides 'port = 3306' and replaces it in place.
+//   - Including a file more than once is ok, including a file in its include chain is an error.
+//   - The included files could be in the YAML format, see 'IsYamlMetaFile'.
+const (
+	IncludeKey        = "include"
+	SectionIncludeKey = "@include"
+	IncludeListSep    = ","
+
+	includeAbbrsSep   = "|"
+	includeEnvPathSep = "."
+)
+
+// The sections keyed by arg names or env keys, the abbrs are allowed in the keys
+var (
+	includeArgSections = []string{"args", "arg"}
+	includeEnvSections = []string{"env", "env.write", "val2env", "env.from-arg", "env.arg", "arg2env"}
+)
+
+// Origin returns the file defining the key, it's the meta file itself if the key is not included
+func (self *MetaFile) Origin(sectionName string, key string) string {
+	if origin, ok := self.origins[sectionName][key]; ok {
+		return origin
+	}
+	return self.path
+}
+
+// Includes returns all the included files, including the ones included by them
+func (self *MetaFile) Includes() []string {
+	return self.includes
+}
+
+// SectionNames returns the names of the sections, the global one first and the others sorted
+func (self *MetaFile) SectionNames() (names []string) {
+	if _, ok := self.sections[GlobalSectionName]; ok {
+		names = append(names, GlobalSectionName)
+	}
+	for _, name := range sortedSectionNames(self.sections) {
+		if name != GlobalSectionName {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+// resolveIncludes merges the included files into the parsed sections,
+// 'chain' is the cleaned paths of the including files, for detecting cycles
+func (self *MetaFile) resolveIncludes(dir string, chain []string) error {
+	merged := make(SectionMap)
+	origins := map[string]map[string]string{}
+	set := func(sectionName string, key string, val string, origin string) {
+		section, ok := merged[sectionName]
+		if !ok {
+			section = NewSection()
+			merged[sectionName] = section
+		}
+		if old := section.findKeyByName(sectionName, key); len(old) != 0 && old != key {
+			section.rename(old, key)
+			delete(origins[sectionName], old)
+		}
+		section.Set(key, val)
+		if origin == self.path {
+			delete(origins[sectionName], key)
+			return
+		}
+		if origins[sectionName] == nil {
+			origins[sectionName] = map[string]string{}
+		}
+		origins[sectionName][key] = origin
+	}
+	mergeSection := func(from *MetaFile, sectionName string) {
+		section := from.sections[sectionName]
+		if section == nil {
+			return
+		}
+		for _, key := range section.Keys() {
+			set(sectionName, key, section.GetUnTrim(key), from.Origin(sectionName, key))
+		}
+	}
+
+	hasIncludes := false
+	if global := self.sections[GlobalSectionName]; global != nil {
+		paths := global.GetUnTrim(IncludeKey)
+		global.Delete(IncludeKey)
+		for _, path := range splitIncludePaths(paths) {
+			hasIncludes = true
+			included, err := self.include(dir, path, chain)
+			if err != nil {
+				return err
+			}
+			for _, name := range included.SectionNames() {
+				mergeSection(included, name)
+			}
+		}
+	}
+
+	names := sortedSectionNames(self.sections)
+	for _, name := range names {
+		section := self.sections[name]
+		paths := section.GetUnTrim(SectionIncludeKey)
+		section.Delete(SectionIncludeKey)
+		for _, path := range splitIncludePaths(paths) {
+			hasIncludes = true
+			included, err := self.include(dir, path, chain)
+			if err != nil {
+				return err
+			}
+			mergeSection(included, name)
+		}
+	}
+	if !hasIncludes {
+		return nil
+	}
+
+	for _, name := range names {
+		mergeSection(self, name)
+	}
+	self.sections = merged
+	self.origins = origins
+	return nil
+}
+
+func (self *MetaFile) include(dir string, path string, chain []string) (*MetaFile, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path = filepath.Clean(path)
+	for i, it := range chain {
+		if it == path {
+			cycle := append(append([]string{}, chain[i:]...), path)
+			return nil, fmt.Errorf("[MetaFile.include] include cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	content, err := self.fs.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[MetaFile.include] read file '%s' included by '%s' failed: %v",
+			path, chain[len(chain)-1], err)
+	}
+	included := CreateMetaFileWithFS(self.fs, path)
+	if IsYamlMetaFile(path) {
+		err = included.parseYaml(content)
+	} else {
+		err = included.parse(strings.Split(string(content), LineSep))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("[MetaFile.include] parse file '%s' included by '%s' failed: %v",
+			path, chain[len(chain)-1], err)
+	}
+	chain = append(append([]string{}, chain...), path)
+	if err = included.resolveIncludes(filepath.Dir(path), chain); err != nil {
+		return nil, err
+	}
+
+	for _, it := range append([]string{path}, included.includes...) {
+		if !containsStr(self.includes, it) {
+			self.includes = append(self.includes, it)
+		}
+	}
+	return included, nil
+}
+
+// findKeyByName returns the key with the same arg name or env key, abbrs are not counted
+func (self *Section) findKeyByName(sectionName string, key string) string {
+	var name func(string) string
+	if containsStr(includeArgSections, sectionName) {
+		name = includeArgName
+	} else if containsStr(includeEnvSections, sectionName) {
+		name = includeEnvKey
+	} else {
+		return ""
+	}
+	target := name(key)
+	for _, it := range self.orderedKeys {
+		if name(it) == target {
+			return it
+		}
+	}
+	return ""
+}
+
+// rename changes the key and keeps its position
+func (self *Section) rename(old string, key string) {
+	val, ok := self.pairs[old]
+	if !ok {
+		return
+	}
+	if _, ok := self.pairs[key]; ok {
+		self.Delete(old)
+		return
+	}
+	delete(self.pairs, old)
+	self.pairs[key] = val
+	for i, it := range self.orderedKeys {
+		if it == old {
+			self.orderedKeys[i] = key
+			break
+		}
+	}
+}
+
+func includeArgName(key string) string {
+	return strings.TrimSpace(strings.Split(key, includeAbbrsSep)[0])
+}
+
+func includeEnvKey(key string) string {
+	segs := strings.Split(key, includeEnvPathSep)
+	for i, seg := range segs {
+		segs[i] = includeArgName(seg)
+	}
+	return strings.Join(segs, includeEnvPathSep)
+}
+
+func splitIncludePaths(val string) (paths []string) {
+	for _, path := range strings.Split(strings.Trim(val, ValTrimChars), IncludeListSep) {
+		path = strings.TrimSpace(path)
+		if len(path) != 0 {
+			paths = append(paths, path)
+		}
+	}
+	return
+}
+
+func sortedSectionNames(sections SectionMap) []string {
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func containsStr(strs []string, str string) bool {
+	for _, it := range strs {
+		if it == str {
+			return true
+		}
+	}
+	return false
+}
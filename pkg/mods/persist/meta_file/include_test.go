@@ -0,0 +1,162 @@
+package meta_file
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/innerr/ticat/pkg/mods/persist/fs"
+)
+
+func TestMetaFileInclude(t *testing.T) {
+	memFS := fs.NewMemFS()
+	write := func(path string, content string) {
+		if err := memFS.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	write("repo/common/db.ticat", `include = base.ticat
+help = db common
+[args]
+host|h = 127.0.0.1
+port|p = 4000
+[env]
+db.host = read
+[deps]
+mysql = as client`)
+	write("repo/common/base.ticat", `[args]
+verbose|v = false
+port = 3306
+[env]
+sys.verb = read`)
+	write("repo/common/user.ticat", `[args]
+user|u = root`)
+	write("repo/cmds/query.bash.ticat", `include = ../common/db.ticat
+help = run a query
+[args]
+@include = ../common/user.ticat
+sql = ''
+port|p = 4001
+[env]
+db|d.host|h = write
+[deps]
+mysql = as client to query`)
+
+	metas, err := NewMetaFileWithFS(memFS, "repo/cmds/query.bash.ticat")
+	if err != nil {
+		t.Fatalf("NewMetaFileWithFS failed: %v", err)
+	}
+	meta := metas[0].Meta
+	self := "repo/cmds/query.bash.ticat"
+	db := "repo/common/db.ticat"
+	base := "repo/common/base.ticat"
+	user := "repo/common/user.ticat"
+
+	if meta.Get("help") != "run a query" || meta.Origin("", "help") != self {
+		t.Errorf("the own key should override the included one: %q", meta.Get("help"))
+	}
+	if len(meta.Get(IncludeKey)) != 0 || len(meta.GetSection("args").Get(SectionIncludeKey)) != 0 {
+		t.Errorf("the include directives should not be kept")
+	}
+
+	args := meta.GetSection("args")
+	expectedKeys := []string{"verbose|v", "port|p", "host|h", "user|u", "sql"}
+	if !reflect.DeepEqual(args.Keys(), expectedKeys) {
+		t.Errorf("expect the included args first, got %v", args.Keys())
+	}
+	expectedOrigins := map[string]string{
+		"verbose|v": base,
+		"host|h":    db,
+		"port|p":    self,
+		"user|u":    user,
+		"sql":       self,
+	}
+	for key, origin := range expectedOrigins {
+		if meta.Origin("args", key) != origin {
+			t.Errorf("expect origin of '%s' is '%s', got '%s'", key, origin, meta.Origin("args", key))
+		}
+	}
+	if args.Get("port|p") != "4001" {
+		t.Errorf("expect overridden port, got %q", args.Get("port|p"))
+	}
+	if len(args.Get("port")) != 0 {
+		t.Errorf("expect the included 'port' replaced by 'port|p'")
+	}
+
+	if meta.Origin("env", "sys.verb") != base {
+		t.Errorf("expect the env section included")
+	}
+	env := meta.GetSection("env")
+	if !reflect.DeepEqual(env.Keys(), []string{"sys.verb", "db|d.host|h"}) ||
+		env.Get("db|d.host|h") != "write" || meta.Origin("env", "db|d.host|h") != self {
+		t.Errorf("expect 'db.host' replaced by the own env key with abbrs, got %v", env.Keys())
+	}
+	if meta.SectionGet("deps", "mysql") != "as client to query" || meta.Origin("deps", "mysql") != self {
+		t.Errorf("expect the own deps override the included ones")
+	}
+	if !reflect.DeepEqual(meta.Includes(), []string{db, base, user}) {
+		t.Errorf("unexpected includes: %v", meta.Includes())
+	}
+	if !reflect.DeepEqual(meta.SectionNames(), []string{"", "args", "deps", "env"}) {
+		t.Errorf("unexpected section names: %v", meta.SectionNames())
+	}
+}
+
+func TestMetaFileIncludeErrors(t *testing.T) {
+	memFS := fs.NewMemFS()
+	write := func(path string, content string) {
+		if err := memFS.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+
+	write("a.ticat", "include = b.ticat\n")
+	write("b.ticat", "include = c.ticat, a.ticat\n")
+	write("c.ticat", "key = c\n")
+	_, err := NewMetaFileWithFS(memFS, "a.ticat")
+	if err == nil || !strings.Contains(err.Error(), "a.ticat -> b.ticat -> a.ticat") {
+		t.Errorf("expect include cycle error, got %v", err)
+	}
+
+	write("self.ticat", "[args]\n@include = self.ticat\n")
+	if _, err := NewMetaFileWithFS(memFS, "self.ticat"); err == nil {
+		t.Errorf("expect error when including itself")
+	}
+
+	write("missing.ticat", "include = not-exists.ticat\n")
+	if _, err := NewMetaFileWithFS(memFS, "missing.ticat"); err == nil ||
+		!strings.Contains(err.Error(), "not-exists.ticat") {
+		t.Errorf("expect error for missing included file, got %v", err)
+	}
+
+	// Including the same file from different places is not a cycle
+	write("d.ticat", "include = c.ticat, e.ticat\n")
+	write("e.ticat", "include = c.ticat\n")
+	metas, err := NewMetaFileWithFS(memFS, "d.ticat")
+	if err != nil || metas[0].Meta.Get("key") != "c" {
+		t.Errorf("expect diamond includes ok: %v", err)
+	}
+}
+
+func TestMetaFileIncludeInCombinedFile(t *testing.T) {
+	memFS := fs.NewMemFS()
+	if err := memFS.WriteFile("flows/common.ticat", []byte("[args]\nenv = test\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content := `### file: x.tiflow
+include = common.ticat
+flow = dbg.echo
+### file: y.tiflow
+flow = dbg.echo`
+	if err := memFS.WriteFile("flows/all.tiflow", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	metas, err := NewMetaFileWithFS(memFS, "flows/all.tiflow")
+	if err != nil {
+		t.Fatalf("NewMetaFileWithFS failed: %v", err)
+	}
+	if len(metas) != 2 || metas[0].Meta.SectionGet("args", "env") != "test" ||
+		metas[1].Meta.GetSection("args") != nil {
+		t.Errorf("expect included relative to the real file, only in the virtual file declaring it")
+	}
+}
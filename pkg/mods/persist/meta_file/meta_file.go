@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/innerr/ticat/pkg/mods/persist/fs"
@@ -23,6 +24,10 @@ type MetaFile struct {
 	lineSep     string
 	kvSep       string
 	fs          fs.FS
+
+	// The files defining the included keys, see 'Origin'
+	origins  map[string]map[string]string
+	includes []string
 }
 
 var defaultFS = fs.NewRealFS()
@@ -49,17 +54,49 @@ func ParseMetaFile(path string, r io.Reader) (metas []VirtualMetaFile, err error
 }
 
 func ParseMetaFileWithFS(f fs.FS, path string, r io.Reader) (metas []VirtualMetaFile, err error) {
+	return parseMetaFile(f, path, r, true)
+}
+
+// NewRawMetaFile parses the meta file without resolving the includes, for converting or editing it
+func NewRawMetaFile(path string) (metas []VirtualMetaFile, err error) {
+	var content []byte
+	content, err = defaultFS.ReadFile(path)
+	if err != nil {
+		return
+	}
+	return parseMetaFile(defaultFS, path, bytes.NewReader(content), false)
+}
+
+func parseMetaFile(f fs.FS, path string, r io.Reader, resolveIncludes bool) (metas []VirtualMetaFile, err error) {
 	var content []byte
 	content, err = io.ReadAll(r)
 	if err != nil {
 		return
 	}
+	if IsYamlMetaFile(path) {
+		meta := CreateMetaFileWithFS(f, path)
+		if err = meta.parseYaml(content); err != nil {
+			return
+		}
+		if resolveIncludes {
+			if err = meta.resolveIncludes(filepath.Dir(path), []string{filepath.Clean(path)}); err != nil {
+				return
+			}
+		}
+		return []VirtualMetaFile{{meta, path, true}}, nil
+	}
 	paths, contents, notVirtuals := parseCombinedFile(path, content, LineSep)
 	for i, it := range contents {
 		meta := CreateMetaFileWithFS(f, paths[i])
 		if err = meta.parse(it); err != nil {
 			return
 		}
+		// The included files are relative to the real file, even in a virtual one
+		if resolveIncludes {
+			if err = meta.resolveIncludes(filepath.Dir(path), []string{filepath.Clean(path)}); err != nil {
+				return
+			}
+		}
 		metas = append(metas, VirtualMetaFile{meta, paths[i], notVirtuals[i]})
 	}
 	return
@@ -108,6 +145,8 @@ func CreateMetaFileWithFS(f fs.FS, path string) (meta *MetaFile) {
 		LineSep,
 		KvSep,
 		f,
+		nil,
+		nil,
 	}
 	return
 }
@@ -426,6 +465,19 @@ func (self *Section) Set(key string, val string) {
 	}
 }
 
+func (self *Section) Delete(key string) {
+	if _, ok := self.pairs[key]; !ok {
+		return
+	}
+	delete(self.pairs, key)
+	for i, it := range self.orderedKeys {
+		if it == key {
+			self.orderedKeys = append(self.orderedKeys[:i], self.orderedKeys[i+1:]...)
+			break
+		}
+	}
+}
+
 func (self *Section) SetMultiLineVal(key string, val []string) {
 	self.Set(key, strings.Join(val, LineSep))
 }
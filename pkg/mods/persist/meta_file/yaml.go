@@ -0,0 +1,451 @@
+package meta_file
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A YAML subset for the meta files, enough for the meta format and no dependency needed:
+//   - block mappings and sequences, nested by indentation (spaces only)
+//   - plain, single-quoted and double-quoted scalars, the values are kept as strings
+//   - block scalars: '|' and '>', with the chomping indicators '-' and '+'
+//   - flow sequences and mappings in one line, not nested: '[a, b]', '{k: v}'
+//   - comments
+// Anchors, aliases, tags and multi documents are not supported.
+
+type yamlKind int
+
+const (
+	yamlScalar yamlKind = iota
+	yamlSeq
+	yamlMap
+)
+
+type yamlNode struct {
+	kind  yamlKind
+	line  int
+	value string
+	items []*yamlNode
+	keys  []string
+	vals  map[string]*yamlNode
+}
+
+func newYamlMap(line int) *yamlNode {
+	return &yamlNode{kind: yamlMap, line: line, vals: map[string]*yamlNode{}}
+}
+
+func (self *yamlNode) set(key string, val *yamlNode) error {
+	if _, ok := self.vals[key]; ok {
+		return fmt.Errorf("line %d: duplicated key '%s'", val.line, key)
+	}
+	self.keys = append(self.keys, key)
+	self.vals[key] = val
+	return nil
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	// Comment stripped and trimmed, empty if it's a blank or comment line
+	content string
+	raw     string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func parseYaml(content []byte) (*yamlNode, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(content), LineSep) {
+		raw = strings.TrimRight(raw, "\r")
+		line := yamlLine{num: i + 1, raw: raw}
+		trimmed := strings.TrimLeft(raw, " ")
+		line.indent = len(raw) - len(trimmed)
+		line.content = strings.TrimSpace(stripYamlComment(trimmed))
+		if i == 0 && line.content == "---" {
+			line.content = ""
+		}
+		p.lines = append(p.lines, line)
+	}
+
+	first := p.peek()
+	if first == nil {
+		return newYamlMap(1), nil
+	}
+	node, err := p.parseNode(first.indent)
+	if err != nil {
+		return nil, err
+	}
+	if left := p.peek(); left != nil {
+		return nil, fmt.Errorf("line %d: unexpected indentation", left.num)
+	}
+	return node, nil
+}
+
+// peek skips the blank lines, returns nil if no more lines
+func (self *yamlParser) peek() *yamlLine {
+	for ; self.pos < len(self.lines); self.pos++ {
+		line := &self.lines[self.pos]
+		if len(line.content) == 0 {
+			continue
+		}
+		return line
+	}
+	return nil
+}
+
+func (self *yamlParser) parseNode(indent int) (*yamlNode, error) {
+	line := self.peek()
+	if err := checkYamlIndent(line); err != nil {
+		return nil, err
+	}
+	if isYamlSeqItem(line.content) {
+		return self.parseSeq(indent)
+	}
+	if _, _, ok := splitYamlKey(line.content); ok {
+		return self.parseMap(indent)
+	}
+	self.pos += 1
+	return parseYamlInline(line.content, line.num)
+}
+
+func (self *yamlParser) parseMap(indent int) (*yamlNode, error) {
+	node := newYamlMap(self.peek().num)
+	for {
+		line := self.peek()
+		if line == nil || line.indent < indent {
+			break
+		}
+		if err := checkYamlIndent(line); err != nil {
+			return nil, err
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.num)
+		}
+		if isYamlSeqItem(line.content) {
+			return nil, fmt.Errorf("line %d: unexpected sequence item in mapping", line.num)
+		}
+		key, rest, ok := splitYamlKey(line.content)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expect 'key: value', got '%s'", line.num, line.content)
+		}
+		self.pos += 1
+		val, err := self.parseValue(rest, indent, line.num, true)
+		if err != nil {
+			return nil, err
+		}
+		if err = node.set(key, val); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+func (self *yamlParser) parseSeq(indent int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlSeq, line: self.peek().num}
+	for {
+		line := self.peek()
+		if line == nil || line.indent < indent {
+			break
+		}
+		if err := checkYamlIndent(line); err != nil {
+			return nil, err
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation in sequence", line.num)
+		}
+		// The sequence is the value of a key at the same indentation, the next key is reached
+		if !isYamlSeqItem(line.content) {
+			break
+		}
+		rest := strings.TrimSpace(line.content[1:])
+		if _, _, ok := splitYamlKey(rest); ok && len(rest) != 0 && rest[0] != '[' && rest[0] != '{' {
+			// A mapping item, the keys after the first one are aligned with it
+			line.indent += len(line.content) - len(rest)
+			line.content = rest
+			item, err := self.parseMap(line.indent)
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+			continue
+		}
+		self.pos += 1
+		item, err := self.parseValue(rest, indent, line.num, false)
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+	}
+	return node, nil
+}
+
+// parseValue parses the value after 'key:' or '-', the value could be in the following lines
+func (self *yamlParser) parseValue(rest string, indent int, num int, isMapVal bool) (*yamlNode, error) {
+	if len(rest) != 0 && (rest[0] == '|' || rest[0] == '>') {
+		return self.parseBlockScalar(rest, indent, num)
+	}
+	if len(rest) != 0 {
+		return parseYamlInline(rest, num)
+	}
+	next := self.peek()
+	// The sequence could be at the same indentation of the key
+	if next != nil && (next.indent > indent || isMapVal && next.indent == indent && isYamlSeqItem(next.content)) {
+		return self.parseNode(next.indent)
+	}
+	return &yamlNode{kind: yamlScalar, line: num}, nil
+}
+
+func (self *yamlParser) parseBlockScalar(header string, indent int, num int) (*yamlNode, error) {
+	folded := header[0] == '>'
+	chomping := header[1:]
+	if chomping != "" && chomping != "-" && chomping != "+" {
+		return nil, fmt.Errorf("line %d: unsupported block scalar header '%s'", num, header)
+	}
+
+	var lines []string
+	blockIndent := -1
+	for ; self.pos < len(self.lines); self.pos++ {
+		line := self.lines[self.pos]
+		if len(strings.TrimSpace(line.raw)) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		if line.indent <= indent {
+			break
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+		if line.indent < blockIndent {
+			return nil, fmt.Errorf("line %d: bad indentation in block scalar", line.num)
+		}
+		lines = append(lines, line.raw[blockIndent:])
+	}
+
+	trailing := 0
+	for len(lines) > trailing && len(lines[len(lines)-1-trailing]) == 0 {
+		trailing += 1
+	}
+	lines = lines[:len(lines)-trailing]
+
+	var val string
+	if folded {
+		// The lines are joined by spaces, a blank line is a line break
+		for i, line := range lines {
+			if i != 0 && len(line) == 0 {
+				val += LineSep
+				continue
+			}
+			if i != 0 && len(lines[i-1]) != 0 {
+				val += " "
+			}
+			val += line
+		}
+	} else {
+		val = strings.Join(lines, LineSep)
+	}
+	if len(lines) != 0 {
+		switch chomping {
+		case "":
+			val += LineSep
+		case "+":
+			val += strings.Repeat(LineSep, trailing+1)
+		}
+	}
+	return &yamlNode{kind: yamlScalar, line: num, value: val}, nil
+}
+
+func parseYamlInline(s string, num int) (*yamlNode, error) {
+	if len(s) != 0 && (s[0] == '[' || s[0] == '{') {
+		isMap := s[0] == '{'
+		closing := byte(']')
+		if isMap {
+			closing = '}'
+		}
+		if s[len(s)-1] != closing {
+			return nil, fmt.Errorf("line %d: unclosed flow collection '%s'", num, s)
+		}
+		var node *yamlNode
+		if isMap {
+			node = newYamlMap(num)
+		} else {
+			node = &yamlNode{kind: yamlSeq, line: num}
+		}
+		for _, item := range splitYamlFlowItems(s[1 : len(s)-1]) {
+			if len(item) == 0 {
+				continue
+			}
+			if !isMap {
+				val, err := parseYamlScalar(item, num)
+				if err != nil {
+					return nil, err
+				}
+				node.items = append(node.items, val)
+				continue
+			}
+			key, rest, ok := splitYamlKey(item)
+			if !ok {
+				return nil, fmt.Errorf("line %d: expect 'key: value' in flow mapping, got '%s'", num, item)
+			}
+			val, err := parseYamlScalar(rest, num)
+			if err != nil {
+				return nil, err
+			}
+			if err = node.set(key, val); err != nil {
+				return nil, err
+			}
+		}
+		return node, nil
+	}
+	return parseYamlScalar(s, num)
+}
+
+func parseYamlScalar(s string, num int) (*yamlNode, error) {
+	node := &yamlNode{kind: yamlScalar, line: num}
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return node, nil
+	}
+	switch s[0] {
+	case '"':
+		val, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad double-quoted string %s", num, s)
+		}
+		node.value = val
+	case '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' || strings.Contains(strings.ReplaceAll(s[1:len(s)-1], "''", ""), "'") {
+			return nil, fmt.Errorf("line %d: bad single-quoted string %s", num, s)
+		}
+		node.value = strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	case '&', '*', '!':
+		return nil, fmt.Errorf("line %d: anchors, aliases and tags are not supported: %s", num, s)
+	default:
+		if s != "~" && s != "null" {
+			node.value = s
+		}
+	}
+	return node, nil
+}
+
+func checkYamlIndent(line *yamlLine) error {
+	if line.raw[line.indent] == '\t' {
+		return fmt.Errorf("line %d: tabs are not allowed in indentation", line.num)
+	}
+	return nil
+}
+
+func isYamlSeqItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// splitYamlKey splits 'key: value', the key could be quoted
+func splitYamlKey(s string) (key string, rest string, ok bool) {
+	if len(s) != 0 && (s[0] == '"' || s[0] == '\'') {
+		end := yamlQuotedEnd(s)
+		if end < 0 {
+			return
+		}
+		node, err := parseYamlScalar(s[:end+1], 0)
+		if err != nil {
+			return
+		}
+		after := s[end+1:]
+		if !strings.HasPrefix(after, ":") || len(after) > 1 && after[1] != ' ' {
+			return
+		}
+		return node.value, strings.TrimSpace(after[1:]), true
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] == ':' && (i+1 == len(s) || s[i+1] == ' ') {
+			key = strings.TrimSpace(s[:i])
+			return key, strings.TrimSpace(s[i+1:]), len(key) != 0
+		}
+	}
+	return
+}
+
+// yamlQuotedEnd returns the index of the closing quote of the quoted string at the beginning
+func yamlQuotedEnd(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i += 1
+			continue
+		}
+		if s[i] == quote {
+			if quote == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+				i += 1
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+func splitYamlFlowItems(s string) (items []string) {
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if (s[i] == '"' || s[i] == '\'') && len(strings.TrimSpace(s[start:i])) == 0 {
+			if end := yamlQuotedEnd(s[i:]); end > 0 {
+				i += end
+			}
+			continue
+		}
+		if s[i] == ',' {
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(items, strings.TrimSpace(s[start:]))
+}
+
+// stripYamlComment removes the comment, a '#' starts a comment if it's at the beginning or after a space
+func stripYamlComment(s string) string {
+	tokenStart := true
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c == '"' || c == '\'') && tokenStart {
+			if end := yamlQuotedEnd(s[i:]); end > 0 {
+				i += end
+				tokenStart = false
+				continue
+			}
+		}
+		if c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t') {
+			return s[:i]
+		}
+		tokenStart = c == ' ' || c == '[' || c == '{' || c == ',' || c == ':' || c == '-'
+	}
+	return s
+}
+
+// yamlScalarStr encodes a single line string as a plain or double-quoted scalar
+func yamlScalarStr(s string) string {
+	if len(s) == 0 {
+		return "''"
+	}
+	needQuote := strings.ContainsAny(s[:1], "?:,[]{}#&*!|>'\"%@` \t") ||
+		s == "-" || strings.HasPrefix(s, "- ") ||
+		s[len(s)-1] == ' ' || s[len(s)-1] == ':' ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") ||
+		strings.ContainsAny(s, "\t\r\n") || s == "~" || s == "null"
+	if !needQuote {
+		return s
+	}
+	return strconv.Quote(s)
+}
+
+// yamlFlowItemStr encodes an item of a flow sequence
+func yamlFlowItemStr(s string) string {
+	str := yamlScalarStr(s)
+	if str == s && strings.ContainsAny(s, ",[]{}") {
+		return strconv.Quote(s)
+	}
+	return str
+}
@@ -0,0 +1,398 @@
+package meta_file
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The YAML meta files have the same semantics as the INI-like ones, they are translated to the same sections:
+//
+//	help: run a query
+//	abbrs: [q, qry]
+//	tags: ['@db']
+//	flow: |
+//	  dbg.echo begin
+//	  : db.query
+//	macros:
+//	  name: content
+//	args:
+//	  - name: host
+//	    abbrs: [h]
+//	    default: 127.0.0.1
+//	  - name: hosts
+//	    list: true
+//	  - name: mode
+//	    enum: [fast, safe]
+//	  - include: ../common/user.ticat
+//	env:
+//	  cluster|c.name|n: [read, write]
+//	deps:
+//	  mysql: as client
+//
+// The other top level scalars (eg: 'quiet', 'trivial') are the global keys,
+// the other top level mappings (eg: 'val2env', 'arg2env') are the sections.
+
+var YamlExts = []string{".yaml", ".yml"}
+
+// The seps joining the YAML lists to the meta values, they are the defaults of the 'strs.*' seps
+const (
+	yamlAbbrsSep   = "|"
+	yamlEnvOpSep   = ":"
+	yamlListSep    = ","
+	yamlArgEnumSep = "|"
+	yamlTagsSep    = " "
+)
+
+const (
+	yamlArgsSection = "args"
+	yamlMacrosKey   = "macros"
+
+	// The macro keys in the INI-like meta files are '[[name]]'
+	FlowTemplateBracketLeft  = "[["
+	FlowTemplateBracketRight = "]]"
+)
+
+// IsYamlMetaFile checks the ext, eg: 'run.bash.ticat.yaml'
+func IsYamlMetaFile(path string) bool {
+	return TrimYamlExt(path) != path
+}
+
+// TrimYamlExt removes the YAML ext, the result is the same as the INI-like meta file name
+func TrimYamlExt(path string) string {
+	for _, ext := range YamlExts {
+		if strings.HasSuffix(path, ext) {
+			return path[:len(path)-len(ext)]
+		}
+	}
+	return path
+}
+
+func (self *MetaFile) parseYaml(content []byte) error {
+	root, err := parseYaml(content)
+	if err != nil {
+		return fmt.Errorf("[MetaFile.parseYaml] parse '%s' failed: %v", self.path, err)
+	}
+	if root.kind != yamlMap {
+		return fmt.Errorf("[MetaFile.parseYaml] parse '%s' failed: line %d: the top level should be a mapping",
+			self.path, root.line)
+	}
+	global := NewSection()
+	self.sections[GlobalSectionName] = global
+
+	for _, key := range root.keys {
+		val := root.vals[key]
+		var err error
+		switch {
+		case (key == yamlArgsSection || key == "arg") && val.kind == yamlSeq:
+			err = self.parseYamlArgs(key, val)
+		case key == yamlMacrosKey && val.kind == yamlMap:
+			for _, name := range val.keys {
+				var macro string
+				if macro, err = yamlMetaVal(name, val.vals[name], LineSep); err != nil {
+					break
+				}
+				global.Set(FlowTemplateBracketLeft+name+FlowTemplateBracketRight, macro)
+			}
+		case val.kind == yamlMap:
+			section := NewSection()
+			self.sections[key] = section
+			sep := LineSep
+			if key == "env" {
+				sep = yamlEnvOpSep
+			}
+			for _, name := range val.keys {
+				var it string
+				if it, err = yamlMetaVal(key+"."+name, val.vals[name], sep); err != nil {
+					break
+				}
+				section.Set(name, it)
+			}
+		default:
+			var it string
+			if it, err = yamlMetaVal(key, val, yamlGlobalListSep(key)); err == nil {
+				global.Set(key, it)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("[MetaFile.parseYaml] parse '%s' failed: %v", self.path, err)
+		}
+	}
+	return nil
+}
+
+func (self *MetaFile) parseYamlArgs(sectionName string, args *yamlNode) error {
+	section := NewSection()
+	self.sections[sectionName] = section
+	var includes []string
+	for _, arg := range args.items {
+		if arg.kind == yamlScalar {
+			section.Set(arg.value, "")
+			continue
+		}
+		if arg.kind != yamlMap {
+			return fmt.Errorf("line %d: an arg should be a name or a mapping", arg.line)
+		}
+		var name, defVal, enums, abbrs string
+		isList := false
+		for _, key := range arg.keys {
+			val := arg.vals[key]
+			var err error
+			switch key {
+			case "name":
+				name, err = yamlMetaVal(key, val, "")
+			case "abbrs", "abbr":
+				abbrs, err = yamlMetaVal(key, val, yamlAbbrsSep)
+			case "default":
+				defVal, err = yamlMetaVal(key, val, "")
+			case "enum", "enums":
+				enums, err = yamlMetaVal(key, val, yamlArgEnumSep)
+			case "list":
+				var str string
+				if str, err = yamlMetaVal(key, val, ""); err == nil {
+					if isList, err = strconv.ParseBool(str); err != nil {
+						err = fmt.Errorf("line %d: 'list' should be a bool, got '%s'", val.line, str)
+					}
+				}
+			case IncludeKey:
+				var include string
+				include, err = yamlMetaVal(key, val, IncludeListSep)
+				includes = append(includes, include)
+				section.Set(SectionIncludeKey, strings.Join(includes, IncludeListSep))
+			default:
+				err = fmt.Errorf("line %d: unknown arg property '%s'", val.line, key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if len(name) == 0 {
+			if len(includes) != 0 && len(arg.keys) == 1 {
+				continue
+			}
+			return fmt.Errorf("line %d: the arg has no name", arg.line)
+		}
+		if len(abbrs) != 0 {
+			name += yamlAbbrsSep + abbrs
+		}
+		if len(enums) != 0 {
+			defVal += " (enum: " + enums + ")"
+		}
+		if isList {
+			defVal += " (list)"
+		}
+		section.Set(name, strings.TrimSpace(defVal))
+	}
+	return nil
+}
+
+// yamlMetaVal converts a scalar or a list of scalars to a meta value
+func yamlMetaVal(key string, val *yamlNode, listSep string) (string, error) {
+	switch val.kind {
+	case yamlScalar:
+		return strings.TrimRight(val.value, LineSep), nil
+	case yamlSeq:
+		if len(listSep) == 0 {
+			return "", fmt.Errorf("line %d: the value of '%s' should not be a list", val.line, key)
+		}
+		var items []string
+		for _, item := range val.items {
+			if item.kind != yamlScalar {
+				return "", fmt.Errorf("line %d: the items of '%s' should be scalars", item.line, key)
+			}
+			items = append(items, strings.TrimRight(item.value, LineSep))
+		}
+		return strings.Join(items, listSep), nil
+	default:
+		return "", fmt.Errorf("line %d: the value of '%s' should not be a mapping", val.line, key)
+	}
+}
+
+func yamlGlobalListSep(key string) string {
+	switch key {
+	case "abbrs", "abbr":
+		return yamlAbbrsSep
+	case "tags", "tag":
+		return yamlTagsSep
+	case IncludeKey, "args.auto", "arg.auto", "arg2env.auto-map", "arg2env.auto", "arg2env.map":
+		return yamlListSep
+	}
+	// Multi-line values, eg: 'flow'
+	return LineSep
+}
+
+// EncodeYaml encodes the meta in the YAML format, it should be parsed without resolving the includes
+func (self *MetaFile) EncodeYaml() []byte {
+	var b strings.Builder
+
+	if global := self.sections[GlobalSectionName]; global != nil {
+		isMacro := func(key string) bool {
+			return strings.HasPrefix(key, FlowTemplateBracketLeft) && strings.HasSuffix(key, FlowTemplateBracketRight)
+		}
+		macrosWritten := false
+		for _, key := range global.Keys() {
+			// All macros are written at the position of the first one
+			if isMacro(key) {
+				if !macrosWritten {
+					b.WriteString(yamlMacrosKey + ":\n")
+					for _, key := range global.Keys() {
+						if isMacro(key) {
+							name := key[len(FlowTemplateBracketLeft) : len(key)-len(FlowTemplateBracketRight)]
+							writeYamlKV(&b, "  ", name, global.GetUnTrim(key))
+						}
+					}
+					macrosWritten = true
+				}
+				continue
+			}
+			val := yamlSourceVal(global, key)
+			var items []string
+			switch key {
+			case "abbrs", "abbr":
+				// The abbrs of flows may have path seps, keep them as it is
+				if !strings.Contains(val, ".") {
+					items = strings.Split(val, yamlAbbrsSep)
+				}
+			case "tags", "tag":
+				items = strings.Fields(val)
+			case IncludeKey:
+				items = splitIncludePaths(val)
+			}
+			if len(items) > 1 {
+				writeYamlFlowSeq(&b, "", key, items)
+			} else {
+				writeYamlKV(&b, "", key, val)
+			}
+		}
+	}
+
+	for _, name := range yamlSectionsOrder(self.sections) {
+		section := self.sections[name]
+		if len(section.Keys()) == 0 {
+			continue
+		}
+		b.WriteString(yamlScalarStr(name) + ":\n")
+		if name == yamlArgsSection || name == "arg" {
+			writeYamlArgs(&b, section)
+			continue
+		}
+		for _, key := range section.Keys() {
+			val := yamlSourceVal(section, key)
+			if name == "env" {
+				ops := strings.Split(val, yamlAbbrsSep)
+				if len(ops) == 1 {
+					ops = strings.Split(val, yamlEnvOpSep)
+				}
+				if len(ops) > 1 {
+					writeYamlFlowSeq(&b, "  ", key, ops)
+					continue
+				}
+			}
+			writeYamlKV(&b, "  ", key, val)
+		}
+	}
+	return []byte(b.String())
+}
+
+func writeYamlArgs(b *strings.Builder, section *Section) {
+	for _, key := range section.Keys() {
+		if key == SectionIncludeKey {
+			for _, path := range splitIncludePaths(section.GetUnTrim(key)) {
+				writeYamlKV(b, "  - ", IncludeKey, path)
+			}
+			continue
+		}
+		names := strings.Split(key, yamlAbbrsSep)
+		defVal := section.Get(key)
+		var enums []string
+		isList := false
+		// The same as parsing the annotations in registering
+		for len(defVal) > 0 && defVal[len(defVal)-1] == ')' {
+			i := strings.LastIndex(defVal, "(")
+			if i < 0 {
+				break
+			}
+			annotation := strings.TrimSpace(defVal[i+1 : len(defVal)-1])
+			defVal = strings.TrimSpace(defVal[:i])
+			if annotation == "list" {
+				isList = true
+				continue
+			}
+			annotation = strings.TrimSpace(strings.TrimPrefix(annotation, "enum:"))
+			enums = strings.Split(annotation, yamlArgEnumSep)
+		}
+
+		writeYamlKV(b, "  - ", "name", strings.TrimSpace(names[0]))
+		var abbrs []string
+		for _, abbr := range names[1:] {
+			abbrs = append(abbrs, strings.TrimSpace(abbr))
+		}
+		if len(abbrs) != 0 {
+			writeYamlFlowSeq(b, "    ", "abbrs", abbrs)
+		}
+		if len(defVal) != 0 {
+			writeYamlKV(b, "    ", "default", defVal)
+		}
+		if len(enums) != 0 {
+			writeYamlFlowSeq(b, "    ", "enum", enums)
+		}
+		if isList {
+			writeYamlKV(b, "    ", "list", "true")
+		}
+	}
+}
+
+// yamlSourceVal returns the value for encoding, the quotes are trimmed the same as reading it
+func yamlSourceVal(section *Section, key string) string {
+	val := section.GetUnTrim(key)
+	if strings.Contains(val, LineSep) {
+		return val
+	}
+	return section.Get(key)
+}
+
+func writeYamlKV(b *strings.Builder, indent string, key string, val string) {
+	lines := strings.Split(val, LineSep)
+	if len(lines) == 1 || strings.HasPrefix(lines[0], " ") {
+		b.WriteString(indent + yamlScalarStr(key) + ": " + yamlScalarStr(val) + "\n")
+		return
+	}
+	b.WriteString(indent + yamlScalarStr(key) + ": |\n")
+	// The following lines of a seq item are aligned with the first key
+	indent = strings.Repeat(" ", len(indent)+2)
+	for _, line := range lines {
+		if len(line) == 0 {
+			b.WriteString("\n")
+		} else {
+			b.WriteString(indent + line + "\n")
+		}
+	}
+}
+
+func writeYamlFlowSeq(b *strings.Builder, indent string, key string, items []string) {
+	var strs []string
+	for _, item := range items {
+		strs = append(strs, yamlFlowItemStr(strings.TrimSpace(item)))
+	}
+	b.WriteString(indent + yamlScalarStr(key) + ": [" + strings.Join(strs, ", ") + "]\n")
+}
+
+// yamlSectionsOrder returns the sections in the usual order of writing meta files
+func yamlSectionsOrder(sections SectionMap) (names []string) {
+	known := []string{yamlArgsSection, "arg", "env", "val2env", "env.write",
+		"arg2env", "env.arg", "env.from-arg", "deps", "dep"}
+	for _, name := range known {
+		if _, ok := sections[name]; ok {
+			names = append(names, name)
+		}
+	}
+	var others []string
+	for name := range sections {
+		if name != GlobalSectionName && !containsStr(known, name) {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
@@ -0,0 +1,240 @@
+package meta_file
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/innerr/ticat/pkg/mods/persist/fs"
+)
+
+func TestParseYaml(t *testing.T) {
+	content := `---
+# comment
+help: "say: hi"   # trailing comment
+name: it's a tool # comment
+empty:
+quoted: 'a ''b'' c'
+list: [a, "b, c", 'd']
+seq:
+- x
+- y
+nested:
+  block: |
+    line 1
+
+    line 2 # not a comment
+  folded: >-
+    a
+    b
+
+    c
+  items:
+    - k: v
+      k2: v2
+    - plain
+`
+	root, err := parseYaml([]byte(content))
+	if err != nil {
+		t.Fatalf("parseYaml failed: %v", err)
+	}
+	scalar := func(node *yamlNode, key string) string {
+		val := node.vals[key]
+		if val == nil || val.kind != yamlScalar {
+			t.Fatalf("'%s' is not a scalar", key)
+		}
+		return val.value
+	}
+	if !reflect.DeepEqual(root.keys, []string{"help", "name", "empty", "quoted", "list", "seq", "nested"}) {
+		t.Errorf("unexpected keys: %v", root.keys)
+	}
+	expected := map[string]string{
+		"help":   "say: hi",
+		"name":   "it's a tool",
+		"empty":  "",
+		"quoted": "a 'b' c",
+	}
+	for key, val := range expected {
+		if scalar(root, key) != val {
+			t.Errorf("expect '%s' = %q, got %q", key, val, scalar(root, key))
+		}
+	}
+	list := root.vals["list"]
+	if list.kind != yamlSeq || len(list.items) != 3 || list.items[1].value != "b, c" {
+		t.Errorf("unexpected flow seq: %+v", list)
+	}
+	if seq := root.vals["seq"]; seq.kind != yamlSeq || len(seq.items) != 2 || seq.items[1].value != "y" {
+		t.Errorf("unexpected seq at the same indentation of the key: %+v", seq)
+	}
+	nested := root.vals["nested"]
+	if scalar(nested, "block") != "line 1\n\nline 2 # not a comment\n" {
+		t.Errorf("unexpected block scalar: %q", scalar(nested, "block"))
+	}
+	if scalar(nested, "folded") != "a b\nc" {
+		t.Errorf("unexpected folded scalar: %q", scalar(nested, "folded"))
+	}
+	items := nested.vals["items"]
+	if len(items.items) != 2 || scalar(items.items[0], "k2") != "v2" || items.items[1].value != "plain" {
+		t.Errorf("unexpected seq of mappings: %+v", items)
+	}
+
+	for _, bad := range []string{
+		"a: 1\na: 2",
+		"a: 1\n  b: 2",
+		"a:\n\t- x",
+		"a: [x, y",
+		"a: \"unclosed",
+		"a: *alias",
+		"- x\nb: 1",
+	} {
+		if _, err := parseYaml([]byte(bad)); err == nil {
+			t.Errorf("expect error for %q", bad)
+		}
+	}
+}
+
+func TestMetaFileYaml(t *testing.T) {
+	memFS := fs.NewMemFS()
+	content := `help: run a query
+abbrs: [q, qry]
+tags: ['@db', '@ready']
+quiet: true
+include: common.ticat
+flow: |
+  dbg.echo begin
+  : db.query
+macros:
+  twice: |
+    dbg.echo 1
+    dbg.echo 2
+args:
+  - name: host
+    abbrs: [h]
+    default: 127.0.0.1
+  - name: hosts
+    default: a,b
+    list: true
+  - name: mode
+    enum: [fast, safe]
+  - sql
+  - include: user.ticat
+env:
+  cluster|c.name|n: [read, write]
+  db.port: read
+val2env:
+  db.ready: "true"
+deps:
+  mysql: as client
+`
+	if err := memFS.WriteFile("mods/query.bash.ticat.yaml", []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := memFS.WriteFile("mods/common.ticat", []byte("trivial = 1\n[deps]\nmysql = common\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := memFS.WriteFile("mods/user.ticat", []byte("[args]\nuser|u = root\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	metas, err := NewMetaFileWithFS(memFS, "mods/query.bash.ticat.yaml")
+	if err != nil {
+		t.Fatalf("NewMetaFileWithFS failed: %v", err)
+	}
+	meta := metas[0].Meta
+	expected := map[string]string{
+		"help":      "run a query",
+		"abbrs":     "q|qry",
+		"tags":      "@db @ready",
+		"quiet":     "true",
+		"trivial":   "1",
+		"flow":      "dbg.echo begin\n: db.query",
+		"[[twice]]": "dbg.echo 1\ndbg.echo 2",
+	}
+	for key, val := range expected {
+		if meta.Get(key) != val {
+			t.Errorf("expect '%s' = %q, got %q", key, val, meta.Get(key))
+		}
+	}
+	args := meta.GetSection("args")
+	if !reflect.DeepEqual(args.Keys(), []string{"user|u", "host|h", "hosts", "mode", "sql"}) {
+		t.Errorf("unexpected args: %v", args.Keys())
+	}
+	if args.Get("hosts") != "a,b (list)" || args.Get("mode") != "(enum: fast|safe)" || args.Get("host|h") != "127.0.0.1" {
+		t.Errorf("unexpected arg values: %q %q", args.Get("hosts"), args.Get("mode"))
+	}
+	if meta.SectionGet("env", "cluster|c.name|n") != "read:write" || meta.SectionGet("val2env", "db.ready") != "true" {
+		t.Errorf("unexpected env sections")
+	}
+	if meta.SectionGet("deps", "mysql") != "as client" || meta.Origin("args", "user|u") != "mods/user.ticat" {
+		t.Errorf("the yaml file should override the included keys")
+	}
+
+	if _, err := ParseMetaFile("bad.ticat.yaml", strings.NewReader("args:\n  - abbrs: [x]\n")); err == nil {
+		t.Errorf("expect error for arg without name")
+	}
+	if _, err := ParseMetaFile("bad.ticat.yaml", strings.NewReader("- a\n- b\n")); err == nil {
+		t.Errorf("expect error for non-mapping top level")
+	}
+}
+
+func TestMetaFileEncodeYaml(t *testing.T) {
+	content := `help = "run: a query"
+abbrs = q|qry
+tags = @db @ready
+include = common.ticat,more.ticat
+unlog = true
+[[twice]] = dbg.echo 1
+[flow/]
+dbg.echo begin
+: db.query
+[/flow]
+
+[args]
+@include = user.ticat
+host|h = 127.0.0.1
+hosts = a,b (list)
+mode = fast (enum: fast|safe)
+sql = ''
+[env]
+cluster|c.name|n = read:write
+db.port = may-read
+[arg2env]
+db.host = host
+[deps]
+mysql = as client
+[custom]
+key = - dash`
+	metas, err := ParseMetaFile("query.bash.ticat", strings.NewReader(content))
+	if err == nil {
+		t.Fatalf("expect error for the missing included files")
+	}
+	metas, err = parseMetaFile(defaultFS, "query.bash.ticat", strings.NewReader(content), false)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	origin := metas[0].Meta
+	encoded := origin.EncodeYaml()
+	if !bytes.Contains(encoded, []byte("  - name: host\n    abbrs: [h]\n    default: 127.0.0.1\n")) ||
+		!bytes.Contains(encoded, []byte("tags: [\"@db\", \"@ready\"]\n")) {
+		t.Errorf("unexpected encoded yaml:\n%s", encoded)
+	}
+
+	converted, err := parseMetaFile(defaultFS, "query.bash.ticat.yaml", bytes.NewReader(encoded), false)
+	if err != nil {
+		t.Fatalf("parse the encoded yaml failed: %v\n%s", err, encoded)
+	}
+	meta := converted[0].Meta
+	for _, name := range origin.SectionNames() {
+		section := origin.GetSection(name)
+		for _, key := range section.Keys() {
+			if meta.SectionGet(name, key) != section.Get(key) {
+				t.Errorf("'[%s] %s' not the same after converting: %q vs %q",
+					name, key, meta.SectionGet(name, key), section.Get(key))
+			}
+		}
+		if !reflect.DeepEqual(meta.GetSection(name).Keys(), section.Keys()) {
+			t.Errorf("the keys of '[%s]' not the same after converting: %v vs %v",
+				name, meta.GetSection(name).Keys(), section.Keys())
+		}
+	}
+}
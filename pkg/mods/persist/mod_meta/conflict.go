@@ -0,0 +1,90 @@
+package mod_meta
+
+import (
+	"strings"
+
+	"github.com/innerr/ticat/pkg/core/model"
+)
+
+// resolveCmdConflict handles the case that the cmd path is registered by another repo/dir,
+// the winner is decided by the priorities, the loser is moved (or registered) to the shadowed path.
+// Returns the node which the cmd path should be registered under, it's the mount node if no conflicts.
+func resolveCmdConflict(
+	cc *model.Cli,
+	mount *model.CmdTree,
+	cmdPath []string,
+	source string,
+	metaPath string) (root *model.CmdTree) {
+
+	root = mount
+	if cc.CmdConflicts == nil {
+		return
+	}
+	mod := mount.GetSub(cmdPath...)
+	if mod == nil || mod.Cmd() == nil || mod.Cmd().IsTotallyEmpty() {
+		return
+	}
+	// Conflicts with builtin commands or inside the same repo/dir are not resolvable
+	oldSource := mod.Source()
+	if len(oldSource) == 0 || oldSource == source {
+		return
+	}
+	shadowed := cc.Cmds.GetSubByPath(model.ShadowedCmdsPath, false)
+	if shadowed == nil {
+		return
+	}
+
+	path := mod.DisplayPath()
+	newWins, by := cc.CmdConflicts.Priorities.NewWins(path, oldSource, source)
+	conflict := model.CmdConflict{CmdPath: path, Winner: oldSource, Loser: source, By: by}
+	if newWins {
+		conflict.Winner, conflict.Loser = source, oldSource
+	}
+
+	mountPath := mount.Path()
+	dropped := false
+	shadowBase := shadowed.GetOrAddSubEx(conflict.Loser, model.ShadowedCmdName(conflict.Loser))
+	shadowBase = shadowBase.GetOrAddSubEx(conflict.Loser, mountPath...)
+	if shadow := shadowBase.GetSub(cmdPath...); shadow != nil && shadow.Cmd() != nil {
+		// Can't shadow, let the registering report the conflict
+		if !newWins {
+			cc.CmdConflicts.Add(conflict)
+			return
+		}
+		mod.MoveCmdTo(model.NewCmdTree(mod.Strs))
+		dropped = true
+	} else {
+		if newWins {
+			shadow = shadowBase.GetOrAddSubEx(oldSource, cmdPath...)
+			mod.MoveCmdTo(shadow)
+		} else {
+			root = shadowBase
+		}
+		conflict.ShadowPath = strings.Join([]string{model.ShadowedCmdsPath, model.ShadowedCmdName(conflict.Loser),
+			strings.Join(append(append([]string{}, mountPath...), cmdPath...), cc.Cmds.Strs.PathSep)},
+			cc.Cmds.Strs.PathSep)
+	}
+	mod.SetSource(conflict.Winner)
+	cc.CmdConflicts.Add(conflict)
+
+	// The old one is dropped (no shadowed path), always warn whoever decided the winner
+	if dropped {
+		cc.TolerableErrs.OnErr(&model.CmdTreeErrExecutableConflicted{
+			Str:       "reg-cmd conflicted, the new one wins, the old one is dropped because its shadowed path is taken",
+			CmdPath:   mod.Path(),
+			OldSource: oldSource,
+		}, source, metaPath, "old cmd dropped")
+		return
+	}
+
+	// Only warn if the winner is not decided by the user
+	if by == model.CmdConflictByLoadOrder {
+		cc.TolerableErrs.OnErr(&model.CmdTreeErrExecutableConflicted{
+			Str:        "reg-cmd conflicted, the first loaded one wins",
+			CmdPath:    mod.Path(),
+			OldSource:  oldSource,
+			ShadowPath: conflict.ShadowPath,
+		}, source, metaPath, "module partly loaded")
+	}
+	return
+}
@@ -0,0 +1,125 @@
+package mod_meta
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/innerr/ticat/pkg/core/model"
+)
+
+func TestResolveCmdConflict(t *testing.T) {
+	root := t.TempDir()
+	newCli := func(priorities model.CmdPriorities) *model.Cli {
+		tree := model.NewCmdTree(model.CmdTreeStrsForTest())
+		tree.GetOrAddSub("hub").AddSub("shadowed").RegEmptyCmd("shadowed")
+		conflicts := model.NewCmdConflicts()
+		conflicts.Priorities = priorities
+		return &model.Cli{
+			Cmds:               tree,
+			EnvAbbrs:           model.NewEnvAbbrs("test"),
+			TolerableErrs:      model.NewTolerableErrs(),
+			CmdConflicts:       conflicts,
+			Arg2EnvAutoMapCmds: model.Arg2EnvAutoMapCmds{},
+		}
+	}
+	reg := func(cc *model.Cli, source string) {
+		dir := filepath.Join(root, source)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		metaPath := filepath.Join(dir, "dup.ticat")
+		if err := os.WriteFile(metaPath, []byte("help = from "+source+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "dup"), []byte("#!/bin/bash\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := RegMod(cc, metaPath, filepath.Join(dir, "dup"), false, false, []string{"dup"}, nil,
+			".tiflow", "|", ".", source, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(cc *model.Cli, winner string, loser string, by string, warned bool) {
+		if source := cc.Cmds.GetSub("dup").Source(); source != winner {
+			t.Errorf("expect winner '%s', got '%s'", winner, source)
+		}
+		shadow := cc.Cmds.GetSubByPath("hub.shadowed."+loser+".dup", false)
+		if shadow == nil || shadow.Cmd() == nil || shadow.Source() != loser {
+			t.Errorf("expect '%s' shadowed", loser)
+		}
+		if len(cc.CmdConflicts.List) != 1 || cc.CmdConflicts.List[0].By != by ||
+			cc.CmdConflicts.List[0].ShadowPath != "hub.shadowed."+loser+".dup" {
+			t.Errorf("unexpected conflicts: %+v", cc.CmdConflicts.List)
+		}
+		if (len(cc.TolerableErrs.Conflicteds) != 0) != warned {
+			t.Errorf("expect warned = %v", warned)
+		}
+	}
+
+	cc := newCli(model.NewCmdPriorities())
+	reg(cc, "a")
+	reg(cc, "b")
+	check(cc, "a", "b", model.CmdConflictByLoadOrder, true)
+
+	priorities := model.NewCmdPriorities()
+	priorities.SourceLevels["b"] = 1
+	cc = newCli(priorities)
+	reg(cc, "a")
+	reg(cc, "b")
+	check(cc, "b", "a", model.CmdConflictByRepoLevel, false)
+
+	priorities.CmdWinners["dup"] = "a"
+	cc = newCli(priorities)
+	reg(cc, "a")
+	reg(cc, "b")
+	check(cc, "a", "b", model.CmdConflictByCmdRule, false)
+}
+
+func TestResolveCmdConflictShadowTaken(t *testing.T) {
+	root := t.TempDir()
+	tree := model.NewCmdTree(model.CmdTreeStrsForTest())
+	tree.GetOrAddSub("hub").AddSub("shadowed").RegEmptyCmd("shadowed")
+	priorities := model.NewCmdPriorities()
+	priorities.SourceLevels["b"] = 1
+	conflicts := model.NewCmdConflicts()
+	conflicts.Priorities = priorities
+	cc := &model.Cli{
+		Cmds:               tree,
+		EnvAbbrs:           model.NewEnvAbbrs("test"),
+		TolerableErrs:      model.NewTolerableErrs(),
+		CmdConflicts:       conflicts,
+		Arg2EnvAutoMapCmds: model.Arg2EnvAutoMapCmds{},
+	}
+	reg := func(source string) {
+		dir := filepath.Join(root, source)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		metaPath := filepath.Join(dir, "dup.ticat")
+		if err := os.WriteFile(metaPath, []byte("help = from "+source+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "dup"), []byte("#!/bin/bash\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		err := RegMod(cc, metaPath, filepath.Join(dir, "dup"), false, false, []string{"dup"}, nil,
+			".tiflow", "|", ".", source, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reg("a")
+	// The shadowed path of 'a' is taken by a stale one
+	tree.GetSubByPath("hub.shadowed", false).GetOrAddSub(model.ShadowedCmdName("a"), "dup").RegEmptyCmd("stale")
+	reg("b")
+
+	if source := tree.GetSub("dup").Source(); source != "b" {
+		t.Errorf("expect winner 'b', got '%s'", source)
+	}
+	if len(cc.TolerableErrs.Conflicteds["a"]) == 0 {
+		t.Errorf("the dropped cmd should be reported %+v %+v", cc.TolerableErrs, cc.CmdConflicts.List)
+	}
+}
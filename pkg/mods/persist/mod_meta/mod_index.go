@@ -0,0 +1,321 @@
+package mod_meta
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/innerr/ticat/pkg/core/model"
+	"github.com/innerr/ticat/pkg/mods/persist/meta_file"
+)
+
+// Bump this when the index format or the registering logic changes, the old indexes will be rebuilt
+const ModIndexVersion = 2
+
+// ModIndex is the registering result of the mods in a dir (usually a repo),
+// the mods could be registered from it without parsing the meta files,
+// the cmds are lazy loaded (parse the meta file) when they are accessed.
+type ModIndex struct {
+	// Changes when any file in the dir changes, see 'ModsFingerprint'
+	Fingerprint string
+	HelpFiles   []string        `json:",omitempty"`
+	Mods        []ModIndexEntry `json:",omitempty"`
+	// The files included by the meta files and their stamps, they may be out of the dir
+	Includes map[string]string `json:",omitempty"`
+}
+
+type ModIndexEntry struct {
+	MetaPath       string
+	ExecutablePath string `json:",omitempty"`
+	IsDir          bool   `json:",omitempty"`
+	IsFlow         bool   `json:",omitempty"`
+	// The cmd path in the dir, the conflicts and the mount point are resolved when registering
+	CmdPath []string
+	Abbrs   string   `json:",omitempty"`
+	Trivial int      `json:",omitempty"`
+	Tags    []string `json:",omitempty"`
+	// The env keys with abbrs definitions, for registering env abbrs
+	EnvKeys []string `json:",omitempty"`
+	// Register the cmd when loading, not lazy loaded
+	Eager bool `json:",omitempty"`
+}
+
+func NewModIndex(fingerprint string) *ModIndex {
+	return &ModIndex{Fingerprint: fingerprint}
+}
+
+// AddIncludes records the stamps of the included files, see 'IncludesChanged'
+func (self *ModIndex) AddIncludes(paths []string) {
+	for _, path := range paths {
+		if self.Includes == nil {
+			self.Includes = map[string]string{}
+		}
+		self.Includes[path] = fileStamp(path)
+	}
+}
+
+// IncludesChanged checks the included files, they are not covered by the fingerprint of the dir
+func (self *ModIndex) IncludesChanged() bool {
+	for path, stamp := range self.Includes {
+		if fileStamp(path) != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+func fileStamp(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return strconv.FormatInt(info.Size(), 10) + "\t" + strconv.FormatInt(info.ModTime().UnixNano(), 10)
+}
+
+// ModIndexFileName returns the index file name of a mods dir
+func ModIndexFileName(root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return hex.EncodeToString(sum[:8]) + ".json"
+}
+
+// ModsFingerprint sums up the file tree of the dir, the hidden files and dirs are skipped the same as loading mods.
+// The sizes and mtimes are only summed for dirs and the files with 'metaExts', for the others, changing content
+// doesn't affect registering, adding or removing files are detected by the dir mtimes.
+// The salts (eg: the file exts and seps) are also summed up.
+func ModsFingerprint(root string, metaExts []string, salts ...string) (string, error) {
+	return dirFingerprint(root, metaExts, true, salts)
+}
+
+// FlowsFingerprint is the same as 'ModsFingerprint' for the flows dirs, the hidden dirs are not skipped in these dirs
+func FlowsFingerprint(root string, flowExts []string, salts ...string) (string, error) {
+	return dirFingerprint(root, flowExts, false, salts)
+}
+
+func dirFingerprint(root string, metaExts []string, skipHidden bool, salts []string) (string, error) {
+	hash := sha256.New()
+	_, _ = hash.Write([]byte(strconv.Itoa(ModIndexVersion) + "\n" + strings.Join(salts, "\n") + "\n"))
+
+	isMeta := func(name string) bool {
+		for _, ext := range metaExts {
+			if strings.HasSuffix(name, ext) {
+				return true
+			}
+		}
+		return false
+	}
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if skipHidden && entry.IsDir() && path != root {
+			name := entry.Name()
+			if len(name) > 0 && name[0] == '.' {
+				return filepath.SkipDir
+			}
+		}
+		line := path[len(root):] + "\t" + entry.Type().String()
+		if entry.IsDir() || isMeta(entry.Name()) {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			line += "\t" + strconv.FormatInt(info.Size(), 10) + "\t" + strconv.FormatInt(info.ModTime().UnixNano(), 10)
+		}
+		_, _ = hash.Write([]byte(line + "\n"))
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("[ModsFingerprint] scan dir '%s' failed: %v", root, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func ReadModIndex(path string) (*ModIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[ReadModIndex] read index file '%s' failed: %v", path, err)
+	}
+	index := &ModIndex{}
+	if err = json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("[ReadModIndex] parse index file '%s' failed: %v", path, err)
+	}
+	return index, nil
+}
+
+// WriteModIndex writes to a tmp file then renames it, so other processes never read a partial index
+func WriteModIndex(path string, index *ModIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("[WriteModIndex] encode index failed: %v", err)
+	}
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return fmt.Errorf("[WriteModIndex] create dir '%s' failed: %v", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("[WriteModIndex] create tmp file in '%s' failed: %v", dir, err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("[WriteModIndex] write index file '%s' failed: %v", path, err)
+	}
+	return nil
+}
+
+// RegModsFromIndex registers the mods recorded in the index, the meta files are not parsed
+// except the eager ones, the others are parsed when the cmds are accessed
+func RegModsFromIndex(
+	cc *model.Cli,
+	index *ModIndex,
+	// The index file, it's removed if a lazy cmd can't be loaded, so it will be rebuilt in the next run
+	indexPath string,
+	// The cmd path prefix of the dir, empty if not mounted
+	mountPath []string,
+	flowExt string,
+	abbrsSep string,
+	envPathSep string,
+	source string,
+	panicRecover bool) error {
+
+	for _, path := range index.HelpFiles {
+		_ = cc.Helps.RegHelpFile(path)
+	}
+	for _, entry := range index.Mods {
+		err := regModFromIndex(cc, entry, indexPath, mountPath, flowExt, abbrsSep, envPathSep, source, panicRecover)
+		if err != nil && !panicRecover {
+			return err
+		}
+	}
+	return nil
+}
+
+func regModFromIndex(
+	cc *model.Cli,
+	entry ModIndexEntry,
+	indexPath string,
+	mountPath []string,
+	flowExt string,
+	abbrsSep string,
+	envPathSep string,
+	source string,
+	panicRecover bool) (err error) {
+
+	defer func() {
+		if !panicRecover {
+			return
+		}
+		if panicErr := recover(); panicErr != nil {
+			cc.TolerableErrs.OnErr(panicErr, source, entry.MetaPath, "module loading failed")
+		}
+	}()
+
+	if entry.Eager {
+		var meta *meta_file.MetaFile
+		meta, err = readIndexedMeta(entry, flowExt, cc.Cmds.Strs.PathSep)
+		if err != nil {
+			return
+		}
+		return regModFile(meta, cc, entry.MetaPath, entry.ExecutablePath, entry.IsDir, entry.IsFlow,
+			entry.CmdPath, mountPath, abbrsSep, envPathSep, source, nil)
+	}
+
+	mount := cc.Cmds.GetOrAddSubEx(source, mountPath...)
+	root := resolveCmdConflict(cc, mount, entry.CmdPath, source, entry.MetaPath)
+	mod := root.GetOrAddSubEx(source, entry.CmdPath...)
+
+	// The conflict is not resolved, register it now to report the conflict as loading without index
+	if mod.Cmd() != nil {
+		var meta *meta_file.MetaFile
+		meta, err = readIndexedMeta(entry, flowExt, cc.Cmds.Strs.PathSep)
+		if err != nil {
+			return
+		}
+		_, err = regModCmd(meta, cc, cc.EnvAbbrs, mod, entry.MetaPath, entry.ExecutablePath, entry.IsDir,
+			mountPath, abbrsSep, envPathSep, source)
+		if err != nil {
+			return
+		}
+		regModTreeAttrs(root, mod, entry.IsFlow, entry.CmdPath, entry.Abbrs, entry.Trivial, entry.Tags)
+		return
+	}
+
+	mod.SetSource(source)
+	regModTreeAttrs(root, mod, entry.IsFlow, entry.CmdPath, entry.Abbrs, entry.Trivial, entry.Tags)
+	for _, key := range entry.EnvKeys {
+		regEnvKeyAbbrs(cc.EnvAbbrs, key, abbrsSep, envPathSep)
+	}
+	// The lazy loading may happen in a cloned cmd tree or in bg tasks, so 'cc' is not used in the loader,
+	// the env abbrs are registered above, and the auto-map cmds are not lazy loaded
+	mod.SetLazyCmd(func(mod *model.CmdTree) error {
+		meta, err := readIndexedMeta(entry, flowExt, mod.Strs.PathSep)
+		if err == nil {
+			_, err = regModCmd(meta, nil, nil, mod, entry.MetaPath, entry.ExecutablePath, entry.IsDir,
+				mountPath, abbrsSep, envPathSep, source)
+		}
+		if err != nil {
+			_ = os.Remove(indexPath)
+			return fmt.Errorf("%v, the mods index is outdated and will be rebuilt in the next run", err)
+		}
+		return nil
+	})
+	return nil
+}
+
+// readIndexedMeta parses the meta file of an index entry, finds the virtual one if it's a combined file
+func readIndexedMeta(entry ModIndexEntry, flowExt string, pathSep string) (*meta_file.MetaFile, error) {
+	cmdPath := strings.Join(entry.CmdPath, pathSep)
+	return readMeta(entry.MetaPath, cmdPath, flowExt, pathSep, func(path string) bool {
+		return path == cmdPath
+	})
+}
+
+// ReadCmdMeta parses the meta file of a registered cmd, finds the virtual one if it's a combined file.
+// The virtual file is matched by the tail of the cmd path, the mount path is not a part of the file name
+func ReadCmdMeta(metaPath string, cmdPath []string, flowExt string, pathSep string) (*meta_file.MetaFile, error) {
+	fullPath := strings.Join(cmdPath, pathSep)
+	return readMeta(metaPath, fullPath, flowExt, pathSep, func(path string) bool {
+		return path == fullPath || strings.HasSuffix(fullPath, pathSep+path)
+	})
+}
+
+func readMeta(
+	metaPath string,
+	cmdPath string,
+	flowExt string,
+	pathSep string,
+	match func(path string) bool) (*meta_file.MetaFile, error) {
+
+	metas, err := meta_file.NewMetaFile(metaPath)
+	if err != nil {
+		return nil, fmt.Errorf("[readMeta] parse meta file '%s' failed: %v", metaPath, err)
+	}
+	if len(metas) == 1 && metas[0].NotVirtual {
+		return metas[0].Meta, nil
+	}
+	for _, meta := range metas {
+		path, err := getVirtualFileCmdPath(meta.VirtualPath, flowExt, pathSep)
+		if err != nil {
+			return nil, err
+		}
+		if match(strings.Join(path, pathSep)) {
+			return meta.Meta, nil
+		}
+	}
+	return nil, fmt.Errorf("[readMeta] cmd '%s' not found in combined meta file '%s'",
+		cmdPath, metaPath)
+}
@@ -22,10 +22,14 @@ func RegMod(
 	isFlow bool,
 	// Cmd path defined by meta file base name
 	cmdPath []string,
+	// The cmd path prefix of the repo, empty if not mounted
+	mountPath []string,
 	flowExt string,
 	abbrsSep string,
 	envPathSep string,
 	source string,
+	// Record the registered mods to the index if it's not nil
+	index *ModIndex,
 	panicRecover bool) (err error) {
 
 	defer func() {
@@ -44,8 +48,8 @@ func RegMod(
 	}
 
 	if len(metas) == 1 && metas[0].NotVirtual {
-		err = regModFile(metas[0].Meta, cc, metaPath, executablePath, isDir, isFlow, cmdPath,
-			abbrsSep, envPathSep, source, panicRecover)
+		err = regModFile(metas[0].Meta, cc, metaPath, executablePath, isDir, isFlow, cmdPath, mountPath,
+			abbrsSep, envPathSep, source, index)
 		return
 	}
 
@@ -60,8 +64,8 @@ func RegMod(
 		if err != nil {
 			return
 		}
-		err = regModFile(meta.Meta, cc, metaPath, "", false, true, path,
-			abbrsSep, envPathSep, source, panicRecover)
+		err = regModFile(meta.Meta, cc, metaPath, "", false, true, path, mountPath,
+			abbrsSep, envPathSep, source, index)
 		if err != nil {
 			return
 		}
@@ -86,66 +90,140 @@ func regModFile(
 	isDir bool,
 	isFlow bool,
 	cmdPath []string,
+	mountPath []string,
 	abbrsSep string,
 	envPathSep string,
 	source string,
-	panicRecover bool) error {
+	index *ModIndex) error {
 
-	mod := cc.Cmds.GetOrAddSubEx(source, cmdPath...)
-	cmd, err := regMod(meta, mod, executablePath, isDir, source)
+	mount := cc.Cmds.GetOrAddSubEx(source, mountPath...)
+	root := resolveCmdConflict(cc, mount, cmdPath, source, metaPath)
+	mod := root.GetOrAddSubEx(source, cmdPath...)
+	cmd, err := regModCmd(meta, cc, cc.EnvAbbrs, mod, metaPath, executablePath, isDir, mountPath,
+		abbrsSep, envPathSep, source)
 	if err != nil {
 		return err
 	}
-	mod.SetSource(source)
-	cmd.SetMetaFile(metaPath)
+
+	abbrs := getAbbrs(meta)
+	trivial, err := getTrivial(meta)
+	if err != nil {
+		return err
+	}
+	tags := getTags(meta)
+	regModTreeAttrs(root, mod, isFlow, cmdPath, abbrs, trivial, tags)
+
+	if index != nil {
+		index.Mods = append(index.Mods, ModIndexEntry{
+			MetaPath:       metaPath,
+			ExecutablePath: executablePath,
+			IsDir:          isDir,
+			IsFlow:         isFlow,
+			CmdPath:        cmdPath,
+			Abbrs:          abbrs,
+			Trivial:        trivial,
+			Tags:           tags,
+			EnvKeys:        getEnvKeysWithAbbrs(meta),
+			// The auto-map targets are handled right after bootstrap, and the totally empty cmds could be
+			// overwritten by other repos, so they are not lazy loaded
+			Eager: cc.Arg2EnvAutoMapCmds[cmd] || cmd.IsTotallyEmpty(),
+		})
+		index.AddIncludes(meta.Includes())
+	}
+	return nil
+}
+
+// regModTreeAttrs registers the things belong to the cmd tree node
+func regModTreeAttrs(
+	root *model.CmdTree,
+	mod *model.CmdTree,
+	isFlow bool,
+	cmdPath []string,
+	abbrs string,
+	trivial int,
+	tags []string) {
 
 	// Reg by isFlow, not 'cmd.Type()'
 	if isFlow {
-		regFlowAbbrs(meta, cc.Cmds, cmdPath)
+		regFlowAbbrs(abbrs, root, cmdPath)
 	} else {
-		regModAbbrs(meta, mod)
+		regModAbbrs(abbrs, mod)
 	}
+	if trivial != 0 {
+		mod.SetTrivial(trivial)
+	}
+	mod.AddTags(tags...)
+}
 
-	regMacro(meta, cmd)
-	if err := regTrivial(meta, mod); err != nil {
-		return err
+// regModCmd registers the cmd and everything belongs to it, the things belong to the cmd tree node
+// (abbrs, tags, trivial) are not included. The env abbrs are not registered if 'envAbbrs' is nil,
+// 'cc' is nil when lazy loading, the arg2env auto-map is not allowed then
+func regModCmd(
+	meta *meta_file.MetaFile,
+	cc *model.Cli,
+	envAbbrs *model.EnvAbbrs,
+	mod *model.CmdTree,
+	metaPath string,
+	executablePath string,
+	isDir bool,
+	mountPath []string,
+	abbrsSep string,
+	envPathSep string,
+	source string) (*model.Cmd, error) {
+
+	cmd, err := regMod(meta, mod, executablePath, isDir, source)
+	if err != nil {
+		return nil, err
 	}
+	mod.SetSource(source)
+	cmd.SetMetaFile(metaPath)
+	if len(mountPath) != 0 {
+		cmd.SetMountPath(mountPath)
+	}
+
+	regMacro(meta, cmd)
 	if err := regUnLog(meta, cmd); err != nil {
-		return err
+		return nil, err
 	}
 	if err := regQuietError(meta, cmd); err != nil {
-		return err
+		return nil, err
 	}
 	if err := regNoSession(meta, cmd); err != nil {
-		return err
+		return nil, err
 	}
 	if err := regQuietCmd(meta, cmd); err != nil {
-		return err
+		return nil, err
 	}
 	if err := regHideInSessionsLast(meta, cmd); err != nil {
-		return err
+		return nil, err
 	}
 	if err := regQuietSubFlow(meta, cmd); err != nil {
-		return err
+		return nil, err
 	}
 	if err := regUnbreakFileNFlow(meta, cmd); err != nil {
-		return err
+		return nil, err
+	}
+	if err := regListArgsMode(meta, cmd); err != nil {
+		return nil, err
 	}
 
 	regAutoTimer(meta, cmd)
-	regTags(meta, mod)
 
 	// AutoMap must after regular args are registered
 	regArgs(meta, cmd, abbrsSep)
-	regArg2EnvAutoMap(cc, meta, cmd)
+	if cc != nil {
+		regArg2EnvAutoMap(cc, meta, cmd)
+	} else if len(getArg2EnvAutoMapNames(meta)) != 0 {
+		return nil, fmt.Errorf("[regModCmd] the arg2env auto-map of '%s' is added after indexing", metaPath)
+	}
 
 	regDeps(meta, cmd)
-	if err := regEnvOps(cc.EnvAbbrs, meta, cmd, abbrsSep, envPathSep); err != nil {
-		return err
+	if err := regEnvOps(envAbbrs, meta, cmd, abbrsSep, envPathSep); err != nil {
+		return nil, err
 	}
-	regVal2Env(cc.EnvAbbrs, meta, cmd, abbrsSep, envPathSep)
-	regArg2Env(cc.EnvAbbrs, meta, cmd, abbrsSep, envPathSep)
-	return nil
+	regVal2Env(envAbbrs, meta, cmd, abbrsSep, envPathSep)
+	regArg2Env(envAbbrs, meta, cmd, abbrsSep, envPathSep)
+	return cmd, nil
 }
 
 func regAutoTimer(meta *meta_file.MetaFile, cmd *model.Cmd) {
@@ -207,17 +285,16 @@ func regMacro(meta *meta_file.MetaFile, cmd *model.Cmd) {
 	}
 }
 
-func regTrivial(meta *meta_file.MetaFile, mod *model.CmdTree) error {
+func getTrivial(meta *meta_file.MetaFile) (int, error) {
 	val := meta.Get("trivial")
 	if len(val) == 0 {
-		return nil
+		return 0, nil
 	}
 	trivial, err := strconv.Atoi(val)
 	if err != nil {
-		return fmt.Errorf("[regTrivial] trivial string '%s' is not int: '%v'", val, err)
+		return 0, fmt.Errorf("[getTrivial] trivial string '%s' is not int: '%v'", val, err)
 	}
-	mod.SetTrivial(trivial)
-	return nil
+	return trivial, nil
 }
 
 func regUnLog(meta *meta_file.MetaFile, cmd *model.Cmd) error {
@@ -346,9 +423,38 @@ func regUnbreakFileNFlow(meta *meta_file.MetaFile, cmd *model.Cmd) error {
 	return nil
 }
 
+func regListArgsMode(meta *meta_file.MetaFile, cmd *model.Cmd) error {
+	for _, key := range []string{"list-args", "list-arg"} {
+		val := meta.Get(key)
+		if len(val) == 0 {
+			continue
+		}
+		switch val {
+		case "repeated", "repeat":
+			cmd.SetListArgsRepeated()
+		case "joined", "join":
+		default:
+			return fmt.Errorf("[regListArgsMode] list-args value '%s' should be 'joined' or 'repeated'", val)
+		}
+		return nil
+	}
+	return nil
+}
+
 func regArg2EnvAutoMap(cc *model.Cli, meta *meta_file.MetaFile, cmd *model.Cmd) {
+	names := getArg2EnvAutoMapNames(meta)
+	if len(names) != 0 {
+		_, err := cmd.SetArg2EnvAutoMap(names)
+		if err != nil {
+			cc.TolerableErrs.OnErr(err, cmd.Owner().Source(), meta.Path(), "arg2env auto map definition error")
+		} else {
+			cc.Arg2EnvAutoMapCmds.AddAutoMapTarget(cmd)
+		}
+	}
+}
+
+func getArg2EnvAutoMapNames(meta *meta_file.MetaFile) (names []string) {
 	globalSection := meta.GetGlobalSection()
-	var names []string
 	for _, key := range []string{"args.auto", "arg.auto", "arg2env.auto-map", "arg2env.auto", "arg2env.map"} {
 		lines := globalSection.GetMultiLineVal(key, false)
 		if len(lines) == 0 {
@@ -365,25 +471,15 @@ func regArg2EnvAutoMap(cc *model.Cli, meta *meta_file.MetaFile, cmd *model.Cmd)
 		}
 		break
 	}
-	if len(names) != 0 {
-		_, err := cmd.SetArg2EnvAutoMap(names)
-		if err != nil {
-			cc.TolerableErrs.OnErr(err, cmd.Owner().Source(), meta.Path(), "arg2env auto map definition error")
-		} else {
-			cc.Arg2EnvAutoMapCmds.AddAutoMapTarget(cmd)
-		}
-	}
+	return
 }
 
-func regTags(meta *meta_file.MetaFile, mod *model.CmdTree) {
+func getTags(meta *meta_file.MetaFile) []string {
 	tags := meta.Get("tags")
 	if len(tags) == 0 {
 		tags = meta.Get("tag")
 	}
-	if len(tags) == 0 {
-		return
-	}
-	mod.AddTags(strings.Fields(tags)...)
+	return strings.Fields(tags)
 }
 
 func regMod(
@@ -456,11 +552,15 @@ func regMod(
 	}
 }
 
-func regModAbbrs(meta *meta_file.MetaFile, mod *model.CmdTree) {
+func getAbbrs(meta *meta_file.MetaFile) string {
 	abbrs := meta.Get("abbrs")
 	if len(abbrs) == 0 {
 		abbrs = meta.Get("abbr")
 	}
+	return abbrs
+}
+
+func regModAbbrs(abbrs string, mod *model.CmdTree) {
 	if len(abbrs) == 0 {
 		return
 	}
@@ -468,11 +568,7 @@ func regModAbbrs(meta *meta_file.MetaFile, mod *model.CmdTree) {
 	mod.AddAbbrs(strings.Split(abbrs, abbrsSep)...)
 }
 
-func regFlowAbbrs(meta *meta_file.MetaFile, cmds *model.CmdTree, cmdPath []string) {
-	abbrsStr := meta.Get("abbrs")
-	if len(abbrsStr) == 0 {
-		abbrsStr = meta.Get("abbr")
-	}
+func regFlowAbbrs(abbrsStr string, cmds *model.CmdTree, cmdPath []string) {
 	if len(abbrsStr) == 0 {
 		return
 	}
@@ -513,21 +609,31 @@ func regArgs(meta *meta_file.MetaFile, cmd *model.Cmd, abbrsSep string) {
 		}
 		defVal := args.Get(names)
 		var enums []string
-		if len(defVal) > 0 && defVal[len(defVal)-1] == ')' {
+		isList := false
+		// Annotations: 'default-value (list)', 'default-value (enum: a|b)', could be both
+		for len(defVal) > 0 && defVal[len(defVal)-1] == ')' {
 			i := strings.LastIndex(defVal, "(")
-			if i >= 0 {
-				enumsStr := strings.TrimSpace(defVal[i+1 : len(defVal)-1])
-				if strings.HasPrefix(enumsStr, "enum:") {
-					enumsStr = strings.TrimSpace(enumsStr[5:])
-				}
-				enums = strings.Split(enumsStr, enumSep)
-				defVal = strings.TrimSpace(defVal[:i])
+			if i < 0 {
+				break
 			}
+			annotation := strings.TrimSpace(defVal[i+1 : len(defVal)-1])
+			defVal = strings.TrimSpace(defVal[:i])
+			if annotation == "list" {
+				isList = true
+				continue
+			}
+			if strings.HasPrefix(annotation, "enum:") {
+				annotation = strings.TrimSpace(annotation[5:])
+			}
+			enums = strings.Split(annotation, enumSep)
 		}
 		cmd.AddArg(name, defVal, argAbbrs...)
 		if len(enums) != 0 {
 			cmd.SetArgEnums(name, enums...)
 		}
+		if isList {
+			cmd.SetArgIsList(name)
+		}
 	}
 }
 
@@ -579,10 +685,7 @@ func regVal2Env(
 	abbrsSep string,
 	envPathSep string) {
 
-	writes := meta.GetSection("env.write")
-	if writes == nil {
-		writes = meta.GetSection("val2env")
-	}
+	writes := getVal2EnvSection(meta)
 	if writes == nil {
 		return
 	}
@@ -601,13 +704,7 @@ func regArg2Env(
 	abbrsSep string,
 	envPathSep string) {
 
-	writes := meta.GetSection("env.from-arg")
-	if writes == nil {
-		writes = meta.GetSection("env.arg")
-	}
-	if writes == nil {
-		writes = meta.GetSection("arg2env")
-	}
+	writes := getArg2EnvSection(meta)
 	if writes == nil {
 		return
 	}
@@ -619,6 +716,36 @@ func regArg2Env(
 	}
 }
 
+func getVal2EnvSection(meta *meta_file.MetaFile) *meta_file.Section {
+	writes := meta.GetSection("env.write")
+	if writes == nil {
+		writes = meta.GetSection("val2env")
+	}
+	return writes
+}
+
+func getArg2EnvSection(meta *meta_file.MetaFile) *meta_file.Section {
+	writes := meta.GetSection("env.from-arg")
+	if writes == nil {
+		writes = meta.GetSection("env.arg")
+	}
+	if writes == nil {
+		writes = meta.GetSection("arg2env")
+	}
+	return writes
+}
+
+// getEnvKeysWithAbbrs returns the env keys (with abbrs definition) used by 'regEnvKeyAbbrs'
+func getEnvKeysWithAbbrs(meta *meta_file.MetaFile) (keys []string) {
+	for _, section := range []*meta_file.Section{
+		meta.GetSection("env"), getVal2EnvSection(meta), getArg2EnvSection(meta)} {
+		if section != nil {
+			keys = append(keys, section.Keys()...)
+		}
+	}
+	return
+}
+
 func regEnvKeyAbbrs(
 	envAbbrs *model.EnvAbbrs,
 	envKeyWithAbbrs string,
@@ -638,12 +765,16 @@ func regEnvKeyAbbrs(
 		}
 		name := abbrs[0]
 		abbrs = abbrs[1:]
+		path = append(path, name)
+		// Only get the key without registering
+		if envAbbrs == nil {
+			continue
+		}
 		subEnvAbbrs := envAbbrs.GetOrAddSub(name)
 		if len(abbrs) > 0 {
 			envAbbrs.AddSubAbbrs(name, abbrs...)
 		}
 		envAbbrs = subEnvAbbrs
-		path = append(path, name)
 	}
 
 	return strings.Join(path, envPathSep)
@@ -44,9 +44,15 @@ const (
 	FlowExt                  string = ".tiflow"
 	HelpExt                  string = ".tihelp"
 	HubFileName              string = "repos.hub"
+	HubLockFileName          string = "hub.lock"
+	HubPriorityFileName      string = "priority.hub"
+	HubTrustFileName         string = "trust.hub"
+	HubSumFileName           string = "hub.sum"
+	HubSumSigFileName        string = "hub.sum.sig"
 	ReposFileName            string = "hub.ticat"
 	SessionEnvFileName       string = "env"
 	SessionStatusFileName    string = "status"
+	SessionMetaFileName      string = "meta"
 	FlowTemplateBracketLeft  string = "[["
 	FlowTemplateBracketRight string = "]]"
 	FlowTemplateMultiplyMark string = "*"
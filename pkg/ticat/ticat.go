@@ -51,7 +51,13 @@ func NewTiCat() *TiCat {
 	defEnv.Set("strs.env-file-name", EnvFileName)
 	defEnv.Set("strs.session-env-file", SessionEnvFileName)
 	defEnv.Set("strs.session-status-file", SessionStatusFileName)
+	defEnv.Set("strs.session-meta-file", SessionMetaFileName)
 	defEnv.Set("strs.hub-file-name", HubFileName)
+	defEnv.Set("strs.hub-lock-file-name", HubLockFileName)
+	defEnv.Set("strs.hub-priority-file-name", HubPriorityFileName)
+	defEnv.Set("strs.hub-trust-file-name", HubTrustFileName)
+	defEnv.Set("strs.hub-sum-file-name", HubSumFileName)
+	defEnv.Set("strs.hub-sum-sig-file-name", HubSumSigFileName)
 	defEnv.Set("strs.repos-file-name", ReposFileName)
 	defEnv.Set("strs.mods-repo-ext", ModsRepoExt)
 	defEnv.Set("strs.proto-sep", ProtoSep)
@@ -98,10 +104,11 @@ func NewTiCat() *TiCat {
 	abbrs := model.NewEnvAbbrs(CmdRootDisplayName)
 	builtin.LoadEnvAbbrs(abbrs)
 
-	// A simple parser, should be insteaded in the future
+	// The 'http' and 'file' prefixes keep unquoted URLs unbroken by the sequence sep,
+	// quoting and escaping (see 'parser/lexer.go') are the general way
 	seqParser := parser.NewSequenceParser(
 		SequenceSep,
-		[]string{"http", "HTTP", "https", "HTTPS"},
+		[]string{"http", "HTTP", "https", "HTTPS", "file", "FILE"},
 		nil,
 	)
 	envParser := parser.NewEnvParser(